@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The escaping GitHub Actions workflow commands need: for the
+// message, and for the properties (file=..., line=...).
+var (
+	annotationEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	annotationPropEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// annotationsOn reports whether failures and warnings should also
+// be printed as GitHub Actions annotations: if -annotations is
+// github, or if it isn't set and we're running in GitHub Actions.
+func annotationsOn() bool {
+	switch *annotationsFlag {
+	case "github":
+		return true
+	case "none":
+		return false
+	}
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// annotate prints a GitHub Actions workflow command to Stdout
+// that annotates the document name with msg, at level "error" or
+// "warning", so it shows up inline on the file in a pull request.
+// It does nothing if annotations aren't on.
+func annotate(level, name string, msg string, line, col int) {
+	if !annotationsOn() {
+		return
+	}
+	props := "file=" + annotationPropEscaper.Replace(name)
+	if line > 0 {
+		props += ",line=" + strconv.Itoa(line)
+	}
+	if col > 0 {
+		props += ",col=" + strconv.Itoa(col)
+	}
+	fmt.Printf("::%s %s::%s\n", level, props, annotationEscaper.Replace(msg))
+}
+
+// fileWarnf is warnf for a warning about the document name,
+// which is also annotated, and which a -log-format=json event
+// names.
+func fileWarnf(name, format string, args ...any) {
+	logEventf("warning", name, format, args...)
+	annotate("warning", name, fmt.Sprintf(format, args...), 0, 0)
+}
+
+// annotateErr is annotate for an error, at the error's line and
+// column if it says where it is.
+func annotateErr(name string, err error) {
+	line, col := errorPosition(err)
+	annotate("error", name, err.Error(), line, col)
+}
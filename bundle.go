@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// errNoMermaidJS is the error for a nombed build that wasn't given
+// a MermaidJS bundle to load.
+var errNoMermaidJS = errors.New("this mermaid-cli was built without MermaidJS (-tags nombed); give it a bundle with -mermaid-js=FILE, MERMAID_JS_PATH=FILE, or -mermaid-cdn=URL")
+
+// mermaidCDNTimeout bounds downloading the -mermaid-cdn bundle.
+const mermaidCDNTimeout = 30 * time.Second
+
+// mermaidJSPath returns the name of the MermaidJS bundle to load
+// instead of the embedded one: -mermaid-js, or else the
+// MERMAID_JS_PATH environment variable, or "" for the embedded
+// one.
+func mermaidJSPath() string {
+	if *mermaidJSFlag != "" {
+		return *mermaidJSFlag
+	}
+	return os.Getenv("MERMAID_JS_PATH")
+}
+
+// mermaidJSOrigin returns where the MermaidJS bundle comes from,
+// for messages: the -mermaid-cdn URL, or mermaidJSPath's file, or
+// "" for the embedded one.
+func mermaidJSOrigin() string {
+	if *mermaidCDNFlag != "" {
+		return *mermaidCDNFlag
+	}
+	return mermaidJSPath()
+}
+
+// bundleName returns where the MermaidJS bundle comes from, for
+// messages: mermaidJSOrigin's URL or file, or "embedded" for the
+// one built in.
+func bundleName() string {
+	if origin := mermaidJSOrigin(); origin != "" {
+		return origin
+	}
+	return "embedded"
+}
+
+// readMermaidJS returns the bundle at the -mermaid-cdn URL, or the
+// one mermaidJSPath names, or else the embedded one.  A nombed
+// build has no embedded one, so it's an error for it not to name
+// one.
+func readMermaidJS() ([]byte, error) {
+	if *mermaidCDNFlag != "" {
+		return downloadMermaidJS(*mermaidCDNFlag)
+	}
+	name := mermaidJSPath()
+	if name == "" {
+		if !mermaidJSEmbedded {
+			return nil, errNoMermaidJS
+		}
+		return []byte(mermaidJSSource), nil
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read MermaidJS bundle: %w", err)
+	}
+	return b, nil
+}
+
+// downloadedMermaidJS caches the -mermaid-cdn bundle, so the
+// renderer, the hash of the outputs' inputs, and a restarted
+// renderer all get the same bundle from one download.
+var downloadedMermaidJS struct {
+	sync.Mutex
+	url string
+	src []byte
+}
+
+// downloadMermaidJS returns the bundle at url, downloading it the
+// first time it's asked for.  The cli downloads it, rather than
+// the page, so it's hashed like a file and the browser needs no
+// network.
+func downloadMermaidJS(url string) ([]byte, error) {
+	downloadedMermaidJS.Lock()
+	defer downloadedMermaidJS.Unlock()
+	if downloadedMermaidJS.url == url {
+		return downloadedMermaidJS.src, nil
+	}
+
+	ctx, cancel := context.WithTimeout(runCtx, mermaidCDNTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't download MermaidJS bundle: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't download MermaidJS bundle: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couldn't download MermaidJS bundle: %s: %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't download MermaidJS bundle: %w", err)
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("couldn't download MermaidJS bundle: %s is empty", url)
+	}
+	log.Printf("downloaded MermaidJS bundle from %s (%d bytes)", url, len(b))
+	downloadedMermaidJS.url, downloadedMermaidJS.src = url, b
+	return b, nil
+}
@@ -0,0 +1,19 @@
+//go:build !nombed
+
+package main
+
+import _ "embed"
+
+// mermaidJSEmbedded is whether the binary has MermaidJS embedded.
+// Build with -tags nombed to leave it out, for a smaller binary
+// that loads a bundle at runtime.
+const mermaidJSEmbedded = true
+
+// mermaidJSSource is the source for MermaidJS that will be
+// registered with the headles Chrome browser.
+//
+// Use the minified version (see download.sh) for a smaller
+// binary.
+//
+//go:embed mermaid.min.js
+var mermaidJSSource string
@@ -0,0 +1,10 @@
+//go:build nombed
+
+package main
+
+// mermaidJSEmbedded is whether the binary has MermaidJS embedded.
+const mermaidJSEmbedded = false
+
+// mermaidJSSource is empty: a nombed build loads MermaidJS from
+// the bundle given with -mermaid-js or MERMAID_JS_PATH.
+var mermaidJSSource string
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReadMermaidJS(t *testing.T) {
+	t.Setenv("MERMAID_JS_PATH", "")
+	b, err := readMermaidJS()
+	switch {
+	case mermaidJSEmbedded && (err != nil || string(b) != mermaidJSSource):
+		t.Errorf("readMermaidJS = %d bytes, %v; want the embedded bundle", len(b), err)
+	case !mermaidJSEmbedded && !errors.Is(err, errNoMermaidJS):
+		t.Errorf("readMermaidJS in a nombed build = %v, want errNoMermaidJS", err)
+	}
+
+	name := filepath.Join(t.TempDir(), "mermaid.js")
+	writeTestFile(t, name, "var mermaid = {};")
+	t.Setenv("MERMAID_JS_PATH", name)
+	if b, err := readMermaidJS(); err != nil || string(b) != "var mermaid = {};" {
+		t.Errorf("readMermaidJS with MERMAID_JS_PATH = %q, %v; want its file", b, err)
+	}
+}
+
+// TestBuildVariants builds the cli with and without -tags nombed,
+// and checks a nombed build without a bundle fails saying how to
+// give it one, while the embedded one doesn't need one.
+func TestBuildVariants(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping builds in short mode")
+	}
+	goTool := filepath.Join(runtime.GOROOT(), "bin", "go")
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "flow.mmd"), "flowchart LR\n    A --> B\n")
+
+	for _, tags := range []string{"", "nombed"} {
+		exe := filepath.Join(dir, "mermaid-cli-"+tags)
+		if runtime.GOOS == "windows" {
+			exe += ".exe"
+		}
+		build := exec.Command(goTool, "build", "-tags", tags, "-o", exe, ".")
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Fatalf("go build -tags %q: %v\n%s", tags, err, out)
+		}
+
+		cmd := exec.Command(exe, "-version")
+		cmd.Env = append(os.Environ(), "MERMAID_JS_PATH=")
+		out, _ := cmd.CombinedOutput()
+		if !strings.HasPrefix(string(out), "mermaid-cli ") {
+			t.Errorf("-tags %q: -version printed %q", tags, out)
+		}
+		if got := strings.Contains(string(out), errNoMermaidJS.Error()); got != (tags == "nombed") {
+			t.Errorf("-tags %q: -version says built without MermaidJS = %t\n%s", tags, got, out)
+		}
+
+		if tags != "nombed" {
+			continue
+		}
+		cmd = exec.Command(exe, "flow.mmd")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "MERMAID_JS_PATH=")
+		out, err := cmd.CombinedOutput()
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			t.Errorf("nombed build without a bundle: %v, want exit status 1", err)
+		}
+		if !strings.Contains(string(out), errNoMermaidJS.Error()) {
+			t.Errorf("nombed build without a bundle printed %q, want %q", out, errNoMermaidJS)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "flow.svg")); err == nil {
+			t.Error("nombed build without a bundle wrote flow.svg")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// checkAll checks the syntax of pairs' documents with MermaidJS's
+// parser, for -check, instead of rendering them.  It writes
+// nothing, and prints each failure as a failed render's is
+// printed, then a summary.  Documents go through renderAll's
+// pipeline (see renderAllWith), so they're read ahead, and with
+// WithConcurrency (-j) over 1 they're checked in the tabs of a
+// renderer.Pool.  It returns how many documents failed.
+func checkAll(pairs []renderPair) int {
+	files, badFiles := make(map[string]bool), make(map[string]bool)
+	failed := renderAllWith(pairs, (*renderDoc).check, func(d *renderDoc) error {
+		files[d.pair.mmdName] = true
+		err := finishCheck(d)
+		if err != nil {
+			badFiles[d.pair.mmdName] = true
+		}
+		return err
+	})
+	fmt.Fprintf(os.Stderr, "checked %d files, %d with errors\n", len(files), len(badFiles))
+	return failed
+}
+
+// check parses d's document with r, leaving any error in d.err.
+func (d *renderDoc) check(r *renderer.Renderer) {
+	if d.readErr != nil {
+		return
+	}
+	err := r.ParseCheck(runCtx, string(d.src))
+	var parseErr *renderer.ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.File = d.pair.mmdName
+		if parseErr.Line > 0 {
+			parseErr.Line += d.lineOffset
+		}
+	}
+	d.err = err
+}
+
+// finishCheck prints and records the outcome of checking d.
+func finishCheck(d *renderDoc) error {
+	pair := d.pair
+	fail := func(err error, format string, args ...any) error {
+		recordRender(pair, d.start, renderer.RenderResult{}, err)
+		fileErrorf(pair.mmdName, err, format, args...)
+		return err
+	}
+	if d.readErr != nil {
+		return fail(d.readErr, "couldn't read MMD: %v", d.readErr)
+	}
+	if err := d.err; err != nil {
+		if hint := separatorHint(pair, d.src); hint != "" {
+			return fail(err, "%s", hint)
+		}
+		var parseErr *renderer.ParseError
+		if errors.As(err, &parseErr) {
+			return fail(err, "%s", parseErrorReport(parseErr, string(d.src), d.lineOffset))
+		}
+		fail(err, "couldn't check %s: %v", pair.docName(), err)
+		if deadlineExceeded() {
+			abortRun()
+		}
+		return err
+	}
+	recordRender(pair, d.start, renderer.RenderResult{}, nil)
+	log.Println("parsed", pair.docName())
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// cliStampRE matches the comments mermaid-cli stamps SVGs with:
+// the versions (see stampVersion) and the inputs (see stampInputs).
+var cliStampRE = regexp.MustCompile(`<!-- mermaid-cli [^>]*? -->`)
+
+// staleError is the error of a document whose output on disk
+// doesn't match what it renders now, for -check-output.
+type staleError struct {
+	svgName string
+	missing bool
+}
+
+func (e *staleError) Error() string {
+	if e.missing {
+		return e.svgName + " doesn't exist"
+	}
+	return e.svgName + " is stale"
+}
+
+// checkOutputs renders pairs' documents in memory, as renderAll
+// does, for -check-output, and compares each against its SVG on
+// disk, reporting the ones whose SVG is missing or stale.  It
+// writes nothing.  It returns how many documents failed to render
+// or are stale.
+func checkOutputs(pairs []renderPair) int {
+	n := renderAllWith(pairs, (*renderDoc).render, finishOutputCheck)
+	stale := 0
+	for _, f := range failures {
+		var staleErr *staleError
+		if errors.As(f.cause, &staleErr) {
+			stale++
+		}
+	}
+	if stale > 0 {
+		errorf("%d of %d outputs are stale; render them again and commit the result", stale, len(pairs))
+	}
+	return n
+}
+
+// committedSVG returns svg, as read from disk, as it was rendered:
+// without a BOM, CRLF line endings, or mermaid-cli's stamps, which
+// don't say anything about the diagram.
+func committedSVG(svg []byte) string {
+	svg = bytes.TrimPrefix(svg, utf8BOM)
+	svg = bytes.ReplaceAll(svg, []byte("\r\n"), []byte("\n"))
+	return cliStampRE.ReplaceAllString(string(svg), "")
+}
+
+// finishOutputCheck compares d's SVG against its output on disk
+// with mermaidtest.DiffSVG, and prints and records the outcome:
+// with -diff, how they differ.
+func finishOutputCheck(d *renderDoc) error {
+	pair := d.pair
+	fail := func(err error, format string, args ...any) error {
+		recordRender(pair, d.start, renderer.RenderResult{}, err)
+		fileErrorf(pair.mmdName, err, format, args...)
+		return err
+	}
+	if d.readErr != nil {
+		return fail(d.readErr, "couldn't read MMD: %v", d.readErr)
+	}
+	if err := d.err; err != nil {
+		var parseErr *renderer.ParseError
+		switch hint := separatorHint(pair, d.src); {
+		case hint != "":
+			fail(err, "%s", hint)
+		case errors.As(err, &parseErr):
+			fail(err, "%s", parseErrorReport(parseErr, string(d.src), d.lineOffset))
+		default:
+			fail(err, "couldn't render %s: %v", pair.docName(), err)
+		}
+		if deadlineExceeded() {
+			abortRun()
+		}
+		return err
+	}
+
+	b, err := os.ReadFile(pair.svgName)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fail(&staleError{svgName: pair.svgName, missing: true}, "%s has no output %s", pair.docName(), pair.svgName)
+	case err != nil:
+		return fail(err, "couldn't read %s: %v", pair.svgName, err)
+	}
+	want := committedSVG(b)
+	diff := mermaidtest.DiffSVG(pair.svgName+" (on disk)", want, pair.svgName+" (rendered)", d.result.SVG)
+	if diff == "" {
+		recordRender(pair, d.start, d.result, nil)
+		log.Println("up to date", pair.svgName)
+		return nil
+	}
+	switch diffFlag {
+	case "":
+	case "full":
+		fmt.Print(limitLines(diff, *diffLinesFlag))
+		fallthrough
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %s\n", pair.svgName, summarizeSVGChange(want, d.result.SVG))
+	}
+	return fail(&staleError{svgName: pair.svgName}, "%s is stale: %s renders differently now", pair.svgName, pair.docName())
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// chromeWSEnv names the environment variable that, like
+// -remote-chrome, gives the DevTools websocket URL of a running
+// Chrome to connect to.
+const chromeWSEnv = "MERMAID_CLI_CHROME_WS"
+
+// remoteChromeURL returns the DevTools websocket URL of the Chrome
+// to connect to: -remote-chrome's, or else MERMAID_CLI_CHROME_WS's,
+// or "" to launch one.
+func remoteChromeURL() string {
+	if *remoteChromeFlag != "" {
+		return *remoteChromeFlag
+	}
+	return os.Getenv(chromeWSEnv)
+}
+
+// chromeFlagList is the value of -chrome-flag, which can be
+// repeated: command line flags for the Chrome the cli launches,
+// e.g., --no-sandbox or --proxy-server=host:3128, in the order
+// they're given.
+type chromeFlagList []string
+
+func (l *chromeFlagList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, " ")
+}
+
+func (l *chromeFlagList) Set(s string) error {
+	name, _, _ := strings.Cut(strings.TrimLeft(s, "-"), "=")
+	if name == "" {
+		return fmt.Errorf("got %q; expected a Chrome flag, e.g., --no-sandbox", s)
+	}
+	*l = append(*l, s)
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+const compareUsage = "usage: mermaid-cli compare [-log] [-mermaid-js-a=old.js] [-mermaid-js-b=new.js] [-out=DIR] [-fail-on-diff] file.mmd [file2.mmd ...]"
+
+// compareResult is how one document rendered with the a and b
+// bundles.
+type compareResult struct {
+	Name       string
+	A, B       string // the normalized SVGs, or "" for a failure
+	ErrA, ErrB error
+	Differs    bool
+}
+
+// compareOptions are the compare subcommand's flags.
+type compareOptions struct {
+	log, failOnDiff bool
+	jsA, jsB, out   string
+}
+
+// compareFlagSet returns the compare subcommand's flags, which set
+// o, for compareCmd, and for the completion scripts.
+func compareFlagSet(o *compareOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, compareUsage)
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	fs.BoolVar(&o.log, "log", false, "log events to stderr")
+	fs.StringVar(&o.jsA, "mermaid-js-a", "", "render the A side with the MermaidJS bundle in `file` instead of the embedded one")
+	fs.StringVar(&o.jsB, "mermaid-js-b", "", "render the B side with the MermaidJS bundle in `file` instead of the embedded one")
+	fs.StringVar(&o.out, "out", "", "write both sides' SVGs and an HTML report to `dir`")
+	fs.BoolVar(&o.failOnDiff, "fail-on-diff", false, "exit with status 1 if any document differs")
+	return fs
+}
+
+// compareCmd renders each document named in args with two
+// MermaidJS bundles, A and B, and prints whether their
+// normalized SVGs differ.  Either bundle defaults to the one in
+// MERMAID_JS_PATH, or else the embedded one.
+//
+// With -out it also writes each pair of SVGs to DIR/a and DIR/b,
+// and an HTML report showing them side by side to
+// DIR/index.html.  With -fail-on-diff it exits with status 1 if
+// any document differs.
+//
+// usage: mermaid-cli compare [-log] [-mermaid-js-a=old.js] [-mermaid-js-b=new.js] [-out=DIR] [-fail-on-diff] file.mmd [file2.mmd ...]
+func compareCmd(args []string) {
+	var o compareOptions
+	fs := compareFlagSet(&o)
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+	}
+	if o.log {
+		enableLogging()
+	}
+
+	// Read everything first, so a bad name doesn't leave a
+	// browser running.
+	var (
+		bundles [2][]byte
+		sources = make([]string, fs.NArg())
+	)
+	for i, name := range []string{o.jsA, o.jsB} {
+		if name == "" {
+			name = os.Getenv("MERMAID_JS_PATH")
+		}
+		if name == "" {
+			continue
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			fatalf("couldn't read MermaidJS bundle: %v", err)
+		}
+		bundles[i] = b
+	}
+	for i, name := range fs.Args() {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			fileFatalf(name, err, "couldn't read MMD: %v", err)
+		}
+		sources[i] = string(b)
+	}
+
+	mainRenderer = newRenderer(renderer.WithMermaidJS(bundles[0]))
+	rendererB := newRenderer(renderer.WithMermaidJS(bundles[1]))
+	log.Printf("comparing MermaidJS %s (a) with %s (b)", mainRenderer.Version(), rendererB.Version())
+
+	var results []compareResult
+	differs := false
+	for i, name := range fs.Args() {
+		res := compareResult{Name: name}
+		res.A, res.ErrA = renderNormalized(mainRenderer, sources[i])
+		res.B, res.ErrB = renderNormalized(rendererB, sources[i])
+
+		switch {
+		case res.ErrA != nil || res.ErrB != nil:
+			res.Differs = (res.ErrA == nil) != (res.ErrB == nil) ||
+				res.ErrA.Error() != res.ErrB.Error()
+			fmt.Printf("%s: %s\n", name, compareErrStatus(res))
+		case res.A != res.B:
+			res.Differs = true
+			fmt.Printf("%s: differs\n", name)
+			log.Print(mermaidtest.FirstDiff(name+" (a)", mermaidtest.Lines(res.A), name+" (b)", mermaidtest.Lines(res.B)))
+		default:
+			fmt.Printf("%s: same\n", name)
+		}
+		differs = differs || res.Differs
+		results = append(results, res)
+	}
+	stopRenderer(rendererB)
+
+	if o.out != "" {
+		if err := writeCompareReport(o.out, results, mainRenderer.Version(), rendererB.Version()); err != nil {
+			fatalf("couldn't write comparison: %v", err)
+		}
+		log.Println("wrote", filepath.Join(o.out, "index.html"))
+	}
+
+	stopRenderer(mainRenderer)
+	if differs && o.failOnDiff {
+		os.Exit(1)
+	}
+}
+
+// renderNormalized renders src with r and normalizes the result
+// with mermaidtest.NormalizeSVG.
+func renderNormalized(r *renderer.Renderer, src string) (string, error) {
+	svgResult, err := r.Render(runCtx, src)
+	if err != nil {
+		return "", err
+	}
+	return mermaidtest.NormalizeSVG(svgResult), nil
+}
+
+// compareErrStatus describes a result where at least one side
+// failed to render.
+func compareErrStatus(res compareResult) string {
+	switch {
+	case res.ErrB == nil:
+		return "fails with a: " + oneLineMessage(res.ErrA)
+	case res.ErrA == nil:
+		return "fails with b: " + oneLineMessage(res.ErrB)
+	case res.Differs:
+		return "fails differently with a and b: " + oneLineMessage(res.ErrA) + "; " + oneLineMessage(res.ErrB)
+	default:
+		return "fails the same with a and b: " + oneLineMessage(res.ErrA)
+	}
+}
+
+// compareSVGName is where a document's SVG for side ("a" or "b")
+// goes in the -out directory, relative to it.
+func compareSVGName(side, mmdName string) string {
+	return path.Join(side, strings.TrimSuffix(filepath.Base(mmdName), mmd)+svg)
+}
+
+var compareReportTmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"svgName": compareSVGName,
+	"status":  compareErrStatus,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mermaid-cli compare</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 8px; vertical-align: top; }
+tr.differs th { background: #fee; }
+img { max-width: 600px; }
+</style>
+</head>
+<body>
+<h1>MermaidJS {{.VersionA}} (a) vs. {{.VersionB}} (b)</h1>
+<table>
+<tr><th></th><th>a</th><th>b</th></tr>
+{{range .Results}}<tr{{if .Differs}} class="differs"{{end}}>
+<th>{{.Name}}<br>{{if or .ErrA .ErrB}}{{status .}}{{else if .Differs}}differs{{else}}same{{end}}</th>
+<td>{{if .ErrA}}<pre>{{.ErrA}}</pre>{{else}}<img src="{{svgName "a" .Name}}">{{end}}</td>
+<td>{{if .ErrB}}<pre>{{.ErrB}}</pre>{{else}}<img src="{{svgName "b" .Name}}">{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// writeCompareReport writes the SVGs of results to dir/a and
+// dir/b, and the HTML report to dir/index.html.
+func writeCompareReport(dir string, results []compareResult, versionA, versionB string) error {
+	for _, side := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(dir, side), 0755); err != nil {
+			return err
+		}
+	}
+	for _, res := range results {
+		for side, svgResult := range map[string]string{"a": res.A, "b": res.B} {
+			if svgResult == "" {
+				continue
+			}
+			name := filepath.Join(dir, filepath.FromSlash(compareSVGName(side, res.Name)))
+			if err := writeFileAtomic(name, []byte(svgResult), 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	var b strings.Builder
+	err := compareReportTmpl.Execute(&b, struct {
+		VersionA, VersionB string
+		Results            []compareResult
+	}{versionA, versionB, results})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, "index.html"), []byte(b.String()), 0644)
+}
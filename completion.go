@@ -0,0 +1,315 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// flagChoices lists the accepted values for flags that only take
+// one of a fixed set of values, so the completion scripts can
+// offer them.
+var flagChoices = map[string][]string{
+	"annotations":    {"github", "none"},
+	"diff":           {"summary", "full"},
+	"error-format":   {"human", "unix"},
+	"log-format":     {"text", "json"},
+	"output-newline": {"lf", "crlf"},
+	"format":         {"svg", "png", "pdf"},
+	"f":              {"svg", "png", "pdf"},
+	"theme":          mermaidThemes,
+}
+
+// inputExts are the extensions of the documents mermaid-cli
+// accepts as positional arguments.
+var inputExts = []string{mmd, md}
+
+// completionShells are the shells that the completion subcommand
+// can generate scripts for.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completionCmd prints a completion script for the shell named in
+// args to Stdout.
+//
+// usage: mermaid-cli completion bash|zsh|fish
+func completionCmd(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: mermaid-cli completion bash|zsh|fish")
+		os.Exit(2)
+	}
+	if err := writeCompletion(os.Stdout, args[0], flag.CommandLine); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// completionFlag is the part of a registered flag that the
+// completion scripts need.
+type completionFlag struct {
+	name, usage string
+	isBool      bool
+	choices     []string
+}
+
+// completionFlags collects every flag registered in fs, sorted by
+// name.
+func completionFlags(fs *flag.FlagSet) []completionFlag {
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			name:    f.Name,
+			usage:   f.Usage,
+			isBool:  ok && bf.IsBoolFlag(),
+			choices: flagChoices[f.Name],
+		})
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].name < flags[j].name })
+	return flags
+}
+
+// completionSubcommand is a subcommand with flags of its own, and
+// the extensions of the files it takes as positional arguments.
+type completionSubcommand struct {
+	name  string
+	flags []completionFlag
+	exts  []string
+}
+
+// completionSubcommands returns the subcommands whose flags the
+// completion scripts complete after the subcommand's name.
+func completionSubcommands() []completionSubcommand {
+	return []completionSubcommand{
+		{"compare", completionFlags(compareFlagSet(new(compareOptions))), inputExts},
+		{"extract", completionFlags(extractFlagSet(new(string))), []string{svg}},
+	}
+}
+
+// writeCompletion writes the completion script for shell to w,
+// completing the flags registered in fs, and those of each
+// subcommand in completionSubcommands.
+func writeCompletion(w io.Writer, shell string, fs *flag.FlagSet) error {
+	flags := completionFlags(fs)
+	subs := completionSubcommands()
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, flags, subs)
+	case "zsh":
+		writeZshCompletion(w, flags, subs)
+	case "fish":
+		writeFishCompletion(w, flags, subs)
+	default:
+		return fmt.Errorf("got shell %q; expected one of %s", shell, strings.Join(completionShells, ", "))
+	}
+	return nil
+}
+
+// subcommandNames returns the names of subs.
+func subcommandNames(subs []completionSubcommand) []string {
+	var names []string
+	for _, sub := range subs {
+		names = append(names, sub.name)
+	}
+	return names
+}
+
+func writeBashCompletion(w io.Writer, flags []completionFlag, subs []completionSubcommand) {
+	fmt.Fprintln(w, "# bash completion for mermaid-cli")
+	for _, sub := range subs {
+		fmt.Fprintf(w, "_mermaid_cli_%s() {\n", sub.name)
+		fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"`)
+		writeBashFlags(w, sub.flags, sub.exts)
+		fmt.Fprintln(w, "}")
+	}
+	fmt.Fprintln(w, "_mermaid_cli() {")
+	fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"`)
+	fmt.Fprintln(w, `	if [[ $COMP_CWORD -eq 2 && ${COMP_WORDS[1]} == completion ]]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(completionShells, " "))
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	if len(subs) > 0 {
+		fmt.Fprintln(w, `	if [[ $COMP_CWORD -gt 1 ]]; then`)
+		fmt.Fprintln(w, `		case "${COMP_WORDS[1]}" in`)
+		fmt.Fprintf(w, "\t\t%s)\n", strings.Join(subcommandNames(subs), "|"))
+		fmt.Fprintln(w, `			_mermaid_cli_${COMP_WORDS[1]}`)
+		fmt.Fprintln(w, "\t\t\treturn ;;")
+		fmt.Fprintln(w, "\t\tesac")
+		fmt.Fprintln(w, "\tfi")
+	}
+	writeBashFlags(w, flags, inputExts)
+	fmt.Fprintln(w, `	if [[ $COMP_CWORD -eq 1 ]]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY+=($(compgen -W %q -- \"$cur\"))\n", strings.Join(subcommands, " "))
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o filenames -F _mermaid_cli mermaid-cli")
+}
+
+// writeBashFlags writes the body of a bash completion function that
+// completes flags, their values, and files with exts.  Bash splits
+// -name=value at the "=", so a value after it is completed from
+// the word before the "=".
+func writeBashFlags(w io.Writer, flags []completionFlag, exts []string) {
+	var names, valueFlags []string
+	var choiceFlags []completionFlag
+	for _, f := range flags {
+		names = append(names, "-"+f.name)
+		if !f.isBool {
+			valueFlags = append(valueFlags, "-"+f.name)
+		} else {
+			for _, c := range f.choices {
+				names = append(names, "-"+f.name+"="+c)
+			}
+		}
+		if len(f.choices) > 0 {
+			choiceFlags = append(choiceFlags, f)
+		}
+	}
+
+	if len(choiceFlags) > 0 {
+		fmt.Fprintln(w, `	if [[ $prev == = ]]; then`)
+		fmt.Fprintln(w, `		case "${COMP_WORDS[COMP_CWORD-2]}" in`)
+		for _, f := range choiceFlags {
+			fmt.Fprintf(w, "\t\t-%s|--%s)\n", f.name, f.name)
+			fmt.Fprintf(w, "\t\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(f.choices, " "))
+			fmt.Fprintln(w, "\t\t\treturn ;;")
+		}
+		fmt.Fprintln(w, "\t\tesac")
+		fmt.Fprintln(w, "\tfi")
+	}
+	fmt.Fprintln(w, `	case "$prev" in`)
+	for _, f := range choiceFlags {
+		if !f.isBool {
+			fmt.Fprintf(w, "\t-%s|--%s)\n", f.name, f.name)
+			fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(f.choices, " "))
+			fmt.Fprintln(w, "\t\treturn ;;")
+		}
+	}
+	if len(valueFlags) > 0 {
+		fmt.Fprintf(w, "\t%s)\n", strings.Join(valueFlags, "|"))
+		fmt.Fprintln(w, `		COMPREPLY=($(compgen -f -- "$cur"))`)
+		fmt.Fprintln(w, "\t\treturn ;;")
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, `	if [[ $cur == -* ]]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, `	COMPREPLY=($(compgen -d -- "$cur"))`)
+	for _, ext := range exts {
+		fmt.Fprintf(w, "\tCOMPREPLY+=($(compgen -f -X '!*%s' -- \"$cur\"))\n", ext)
+	}
+}
+
+// zshEscaper escapes the characters that are special inside an
+// _arguments spec.
+var zshEscaper = strings.NewReplacer(
+	`'`, `'\''`,
+	`[`, `\[`,
+	`]`, `\]`,
+	`:`, `\:`,
+)
+
+// zshGlobs returns the _files pattern matching exts.
+func zshGlobs(exts []string) string {
+	var globs []string
+	for _, ext := range exts {
+		globs = append(globs, "*"+ext)
+	}
+	return strings.Join(globs, " ")
+}
+
+// writeZshSpecs writes the _arguments specs of flags, each followed
+// by a line continuation.  A bool flag with choices takes its value
+// only as -name=value.
+func writeZshSpecs(w io.Writer, flags []completionFlag) {
+	for _, f := range flags {
+		var spec string
+		switch {
+		case f.isBool && len(f.choices) > 0:
+			spec = fmt.Sprintf("-%s=-[%s]::%s:(%s)", f.name, zshEscaper.Replace(f.usage), f.name, strings.Join(f.choices, " "))
+		case f.isBool:
+			spec = fmt.Sprintf("-%s[%s]", f.name, zshEscaper.Replace(f.usage))
+		case len(f.choices) > 0:
+			spec = fmt.Sprintf("-%s[%s]:%s:(%s)", f.name, zshEscaper.Replace(f.usage), f.name, strings.Join(f.choices, " "))
+		default:
+			spec = fmt.Sprintf("-%s[%s]:%s:_files", f.name, zshEscaper.Replace(f.usage), f.name)
+		}
+		fmt.Fprintf(w, "\t'%s' \\\n", spec)
+	}
+}
+
+func writeZshCompletion(w io.Writer, flags []completionFlag, subs []completionSubcommand) {
+	fmt.Fprintln(w, "#compdef mermaid-cli")
+	for _, sub := range subs {
+		fmt.Fprintf(w, "_mermaid_cli_%s() {\n", sub.name)
+		fmt.Fprintln(w, "_arguments \\")
+		writeZshSpecs(w, sub.flags)
+		fmt.Fprintf(w, "\t'*:file:_files -g \"%s\"'\n", zshGlobs(sub.exts))
+		fmt.Fprintln(w, "}")
+	}
+	fmt.Fprintln(w, "if (( CURRENT == 3 )) && [[ ${words[2]} == completion ]]; then")
+	fmt.Fprintf(w, "\t_values shell %s\n", strings.Join(completionShells, " "))
+	fmt.Fprintln(w, "\treturn")
+	fmt.Fprintln(w, "fi")
+	if len(subs) > 0 {
+		fmt.Fprintln(w, "if (( CURRENT > 2 )); then")
+		fmt.Fprintln(w, "\tcase ${words[2]} in")
+		fmt.Fprintf(w, "\t%s)\n", strings.Join(subcommandNames(subs), "|"))
+		fmt.Fprintln(w, "\t\tshift words")
+		fmt.Fprintln(w, "\t\t(( CURRENT-- ))")
+		fmt.Fprintln(w, "\t\t_mermaid_cli_${words[1]}")
+		fmt.Fprintln(w, "\t\treturn ;;")
+		fmt.Fprintln(w, "\tesac")
+		fmt.Fprintln(w, "fi")
+	}
+	fmt.Fprintln(w, "_arguments \\")
+	writeZshSpecs(w, flags)
+	fmt.Fprintf(w, "\t'1:document or subcommand:{_files -g \"%s\"; _values subcommand %s}' \\\n",
+		zshGlobs(inputExts), strings.Join(subcommands, " "))
+	fmt.Fprintf(w, "\t'*:MermaidJS document:_files -g \"%s\"'\n", zshGlobs(inputExts))
+}
+
+// fishQuote quotes s as a single fish argument.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// writeFishFlags writes a complete command for each of flags,
+// offered when cond holds, and completes files with exts.  A bool
+// flag with choices is offered as -name=value too.
+func writeFishFlags(w io.Writer, cond string, flags []completionFlag, exts []string) {
+	prefix := "complete -c mermaid-cli -n " + fishQuote(cond)
+	for _, f := range flags {
+		line := prefix + " -o " + f.name
+		switch {
+		case f.isBool && len(f.choices) > 0:
+			var values []string
+			for _, c := range f.choices {
+				values = append(values, "-"+f.name+"="+c)
+			}
+			fmt.Fprintln(w, prefix+" -a "+fishQuote(strings.Join(values, " "))+" -d "+fishQuote(f.usage))
+		case f.isBool:
+		case len(f.choices) > 0:
+			line += " -x -a " + fishQuote(strings.Join(f.choices, " "))
+		default:
+			line += " -r -F"
+		}
+		fmt.Fprintln(w, line+" -d "+fishQuote(f.usage))
+	}
+	for _, ext := range exts {
+		fmt.Fprintf(w, "%s -k -a '(__fish_complete_suffix %s)'\n", prefix, ext)
+	}
+}
+
+func writeFishCompletion(w io.Writer, flags []completionFlag, subs []completionSubcommand) {
+	fmt.Fprintln(w, "# fish completion for mermaid-cli")
+	fmt.Fprintln(w, "complete -c mermaid-cli -f")
+	writeFishFlags(w, "not __fish_seen_subcommand_from "+strings.Join(subcommandNames(subs), " "), flags, inputExts)
+	for _, sub := range subs {
+		writeFishFlags(w, "__fish_seen_subcommand_from "+sub.name, sub.flags, sub.exts)
+	}
+	fmt.Fprintf(w, "complete -c mermaid-cli -n __fish_use_subcommand -a %s\n", fishQuote(strings.Join(subcommands, " ")))
+	fmt.Fprintf(w, "complete -c mermaid-cli -n '__fish_seen_subcommand_from completion' -a %s\n", fishQuote(strings.Join(completionShells, " ")))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// mentionsFlag reports whether the completion script for shell
+// completes the flag name.
+func mentionsFlag(shell, script, name string) bool {
+	switch shell {
+	case "bash":
+		words := strings.FieldsFunc(script, func(r rune) bool {
+			return strings.ContainsRune(" \t\n\"|()", r)
+		})
+		return slices.Contains(words, "-"+name)
+	case "zsh":
+		return strings.Contains(script, "'-"+name+"[") || strings.Contains(script, "'-"+name+"=-[")
+	case "fish":
+		return strings.Contains(script, " -o "+name+" ")
+	}
+	panic("unknown shell " + shell)
+}
+
+// offersChoices reports whether the completion script for shell
+// offers choices, and only those, as the values of the flag name.
+// A bool flag's choices are offered as -name=value.
+func offersChoices(shell, script, name string, isBool bool, choices []string) bool {
+	words := strings.Join(choices, " ")
+	var values []string
+	for _, c := range choices {
+		values = append(values, "-"+name+"="+c)
+	}
+	switch shell {
+	case "bash":
+		// After -name= as well as, for a value flag, after -name.
+		ok := strings.Contains(script, "-"+name+"|--"+name+")\n\t\t\tCOMPREPLY=($(compgen -W \""+words+"\"")
+		if isBool {
+			return ok && strings.Contains(script, " "+strings.Join(values, " ")+" ")
+		}
+		return ok && strings.Contains(script, "\t-"+name+"|--"+name+")\n\t\tCOMPREPLY=($(compgen -W \""+words+"\"")
+	case "zsh":
+		if isBool {
+			return strings.Contains(script, "'-"+name+"=-[") && strings.Contains(script, "::"+name+":("+words+")'")
+		}
+		return strings.Contains(script, ":"+name+":("+words+")'")
+	case "fish":
+		if isBool {
+			return strings.Contains(script, " -a '"+strings.Join(values, " ")+"' ")
+		}
+		return strings.Contains(script, " -o "+name+" -x -a '"+words+"' ")
+	}
+	panic("unknown shell " + shell)
+}
+
+// subcommandSection returns the part of the completion script for
+// shell that completes the subcommand sub.
+func subcommandSection(shell, script, sub string) string {
+	switch shell {
+	case "bash", "zsh":
+		_, after, _ := strings.Cut(script, "_mermaid_cli_"+sub+"() {\n")
+		section, _, _ := strings.Cut(after, "\n}\n")
+		return section
+	case "fish":
+		var lines []string
+		for _, line := range strings.Split(script, "\n") {
+			if strings.Contains(line, "'__fish_seen_subcommand_from "+sub+"'") {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, "\n") + "\n"
+	}
+	panic("unknown shell " + shell)
+}
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range completionShells {
+		var buf bytes.Buffer
+		if err := writeCompletion(&buf, shell, flag.CommandLine); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		script := buf.String()
+		flag.VisitAll(func(f *flag.Flag) {
+			if !mentionsFlag(shell, script, f.Name) {
+				t.Errorf("%s completion doesn't mention -%s", shell, f.Name)
+			}
+		})
+		for name, choices := range flagChoices {
+			f := flag.Lookup(name)
+			if f == nil {
+				t.Errorf("flagChoices has -%s, which isn't a flag", name)
+				continue
+			}
+			bf, isBool := f.Value.(interface{ IsBoolFlag() bool })
+			if !offersChoices(shell, script, name, isBool && bf.IsBoolFlag(), choices) {
+				t.Errorf("%s completion doesn't offer -%s %s", shell, name, strings.Join(choices, "|"))
+			}
+		}
+		for _, sub := range subcommands {
+			if !strings.Contains(script, sub) {
+				t.Errorf("%s completion doesn't offer subcommand %s", shell, sub)
+			}
+		}
+		for _, fs := range []*flag.FlagSet{
+			compareFlagSet(new(compareOptions)),
+			extractFlagSet(new(string)),
+		} {
+			section := subcommandSection(shell, script, fs.Name())
+			fs.VisitAll(func(f *flag.Flag) {
+				if !mentionsFlag(shell, section, f.Name) {
+					t.Errorf("%s completion of %s doesn't mention -%s", shell, fs.Name(), f.Name)
+				}
+			})
+		}
+	}
+}
+
+// TestWriteCompletionSyntax checks each script parses, with the
+// shells that are installed.
+func TestWriteCompletionSyntax(t *testing.T) {
+	for _, shell := range completionShells {
+		path, err := exec.LookPath(shell)
+		if err != nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := writeCompletion(&buf, shell, flag.CommandLine); err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(t.TempDir(), "completion."+shell)
+		if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		check := "-n"
+		if shell == "fish" {
+			check = "--no-execute"
+		}
+		if out, err := exec.Command(path, check, name).CombinedOutput(); err != nil {
+			t.Errorf("%s %s: %v\n%s", shell, check, err, out)
+		}
+	}
+}
+
+func TestWriteCompletionUnknownShell(t *testing.T) {
+	err := writeCompletion(&bytes.Buffer{}, "tcsh", flag.CommandLine)
+	if err == nil || !strings.Contains(err.Error(), "tcsh") {
+		t.Errorf("writeCompletion for tcsh = %v, want an error naming it", err)
+	}
+}
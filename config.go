@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// loadMermaidConfig reads the MermaidJS config in the JSON file
+// name, for -c.  It has to be a JSON object; for malformed JSON
+// the error says where, as a byte offset.
+func loadMermaidConfig(name string) (map[string]any, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read config: %w", err)
+	}
+	var config map[string]any
+	if err := json.Unmarshal(b, &config); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return nil, fmt.Errorf("%s: %v, at byte offset %d", name, err, syntaxErr.Offset)
+		case errors.As(err, &typeErr):
+			return nil, fmt.Errorf("%s: got a JSON %s; expected an object of MermaidJS config", name, typeErr.Value)
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return config, nil
+}
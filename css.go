@@ -0,0 +1,20 @@
+package main
+
+import "os"
+
+// reloadCSS rereads the -css file in watch mode, and sets MermaidJS
+// up with it again, returning the pairs to rerender: all of them,
+// since every diagram has the CSS.  For an error, it prints it,
+// keeps the old CSS, and returns none.
+func reloadCSS(pairs []renderPair) []renderPair {
+	css, err := os.ReadFile(*cssFlag)
+	if err != nil {
+		errorf("couldn't reload CSS: %v", err)
+		return nil
+	}
+	if err := mainRenderer.SetCSS(runCtx, string(css)); err != nil {
+		errorf("couldn't set up MermaidJS with the new CSS: %v", err)
+		return nil
+	}
+	return pairs
+}
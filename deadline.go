@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// deadlineExitStatus is the exit status when -max-total-time runs
+// out, to tell it from failed documents (1) and bad usage (2).
+const deadlineExitStatus = 3
+
+// runCtx is done when -max-total-time runs out.  The renderer's
+// browser runs under it, so running out aborts renders in flight.
+var runCtx = context.Background()
+
+// runPairs are the documents of the run, for abortRun to report
+// the ones it never got to.
+var runPairs []renderPair
+
+// startDeadline starts the -max-total-time clock, if it's set.
+func startDeadline() context.CancelFunc {
+	if *maxTotalTimeFlag <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *maxTotalTimeFlag)
+	runCtx = ctx
+	return cancel
+}
+
+// deadlineExceeded reports whether -max-total-time has run out.
+func deadlineExceeded() bool {
+	return errors.Is(runCtx.Err(), context.DeadlineExceeded)
+}
+
+// abortRun ends a run that ran out of -max-total-time.  It records
+// the documents that weren't rendered as not attempted, writes the
+// reports, stops the renderer, prints how many documents were left
+// unrendered, removes the output locks, and exits with
+// deadlineExitStatus.
+func abortRun() {
+	rendered, left := 0, 0
+	for _, pair := range runPairs {
+		switch e := findReportEntry(pair.docName()); {
+		case e == nil:
+			recordNotAttempted(pair)
+			left++
+		case e.OK:
+			rendered++
+		default:
+			left++
+		}
+	}
+	writeReports()
+	stopRenderer(mainRenderer)
+	unlockOutputs()
+	errorf("ran out of -max-total-time (%v): rendered %d of %d documents, %d left unrendered", *maxTotalTimeFlag, rendered, len(runPairs), left)
+	os.Exit(deadlineExitStatus)
+}
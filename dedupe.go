@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+)
+
+// outputHash returns the hash -dedupe-report compares outputs by:
+// the SHA-256 of the normalized SVG, so two documents that render
+// the same diagram match even though their generated ids don't.
+func outputHash(svgResult string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(mermaidtest.NormalizeSVG(svgResult))))
+}
+
+// findDuplicates returns the groups of rendered documents whose
+// outputs are the same, in the order they were first rendered,
+// and fills in each one's Duplicates.
+func findDuplicates() [][]*reportEntry {
+	var (
+		groups [][]*reportEntry
+		byHash = make(map[string]int)
+	)
+	for _, e := range reportEntries {
+		if !e.OK || e.Hash == "" {
+			continue
+		}
+		i, ok := byHash[e.Hash]
+		if !ok {
+			i = len(groups)
+			byHash[e.Hash] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], e)
+	}
+
+	dups := groups[:0]
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		for _, e := range g {
+			e.Duplicates = nil
+			for _, other := range g {
+				if other != e {
+					e.Duplicates = append(e.Duplicates, other.Name)
+				}
+			}
+		}
+		dups = append(dups, g)
+	}
+	return dups
+}
+
+// reportDuplicates prints a warning to stderr for each group of
+// documents that render the same output, for -dedupe-report, and
+// returns how many groups there are.
+func reportDuplicates() int {
+	groups := findDuplicates()
+	for _, g := range groups {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%d documents render the same diagram; consider keeping one:", len(g))
+		for _, e := range g {
+			b.WriteString("\n\t" + e.Name)
+		}
+		warnf("%s", b.String())
+	}
+	return len(groups)
+}
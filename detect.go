@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// detectCmd prints the diagram type of each document named in
+// args to Stdout, prefixed with the document's name if there's
+// more than one.  It exits with status 1 if any document's type
+// couldn't be detected.
+//
+// usage: mermaid-cli detect file.mmd [file2.mmd ...]
+func detectCmd(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: mermaid-cli detect file.mmd [file2.mmd ...]")
+		os.Exit(2)
+	}
+
+	mainRenderer = newRenderer()
+	failed := false
+	for _, name := range args {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			fileFatalf(name, err, "couldn't read MMD: %v", err)
+		}
+		diagramType, err := mainRenderer.DetectType(runCtx, string(b))
+		if err != nil {
+			fileErrorf(name, err, "couldn't detect diagram type of %s: %v", name, err)
+			failed = true
+			continue
+		}
+		if len(args) > 1 {
+			fmt.Printf("%s: %s\n", name, diagramType)
+		} else {
+			fmt.Println(diagramType)
+		}
+	}
+	stopRenderer(mainRenderer)
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// verifyDeterministic renders each pair's document twice, and
+// with fresh, a third time in a new browser, and checks that
+// every render came out byte-for-byte the same, printing the
+// first difference to Stdout for each document that didn't.
+//
+// Nothing is written to the pairs' SVGs.  It reports whether
+// every document rendered and was deterministic.
+//
+// A document that differs is probably relying on Date.now or
+// Math.random, or on ids that MermaidJS doesn't make
+// deterministic.
+func verifyDeterministic(pairs []renderPair, fresh bool, opts []renderer.Option) (ok bool) {
+	var freshRenderer *renderer.Renderer
+	if fresh {
+		freshRenderer = newRenderer(opts...)
+		defer stopRenderer(freshRenderer)
+	}
+
+	ok = true
+	for _, pair := range pairs {
+		d := readDoc(pair)
+		if d.readErr != nil {
+			fileFatalf(pair.mmdName, d.readErr, "couldn't read MMD: %v", d.readErr)
+		}
+
+		type run struct {
+			name string
+			r    *renderer.Renderer
+		}
+		runs := []run{{"first render", mainRenderer}, {"second render", mainRenderer}}
+		if fresh {
+			runs = append(runs, run{"render in a new browser", freshRenderer})
+		}
+
+		var first string
+		same := true
+		for i, run := range runs {
+			// Each run renders the document as render would, with
+			// its per-document config, front matter and all.
+			rd := &renderDoc{pair: pair, start: time.Now(), src: d.src, lineOffset: d.lineOffset}
+			rd.render(run.r)
+			if err := rd.err; err != nil {
+				fileErrorf(pair.mmdName, err, "couldn't render %s (%s): %v", pair.docName(), run.name, err)
+				same = false
+				break
+			}
+			svgResult := rd.result.SVG
+			if i == 0 {
+				first = svgResult
+				continue
+			}
+			if svgResult != first {
+				fmt.Print(mermaidtest.FirstDiff(
+					fmt.Sprintf("%s (%s)", pair.docName(), runs[0].name), mermaidtest.Lines(first),
+					fmt.Sprintf("%s (%s)", pair.docName(), run.name), mermaidtest.Lines(svgResult),
+				))
+				fileErrorf(pair.mmdName, fmt.Errorf("not deterministic: the %s differs from the %s", run.name, runs[0].name),
+					"%s isn't deterministic: the %s differs from the %s", pair.docName(), run.name, runs[0].name)
+				same = false
+				break
+			}
+		}
+		if !same {
+			ok = false
+			continue
+		}
+		log.Println("deterministic", pair.docName())
+	}
+	return ok
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sourceDateEpoch returns the time in SOURCE_DATE_EPOCH (see
+// https://reproducible-builds.org/specs/source-date-epoch/), and
+// whether it's set.  Any date mermaid-cli puts in an artifact
+// comes from it when it's set, so builds are reproducible.
+func sourceDateEpoch() (time.Time, bool, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Time{}, false, nil
+	}
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("got SOURCE_DATE_EPOCH=%s; expected seconds since 1970", v)
+	}
+	return time.Unix(secs, 0).UTC(), true, nil
+}
+
+// artifactTime is the time to put in an artifact: SOURCE_DATE_EPOCH
+// if it's set, or else now.
+func artifactTime() time.Time {
+	t, ok, err := sourceDateEpoch()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if !ok {
+		return time.Now()
+	}
+	return t
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestDeterministicProcesses renders the same tree, with
+// -deterministic, in two separate runs of the cli, and checks
+// every artifact comes out byte for byte the same.
+func TestDeterministicProcesses(t *testing.T) {
+	startTestRenderer(t) // only to skip without Chrome
+	files := make(map[string]string)
+	for _, name := range []string{"flow.mmd", "sequence.mmd", "state.mmd", "gantt.mmd"} {
+		b, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files["docs/"+name] = string(b)
+	}
+	env := []string{"SOURCE_DATE_EPOCH=1700000000"}
+
+	run := func() map[string]string {
+		chdirTemp(t, files)
+		var args []string
+		for name := range files {
+			args = append(args, filepath.FromSlash(name))
+		}
+		slices.Sort(args)
+		for _, format := range []string{"svg", "png", "pdf"} {
+			a := append([]string{"-deterministic", "-metadata", "-write-sums", "-format", format, "-o", format}, args...)
+			if _, stderr, status := runMain(t, env, a...); status != 0 {
+				t.Fatalf("-format=%s exited %d: %s", format, status, stderr)
+			}
+		}
+		artifacts := make(map[string]string)
+		err := filepath.WalkDir(".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || files[filepath.ToSlash(name)] != "" {
+				return err
+			}
+			b, err := os.ReadFile(name)
+			artifacts[name] = string(b)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return artifacts
+	}
+	first, second := run(), run()
+
+	if len(first) == 0 {
+		t.Fatal("the runs wrote nothing")
+	}
+	for name, data := range first {
+		if b, ok := second[name]; !ok {
+			t.Errorf("the second run didn't write %s", name)
+		} else if b != data {
+			t.Errorf("%s differs between the runs", name)
+		}
+	}
+	for name := range second {
+		if _, ok := first[name]; !ok {
+			t.Errorf("the first run didn't write %s", name)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// fileErrorf reports a failure of the document name.
+//
+// By default it prints like errorf(format, args...), as an event
+// about name.  With
+// -error-format=unix it prints "name:line:col: message" instead,
+// for editors' and CI's problem matchers, with the position and
+// message taken from cause; the position is 1:1 if cause doesn't
+// say.  Either way it annotates the failure for GitHub Actions, and
+// records it for the -sarif log.
+func fileErrorf(name string, cause error, format string, args ...any) {
+	failures = append(failures, fileFailure{name: name, cause: cause})
+	annotateErr(name, cause)
+	if *errorFormatFlag != "unix" {
+		logEventf("error", name, format, args...)
+		return
+	}
+	line, col := errorPosition(cause)
+	fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", name, max(line, 1), max(col, 1), oneLineMessage(cause))
+}
+
+// fileFatalf is fileErrorf followed by writing the -sarif and
+// -report-html reports, stopping the renderer, removing the output
+// locks, and exiting with status 1.
+func fileFatalf(name string, cause error, format string, args ...any) {
+	fileErrorf(name, cause, format, args...)
+	writeReports()
+	stopRenderer(mainRenderer)
+	unlockOutputs()
+	os.Exit(1)
+}
+
+// parseErrorExitStatus is the exit status when every document
+// that failed doesn't parse: the documents need fixing, as the
+// arguments do for bad usage (also 2), rather than the renderer or
+// the machine, as for other failures (1).
+const parseErrorExitStatus = 2
+
+// onlyParseErrors reports whether there were failures, and every
+// one is a *ParseError.
+func onlyParseErrors() bool {
+	for _, f := range failures {
+		var parseErr *renderer.ParseError
+		if !errors.As(f.cause, &parseErr) {
+			return false
+		}
+	}
+	return len(failures) > 0
+}
+
+// parseErrorReport returns parseErr, from the document src, as
+// "file:line:col: message", followed by the line of src it's on
+// with a caret under its column, when it says where.  lineOffset is
+// how many lines of the file come before src, as for a Markdown
+// block.
+func parseErrorReport(parseErr *renderer.ParseError, src string, lineOffset int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", parseErr.Position(), oneLineMessage(parseErr))
+	lines := strings.Split(src, "\n")
+	i := parseErr.Line - lineOffset - 1
+	if i < 0 || i >= len(lines) {
+		return b.String()
+	}
+	line := strings.TrimRight(lines[i], "\r")
+	fmt.Fprintf(&b, "\n\t%s", line)
+	if parseErr.Column > 0 {
+		// Indent the caret with the line's own tabs, so it lines up.
+		var indent strings.Builder
+		for j, r := range []rune(line) {
+			if j >= parseErr.Column-1 {
+				break
+			}
+			if r == '\t' {
+				indent.WriteRune('\t')
+			} else {
+				indent.WriteRune(' ')
+			}
+		}
+		fmt.Fprintf(&b, "\n\t%s^", indent.String())
+	}
+	return b.String()
+}
+
+var onLineRE = regexp.MustCompile(`\bon line (\d+)`)
+
+// errorPosition returns the line and column err is at, or 0 for
+// either if err doesn't say.  A *ParseError knows; other errors
+// from MermaidJS's parsers usually say "... on line N:".
+func errorPosition(err error) (line, col int) {
+	var parseErr *renderer.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.Line, parseErr.Column
+	}
+	if m := onLineRE.FindStringSubmatch(err.Error()); m != nil {
+		line, _ = strconv.Atoi(m[1])
+	}
+	return line, 0
+}
+
+var (
+	parseErrorHeaderRE = regexp.MustCompile(`^Parse error on line \d+:$`)
+	caretRE            = regexp.MustCompile(`^-*\^$`)
+)
+
+// oneLineMessage returns err's message on one line.
+//
+// MermaidJS's parse errors take four lines: "Parse error on line
+// N:", the offending source, a caret pointing into it, and what
+// was expected.  The position is reported separately, so only the
+// expectation is kept.
+func oneLineMessage(err error) string {
+	lines := strings.Split(err.Error(), "\n")
+	var kept []string
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "", parseErrorHeaderRE.MatchString(line), caretRE.MatchString(line):
+			continue
+		case i+1 < len(lines) && caretRE.MatchString(strings.TrimSpace(lines[i+1])):
+			continue // the source the caret points into
+		}
+		kept = append(kept, line)
+	}
+	if len(kept) == 0 {
+		return strings.Join(strings.Fields(err.Error()), " ")
+	}
+	return strings.Join(kept, " ")
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// dirDefaultsName is the name of a directory's defaults file: the
+// MermaidJS settings for the documents in it and below it.
+const dirDefaultsName = ".mermaid-cli-dir.yaml"
+
+// dirDefaultsFile is a parsed defaults file.
+type dirDefaultsFile struct {
+	name   string
+	config map[string]any
+}
+
+// dirDefaultsCache caches the defaults file of each directory, by
+// its absolute path, or nil for none, so a tree's documents don't
+// each read the files above them.  It's locked, since the
+// renderers of a pool look documents up concurrently.
+var dirDefaultsCache = struct {
+	sync.Mutex
+	files map[string]*dirDefaultsFile
+	errs  map[string]error
+}{files: make(map[string]*dirDefaultsFile), errs: make(map[string]error)}
+
+// dirDefaults returns the settings the defaults files above the
+// document mmdName give it, and those files, outermost first.  It
+// looks in the document's directory and in every one above it; a
+// file's settings are merged (see renderer.MergeConfig) over those of the
+// files above it, so the nearest file wins.  Standard input has
+// none.
+func dirDefaults(mmdName string) (map[string]any, []*dirDefaultsFile, error) {
+	config := make(map[string]any)
+	if mmdName == stdioName {
+		return config, nil, nil
+	}
+	dir, err := filepath.Abs(filepath.Dir(mmdName))
+	if err != nil {
+		return nil, nil, err
+	}
+	var files []*dirDefaultsFile
+	for {
+		f, err := loadDirDefaults(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if f != nil {
+			files = append(files, f)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	slices.Reverse(files)
+	for _, f := range files {
+		renderer.MergeConfig(config, f.config)
+	}
+	return config, files, nil
+}
+
+// loadDirDefaults returns the defaults file in the directory dir,
+// or nil if it has none, reading it the first time it's asked for.
+func loadDirDefaults(dir string) (*dirDefaultsFile, error) {
+	dirDefaultsCache.Lock()
+	defer dirDefaultsCache.Unlock()
+	if f, ok := dirDefaultsCache.files[dir]; ok {
+		return f, dirDefaultsCache.errs[dir]
+	}
+	f, err := readDirDefaults(filepath.Join(dir, dirDefaultsName))
+	dirDefaultsCache.files[dir] = f
+	dirDefaultsCache.errs[dir] = err
+	return f, err
+}
+
+func readDirDefaults(name string) (*dirDefaultsFile, error) {
+	b, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Under the current directory, it's named relative to it.
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, name); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+	}
+	config, err := parseDirDefaults(name, string(b))
+	if err != nil {
+		return nil, err
+	}
+	return &dirDefaultsFile{name: name, config: config}, nil
+}
+
+// parseDirDefaults parses the defaults file name, with contents
+// src.  Like a theme map, it's only as much YAML as it needs: a
+// mapping of MermaidJS settings to scalars, or to mappings of
+// settings, nested as deep as MermaidJS's settings go, for
+// sections like flowchart or themeVariables.
+//
+//	theme: dark
+//	layout: elk
+//	flowchart:
+//	  curve: basis
+//	  subGraphTitleMargin:
+//	    top: 8
+func parseDirDefaults(name, src string) (map[string]any, error) {
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if _, _, ok := cutYAMLKey(trimmed); !ok || strings.HasPrefix(trimmed, "- ") {
+			return nil, fmt.Errorf("%s:%d: expected key: value", name, i+1)
+		}
+	}
+	nodes := parseYAMLTree(lines)
+	for _, n := range nodes {
+		if n.indent != 0 {
+			return nil, fmt.Errorf("%s:%d: setting %s isn't under a section", name, n.first+1, n.key)
+		}
+	}
+	if err := checkDirDefaults(name, nodes, ""); err != nil {
+		return nil, err
+	}
+
+	config := yamlNodesMap(nodes)
+	if theme, ok := config["theme"]; ok && !isMermaidTheme(theme) {
+		return nil, fmt.Errorf("%s: got theme %v; expected one of %s", name, theme, strings.Join(mermaidThemes, ", "))
+	}
+	return config, nil
+}
+
+// checkDirDefaults checks the settings nodes, of the defaults file
+// name, under the section prefix: each is set once, and has either
+// a value or settings under it.
+func checkDirDefaults(name string, nodes []*yamlNode, prefix string) error {
+	seen := make(map[string]int)
+	for _, n := range nodes {
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", name, n.first+1, fmt.Sprintf(format, args...))
+		}
+		setting := prefix + n.key
+		if prev, ok := seen[n.key]; ok {
+			return errorf("setting %s is already on line %d", setting, prev)
+		}
+		seen[n.key] = n.first + 1
+		switch {
+		case n.value != "" && len(n.children) > 0:
+			return errorf("setting %s has both a value and settings under it", setting)
+		case n.value == "" && len(n.children) == 0:
+			return errorf("setting %s has no value", setting)
+		}
+		if err := checkDirDefaults(name, n.children, setting+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirDefaultsNames returns the defaults files the watcher watches
+// for pairs, once each: the one in each directory from a
+// document's up to the current directory, whether it's there yet
+// or not, and any others above the document.
+func dirDefaultsNames(pairs []renderPair) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, pair := range pairs {
+		if pair.mmdName == stdioName {
+			continue
+		}
+		for dir := filepath.Dir(pair.mmdName); ; dir = filepath.Dir(dir) {
+			add(filepath.Join(dir, dirDefaultsName))
+			if dir == "." || filepath.IsAbs(dir) || filepath.Base(dir) == ".." {
+				break
+			}
+		}
+		if _, files, err := dirDefaults(pair.mmdName); err == nil {
+			for _, f := range files {
+				add(f.name)
+			}
+		}
+	}
+	return names
+}
+
+// reloadDirDefaults reads the defaults file name again, once it's
+// changed, been added, or been removed, and returns the pairs
+// whose settings that changes.  A malformed file is reported now,
+// and fails the documents under it when they render.
+func reloadDirDefaults(pairs []renderPair, name string) []renderPair {
+	// A document's settings change with its files' errors too.
+	settings := func(mmdName string) string {
+		config, _, err := dirDefaults(mmdName)
+		if err != nil {
+			return err.Error()
+		}
+		b, _ := json.Marshal(config)
+		return string(b)
+	}
+	old := make(map[string]string)
+	for _, pair := range pairs {
+		old[pair.mmdName] = settings(pair.mmdName)
+	}
+	dir, err := filepath.Abs(filepath.Dir(name))
+	if err != nil {
+		errorf("%v", err)
+		return nil
+	}
+	dirDefaultsCache.Lock()
+	delete(dirDefaultsCache.files, dir)
+	delete(dirDefaultsCache.errs, dir)
+	dirDefaultsCache.Unlock()
+	if _, err := loadDirDefaults(dir); err != nil {
+		errorf("%v", err)
+	}
+
+	var changed []renderPair
+	for _, pair := range pairs {
+		if settings(pair.mmdName) != old[pair.mmdName] {
+			changed = append(changed, pair)
+		}
+	}
+	return changed
+}
+
+// dirDefaultsKey returns the settings the defaults files give the
+// document mmdName, as JSON, for inputsHash, or "" for none or an
+// error, which rendering it reports.
+func dirDefaultsKey(mmdName string) string {
+	config, _, err := dirDefaults(mmdName)
+	if err != nil || len(config) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(config)
+	return string(b)
+}
+
+// settingNames returns the names of config's settings, sorted, with
+// a section's settings named under it, e.g., flowchart.curve.
+func settingNames(config map[string]any) []string {
+	var names []string
+	for k, v := range config {
+		if m, ok := v.(map[string]any); ok {
+			for _, sub := range settingNames(m) {
+				names = append(names, k+"."+sub)
+			}
+			continue
+		}
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
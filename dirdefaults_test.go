@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDirDefaults(t *testing.T) {
+	src := `# Nested as deep as MermaidJS's settings go.
+theme: dark
+flowchart:
+  curve: basis
+  subGraphTitleMargin:
+    top: 8
+themeVariables:
+  primaryColor: "#ffcc00"
+`
+	config, err := parseDirDefaults("d.yaml", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"theme": "dark",
+		"flowchart": map[string]any{
+			"curve":               "basis",
+			"subGraphTitleMargin": map[string]any{"top": 8.0},
+		},
+		"themeVariables": map[string]any{"primaryColor": "#ffcc00"},
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("parseDirDefaults = %v, want %v", config, want)
+	}
+
+	for _, tc := range []struct{ src, err string }{
+		{"theme: dark\ntheme: forest\n", "d.yaml:2: setting theme is already on line 1"},
+		{"flowchart:\n  curve: basis\n  curve: linear\n", "d.yaml:3: setting flowchart.curve is already on line 2"},
+		{"flowchart:\n", "d.yaml:1: setting flowchart has no value"},
+		{"flowchart:\n  margin:\n", "d.yaml:2: setting flowchart.margin has no value"},
+		{"flowchart: x\n  curve: basis\n", "d.yaml:1: setting flowchart has both a value and settings under it"},
+		{"  curve: basis\n", "d.yaml:1: setting curve isn't under a section"},
+		{"- theme: dark\n", "d.yaml:1: expected key: value"},
+		{"theme: sepia\n", "d.yaml: got theme sepia"},
+	} {
+		if _, err := parseDirDefaults("d.yaml", tc.src); err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+			t.Errorf("parseDirDefaults(%q) = %v, want %s", tc.src, err, tc.err)
+		}
+	}
+}
+
+// dirDefaultsTree is a tree three defaults files deep, for
+// a/b/c/doc.mmd.
+var dirDefaultsTree = map[string]string{
+	"a/" + dirDefaultsName:     "theme: dark\nlayout: elk\nflowchart:\n  curve: basis\n  padding: 10\n",
+	"a/b/" + dirDefaultsName:   "flowchart:\n  curve: linear\nthemeVariables:\n  fontSize: 18\n",
+	"a/b/c/" + dirDefaultsName: "themeVariables:\n  fontSize: 20\n  primaryColor: \"#ffcc00\"\n",
+	"a/b/c/doc.mmd":            "---\nconfig:\n  flowchart:\n    padding: 5\n---\nflowchart LR\n    A --> B\n",
+	"a/b/other.mmd":            "flowchart LR\n    A --> B\n",
+}
+
+func TestDirDefaultsLevels(t *testing.T) {
+	chdirTemp(t, dirDefaultsTree)
+
+	config, files, err := dirDefaults(filepath.Join("a", "b", "c", "doc.mmd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"theme":          "dark",
+		"layout":         "elk",
+		"flowchart":      map[string]any{"curve": "linear", "padding": 10.0},
+		"themeVariables": map[string]any{"fontSize": 20.0, "primaryColor": "#ffcc00"},
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("dirDefaults = %v, want %v", config, want)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.ToSlash(f.name))
+	}
+	if want := []string{"a/" + dirDefaultsName, "a/b/" + dirDefaultsName, "a/b/c/" + dirDefaultsName}; !slices.Equal(names, want) {
+		t.Errorf("dirDefaults files = %q, want %q", names, want)
+	}
+}
+
+// TestEffectiveConfigLevels checks the precedence of the -c file,
+// the defaults files at three levels, and the document's front
+// matter, as -show-effective-config reports it.
+func TestEffectiveConfigLevels(t *testing.T) {
+	startTestRenderer(t) // only to skip without Chrome
+	files := map[string]string{
+		"brand.json": `{"theme": "forest", "fontFamily": "Serif", "flowchart": {"curve": "step", "padding": 20, "nodeSpacing": 70}}`,
+	}
+	for name, data := range dirDefaultsTree {
+		files[name] = data
+	}
+	chdirTemp(t, files)
+
+	stdout, stderr, status := runMain(t, nil, "-c", "brand.json", "-show-effective-config", filepath.Join("a", "b", "c", "doc.mmd"))
+	if status != 0 {
+		t.Fatalf("exited %d: %s", status, stderr)
+	}
+	var config struct {
+		Theme      string
+		FontFamily string
+		Layout     string
+		Flowchart  struct {
+			Curve       string
+			Padding     float64
+			NodeSpacing float64
+		}
+		ThemeVariables struct {
+			FontSize any
+		}
+	}
+	if err := json.Unmarshal([]byte(stdout), &config); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		setting   string
+		got, want any
+	}{
+		{"theme", config.Theme, "dark"},                               // a's defaults over -c
+		{"fontFamily", config.FontFamily, "Serif"},                    // -c
+		{"layout", config.Layout, "elk"},                              // a's defaults
+		{"flowchart.curve", config.Flowchart.Curve, "linear"},         // a/b's over a's over -c
+		{"flowchart.padding", config.Flowchart.Padding, 5.0},          // front matter over them all
+		{"flowchart.nodeSpacing", config.Flowchart.NodeSpacing, 70.0}, // -c
+	} {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.setting, c.got, c.want)
+		}
+	}
+	for _, want := range []string{"brand.json: ", "a/" + dirDefaultsName + ": ", "a/b/c/" + dirDefaultsName + ": themeVariables.fontSize"} {
+		if !strings.Contains(filepath.ToSlash(stderr), want) {
+			t.Errorf("the sources don't have %q:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestDirDefaultsNames(t *testing.T) {
+	pairs := []renderPair{
+		{mmdName: filepath.Join("a", "b", "c", "doc.mmd")},
+		{mmdName: filepath.Join("a", "b", "other.mmd")},
+		{mmdName: stdioName},
+	}
+	chdirTemp(t, dirDefaultsTree)
+	var names []string
+	for _, name := range dirDefaultsNames(pairs) {
+		names = append(names, filepath.ToSlash(name))
+	}
+	want := []string{
+		"a/b/c/" + dirDefaultsName,
+		"a/b/" + dirDefaultsName,
+		"a/" + dirDefaultsName,
+		dirDefaultsName,
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("dirDefaultsNames = %q, want %q", names, want)
+	}
+}
+
+func TestReloadDirDefaults(t *testing.T) {
+	chdirTemp(t, dirDefaultsTree)
+	doc, other := filepath.Join("a", "b", "c", "doc.mmd"), filepath.Join("a", "b", "other.mmd")
+	pairs := []renderPair{{mmdName: doc}, {mmdName: other}}
+	for _, pair := range pairs {
+		if _, _, err := dirDefaults(pair.mmdName); err != nil { // cache them
+			t.Fatal(err)
+		}
+	}
+	reload := func(name, data string) []string {
+		t.Helper()
+		name = filepath.FromSlash(name)
+		if data == "" {
+			if err := os.Remove(name); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			writeTestFile(t, name, data)
+		}
+		var changed []string
+		for _, pair := range reloadDirDefaults(pairs, name) {
+			changed = append(changed, pair.mmdName)
+		}
+		return changed
+	}
+
+	if got := reload("a/b/c/"+dirDefaultsName, "themeVariables:\n  fontSize: 22\n"); !slices.Equal(got, []string{doc}) {
+		t.Errorf("changing a/b/c's file changed %q, want only %s", got, doc)
+	}
+	if got := reload("a/b/"+dirDefaultsName, "flowchart:\n  curve: linear\nthemeVariables:\n  fontSize: 18\n# no change\n"); len(got) != 0 {
+		t.Errorf("a comment in a/b's file changed %q, want none", got)
+	}
+	if got := reload("a/"+dirDefaultsName, ""); !slices.Equal(got, []string{doc, other}) {
+		t.Errorf("removing a's file changed %q, want both", got)
+	}
+	if got := reload("a/b/"+dirDefaultsName, "flowchart:\n"); !slices.Equal(got, []string{doc, other}) {
+		t.Errorf("breaking a/b's file changed %q, want both", got)
+	}
+	if _, _, err := dirDefaults(other); err == nil {
+		t.Error("a broken defaults file doesn't fail the documents under it")
+	}
+}
+
+// TestDirDefaultsFixtures checks the settings each document in
+// testdata/defaults gets from the defaults files above it.
+func TestDirDefaultsFixtures(t *testing.T) {
+	dir := filepath.Join("testdata", "defaults")
+	for _, tc := range []struct {
+		name  string
+		files int
+		want  string
+	}{
+		{"architecture/system.mmd", 1, `{"flowchart":{"curve":"basis"},"layout":"elk","theme":"dark"}`},
+		{"architecture/services/gateway.mmd", 2, `{"flowchart":{"curve":"linear"},"layout":"elk","theme":"dark"}`},
+		{"runbooks/rollback.mmd", 1, `{"theme":"neutral"}`},
+	} {
+		config, files, err := dirDefaults(filepath.Join(dir, filepath.FromSlash(tc.name)))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		b, err := json.Marshal(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.want || len(files) != tc.files {
+			t.Errorf("%s gets %s from %d files, want %s from %d", tc.name, b, len(files), tc.want, tc.files)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// knownConfig caches the default config of the loaded MermaidJS,
+// which has every setting it knows, for checkDocConfig.
+var knownConfig struct {
+	sync.Mutex
+	config map[string]any
+}
+
+// loadKnownConfig returns the default config of the MermaidJS
+// loaded in r, fetching it the first time it's asked for.
+func loadKnownConfig(r *renderer.Renderer) (map[string]any, error) {
+	knownConfig.Lock()
+	defer knownConfig.Unlock()
+	if knownConfig.config != nil {
+		return knownConfig.config, nil
+	}
+	config, err := r.DefaultConfig(runCtx)
+	if err != nil {
+		return nil, err
+	}
+	knownConfig.config = config
+	return config, nil
+}
+
+// openConfig are settings that take any keys, or have no default
+// for knownConfig to list, so checkDocConfig doesn't flag them or
+// what's in them.
+var openConfig = map[string]bool{
+	"themeVariables": true,
+	"themeCSS":       true,
+	"wrap":           true,
+}
+
+// unknownConfigKeys calls f with the dotted name of each setting in
+// config, under prefix, that known doesn't have.  Sections that
+// both have are checked in turn.
+func unknownConfigKeys(config, known map[string]any, prefix string, f func(name string)) {
+	for _, k := range sortedKeys(config) {
+		name := prefix + k
+		if prefix == "" && openConfig[k] {
+			continue
+		}
+		kv, ok := known[k]
+		if !ok {
+			f(name)
+			continue
+		}
+		sub, subOK := config[k].(map[string]any)
+		knownSub, knownOK := kv.(map[string]any)
+		if subOK && knownOK && len(knownSub) > 0 {
+			unknownConfigKeys(sub, knownSub, name+".", f)
+		}
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// initDirectiveRE matches an init directive, with its config in
+// group 1.
+var initDirectiveRE = regexp.MustCompile(`%%\{\s*(?:init|initialize)\s*:\s*([\s\S]*?)\s*\}%%`)
+
+// checkDocConfig returns the dotted names of the settings that
+// the document mmdSource sets, in its front matter config or its
+// init directives, that known doesn't have, in the order they
+// appear.  MermaidJS ignores them, so a diagram pasted from a
+// newer MermaidJS's live editor renders differently here with no
+// error.  With strip, it also returns mmdSource without them.
+//
+// Front matter is only read as far as a YAML mapping goes, and a
+// directive has to be JSON once its single quotes are double, as
+// MermaidJS has it; settings it can't read aren't flagged.
+func checkDocConfig(mmdSource string, known map[string]any, strip bool) (unknown []string, stripped string) {
+	stripped = mmdSource
+	if fm := frontMatter(mmdSource); fm != "" {
+		lines := strings.Split(fm, "\n")
+		drop := make(map[int]bool)
+		for _, n := range parseYAMLTree(lines) {
+			if n.key != "config" {
+				continue
+			}
+			unknownYAMLNodes(n.children, known, "", func(name string, n *yamlNode) {
+				if !slices.Contains(unknown, name) {
+					unknown = append(unknown, name)
+				}
+				for i := n.first; i <= n.last; i++ {
+					drop[i] = true
+				}
+			})
+		}
+		if strip && len(drop) > 0 {
+			var kept []string
+			for i, line := range lines {
+				if !drop[i] {
+					kept = append(kept, line)
+				}
+			}
+			stripped = strings.Replace(stripped, fm, strings.Join(kept, "\n"), 1)
+		}
+	}
+
+	stripped = initDirectiveRE.ReplaceAllStringFunc(stripped, func(directive string) string {
+		body := initDirectiveRE.FindStringSubmatch(directive)[1]
+		var config map[string]any
+		if err := json.Unmarshal([]byte(strings.ReplaceAll(body, "'", `"`)), &config); err != nil {
+			return directive // MermaidJS will say what's wrong
+		}
+		var names []string
+		unknownConfigKeys(config, known, "", func(name string) {
+			names = append(names, name)
+			if !slices.Contains(unknown, name) {
+				unknown = append(unknown, name)
+			}
+		})
+		if !strip || len(names) == 0 {
+			return directive
+		}
+		for _, name := range names {
+			deleteConfigKey(config, strings.Split(name, "."))
+		}
+		if len(config) == 0 {
+			return ""
+		}
+		b, err := json.Marshal(config)
+		if err != nil {
+			return directive
+		}
+		return fmt.Sprintf("%%%%{init: %s}%%%%", b)
+	})
+	return unknown, stripped
+}
+
+// deleteConfigKey deletes the setting at path from config.
+func deleteConfigKey(config map[string]any, path []string) {
+	if len(path) == 1 {
+		delete(config, path[0])
+		return
+	}
+	if sub, ok := config[path[0]].(map[string]any); ok {
+		deleteConfigKey(sub, path[1:])
+	}
+}
+
+// yamlNode is a key of a YAML mapping, as parseYAMLTree reads it.
+type yamlNode struct {
+	key      string
+	value    string      // as written, or "" for a mapping
+	children []*yamlNode // for a mapping, or nil for a scalar
+
+	// first and last are the lines the key and its value span.
+	first, last int
+	indent      int
+}
+
+// parseYAMLTree reads lines of a YAML mapping, nested by
+// indentation, into a tree of its keys.  It's only as much YAML as
+// checkDocConfig needs: a line that isn't a key, say a list item,
+// counts toward the span of the key it's under, but nothing more.
+func parseYAMLTree(lines []string) []*yamlNode {
+	var (
+		roots []*yamlNode
+		stack []*yamlNode // the open keys, outermost first
+	)
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		for _, open := range stack {
+			open.last = i
+		}
+		key, value, ok := cutYAMLKey(trimmed)
+		if !ok || strings.HasPrefix(trimmed, "- ") {
+			continue
+		}
+		n := &yamlNode{key: key, value: value, first: i, last: i, indent: indent}
+		if len(stack) == 0 {
+			roots = append(roots, n)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, n)
+		}
+		stack = append(stack, n)
+	}
+	return roots
+}
+
+// unknownYAMLNodes is unknownConfigKeys for the keys of a YAML
+// mapping read by parseYAMLTree, calling f with each node too.
+func unknownYAMLNodes(nodes []*yamlNode, known map[string]any, prefix string, f func(name string, n *yamlNode)) {
+	for _, n := range nodes {
+		name := prefix + n.key
+		if prefix == "" && openConfig[n.key] {
+			continue
+		}
+		kv, ok := known[n.key]
+		if !ok {
+			f(name, n)
+			continue
+		}
+		if knownSub, ok := kv.(map[string]any); ok && len(knownSub) > 0 && len(n.children) > 0 {
+			unknownYAMLNodes(n.children, knownSub, name+".", f)
+		}
+	}
+}
+
+// cliConfig is the config from -c and -gitgraph, as
+// rendererOptionsFromFlags loads it, for forcedConfig.
+var cliConfig map[string]any
+
+// forcedConfig returns the settings the cli's own flags set, which
+// -force-config keeps documents and defaults files from
+// overriding: cliConfig's, themeCSS with -css, fontFamily with
+// -font, and theme with -theme.  Only their names matter, and
+// whether they're sections.
+func forcedConfig() map[string]any {
+	forced := make(map[string]any)
+	renderer.MergeConfig(forced, cliConfig)
+	if *cssFlag != "" {
+		forced["themeCSS"] = *cssFlag
+	}
+	if *fontFlag != "" {
+		forced["fontFamily"] = *fontFlag
+	}
+	if *themeFlag != "" {
+		forced["theme"] = *themeFlag
+	}
+	return forced
+}
+
+// forceDocConfig returns the dotted names of the settings in
+// forced that the document mmdSource overrides, in its front
+// matter config or its init directives, in the order they appear,
+// and mmdSource without them, for -force-config.  Lines dropped
+// from front matter are left empty, so parse errors keep their
+// line numbers, and a section left empty is dropped too.  It reads
+// front matter and directives as checkDocConfig does.
+func forceDocConfig(mmdSource string, forced map[string]any) (overridden []string, out string) {
+	out = mmdSource
+	add := func(name string) {
+		if !slices.Contains(overridden, name) {
+			overridden = append(overridden, name)
+		}
+	}
+	if fm := frontMatter(mmdSource); fm != "" {
+		lines := strings.Split(fm, "\n")
+		drop := make(map[int]bool)
+		for _, n := range parseYAMLTree(lines) {
+			if n.key != "config" {
+				continue
+			}
+			if forcedYAMLNodes(n.children, forced, "", add, drop) && len(n.children) > 0 {
+				for i := n.first; i <= n.last; i++ {
+					drop[i] = true
+				}
+			}
+		}
+		if len(drop) > 0 {
+			for i := range lines {
+				if drop[i] {
+					lines[i] = ""
+				}
+			}
+			out = strings.Replace(out, fm, strings.Join(lines, "\n"), 1)
+		}
+	}
+
+	out = initDirectiveRE.ReplaceAllStringFunc(out, func(directive string) string {
+		body := initDirectiveRE.FindStringSubmatch(directive)[1]
+		var config map[string]any
+		if err := json.Unmarshal([]byte(strings.ReplaceAll(body, "'", `"`)), &config); err != nil {
+			return directive // MermaidJS will say what's wrong
+		}
+		var names []string
+		kept := withoutConfig(config, forced, "", func(name string) {
+			names = append(names, name)
+			add(name)
+		})
+		if len(names) == 0 {
+			return directive
+		}
+		if len(kept) == 0 {
+			return ""
+		}
+		b, err := json.Marshal(kept)
+		if err != nil {
+			return directive
+		}
+		return fmt.Sprintf("%%%%{init: %s}%%%%", b)
+	})
+	return overridden, out
+}
+
+// withoutConfig returns a copy of config without the settings in
+// drop, calling f with the dotted name, under prefix, of each one
+// it leaves out.  A section both have is gone through in turn,
+// and left out if nothing's left of it.
+func withoutConfig(config, drop map[string]any, prefix string, f func(name string)) map[string]any {
+	kept := make(map[string]any, len(config))
+	for _, k := range sortedKeys(config) {
+		dv, ok := drop[k]
+		if !ok {
+			kept[k] = config[k]
+			continue
+		}
+		sub, subOK := config[k].(map[string]any)
+		dropSub, dropOK := dv.(map[string]any)
+		if subOK && dropOK {
+			if rest := withoutConfig(sub, dropSub, prefix+k+".", f); len(rest) > 0 {
+				kept[k] = rest
+			}
+			continue
+		}
+		f(prefix + k)
+	}
+	return kept
+}
+
+// forcedYAMLNodes is withoutConfig for the keys of a YAML mapping
+// read by parseYAMLTree, marking the lines of each one left out in
+// drop.  It reports whether every key was left out.
+func forcedYAMLNodes(nodes []*yamlNode, forced map[string]any, prefix string, f func(name string), drop map[int]bool) bool {
+	all := true
+	for _, n := range nodes {
+		fv, ok := forced[n.key]
+		if !ok {
+			all = false
+			continue
+		}
+		if sub, ok := fv.(map[string]any); ok && len(n.children) > 0 {
+			if !forcedYAMLNodes(n.children, sub, prefix+n.key+".", f, drop) {
+				all = false
+				continue
+			}
+		} else {
+			f(prefix + n.key)
+		}
+		for i := n.first; i <= n.last; i++ {
+			drop[i] = true
+		}
+	}
+	return all
+}
+
+// pinnedTheme returns the theme the document mmdName, with source
+// mmdSource, renders with whatever -theme says, or "" if -theme's
+// is the one it gets: the last init directive's, or else its front
+// matter config's, or else its -theme-map entry's, or else its
+// defaults files'.  With -force-config and -theme, only its
+// -theme-map entry's counts.
+func pinnedTheme(mmdName, mmdSource string) string {
+	forced := *forceConfigFlag && *themeFlag != ""
+	if forced {
+		mmdSource = ""
+	}
+	var theme string
+	for _, m := range initDirectiveRE.FindAllStringSubmatch(mmdSource, -1) {
+		var config map[string]any
+		if json.Unmarshal([]byte(strings.ReplaceAll(m[1], "'", `"`)), &config) == nil {
+			if t, ok := config["theme"].(string); ok {
+				theme = t
+			}
+		}
+	}
+	if theme != "" {
+		return theme
+	}
+	for _, n := range parseYAMLTree(strings.Split(frontMatter(mmdSource), "\n")) {
+		if n.key != "config" {
+			continue
+		}
+		for _, c := range n.children {
+			if c.key == "theme" {
+				if t, ok := yamlScalar(c.value).(string); ok && t != "" {
+					theme = t
+				}
+			}
+		}
+	}
+	if theme != "" {
+		return theme
+	}
+	if e := matchThemeMap(themeMap, mmdName); e != nil {
+		if t, ok := e.config["theme"].(string); ok {
+			return t
+		}
+	}
+	if forced {
+		return ""
+	}
+	if defaults, _, err := dirDefaults(mmdName); err == nil {
+		if t, ok := defaults["theme"].(string); ok {
+			return t
+		}
+	}
+	return ""
+}
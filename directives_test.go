@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestForceDocConfig(t *testing.T) {
+	forced := map[string]any{
+		"theme":     "forest",
+		"flowchart": map[string]any{"curve": "step"},
+	}
+	for _, tc := range []struct {
+		name       string
+		src        string
+		overridden []string
+		want       string
+	}{
+		{
+			name:       "init directive",
+			src:        "%%{init: {'theme':'dark'}}%%\nflowchart LR\n    A --> B\n",
+			overridden: []string{"theme"},
+			want:       "\nflowchart LR\n    A --> B\n",
+		},
+		{
+			name:       "init directive keeps the rest",
+			src:        "%%{init: {'theme':'dark', 'fontFamily':'Mono', 'flowchart':{'curve':'basis', 'padding':5}}}%%\nflowchart LR\n",
+			overridden: []string{"flowchart.curve", "theme"},
+			want:       `%%{init: {"flowchart":{"padding":5},"fontFamily":"Mono"}}%%` + "\nflowchart LR\n",
+		},
+		{
+			name:       "front matter",
+			src:        "---\ntitle: T\nconfig:\n  theme: dark\n  flowchart:\n    curve: basis\n---\nflowchart LR\n",
+			overridden: []string{"theme", "flowchart.curve"},
+			want:       "---\ntitle: T\n\n\n\n\n---\nflowchart LR\n",
+		},
+		{
+			name:       "front matter keeps the rest",
+			src:        "---\nconfig:\n  theme: dark\n  look: handDrawn\n  flowchart:\n    curve: basis\n    padding: 5\n---\nflowchart LR\n",
+			overridden: []string{"theme", "flowchart.curve"},
+			want:       "---\nconfig:\n\n  look: handDrawn\n  flowchart:\n\n    padding: 5\n---\nflowchart LR\n",
+		},
+		{
+			name: "nothing forced",
+			src:  "%%{init: {'fontFamily':'Mono'}}%%\nflowchart LR\n",
+			want: "%%{init: {'fontFamily':'Mono'}}%%\nflowchart LR\n",
+		},
+		{
+			name: "bad directive",
+			src:  "%%{init: {'theme':}}%%\nflowchart LR\n",
+			want: "%%{init: {'theme':}}%%\nflowchart LR\n",
+		},
+	} {
+		overridden, got := forceDocConfig(tc.src, forced)
+		if !slices.Equal(overridden, tc.overridden) {
+			t.Errorf("%s: overridden %q, want %q", tc.name, overridden, tc.overridden)
+		}
+		if got != tc.want {
+			t.Errorf("%s: got\n%q\nwant\n%q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestForcedConfig(t *testing.T) {
+	old := cliConfig
+	t.Cleanup(func() { cliConfig = old })
+	cliConfig = map[string]any{"flowchart": map[string]any{"curve": "step"}}
+	setFlag(t, "theme", "forest")
+	setFlag(t, "font", "Serif")
+
+	b, err := json.Marshal(forcedConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"flowchart":{"curve":"step"},"fontFamily":"Serif","theme":"forest"}`; string(b) != want {
+		t.Errorf("forcedConfig() = %s, want %s", b, want)
+	}
+}
+
+// TestPinnedThemeForced checks a document's own theme pins it,
+// unless -force-config and -theme are both set.
+func TestPinnedThemeForced(t *testing.T) {
+	chdirTemp(t, nil)
+	const src = "%%{init: {'theme':'dark'}}%%\nflowchart LR\n"
+	setFlag(t, "theme", "forest")
+	if got := pinnedTheme("doc.mmd", src); got != "dark" {
+		t.Errorf("without -force-config, pinned theme = %q, want dark", got)
+	}
+	setFlag(t, "force-config", "true")
+	if got := pinnedTheme("doc.mmd", src); got != "" {
+		t.Errorf("with -force-config, pinned theme = %q, want none", got)
+	}
+}
+
+// TestForceConfigThemes renders the effective config of documents
+// whose themes conflict with -theme and -c, with and without
+// -force-config.
+func TestForceConfigThemes(t *testing.T) {
+	startTestRenderer(t) // only to skip without Chrome
+	chdirTemp(t, map[string]string{
+		"brand.json":  `{"flowchart": {"curve": "step"}}`,
+		"init.mmd":    "%%{init: {'theme':'dark', 'flowchart':{'curve':'basis'}}}%%\nflowchart LR\n    A --> B\n",
+		"front.mmd":   "---\nconfig:\n  theme: neutral\n  flowchart:\n    curve: linear\n---\nflowchart LR\n    A --> B\n",
+		"neither.mmd": "flowchart LR\n    A --> B\n",
+	})
+	for _, tc := range []struct {
+		name         string
+		force        bool
+		theme, curve string
+	}{
+		{"init.mmd", false, "dark", "basis"},
+		{"front.mmd", false, "neutral", "linear"},
+		{"neither.mmd", false, "forest", "step"},
+		{"init.mmd", true, "forest", "step"},
+		{"front.mmd", true, "forest", "step"},
+		{"neither.mmd", true, "forest", "step"},
+	} {
+		args := []string{"-theme", "forest", "-c", "brand.json", "-show-effective-config", tc.name}
+		if tc.force {
+			args = append([]string{"-force-config"}, args...)
+		}
+		stdout, stderr, status := runMain(t, nil, args...)
+		if status != 0 {
+			t.Fatalf("%s exited %d: %s", strings.Join(args, " "), status, stderr)
+		}
+		var config struct {
+			Theme     string
+			Flowchart struct{ Curve string }
+		}
+		if err := json.Unmarshal([]byte(stdout), &config); err != nil {
+			t.Fatal(err)
+		}
+		if config.Theme != tc.theme || config.Flowchart.Curve != tc.curve {
+			t.Errorf("%s: theme %q, curve %q; want %q, %q", strings.Join(args, " "), config.Theme, config.Flowchart.Curve, tc.theme, tc.curve)
+		}
+	}
+}
+
+// TestConfigPrecedence prints the effective config of each of the
+// documents in testdata/config, with and without -theme and -c, and
+// checks each level wins over the ones below it: a document's init
+// directive, its front matter config, -theme, the -c file, and
+// MermaidJS's defaults.
+func TestConfigPrecedence(t *testing.T) {
+	startTestRenderer(t) // only to skip without Chrome
+	files := map[string]string{
+		"brand.json": `{"theme": "base", "flowchart": {"curve": "step"}}`,
+	}
+	for _, name := range []string{"none.mmd", "frontmatter.mmd", "directive.mmd", "both.mmd"} {
+		b, err := os.ReadFile(filepath.Join("testdata", "config", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = string(b)
+	}
+	chdirTemp(t, files)
+
+	for _, tc := range []struct {
+		name         string
+		flags        []string
+		theme, curve string
+	}{
+		{"none.mmd", nil, "default", "basis"},
+		{"none.mmd", []string{"-c", "brand.json"}, "base", "step"},
+		{"none.mmd", []string{"-c", "brand.json", "-theme", "neutral"}, "neutral", "step"},
+		{"frontmatter.mmd", []string{"-c", "brand.json", "-theme", "neutral"}, "forest", "step"},
+		{"directive.mmd", []string{"-c", "brand.json", "-theme", "neutral"}, "dark", "step"},
+		{"both.mmd", nil, "dark", "linear"},
+		{"both.mmd", []string{"-c", "brand.json", "-theme", "neutral"}, "dark", "linear"},
+	} {
+		args := append(append([]string{}, tc.flags...), "-show-effective-config", tc.name)
+		stdout, stderr, status := runMain(t, nil, args...)
+		if status != 0 {
+			t.Fatalf("%s exited %d: %s", strings.Join(args, " "), status, stderr)
+		}
+		var config struct {
+			Theme     string
+			Flowchart struct{ Curve string }
+		}
+		if err := json.Unmarshal([]byte(stdout), &config); err != nil {
+			t.Fatal(err)
+		}
+		if config.Theme != tc.theme || config.Flowchart.Curve != tc.curve {
+			t.Errorf("%s: theme %q, curve %q; want %q, %q", strings.Join(args, " "), config.Theme, config.Flowchart.Curve, tc.theme, tc.curve)
+		}
+	}
+}
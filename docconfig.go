@@ -0,0 +1,73 @@
+package main
+
+import "github.com/zacharysyoung/mermaid-cli/renderer"
+
+// applyDocConfig initializes MermaidJS in r with the config for
+// pair's document, with source mmdSource, on top of r's own,
+// unless it already is: the -chart-width and
+// -chart-height sizes for its chart type (see chartConfig), the
+// settings of the defaults files above it (see dirDefaults) over
+// those, its -theme-map settings over those, and its -manifest
+// entry's theme and config over those.  All sit under
+// the document's own front matter and directives, which override
+// them as they do the cli's.  With -force-config, the defaults
+// files' settings that the cli's flags set are left out.
+func applyDocConfig(r *renderer.Renderer, pair renderPair, mmdSource string) error {
+	mmdName := pair.mmdName
+	config := chartConfig(r, mmdSource)
+	defaults, _, err := dirDefaults(mmdName)
+	if err != nil {
+		return err
+	}
+	if *forceConfigFlag {
+		defaults = withoutConfig(defaults, forcedConfig(), "", func(string) {})
+	}
+	renderer.MergeConfig(config, defaults)
+	if e := matchThemeMap(themeMap, mmdName); e != nil {
+		for k, v := range e.config {
+			config[k] = v
+		}
+	}
+	renderer.MergeConfig(config, manifestConfig(pair))
+	return r.Configure(runCtx, config)
+}
+
+// chartConfig returns the config section that sizes the chart in
+// mmdSource, detected with r, per -chart-width and -chart-height, if it's a chart
+// MermaidJS sizes by config: pie (only its width), quadrantChart,
+// or xychart.  Other diagrams get no config, and don't need their
+// type detected unless a size is set.
+func chartConfig(r *renderer.Renderer, mmdSource string) map[string]any {
+	config := make(map[string]any)
+	w, h := *chartWidthFlag, *chartHeightFlag
+	if w <= 0 && h <= 0 {
+		return config
+	}
+	diagramType, err := r.DetectType(runCtx, mmdSource)
+	if err != nil {
+		return config // rendering it will say what's wrong
+	}
+
+	var name, width, height string
+	switch diagramType {
+	case "pie":
+		name, width = "pie", "useWidth"
+	case "quadrantChart":
+		name, width, height = "quadrantChart", "chartWidth", "chartHeight"
+	case "xychart":
+		name, width, height = "xyChart", "width", "height"
+	default:
+		return config
+	}
+	section := make(map[string]any)
+	if w > 0 {
+		section[width] = w
+	}
+	if h > 0 && height != "" {
+		section[height] = h
+	}
+	if len(section) > 0 {
+		config[name] = section
+	}
+	return config
+}
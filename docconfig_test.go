@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chartFixtures are the documents in testdata/charts, and the
+// config section each gets with -chart-width=800 and
+// -chart-height=600.
+var chartFixtures = []struct {
+	name, section string
+}{
+	{"pie.mmd", `{"pie":{"useWidth":800}}`},
+	{"quadrant.mmd", `{"quadrantChart":{"chartHeight":600,"chartWidth":800}}`},
+	{"xychart.mmd", `{"xyChart":{"height":600,"width":800}}`},
+}
+
+// TestChartConfigUnset checks no chart type is detected, so no
+// renderer is needed, without -chart-width or -chart-height.
+func TestChartConfigUnset(t *testing.T) {
+	if config := chartConfig(nil, "pie\n    \"A\" : 1\n"); len(config) != 0 {
+		t.Errorf("chartConfig without sizes = %v, want nothing", config)
+	}
+}
+
+func TestChartConfig(t *testing.T) {
+	startTestRenderer(t)
+	setFlag(t, "chart-width", "800")
+	setFlag(t, "chart-height", "600")
+	for _, fx := range chartFixtures {
+		b, err := os.ReadFile(filepath.Join("testdata", "charts", fx.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(chartConfig(mainRenderer, string(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != fx.section {
+			t.Errorf("%s: chartConfig = %s, want %s", fx.name, got, fx.section)
+		}
+	}
+	b, err := os.ReadFile(filepath.Join("testdata", "flow.mmd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config := chartConfig(mainRenderer, string(b)); len(config) != 0 {
+		t.Errorf("flow.mmd: chartConfig = %v, want nothing", config)
+	}
+}
+
+// TestChartSizes renders the chart fixtures with -chart-width and
+// -chart-height, and checks the SVGs' sizes.
+func TestChartSizes(t *testing.T) {
+	startTestRenderer(t) // only to skip without Chrome
+	files := make(map[string]string)
+	var args []string
+	for _, fx := range chartFixtures {
+		b, err := os.ReadFile(filepath.Join("testdata", "charts", fx.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[fx.name] = string(b)
+		args = append(args, fx.name)
+	}
+	chdirTemp(t, files)
+
+	viewBoxes := func(out string, sizes ...string) map[string]string {
+		a := append(append([]string{"-o", out}, sizes...), args...)
+		if _, stderr, status := runMain(t, nil, a...); status != 0 {
+			t.Fatalf("%s exited %d: %s", strings.Join(a, " "), status, stderr)
+		}
+		boxes := make(map[string]string)
+		for _, name := range args {
+			b, err := os.ReadFile(filepath.Join(out, strings.TrimSuffix(name, mmd)+svg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m := viewBoxAttrRE.FindStringSubmatch(string(b)); m != nil {
+				boxes[name] = m[1]
+			}
+		}
+		return boxes
+	}
+	unsized := viewBoxes("unsized")
+	sized := viewBoxes("sized", "-chart-width", "800", "-chart-height", "600")
+
+	for _, name := range []string{"quadrant.mmd", "xychart.mmd"} {
+		if want := "0 0 800 600"; sized[name] != want {
+			t.Errorf("%s has viewBox %q, want %q", name, sized[name], want)
+		}
+	}
+	// A pie chart's width also leaves room for its legend, so it
+	// only has to change.
+	if sized["pie.mmd"] == unsized["pie.mmd"] {
+		t.Errorf("pie.mmd has viewBox %q with and without -chart-width", sized["pie.mmd"])
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+)
+
+// errSidecarName returns the name of the -err-sidecars file for
+// the document of pair: file.mmd.err.txt, or for the second block
+// of a Markdown file, file.md.2.err.txt.
+func errSidecarName(pair renderPair) string {
+	if pair.block > 0 {
+		return fmt.Sprintf("%s.%d.err.txt", pair.mmdName, pair.block)
+	}
+	return pair.mmdName + ".err.txt"
+}
+
+// writeErrSidecar writes the failure of the document of d, with
+// everything needed to look into it away from the machine it
+// failed on: the error, the exception's message and stack and
+// any parser details, the config it rendered with, and the
+// versions of mermaid-cli, MermaidJS, and the browser.
+func writeErrSidecar(d *renderDoc) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "mermaid-cli couldn't render %s\n\n", d.pair.docName())
+	fmt.Fprintf(&b, "error: %v\n", d.err)
+
+	if e := d.errDetails; e != nil {
+		fmt.Fprintf(&b, "\nexception: %s\n", e.Message)
+		if e.Stack != "" {
+			fmt.Fprintf(&b, "\nstack:\n%s\n", e.Stack)
+		}
+		if e.Hash != nil {
+			hash, _ := json.MarshalIndent(e.Hash, "", "  ")
+			fmt.Fprintf(&b, "\nparser details:\n%s\n", hash)
+		}
+		if e.Config != nil {
+			config, _ := json.MarshalIndent(e.Config, "", "  ")
+			fmt.Fprintf(&b, "\neffective config:\n%s\n", config)
+		}
+	}
+
+	product, err := mainRenderer.BrowserVersion(runCtx)
+	if err != nil {
+		product = "unknown"
+	}
+	fmt.Fprintf(&b, "\nversions:\nmermaid-cli %s\nMermaidJS %s (%s)\nbrowser %s\n",
+		version, mainRenderer.Version(), bundleName(), product)
+
+	return writeFileAtomic(errSidecarName(d.pair), []byte(b.String()), 0644)
+}
+
+// removeErrSidecar removes the -err-sidecars file of the document
+// of pair, if there is one, once it renders, so a stale error
+// doesn't linger.
+func removeErrSidecar(pair renderPair) {
+	if pair.mmdName == stdioName {
+		return
+	}
+	name := errSidecarName(pair)
+	switch err := os.Remove(name); {
+	case err == nil:
+		log.Println("removed", name)
+	case !errors.Is(err, fs.ErrNotExist):
+		errorf("couldn't remove %s: %v", name, err)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// fileList is the value of a flag that can be repeated to name
+// more files, like -extra-js, in the order they're given.
+type fileList []string
+
+func (l *fileList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *fileList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// extraJSOptions reads the -extra-js files into WithExtraJS
+// options, in order.
+//
+// It prints and exits for any error.
+func extraJSOptions() []renderer.Option {
+	var opts []renderer.Option
+	for _, name := range extraJSFlag {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			fatalf("couldn't read extra JavaScript: %v", err)
+		}
+		opts = append(opts, renderer.WithExtraJS(name, b))
+	}
+	return opts
+}
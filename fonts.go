@@ -0,0 +1,27 @@
+package main
+
+import "unicode"
+
+// containsCJK reports whether s has any Chinese, Japanese, or
+// Korean characters.
+func containsCJK(s string) bool {
+	for _, c := range s {
+		if unicode.In(c, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsEmoji reports whether s has any codepoints from the
+// Unicode blocks that are drawn with an emoji font.
+func containsEmoji(s string) bool {
+	for _, c := range s {
+		switch {
+		case c >= 0x1F000 && c <= 0x1FAFF, // pictographs, emoticons, transport, flags, ...
+			c >= 0x2600 && c <= 0x27BF: // miscellaneous symbols, dingbats
+			return true
+		}
+	}
+	return false
+}
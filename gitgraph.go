@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gitGraphKeys are the gitGraph settings -gitgraph accepts, and
+// their JSON types.
+var gitGraphKeys = map[string]string{
+	"diagramPadding":    "number",
+	"mainBranchName":    "string",
+	"mainBranchOrder":   "number",
+	"parallelCommits":   "boolean",
+	"rotateCommitLabel": "boolean",
+	"showBranches":      "boolean",
+	"showCommitLabel":   "boolean",
+	"titleTopMargin":    "number",
+	"useMaxWidth":       "boolean",
+}
+
+// gitGraphConfig is the gitGraph section of the initialize config
+// that the repeatable -gitgraph key=value flag builds up.
+type gitGraphConfig map[string]any
+
+func (c *gitGraphConfig) String() string {
+	if c == nil || len(*c) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(*c))
+	for k := range *c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = fmt.Sprintf("%s=%v", k, (*c)[k])
+	}
+	return strings.Join(keys, ",")
+}
+
+func (c *gitGraphConfig) Set(s string) error {
+	key, val, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("got %q; expected key=value", s)
+	}
+	typ, ok := gitGraphKeys[key]
+	if !ok {
+		known := make([]string, 0, len(gitGraphKeys))
+		for k := range gitGraphKeys {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return fmt.Errorf("unknown gitGraph setting %s; expected one of %s", key, strings.Join(known, ", "))
+	}
+
+	var v any
+	switch typ {
+	case "boolean":
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("got %s=%s; expected true or false", key, val)
+		}
+		v = b
+	case "number":
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("got %s=%s; expected a number", key, val)
+		}
+		v = f
+	default:
+		v = val
+	}
+	if *c == nil {
+		*c = make(gitGraphConfig)
+	}
+	(*c)[key] = v
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGitGraphConfigSet(t *testing.T) {
+	var c gitGraphConfig
+	for _, s := range []string{"mainBranchName=trunk", "showCommitLabel=false", "rotateCommitLabel=true", "parallelCommits=1", "mainBranchOrder=2", "diagramPadding=8.5"} {
+		if err := c.Set(s); err != nil {
+			t.Fatalf("Set(%q): %v", s, err)
+		}
+	}
+	want := "diagramPadding=8.5,mainBranchName=trunk,mainBranchOrder=2,parallelCommits=true,rotateCommitLabel=true,showCommitLabel=false"
+	if got := c.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	for _, tc := range []struct{ s, want string }{
+		{"mainBranchName", "expected key=value"},
+		{"mainBranch=trunk", "unknown gitGraph setting mainBranch"},
+		{"showCommitLabel=yes", "expected true or false"},
+		{"mainBranchOrder=first", "expected a number"},
+	} {
+		if err := c.Set(tc.s); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Set(%q) = %v, want an error with %q", tc.s, err, tc.want)
+		}
+	}
+}
+
+// svgTexts returns the text of each text element in svg.
+func svgTexts(t *testing.T, svg string) []string {
+	t.Helper()
+	var texts []string
+	var text strings.Builder
+	depth := 0
+	d := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return texts
+		}
+		if err != nil {
+			t.Fatalf("SVG doesn't parse: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if depth > 0 || tok.Name.Local == "text" {
+				depth++
+			}
+		case xml.EndElement:
+			if depth > 0 {
+				depth--
+				if depth == 0 {
+					texts = append(texts, strings.TrimSpace(text.String()))
+					text.Reset()
+				}
+			}
+		case xml.CharData:
+			if depth > 0 {
+				text.Write(tok)
+			}
+		}
+	}
+}
+
+// TestGitGraphMainBranchName renders testdata/gitgraph/release.mmd,
+// which checks out trunk, with -gitgraph mainBranchName=trunk, and
+// checks trunk labels a branch.  It doesn't render without it.
+func TestGitGraphMainBranchName(t *testing.T) {
+	startTestRenderer(t) // only to skip without Chrome
+	b, err := os.ReadFile(filepath.Join("testdata", "gitgraph", "release.mmd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chdirTemp(t, map[string]string{"release.mmd": string(b)})
+
+	if _, _, status := runMain(t, nil, "release.mmd"); status == 0 {
+		t.Error("release.mmd rendered without -gitgraph mainBranchName=trunk")
+	}
+	if _, stderr, status := runMain(t, nil, "-gitgraph", "mainBranchName=trunk", "-gitgraph", "rotateCommitLabel=false", "release.mmd"); status != 0 {
+		t.Fatalf("exited %d: %s", status, stderr)
+	}
+	svg, err := os.ReadFile("release.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := svgTexts(t, string(svg))
+	for _, want := range []string{"trunk", "release", "v1.1.0"} {
+		if !slices.Contains(texts, want) {
+			t.Errorf("release.svg has no text %q in %q", want, texts)
+		}
+	}
+	if slices.Contains(texts, "main") {
+		t.Error("release.svg still has a main branch")
+	}
+}
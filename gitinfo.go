@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sourceInfo is what templates can know about a document's file
+// beyond its name: its last commit, whether it has uncommitted
+// changes, and when it was modified.
+type sourceInfo struct {
+	revision string
+	dirty    bool
+	modTime  time.Time
+
+	// gitErr is why the file has no revision, e.g., it isn't in a
+	// git repository, for -strict-template.
+	gitErr error
+}
+
+// sourceInfos caches lookupSourceInfo's results, so each file is
+// asked of git once per run however many pages use it.
+var sourceInfos = struct {
+	sync.Mutex
+	m map[string]*sourceInfo
+}{m: make(map[string]*sourceInfo)}
+
+// lookupSourceInfo returns the sourceInfo for the file name, looking
+// it up the first time it's asked for.
+func lookupSourceInfo(name string) *sourceInfo {
+	sourceInfos.Lock()
+	defer sourceInfos.Unlock()
+	if info, ok := sourceInfos.m[name]; ok {
+		return info
+	}
+	info := new(sourceInfo)
+	sourceInfos.m[name] = info
+	if name == stdioName {
+		info.gitErr = fmt.Errorf("standard input isn't in git")
+		return info
+	}
+	if fi, err := os.Stat(name); err == nil {
+		info.modTime = fi.ModTime()
+	}
+
+	// Run git from the file's directory, so a document in another
+	// repository (say, a submodule) gets that repository's commit.
+	dir, base := filepath.Split(name)
+	out, err := gitIn(dir, "log", "-1", "--format=%h", "--", base)
+	if err != nil {
+		info.gitErr = err
+		return info
+	}
+	info.revision = strings.TrimSpace(string(out))
+	if info.revision == "" {
+		info.gitErr = fmt.Errorf("%s has no commits", name)
+	}
+	out, err = gitIn(dir, "status", "--porcelain", "--", base)
+	if err != nil {
+		info.gitErr = err
+		return info
+	}
+	info.dirty = len(strings.TrimSpace(string(out))) > 0
+	return info
+}
+
+// GitRevision is the short hash of the last commit of the document's
+// file, or empty if it isn't in git.  With -strict-template, a page
+// that uses it for a file that isn't fails instead.
+func (p htmlPage) GitRevision() (string, error) {
+	info := lookupSourceInfo(p.SourcePath)
+	if info.gitErr != nil && *strictTemplateFlag {
+		return "", fmt.Errorf("no git revision: %w", info.gitErr)
+	}
+	return info.revision, nil
+}
+
+// GitDirty reports whether the document's file has changes that
+// aren't committed.  Like GitRevision, it's false for a file that
+// isn't in git, or an error with -strict-template.
+func (p htmlPage) GitDirty() (bool, error) {
+	info := lookupSourceInfo(p.SourcePath)
+	if info.gitErr != nil && *strictTemplateFlag {
+		return false, fmt.Errorf("no git status: %w", info.gitErr)
+	}
+	return info.dirty, nil
+}
+
+// SourceModTime is when the document's file was last modified, or
+// the zero time for standard input.
+func (p htmlPage) SourceModTime() time.Time {
+	return lookupSourceInfo(p.SourcePath).modTime
+}
@@ -5,6 +5,7 @@ go 1.22.4
 require (
 	github.com/chromedp/cdproto v0.0.0-20240614221651-cc28c8fb63e7
 	github.com/chromedp/chromedp v0.9.5
+	github.com/fsnotify/fsnotify v1.7.0
 )
 
 require (
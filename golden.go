@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// checkGolden renders each pair's document as renderAll does, with
+// its per-document config, and compares it, with
+// mermaidtest.DiffSVG, against its golden file in dir (see
+// goldenNames), printing a diff to Stdout for each one that
+// doesn't match.  With update, it writes the result, normalized
+// with mermaidtest.NormalizeSVG, to the golden file instead.
+//
+// Nothing is written to the pairs' SVGs.  It reports whether
+// every document rendered and matched its golden file.
+func checkGolden(pairs []renderPair, dir string, update bool) (ok bool) {
+	names, err := goldenNames(pairs, dir)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	return renderAllWith(pairs, (*renderDoc).render, func(d *renderDoc) error {
+		return finishGolden(d, names[d.pair], update)
+	}) == 0
+}
+
+// goldenNames returns the golden file in dir of each of pairs: the
+// one with its SVG's name, in the directory under dir that mirrors
+// its input's, e.g., golden/docs/flow.svg for docs/flow.mmd.  An
+// input outside the current directory has its golden file in dir
+// itself.
+//
+// It returns an error for two pairs with the same golden file,
+// rather than have them overwrite each other's.
+func goldenNames(pairs []renderPair, dir string) (map[renderPair]string, error) {
+	names := make(map[renderPair]string, len(pairs))
+	seen := make(map[string]renderPair, len(pairs))
+	for _, pair := range pairs {
+		sub := filepath.Dir(pair.mmdName)
+		if !filepath.IsLocal(sub) {
+			sub = "."
+		}
+		name := filepath.Join(dir, sub, filepath.Base(pair.svgName))
+		if first, ok := seen[name]; ok {
+			return nil, fmt.Errorf("%s and %s would both be compared against golden file %s", first.docName(), pair.docName(), name)
+		}
+		seen[name] = pair
+		names[pair] = name
+	}
+	return names, nil
+}
+
+// finishGolden compares d's SVG against goldenName, or with update
+// writes it there, and prints the outcome, for checkGolden.
+func finishGolden(d *renderDoc, goldenName string, update bool) error {
+	pair := d.pair
+	fail := func(err error, format string, args ...any) error {
+		recordRender(pair, d.start, renderer.RenderResult{}, err)
+		fileErrorf(pair.mmdName, err, format, args...)
+		return err
+	}
+	if d.readErr != nil {
+		return fail(d.readErr, "couldn't read MMD: %v", d.readErr)
+	}
+	if d.err != nil {
+		return fail(d.err, "couldn't render %s: %v", pair.docName(), d.err)
+	}
+	svgResult := d.result.SVG
+
+	if update {
+		got := mermaidtest.NormalizeSVG(svgResult)
+		if err := os.MkdirAll(filepath.Dir(goldenName), 0755); err != nil {
+			fatalf("couldn't write golden file: %v", err)
+		}
+		if err := writeFileAtomic(goldenName, []byte(got), 0644); err != nil {
+			fatalf("couldn't write golden file: %v", err)
+		}
+		recordRender(pair, d.start, d.result, nil)
+		log.Println("updated", goldenName)
+		return nil
+	}
+
+	want, err := os.ReadFile(goldenName)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fail(fmt.Errorf("no golden file %s", goldenName),
+			"%s has no golden file %s; run with -update-golden to create it", pair.docName(), goldenName)
+	case err != nil:
+		fatalf("couldn't read golden file: %v", err)
+	}
+
+	if diff := mermaidtest.DiffSVG(goldenName, string(want), pair.docName(), svgResult); diff != "" {
+		fmt.Print(diff)
+		return fail(fmt.Errorf("doesn't match golden file %s", goldenName),
+			"%s doesn't match %s", pair.docName(), goldenName)
+	}
+	recordRender(pair, d.start, d.result, nil)
+	log.Println("matched", goldenName)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoldenNames(t *testing.T) {
+	j := filepath.Join
+	pairs := []renderPair{
+		{mmdName: "flow.mmd", svgName: "flow.svg"},
+		{mmdName: j("docs", "flow.mmd"), svgName: j("docs", "flow.svg")},
+		{mmdName: j("docs", "guide", "flow.mmd"), svgName: j("out", "flow.svg")},
+		{mmdName: j("docs", "README.md"), svgName: j("docs", "README-2.svg"), block: 2},
+		{mmdName: j("..", "elsewhere", "seq.mmd"), svgName: j("..", "elsewhere", "seq.svg")},
+	}
+	want := []string{
+		j("golden", "flow.svg"),
+		j("golden", "docs", "flow.svg"),
+		j("golden", "docs", "guide", "flow.svg"),
+		j("golden", "docs", "README-2.svg"),
+		j("golden", "seq.svg"),
+	}
+	names, err := goldenNames(pairs, "golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pair := range pairs {
+		if got := names[pair]; got != want[i] {
+			t.Errorf("golden file of %s = %s, want %s", pair.docName(), got, want[i])
+		}
+	}
+}
+
+func TestGoldenNamesCollision(t *testing.T) {
+	j := filepath.Join
+	for _, pairs := range [][]renderPair{
+		// Two documents of the same name under -outdir.
+		{
+			{mmdName: j("a", "flow.mmd"), svgName: j("out", "flow.svg")},
+			{mmdName: j("a", "flow.md"), svgName: j("out", "flow.svg"), block: 1},
+		},
+		// Two inputs outside the current directory.
+		{
+			{mmdName: j("..", "a", "flow.mmd"), svgName: j("..", "a", "flow.svg")},
+			{mmdName: j("..", "b", "flow.mmd"), svgName: j("..", "b", "flow.svg")},
+		},
+	} {
+		_, err := goldenNames(pairs, "golden")
+		if err == nil || !strings.Contains(err.Error(), "would both be compared against golden file") {
+			t.Errorf("goldenNames(%v) = %v, want a collision", pairs, err)
+		}
+	}
+}
+
+// TestCheckGolden runs -golden and -update-golden over two
+// documents of the same name, one of which a defaults file gives
+// the dark theme.
+func TestCheckGolden(t *testing.T) {
+	startTestRenderer(t)
+	const flow = "flowchart LR\n    A --> B\n"
+	chdirTemp(t, map[string]string{
+		"a/flow.mmd":           flow,
+		"b/flow.mmd":           flow,
+		"b/" + dirDefaultsName: "theme: dark\n",
+	})
+	pairs := []renderPair{
+		{mmdName: filepath.Join("a", "flow.mmd"), svgName: filepath.Join("a", "flow.svg")},
+		{mmdName: filepath.Join("b", "flow.mmd"), svgName: filepath.Join("b", "flow.svg")},
+	}
+
+	if !checkGolden(pairs, "golden", true) {
+		t.Fatal("-update-golden failed")
+	}
+	a, err := os.ReadFile(filepath.Join("golden", "a", "flow.svg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join("golden", "b", "flow.svg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a) == string(b) {
+		t.Error("b/flow.mmd's golden file doesn't have its defaults file's theme")
+	}
+	for _, pair := range pairs {
+		if _, err := os.Stat(pair.svgName); err == nil {
+			t.Errorf("-update-golden wrote %s", pair.svgName)
+		}
+	}
+
+	if !checkGolden(pairs, "golden", false) {
+		t.Error("-golden failed right after -update-golden")
+	}
+
+	writeTestFile(t, filepath.Join("a", "flow.mmd"), "flowchart LR\n    A --> C\n")
+	if checkGolden(pairs, "golden", false) {
+		t.Error("-golden passed a changed document")
+	}
+	if len(failures) != 1 || failures[0].name != filepath.Join("a", "flow.mmd") {
+		t.Errorf("failures = %v, want just a/flow.mmd", failures)
+	}
+}
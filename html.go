@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+)
+
+// htmlPage is the data an HTML page template gets.
+type htmlPage struct {
+	// SVG is the rendered diagram, safe to put in the page as is.
+	SVG template.HTML
+
+	// Title is the diagram's title, or the document's name if it
+	// has none.
+	Title string
+
+	// SourcePath is the name of the document.
+	SourcePath string
+
+	// GeneratedBy is the name and version of mermaid-cli, for a
+	// generator meta tag or footer.
+	GeneratedBy string
+
+	// Styles is the built-in page's CSS, for a template that wants
+	// to start from it.
+	Styles template.CSS
+}
+
+// defaultHTMLStyles is the CSS of the built-in page.
+const defaultHTMLStyles = `body { margin: 2em; font-family: sans-serif; }
+figure { margin: 0; }
+figure svg { max-width: 100%; height: auto; }
+figcaption { margin-top: 1em; color: #555; }`
+
+// defaultHTMLTemplate is the built-in page for -html, which
+// -html-template-print prints as a starting point for
+// -html-template.
+const defaultHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="generator" content="{{.GeneratedBy}}">
+<title>{{.Title}}</title>
+<style>
+{{.Styles}}
+</style>
+</head>
+<body>
+<figure>
+{{.SVG}}
+<figcaption>{{.Title}}</figcaption>
+</figure>
+</body>
+</html>
+`
+
+// htmlTemplate is the page template for -html, parsed once by
+// loadHTMLTemplate.
+var htmlTemplate *template.Template
+
+// loadHTMLTemplate parses the -html-template file, or the built-in
+// template if it isn't set.  Errors name the file and line.
+func loadHTMLTemplate() (*template.Template, error) {
+	if *htmlTemplateFlag == "" {
+		return template.New("built-in").Parse(defaultHTMLTemplate)
+	}
+	b, err := os.ReadFile(*htmlTemplateFlag)
+	if err != nil {
+		return nil, err
+	}
+	// html/template's errors start with "template: NAME:LINE:", so
+	// naming it after the file points right at the problem.
+	return template.New(*htmlTemplateFlag).Parse(string(b))
+}
+
+// htmlName is the name of the -html page for the SVG svgName.
+func htmlName(svgName string) string {
+	return strings.TrimSuffix(svgName, svg) + ".html"
+}
+
+// writeHTML writes the -html page for the document at mmdName,
+// showing svgResult, next to its SVG svgName.
+func writeHTML(mmdName, svgName, svgResult, title string) error {
+	if title == "" {
+		title = mmdName
+	}
+	page := htmlPage{
+		SVG:         template.HTML(svgResult),
+		Title:       title,
+		SourcePath:  mmdName,
+		GeneratedBy: "mermaid-cli " + version,
+		Styles:      template.CSS(defaultHTMLStyles),
+	}
+	var b strings.Builder
+	if err := htmlTemplate.Execute(&b, page); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(htmlName(svgName), encodeOutput([]byte(b.String())), 0644); err != nil {
+		return fmt.Errorf("write HTML: %w", err)
+	}
+	return nil
+}
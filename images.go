@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// inlineImageMaxSize is the biggest image inlineImages inlines.
+// Each one is base64'd into the source and then into the SVG, at a
+// third bigger again.
+const inlineImageMaxSize = 2 << 20
+
+// imageRefRE matches the img of an image shape, e.g.,
+// A@{ img: "./icons/db.png" }: quoted (with its quote in 2 and
+// path in 3) or not (path in 4).
+var imageRefRE = regexp.MustCompile(`(\bimg\s*:\s*)(?:(["'])([^"'\n]*)["']|([^\s,}"']+))`)
+
+// imageTypes are the media types of the images inlineImages knows
+// by extension.  Others are sniffed.
+var imageTypes = map[string]string{
+	".png":  "image/png",
+	".svg":  "image/svg+xml",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// inlineImages returns mmdSource, of the document mmdName, with
+// each local image its image shapes refer to replaced with a data
+// URI of the image, read from disk relative to the document.  The
+// page MermaidJS renders in is about:blank, so a relative path
+// would resolve to nothing and draw a broken image.
+//
+// URLs (http:, data:, and so on) are left alone.  It's an error
+// for an image to be missing, or bigger than inlineImageMaxSize.
+func inlineImages(mmdName, mmdSource string) (string, error) {
+	var err error
+	out := imageRefRE.ReplaceAllStringFunc(mmdSource, func(ref string) string {
+		m := imageRefRE.FindStringSubmatch(ref)
+		quote, name := m[2], m[3]+m[4]
+		if err != nil || name == "" || isURL(name) {
+			return ref
+		}
+		var uri string
+		if uri, err = imageDataURI(mmdName, name); err != nil {
+			return ref
+		}
+		if quote == "" {
+			quote = `"`
+		}
+		return m[1] + quote + uri + quote
+	})
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// isURL reports whether ref is a URL, or protocol-relative, rather
+// than a path.
+func isURL(ref string) bool {
+	if strings.HasPrefix(ref, "//") {
+		return true
+	}
+	scheme, _, ok := strings.Cut(ref, ":")
+	// A one-letter "scheme" is a Windows drive.
+	return ok && len(scheme) > 1 && !strings.ContainsAny(scheme, `/\.`)
+}
+
+// imageDataURI reads the image name, relative to the document
+// mmdName, as a data URI.
+func imageDataURI(mmdName, name string) (string, error) {
+	p := name
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(filepath.Dir(mmdName), filepath.FromSlash(name))
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", fmt.Errorf("image %s: %w", name, err)
+	}
+	if info.Size() > inlineImageMaxSize {
+		return "", fmt.Errorf("image %s is %s; images over %s aren't inlined", name, formatByteSize(info.Size()), formatByteSize(inlineImageMaxSize))
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", fmt.Errorf("image %s: %w", name, err)
+	}
+	typ, ok := imageTypes[strings.ToLower(filepath.Ext(p))]
+	if !ok {
+		typ = http.DetectContentType(b)
+	}
+	return "data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(b), nil
+}
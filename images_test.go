@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestInlineImages inlines testdata/images/images.mmd's PNG and SVG
+// images.
+func TestInlineImages(t *testing.T) {
+	name := filepath.Join("testdata", "images", "images.mmd")
+	src, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := inlineImages(name, string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, img := range []struct{ name, typ string }{
+		{"db.png", "image/png"},
+		{"cloud.svg", "image/svg+xml"},
+	} {
+		b, err := os.ReadFile(filepath.Join("testdata", "images", "icons", img.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `img: "data:` + img.typ + ";base64," + base64.StdEncoding.EncodeToString(b) + `"`
+		if !strings.Contains(out, want) {
+			t.Errorf("%s isn't inlined as %.60s...", img.name, want)
+		}
+	}
+	if strings.Contains(out, "icons/") {
+		t.Errorf("inlined source still refers to a path:\n%s", out)
+	}
+	if !strings.Contains(out, `label: "Database"`) || !strings.Contains(out, "db --> cloud") {
+		t.Errorf("inlined source lost the rest of the document:\n%s", out)
+	}
+}
+
+func TestInlineImagesLeavesURLs(t *testing.T) {
+	const src = "flowchart LR\n" +
+		"    a@{ img: \"https://example.com/a.png\" }\n" +
+		"    b@{ img: 'data:image/png;base64,AAAA' }\n" +
+		"    c@{ img: //cdn.example.com/c.svg }\n"
+	out, err := inlineImages("doc.mmd", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != src {
+		t.Errorf("inlineImages changed URLs:\n%s", out)
+	}
+}
+
+func TestInlineImagesErrors(t *testing.T) {
+	dir := chdirTemp(t, map[string]string{
+		"docs/big.png": strings.Repeat("x", inlineImageMaxSize+1),
+	})
+	for _, tc := range []struct{ src, want string }{
+		{`a@{ img: "missing.png" }`, "image missing.png: "},
+		{`a@{ img: big.png }`, "image big.png is "},
+	} {
+		_, err := inlineImages(filepath.Join(dir, "docs", "doc.mmd"), "flowchart LR\n    "+tc.src+"\n")
+		if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("inlineImages of %s = %v, want an error starting %q", tc.src, err, tc.want)
+		}
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	for _, tc := range []struct {
+		ref  string
+		want bool
+	}{
+		{"https://example.com/a.png", true},
+		{"data:image/png;base64,AAAA", true},
+		{"//cdn.example.com/a.png", true},
+		{"./icons/db.png", false},
+		{"icons/db.png", false},
+		{`C:\icons\db.png`, false},
+		{"../a:b.png", false},
+	} {
+		if got := isURL(tc.ref); got != tc.want {
+			t.Errorf("isURL(%q) = %t, want %t", tc.ref, got, tc.want)
+		}
+	}
+}
+
+// TestRenderImages renders testdata/images, and checks its images
+// are drawn from the data URIs.
+func TestRenderImages(t *testing.T) {
+	startTestRenderer(t) // only to skip without Chrome
+	files := make(map[string]string)
+	for _, name := range []string{"images.mmd", "icons/db.png", "icons/cloud.svg"} {
+		b, err := os.ReadFile(filepath.Join("testdata", "images", filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = string(b)
+	}
+	chdirTemp(t, files)
+	if _, stderr, status := runMain(t, nil, "images.mmd"); status != 0 {
+		t.Fatalf("exited %d: %s", status, stderr)
+	}
+	svg, err := os.ReadFile("images.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"data:image/png;base64,", "data:image/svg+xml;base64,"} {
+		if !strings.Contains(string(svg), want) {
+			t.Errorf("images.svg has no image with %s", want)
+		}
+	}
+}
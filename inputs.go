@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/plan"
+)
+
+// noInputsExitStatus is the exit status when the arguments name no
+// documents at all, to tell it from failed documents (1), bad
+// usage (2), and running out of -max-total-time (3).
+const noInputsExitStatus = 4
+
+// inputArg is a document argument, and the documents it named.
+type inputArg struct {
+	arg   string
+	names []string
+
+	// dirs are the directories searched for the argument, a
+	// directory or a pattern, which the watcher watches for new
+	// documents.
+	dirs []string
+}
+
+// expandInputs returns the documents args name, with what each
+// argument contributed (see expandInput).
+func expandInputs(args []string) ([]inputArg, error) {
+	inputs := make([]inputArg, len(args))
+	for i, arg := range args {
+		in, err := expandInput(arg)
+		if err != nil {
+			return nil, err
+		}
+		inputs[i] = in
+	}
+	return inputs, nil
+}
+
+// expandInput returns the documents arg names.
+//
+// A directory names every .mmd document in its tree, in lexical
+// order, skipping hidden directories and node_modules.  A pattern
+// the shell left alone, because it matched nothing or was quoted,
+// is expanded by the cli, with ** matching any number of
+// directories (see plan.Match).  Any other argument names
+// itself, whether or not it exists, so a missing document fails
+// when it's read.
+func expandInput(arg string) (inputArg, error) {
+	in := inputArg{arg: arg}
+	fi, err := os.Stat(arg)
+	switch {
+	case err == nil && fi.IsDir():
+		return in, walkInputs(&in, arg, func(name string) bool {
+			return strings.HasSuffix(name, mmd)
+		})
+	case err == nil || !strings.ContainsAny(arg, "*?["):
+		in.names = []string{arg}
+		return in, nil
+	}
+
+	pattern := filepath.ToSlash(filepath.Clean(arg))
+	if _, err := path.Match(pattern, ""); err != nil {
+		return in, fmt.Errorf("bad pattern %s: %v", arg, err)
+	}
+	if !strings.Contains(pattern, "**") {
+		in.names, _ = filepath.Glob(arg)
+		dirs, _ := filepath.Glob(filepath.Dir(arg))
+		for _, dir := range dirs {
+			if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+				in.dirs = append(in.dirs, dir)
+			}
+		}
+		return in, nil
+	}
+	// Only the directories under the part of the pattern before
+	// any wildcards can match.
+	root := "."
+	if i := strings.IndexAny(pattern, "*?["); strings.Contains(pattern[:i], "/") {
+		root = pattern[:strings.LastIndex(pattern[:i], "/")+1]
+	}
+	if _, err := os.Stat(root); err != nil {
+		return in, nil // matches nothing
+	}
+	return in, walkInputs(&in, filepath.FromSlash(root), func(name string) bool {
+		return plan.Match(pattern, filepath.ToSlash(filepath.Clean(name)))
+	})
+}
+
+// walkInputs adds the files in the tree at root that match to in,
+// and the directories it searched.
+func walkInputs(in *inputArg, root string, match func(name string) bool) error {
+	return filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name != root && plan.SkipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			in.dirs = append(in.dirs, name)
+			return nil
+		}
+		if match(name) {
+			in.names = append(in.names, name)
+		}
+		return nil
+	})
+}
+
+// checkInputs prints and exits with noInputsExitStatus if inputs
+// name no documents, listing what each argument contributed,
+// unless -allow-empty.
+func checkInputs(inputs []inputArg) {
+	n := 0
+	for _, in := range inputs {
+		n += len(in.names)
+	}
+	if n > 0 || *allowEmptyFlag {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("no documents to render; use -allow-empty if that's expected:")
+	for _, in := range inputs {
+		fmt.Fprintf(&b, "\n\t%s: %d files", in.arg, len(in.names))
+	}
+	errorf("%s", b.String())
+	os.Exit(noInputsExitStatus)
+}
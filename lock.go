@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockName is the name of the advisory lock file that keeps two
+// runs from writing the same outputs at once.
+const lockName = ".mermaid-cli.lock"
+
+// errLocked is returned by tryLock when another process holds the
+// lock.
+var errLocked = errors.New("locked")
+
+// outputLocks are the held lock files.  They're kept here so
+// they aren't closed, releasing the locks, until unlockOutputs or
+// the process exits.
+var outputLocks []*os.File
+
+// lockOutputs takes the lock in each output root of pairs (see
+// lockDirs), in order, creating the directories if need be.  If
+// another process holds a lock it retries for up to timeout, then
+// prints who holds it and exits.
+//
+// The lock is an OS-level lock on the open file (flock, or an
+// unshared open on Windows), so it's released when the holder
+// exits, even by crashing, and a lock file left behind by a
+// crashed run is just reused.  A run that finishes removes its
+// lock files with unlockOutputs.
+func lockOutputs(pairs []renderPair, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for _, dir := range lockDirs(pairs) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fatalf("couldn't lock %s: %v", dir, err)
+		}
+		lockDir(dir, deadline)
+	}
+}
+
+// lockDir takes the lock in the output root dir, retrying until
+// deadline, for lockOutputs.
+func lockDir(dir string, deadline time.Time) {
+	name := filepath.Join(dir, lockName)
+	for {
+		f, err := tryLock(name)
+		switch {
+		case err == nil && !sameLockFile(f, name):
+			// The holder removed the file between our open and our
+			// lock, so another run may have made, and locked, a new
+			// one.
+			f.Close()
+			continue
+		case err == nil:
+			f.Truncate(0)
+			fmt.Fprintln(f, os.Getpid())
+			outputLocks = append(outputLocks, f)
+			log.Println("locked", name)
+			return
+		case !errors.Is(err, errLocked):
+			fatalf("couldn't lock %s: %v", name, err)
+		case time.Now().After(deadline):
+			holder := "another mermaid-cli"
+			if pid := lockHolder(name); pid > 0 {
+				holder += fmt.Sprintf(" (pid %d)", pid)
+			}
+			fatalf("%s is writing to %s; it holds %s", holder, dir, name)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// sameLockFile reports whether the locked file f is still the lock
+// file name.
+func sameLockFile(f *os.File, name string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	ni, err := os.Stat(name)
+	return err == nil && os.SameFile(fi, ni)
+}
+
+// unlockOutputs removes the lock files lockOutputs took, and
+// releases the locks.  The file is removed while it's still
+// locked, so a run waiting on it finds it gone (see sameLockFile)
+// rather than taking a lock on a file no one else will see.
+func unlockOutputs() {
+	for _, f := range outputLocks {
+		if err := os.Remove(f.Name()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("couldn't remove %s: %v", f.Name(), err)
+		}
+		f.Close()
+	}
+	outputLocks = nil
+}
+
+// lockHolder returns the pid written in the lock file name, or 0
+// if it can't be read.
+func lockHolder(name string) int {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(string(bytes.TrimSpace(b)))
+	return pid
+}
+
+// lockDirs returns the output roots of pairs, where their locks
+// go: -outdir, or else the deepest directory that has all of the
+// outputs under it.  If that's the root of the file system, as for
+// outputs on unrelated paths, each directory with an output in it
+// is locked instead, so runs writing elsewhere under the root
+// aren't kept waiting.  They're sorted, so runs take their locks
+// in the same order.
+func lockDirs(pairs []renderPair) []string {
+	if *dirFlag != "" {
+		return []string{*dirFlag}
+	}
+	var dirs []string
+	for _, pair := range pairs {
+		dir, err := filepath.Abs(filepath.Dir(pair.svgName))
+		if err != nil {
+			fatalf("%v", err)
+		}
+		dirs = append(dirs, dir)
+	}
+	if common := commonDir(dirs); filepath.Dir(common) != common {
+		return []string{common}
+	}
+	slices.Sort(dirs)
+	return slices.Compact(dirs)
+}
+
+// commonDir returns the deepest directory that has all of the
+// absolute directories dirs under it.
+func commonDir(dirs []string) string {
+	var common []string
+	for i, dir := range dirs {
+		elems := strings.Split(dir, string(filepath.Separator))
+		if i == 0 {
+			common = elems
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(elems) && common[n] == elems[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	dir := strings.Join(common, string(filepath.Separator))
+	if dir == "" || strings.HasSuffix(dir, ":") {
+		dir += string(filepath.Separator)
+	}
+	return dir
+}
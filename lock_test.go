@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLockDirs(t *testing.T) {
+	dir := chdirTemp(t, nil)
+	j := filepath.Join
+	abs := func(name string) string {
+		t.Helper()
+		a, err := filepath.Abs(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	for _, tc := range []struct {
+		name  string
+		pairs []renderPair
+		want  []string
+	}{
+		{
+			"common root",
+			[]renderPair{
+				{mmdName: j("docs", "a.mmd"), svgName: j("docs", "a.svg")},
+				{mmdName: j("docs", "sub", "b.mmd"), svgName: j("docs", "sub", "b.svg")},
+			},
+			[]string{j(dir, "docs")},
+		},
+		{
+			"one output",
+			[]renderPair{{mmdName: "a.mmd", svgName: "a.svg"}},
+			[]string{dir},
+		},
+		{
+			// Outputs with only the root in common lock each
+			// directory, not the root.
+			"unrelated roots",
+			[]renderPair{
+				{mmdName: "a.mmd", svgName: j("docs", "a.svg")},
+				{mmdName: "b.mmd", svgName: abs(j(string(filepath.Separator), "elsewhere", "b.svg"))},
+			},
+			[]string{abs(j(string(filepath.Separator), "elsewhere")), j(dir, "docs")},
+		},
+	} {
+		slices.Sort(tc.want)
+		if got := lockDirs(tc.pairs); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: lockDirs = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	setFlag(t, "outdir", "out")
+	if got := lockDirs([]renderPair{{mmdName: "a.mmd", svgName: j("out", "a.svg")}}); !slices.Equal(got, []string{"out"}) {
+		t.Errorf("lockDirs with -outdir = %q, want just out", got)
+	}
+}
+
+func TestLockOutputs(t *testing.T) {
+	dir := chdirTemp(t, nil)
+	t.Cleanup(unlockOutputs)
+	name := filepath.Join(dir, "out", lockName)
+
+	lockOutputs([]renderPair{{mmdName: "a.mmd", svgName: filepath.Join("out", "a.svg")}}, 0)
+	if len(outputLocks) != 1 {
+		t.Fatalf("took %d locks, want 1", len(outputLocks))
+	}
+	if pid := lockHolder(name); pid != os.Getpid() {
+		t.Errorf("lock holder = %d, want %d", pid, os.Getpid())
+	}
+	if _, err := tryLock(name); !errors.Is(err, errLocked) {
+		t.Errorf("tryLock of a held lock = %v, want errLocked", err)
+	}
+
+	unlockOutputs()
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unlockOutputs left %s: %v", name, err)
+	}
+	lockDir(filepath.Dir(name), time.Now())
+	if len(outputLocks) != 1 {
+		t.Error("couldn't take a released lock again")
+	}
+}
+
+// TestLockReused checks a lock file left behind, as by a crashed
+// run, is just locked again, and one removed by its holder after
+// it was opened isn't taken for the lock.
+func TestLockReused(t *testing.T) {
+	dir := chdirTemp(t, map[string]string{lockName: "99999999\n"})
+	t.Cleanup(unlockOutputs)
+	name := filepath.Join(dir, lockName)
+
+	lockDir(dir, time.Now())
+	if pid := lockHolder(name); pid != os.Getpid() {
+		t.Errorf("lock holder = %d, want %d", pid, os.Getpid())
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !sameLockFile(f, name) {
+		t.Error("sameLockFile of the lock file = false")
+	}
+	unlockOutputs()
+	writeTestFile(t, name, "")
+	if sameLockFile(f, name) {
+		t.Error("sameLockFile of a removed lock file = true")
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// tryLock opens (or creates) the lock file name and takes an
+// exclusive flock on it, without waiting.
+//
+// A new lock file is made writable by everyone, so another user's
+// run can wait on it, and write its pid when it gets it.  A lock
+// file another user made without that is opened read-only, which
+// is enough for flock.
+func tryLock(name string) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666)
+	if errors.Is(err, fs.ErrPermission) {
+		f, err = os.Open(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Chmod(0666) // past the umask, if it's ours
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
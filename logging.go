@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logEvent is one thing the cli reports on Stderr: an error, a
+// warning, or, with -log, what it's doing.
+type logEvent struct {
+	Level string // "error", "warning", or "info"
+	Msg   string
+
+	// File is the document or output the event is about, if any.
+	File string
+
+	// Duration and Bytes are set for a rendered document: how long
+	// it took, from being read to being written, and the size of
+	// its output.
+	Duration time.Duration
+	Bytes    int
+}
+
+// eventLogger prints logEvents, in one format or another.
+type eventLogger interface {
+	event(e logEvent)
+}
+
+// logger prints the run's events, as -log-format says, once main
+// has parsed the flags.
+var logger eventLogger = textLogger{}
+
+// logging is whether info events are printed: with -log, or
+// -log-format=json, unless -q.  Errors and warnings always are,
+// except warnings with -q.
+var logging bool
+
+// textLogger prints events for people: errors and warnings
+// prefixed with their level, and info events with the time.
+type textLogger struct{}
+
+func (textLogger) event(e logEvent) {
+	switch e.Level {
+	case "info":
+		msg := e.Msg
+		if e.Duration > 0 {
+			msg += fmt.Sprintf(" in %s (%s)", e.Duration.Round(time.Millisecond), formatByteSize(int64(e.Bytes)))
+		}
+		fmt.Fprintf(os.Stderr, "%s %s\n", time.Now().Format("2006/01/02 15:04:05"), msg)
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %s\n", e.Level, e.Msg)
+	}
+}
+
+// jsonLogger prints each event as a JSON object on a line of its
+// own, for -log-format=json.
+type jsonLogger struct {
+	mu sync.Mutex
+}
+
+func (l *jsonLogger) event(e logEvent) {
+	b, err := json.Marshal(struct {
+		Level      string  `json:"level"`
+		Msg        string  `json:"msg"`
+		File       string  `json:"file,omitempty"`
+		DurationMS float64 `json:"duration_ms,omitempty"`
+		Bytes      int     `json:"bytes,omitempty"`
+	}{e.Level, e.Msg, e.File, float64(e.Duration.Microseconds()) / 1000, e.Bytes})
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	os.Stderr.Write(append(b, '\n'))
+}
+
+// logEventf prints an event at level, about file if it isn't "",
+// if the flags call for it.  The message is the format string and
+// its arguments, without any "error: " or "warning: " prefix or
+// trailing newline.
+func logEventf(level, file, format string, args ...any) {
+	if (level == "info" && !logging) || (level == "warning" && *quietFlag) {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	msg = strings.TrimPrefix(msg, level+": ")
+	msg = strings.TrimSuffix(msg, "\n")
+	logger.event(logEvent{Level: level, Msg: msg, File: file})
+}
+
+// logRendered prints that pair's output was written, with how long
+// it took since start and its size, as an info event.
+func logRendered(pair renderPair, start time.Time, size int) {
+	if !logging {
+		return
+	}
+	logger.event(logEvent{Level: "info", Msg: "rendered " + pair.svgName, File: pair.mmdName, Duration: time.Since(start), Bytes: size})
+}
+
+// logWriter is the output of the log package, so the log.Print
+// calls throughout the cli print info events through logger.
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	logEventf("info", "", "%s", p)
+	return len(p), nil
+}
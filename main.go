@@ -1,9 +1,21 @@
 /*
 Mermaid-CLI takes MermaidJS documents with a .mmd extension and
 renders them to SVG files with the same name but with a .svg
-extension.
+extension, or to PNG or PDF files with -format=png or -format=pdf.
 
-usage: mermaid-cli [-log] [-watch] [-outdir=DIR] file.mmd [file2.mmd ...]
+usage:
+
+	mermaid-cli [-log] [-watch] [-outdir=DIR] [-format=png [-scale=N]] file.mmd [file2.mmd ...]
+	mermaid-cli [-log] [-format=png [-scale=N]] - <file.mmd >file.svg
+	mermaid-cli [-log] -golden=DIR [-update-golden] file.mmd [file2.mmd ...]
+	mermaid-cli [-log] -verify-deterministic [-verify-fresh-browser] file.mmd [file2.mmd ...]
+	mermaid-cli [-log] -ndjson
+	mermaid-cli [-log] [-outdir=DIR] -render-on-stdin
+	mermaid-cli -show-effective-config file.mmd
+	mermaid-cli detect file.mmd [file2.mmd ...]
+	mermaid-cli extract [-o=file.mmd] file.svg
+	mermaid-cli compare [-log] [-mermaid-js-a=old.js] [-mermaid-js-b=new.js] [-out=DIR] [-fail-on-diff] file.mmd [file2.mmd ...]
+	mermaid-cli completion bash|zsh|fish
 
 The following was inspired by:
 https://github.com/abhinav/goldmark-mermaid/blob/main/mermaidcdp/compiler.go
@@ -11,41 +23,165 @@ https://github.com/abhinav/goldmark-mermaid/blob/main/mermaidcdp/compiler.go
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"os/signal"
-	"path"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"syscall"
+	texttemplate "text/template"
 	"time"
 
-	_ "embed"
-
-	cdruntime "github.com/chromedp/cdproto/runtime"
-	"github.com/chromedp/chromedp"
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+	"github.com/zacharysyoung/mermaid-cli/plan"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
 )
 
 var (
-	watchFlag = flag.Bool("watch", false, "watch files and render")
-	logFlag   = flag.Bool("log", false, "turn on logging")
-	dirFlag   = flag.String("outdir", "", "output directory for SVGs")
+	watchFlag             = flag.Bool("watch", false, "watch files and render")
+	logFlag               = flag.Bool("log", false, "turn on logging")
+	quietFlag             = flag.Bool("q", false, "print only errors: no warnings, and no logging")
+	logFormatFlag         = flag.String("log-format", "text", "print errors, warnings, and logging as `format` text, or json, one object per line with level, msg, file, and for each render, duration_ms and bytes; json turns on logging")
+	dirFlag               = flag.String("outdir", "", "output `directory` for SVGs, made if it doesn't exist")
+	cjkFontFlag           = flag.String("cjk-font", "", "font `file` (e.g., NotoSansCJK.otf) for drawing Chinese, Japanese, and Korean labels")
+	removeOnFailFlag      = flag.Bool("remove-on-fail", false, "remove the existing SVG for documents that fail to render, rather than leave it stale")
+	placeholderFlag       = flag.Bool("error-placeholder", false, "write an SVG showing the error for documents that fail to render")
+	emojiFontFlag         = flag.String("emoji-font", "", "font `file` (e.g., NotoColorEmoji.ttf) for drawing emoji in labels")
+	ndjsonFlag            = flag.Bool("ndjson", false, "render JSON requests from stdin to JSON responses on stdout, one per line")
+	noValidateFlag        = flag.Bool("no-validate-output", false, "skip checking that each SVG is well-formed XML before writing it")
+	goldenFlag            = flag.String("golden", "", "compare each document's normalized SVG against the one in golden `dir`, instead of writing SVGs")
+	updateGoldenFlag      = flag.Bool("update-golden", false, "with -golden, rewrite the golden files from the documents")
+	verifyFlag            = flag.Bool("verify-deterministic", false, "render each document twice and fail if the SVGs differ, instead of writing SVGs")
+	verifyFreshFlag       = flag.Bool("verify-fresh-browser", false, "with -verify-deterministic, also render each document in a new browser")
+	metadataFlag          = flag.Bool("metadata", false, "also write a JSON sidecar (file.svg.json) with each diagram's type, size, title, and source hash")
+	annotationsFlag       = flag.String("annotations", "", "also print failures as `github` Actions annotations, or none; the default is github when GITHUB_ACTIONS=true")
+	errorFormatFlag       = flag.String("error-format", "human", "how to print per-document failures: human, or unix for path:line:col: message")
+	sarifFlag             = flag.String("sarif", "", "write a SARIF 2.1.0 log of the documents that failed to `file`")
+	statusFileFlag        = flag.String("status-file", "", "with -watch, periodically write the watcher's status to `file`")
+	lockTimeoutFlag       = flag.Duration("lock-timeout", 0, "wait up to `duration` for another run writing the same outputs to finish, instead of failing right away")
+	keepOldFlag           = flag.Int("keep-old", 0, "keep up to `N` backups of each SVG, as file.svg.1 (newest) through file.svg.N, when a render changes it")
+	nameFromTitleFlag     = flag.Bool("name-from-title", false, "name each SVG after its diagram's title, e.g., login-flow.svg for \"title: Login flow\", instead of its document")
+	showConfigFlag        = flag.Bool("show-effective-config", false, "print the MermaidJS config the one document renders with, after its front matter and directives, instead of rendering it")
+	renderOnStdinFlag     = flag.Bool("render-on-stdin", false, "render each document named on a line of stdin as it arrives, printing \"ok NAME\" or \"err NAME: MESSAGE\" to stdout")
+	embedSourceFlag       = flag.Bool("embed-source", false, "embed each document's source, and its SHA-256, in its SVG, for the extract subcommand")
+	reportHTMLFlag        = flag.String("report-html", "", "write an HTML report of every document's status, duration, size, and type to `file`")
+	writeSumsFlag         = flag.Bool("write-sums", false, "after a successful run, record each SVG's checksum, and its inputs', in .mermaid.sum")
+	verifySumsFlag        = flag.Bool("verify-sums", false, "check the documents and SVGs against .mermaid.sum, without rendering, and list any mismatches")
+	writeOversizedFlag    = flag.Bool("write-oversized", false, "with -max-output-size, still write an SVG that's over budget before failing its document")
+	statsFlag             = flag.Bool("stats", false, "with -max-output-size, list the elements that take up the most of an oversized SVG; with -matrix, count the outputs rendered and reused")
+	outputBOMFlag         = flag.Bool("output-bom", false, "start each SVG and HTML file with a UTF-8 byte order mark")
+	outputNewlineFlag     = flag.String("output-newline", "lf", "line endings for SVG and HTML files: lf, or crlf")
+	scopePrefixFlag       = flag.String("scope-prefix", "", "add `prefix` to every class and id in each SVG, and to its style selectors and references, so inlined SVGs can't clash with the page's CSS")
+	htmlFlag              = flag.Bool("html", false, "also write a standalone HTML page (file.html) showing each diagram")
+	htmlTemplateFlag      = flag.String("html-template", "", "write the -html pages with the Go html/template in `file` instead of the built-in page; implies -html")
+	htmlTemplatePrintFlag = flag.Bool("html-template-print", false, "print the built-in -html page template, to start a -html-template from")
+	deterministicFlag     = flag.Bool("deterministic", false, "render reproducibly: deterministic ids, a fixed clock at SOURCE_DATE_EPOCH (or 1970), and seeded randomness")
+	maxTotalTimeFlag      = flag.Duration("max-total-time", 0, "stop the whole run, browser startup included, after `duration`, reporting the documents left unrendered and exiting with status 3")
+	mermaidJSFlag         = flag.String("mermaid-js", "", "load the MermaidJS bundle in `file` instead of the embedded one; MERMAID_JS_PATH sets it too, and a build with -tags nombed needs one")
+	watchHashFlag         = flag.Bool("watch-hash", false, "with -watch, rerender a document when its contents change, not its modification time, ignoring whitespace-only changes")
+	errSidecarsFlag       = flag.Bool("err-sidecars", false, "for a document that fails, write the full exception, effective config, and versions to file.mmd.err.txt; it's removed once the document renders")
+	allowEmptyFlag        = flag.Bool("allow-empty", false, "succeed when the arguments name no documents, e.g., a pattern that matches nothing, rather than exit with status 4")
+	themeMapFlag          = flag.String("theme-map", "", "render documents with the theme, or MermaidJS settings, of the first pattern in the YAML `file` their path matches; a document's own config overrides it")
+	formatFlag            = flag.String("format", "svg", "output `format`: svg, png, or pdf")
+	scaleFlag             = flag.Float64("scale", 1, "with -format=png, device pixels per CSS pixel, e.g., 2 for high-density screens")
+	checkUpdateFlag       = flag.Bool("check-mermaid-update", false, "check the npm registry (at most once a day) for a newer MermaidJS than the loaded one, and say if there is")
+	themeFlag             = flag.String("theme", "", "MermaidJS `theme` for documents that don't set their own: default, dark, forest, neutral, base, or any other MermaidJS knows")
+	chartWidthFlag        = flag.Int("chart-width", 0, "width in `pixels` of pie, quadrant, and XY charts, unless they set their own")
+	chartHeightFlag       = flag.Int("chart-height", 0, "height in `pixels` of quadrant and XY charts, unless they set their own")
+	configFlag            = flag.String("c", "", "pass the MermaidJS config in the JSON `file` (e.g., themeVariables, flowchart.curve) to mermaid.initialize")
+	stagedFlag            = flag.Bool("staged", false, "render the documents staged in git, as staged, e.g., in a pre-commit hook")
+	autoStageFlag         = flag.Bool("auto-stage", false, "with -staged, git add the outputs of the staged documents")
+	dedupeReportFlag      = flag.Bool("dedupe-report", false, "after rendering, warn about groups of documents whose outputs are the same once normalized, e.g., copy-pasted diagrams")
+	failOnDuplicatesFlag  = flag.Bool("fail-on-duplicates", false, "like -dedupe-report, but exit with status 1 if any documents render the same")
+	jobsFlag              = flag.Int("j", 0, "render up to `N` documents at once, each in its own browser tab; 0 means the number of CPUs, up to 4")
+	forceFlag             = flag.Bool("force", false, "render every document, even ones whose output is newer than the document and stamped with the same inputs")
+	strictTemplateFlag    = flag.Bool("strict-template", false, "make a -html-template that uses .GitRevision or .GitDirty fail for a document that isn't in git, rather than get empty values")
+	backgroundFlag        = flag.String("background", "", "with -format=png or pdf, the CSS `color` behind the diagram, e.g., for a dark theme; a PDF's is white if it isn't set")
+	skipIfUnavailableFlag = flag.Bool("skip-if-unavailable", false, "if no browser can be started, warn, skip every document, leaving its output as is, and exit with status 0, e.g., for local docs builds")
+	timeoutFlag           = flag.Duration("timeout", 30*time.Second, "give up on a document whose render takes longer than `duration`, and go on to the next; 0 means no limit")
+	startupTimeoutFlag    = flag.Duration("startup-timeout", 30*time.Second, "give up if the browser hasn't started, with MermaidJS loaded, within `duration`; 0 means no limit")
+	remoteChromeFlag      = flag.String("remote-chrome", "", "use the running Chrome at the DevTools websocket `url`, e.g., ws://localhost:9222, instead of launching one; MERMAID_CLI_CHROME_WS sets it too")
+	chromePathFlag        = flag.String("chrome-path", "", "launch the Chrome or Chromium executable at `path` instead of the one found on the PATH")
+	matrixFlag            = flag.String("matrix", "", "render every document once per variant (theme, background, scale, and an output suffix or dir) in the YAML `file`")
+	strictFlag            = flag.Bool("strict", false, "fail, rather than warn about, a document that sets MermaidJS config, in front matter or an init directive, that the loaded MermaidJS doesn't know")
+	stripUnknownFlag      = flag.Bool("strip-unknown-directives", false, "remove the settings the loaded MermaidJS doesn't know from documents' front matter config and init directives before rendering, after warning about them")
+	forceConfigFlag       = flag.Bool("force-config", false, "make -theme, -c, -css, -font, and -gitgraph win over the same settings in documents' front matter config and init directives, and in defaults files, by removing them before rendering")
+	cssFlag               = flag.String("css", "", "pass the CSS in `file` to mermaid.initialize as themeCSS, over any in the -c config; in watch mode, editing it rerenders every document")
+	fontFlag              = flag.String("font", "", "render labels in the CSS font-family `list`, e.g., \"Inter, sans-serif\", as MermaidJS's fontFamily")
+	dryRunFlag            = flag.Bool("dry-run", false, "print each document and the output it would be written to, one per line, without rendering anything")
+	serveFlag             = flag.String("serve", "", "serve previews of the outputs, with live reload, at `addr`ess, e.g., :8080; implies -watch")
+	mermaidCDNFlag        = flag.String("mermaid-cdn", "", "load the MermaidJS bundle from `url` instead of the embedded one, e.g., https://cdn.jsdelivr.net/npm/mermaid@11/dist/mermaid.min.js")
+	versionFlag           = flag.Bool("version", false, "print the versions of mermaid-cli, Go, and the MermaidJS it loads, and exit")
+	recordFlag            = flag.String("record", "", "record each render (its JavaScript, config, source, and SVG, with the bundle's hash) to the tar `file`, for -replay")
+	replayFlag            = flag.String("replay", "", "render again what the -record session in the tar `file` recorded, and diff each result against the recording")
+	splitThresholdFlag    = flag.Int("split-threshold", 0, "split a flowchart with more than this many `nodes` into one output per top-level subgraph, e.g., flow-1.svg and flow-2.svg, with an index page, flow.html; 0 doesn't split")
+	splitFlag             = flag.Bool("split", false, "render each diagram of a document with several, separated by lines of only ---, to an output of its own, e.g., flow-1.svg and flow-2.svg")
+	checkFlag             = flag.Bool("check", false, "check each document's syntax with MermaidJS's parser, without rendering it or writing anything, and exit with status 0 only if every one parses")
+	checkOutputFlag       = flag.Bool("check-output", false, "render each document in memory and fail if its SVG on disk is stale, i.e., differs once normalized, without writing anything")
+	diffLinesFlag         = flag.Int("diff-lines", 0, "with -diff=full, print at most `N` lines of each diff; 0 means all of it")
+	nameTemplateFlag      = flag.String("name-template", "", "name each output with the Go text/`template`, given .Dir, .Base, .Ext, and .Index (a Markdown block's or split part's number), relative to -outdir or the document's directory; the default is {{.Base}}{{if .Index}}-{{.Index}}{{end}}{{.Ext}}")
+	manifestFlag          = flag.String("manifest", "", "render the documents listed in the JSON or YAML `file`, each entry with an input, an output, and optionally a theme and config over the flags', instead of documents named as arguments")
+	widthFlag             = flag.Int("width", 0, "scale each SVG to `pixels` wide, keeping its aspect ratio; with -height, to fit within both")
+	heightFlag            = flag.Int("height", 0, "scale each SVG to `pixels` high, keeping its aspect ratio; with -width, to fit within both")
+	noMaxWidthFlag        = flag.Bool("no-max-width", false, "remove the max-width MermaidJS puts in each SVG's style, so it sizes by its width and height alone")
 
-	renderer svgRenderer
+	// Set up in init, for their custom flag.Value types.
+	diffFlag          diffMode
+	maxOutputSizeFlag byteSize
+	gitGraphFlag      gitGraphConfig
+	extraJSFlag       fileList
+	chromeFlagFlag    chromeFlagList
+
+	mainRenderer *renderer.Renderer
 )
 
+func init() {
+	flag.StringVar(dirFlag, "o", "", "shorthand for -outdir `directory`")
+	flag.StringVar(dirFlag, "out", "", "same as -outdir `directory`")
+	flag.StringVar(configFlag, "config", "", "same as -c `file`")
+	flag.StringVar(formatFlag, "f", "svg", "shorthand for -format")
+	flag.Var(&diffFlag, "diff", "print a summary of how each SVG changed from the previous one, or with -diff=full a unified diff")
+	flag.Var(&gitGraphFlag, "gitgraph", "set the gitGraph `key=value`, e.g., mainBranchName=trunk, for every gitGraph diagram; repeat it for more settings, which are checked by name and type")
+	flag.Var(&chromeFlagFlag, "chrome-flag", "launch Chrome with the command line `flag`, e.g., --no-sandbox, or --name=value; repeat it for more flags; --name=false drops one of chromedp's defaults")
+	flag.Var(&extraJSFlag, "extra-js", "evaluate the JavaScript in `file` in the page after the cli's own helpers, e.g., to define postProcessSVG; repeat it for more files, which run in order")
+	flag.Var(&maxOutputSizeFlag, "max-output-size", "fail a document whose SVG is over `size`, e.g., 1MB or 512KiB; a document's front matter can override it with maxOutputSize")
+}
+
+// version is the version of mermaid-cli, set at build time with
+// -ldflags "-X main.version=v1.2.3".
+var version = "devel"
+
+// subcommands are the first arguments that select a mode other
+// than rendering the documents named on the command line.
+var subcommands = []string{"compare", "completion", "detect", "extract"}
+
 const (
 	mmd = ".mmd"
 	svg = ".svg"
 )
 
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: mermaid-cli [-log] [-watch] [-outdir=DIR] file.mmd [file2.mmd ...]")
+	fmt.Fprintln(os.Stderr, "usage: mermaid-cli [-log] [-watch] [-outdir=DIR] [-format=png [-scale=N]] file.mmd [file2.mmd ...]")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli [-log] [-format=png [-scale=N]] - <file.mmd >file.svg")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli [-log] -golden=DIR [-update-golden] file.mmd [file2.mmd ...]")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli [-log] [-j=N] -check file.mmd [file2.mmd ...]")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli [-log] -verify-deterministic [-verify-fresh-browser] file.mmd [file2.mmd ...]")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli [-log] [-outdir=DIR] -staged [-auto-stage]")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli [-log] -ndjson")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli [-log] [-outdir=DIR] -render-on-stdin")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli -show-effective-config file.mmd")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli detect file.mmd [file2.mmd ...]")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli extract [-o=file.mmd] file.svg")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli compare [-log] [-mermaid-js-a=old.js] [-mermaid-js-b=new.js] [-out=DIR] [-fail-on-diff] file.mmd [file2.mmd ...]")
+	fmt.Fprintln(os.Stderr, "       mermaid-cli completion bash|zsh|fish")
 	flag.PrintDefaults()
 	os.Exit(2)
 }
@@ -54,92 +190,896 @@ func usage() {
 // and output SVG file.
 type renderPair struct {
 	mmdName, svgName string
+
+	// block is which mermaid block of the Markdown file mmdName
+	// the pair is for, counting from 1, or which part of the
+	// MermaidJS document mmdName that -split-threshold splits it
+	// into, or 0 for a whole MermaidJS document.
+	block int
+
+	// variant is the name of the -matrix variant the pair renders
+	// with, or "".
+	variant string
+
+	// entry is which -manifest entry the pair is for, counting
+	// from 1, or 0.
+	entry int
+}
+
+// docName returns the name of pair's document for messages and
+// reports: mmdName, or for a Markdown block or a part of a split
+// flowchart, e.g., README.md#2, with its -matrix variant after it,
+// e.g., flow.mmd [dark], or its -manifest entry, e.g., flow.mmd
+// (entry 3).
+func (pair renderPair) docName() string {
+	name := pair.mmdName
+	if pair.block > 0 {
+		name = fmt.Sprintf("%s#%d", pair.mmdName, pair.block)
+	}
+	if pair.variant != "" {
+		name += " [" + pair.variant + "]"
+	}
+	if pair.entry > 0 {
+		name += fmt.Sprintf(" (entry %d)", pair.entry)
+	}
+	return name
 }
 
 func main() {
+	log.SetFlags(0)
+	log.SetOutput(logWriter{})
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "completion":
+			completionCmd(os.Args[2:])
+			return
+		case "detect":
+			detectCmd(os.Args[2:])
+			return
+		case "compare":
+			compareCmd(os.Args[2:])
+			return
+		case "extract":
+			extractCmd(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Usage = usage
 	flag.Parse()
-	if len(flag.Args()) < 1 {
+	if *serveFlag != "" {
+		*watchFlag = true
+	}
+	if *versionFlag {
+		if !printVersion() {
+			os.Exit(1)
+		}
+		return
+	}
+	if *htmlTemplatePrintFlag {
+		fmt.Print(defaultHTMLTemplate)
+		return
+	}
+	if (len(flag.Args()) < 1) != (*ndjsonFlag || *renderOnStdinFlag || *stagedFlag || *replayFlag != "" || *manifestFlag != "") {
+		usage()
+	}
+	if *manifestFlag != "" {
+		if conflict := manifestConflict(); conflict != "" {
+			fmt.Fprintf(os.Stderr, "-manifest can't be used with %s\n", conflict)
+			usage()
+		}
+	}
+	if *ndjsonFlag && *renderOnStdinFlag {
+		fmt.Fprintln(os.Stderr, "-ndjson and -render-on-stdin can't be used together")
+		usage()
+	}
+	if *verifyFreshFlag && !*verifyFlag {
+		fmt.Fprintln(os.Stderr, "-verify-fresh-browser needs -verify-deterministic")
+		usage()
+	}
+	if *errorFormatFlag != "human" && *errorFormatFlag != "unix" {
+		fmt.Fprintf(os.Stderr, "got -error-format=%s; expected human or unix\n", *errorFormatFlag)
+		usage()
+	}
+	if *annotationsFlag != "" && *annotationsFlag != "github" && *annotationsFlag != "none" {
+		fmt.Fprintf(os.Stderr, "got -annotations=%s; expected github or none\n", *annotationsFlag)
+		usage()
+	}
+	if *jobsFlag < 0 {
+		fmt.Fprintf(os.Stderr, "got -j=%d; expected 0 or more\n", *jobsFlag)
+		usage()
+	}
+	if *splitThresholdFlag < 0 {
+		fmt.Fprintf(os.Stderr, "got -split-threshold=%d; expected 0 or more\n", *splitThresholdFlag)
+		usage()
+	}
+	if *nameTemplateFlag != "" && *nameFromTitleFlag {
+		fmt.Fprintln(os.Stderr, "-name-template can't be used with -name-from-title")
+		usage()
+	}
+	if *splitThresholdFlag > 0 && *nameFromTitleFlag {
+		fmt.Fprintln(os.Stderr, "-split-threshold can't be used with -name-from-title")
+		usage()
+	}
+	if *logFormatFlag != "text" && *logFormatFlag != "json" {
+		fmt.Fprintf(os.Stderr, "got -log-format=%s; expected text or json\n", *logFormatFlag)
+		usage()
+	}
+	if remoteChromeURL() != "" && (*chromePathFlag != "" || len(chromeFlagFlag) > 0) {
+		fmt.Fprintln(os.Stderr, "-chrome-path and -chrome-flag can't be used with -remote-chrome or "+chromeWSEnv)
+		usage()
+	}
+	if *quietFlag && *logFlag {
+		fmt.Fprintln(os.Stderr, "-q can't be used with -log")
+		usage()
+	}
+	if *splitFlag && *nameFromTitleFlag {
+		fmt.Fprintln(os.Stderr, "-split can't be used with -name-from-title")
+		usage()
+	}
+	if *splitFlag && *splitThresholdFlag > 0 {
+		fmt.Fprintln(os.Stderr, "-split can't be used with -split-threshold")
+		usage()
+	}
+	if *keepOldFlag < 0 {
+		fmt.Fprintf(os.Stderr, "got -keep-old=%d; expected 0 or more\n", *keepOldFlag)
+		usage()
+	}
+	if *mermaidCDNFlag != "" && mermaidJSPath() != "" {
+		fmt.Fprintln(os.Stderr, "-mermaid-cdn can't be used with -mermaid-js or MERMAID_JS_PATH")
+		usage()
+	}
+	if *showConfigFlag && len(flag.Args()) != 1 {
+		fmt.Fprintln(os.Stderr, "-show-effective-config takes exactly one document")
+		usage()
+	}
+	if *writeSumsFlag && (*verifySumsFlag || *goldenFlag != "" || *verifyFlag) {
+		fmt.Fprintln(os.Stderr, "-write-sums only works when writing SVGs")
+		usage()
+	}
+	if *outputNewlineFlag != "lf" && *outputNewlineFlag != "crlf" {
+		fmt.Fprintf(os.Stderr, "got -output-newline=%s; expected lf or crlf\n", *outputNewlineFlag)
+		usage()
+	}
+	checkStdio(flag.Args())
+	if *scopePrefixFlag != "" && !scopePrefixRE.MatchString(*scopePrefixFlag) {
+		fmt.Fprintf(os.Stderr, "got -scope-prefix=%s; expected letters, digits, hyphens, and underscores, starting with a letter or underscore\n", *scopePrefixFlag)
+		usage()
+	}
+	if *statusFileFlag != "" && !*watchFlag {
+		fmt.Fprintln(os.Stderr, "-status-file needs -watch")
+		usage()
+	}
+	if *recordFlag != "" && (*replayFlag != "" || *ndjsonFlag || *renderOnStdinFlag || *goldenFlag != "" || *verifyFlag) {
+		fmt.Fprintln(os.Stderr, "-record can't be used with -replay, -ndjson, -render-on-stdin, -golden, or -verify-deterministic")
+		usage()
+	}
+	if *checkFlag && (*watchFlag || *ndjsonFlag || *renderOnStdinFlag || *goldenFlag != "" || *verifyFlag || *verifySumsFlag || *matrixFlag != "" || *recordFlag != "" || *writeSumsFlag || *autoStageFlag) {
+		fmt.Fprintln(os.Stderr, "-check can't be used with -watch, -ndjson, -render-on-stdin, -golden, -verify-deterministic, -verify-sums, -matrix, -record, -write-sums, or -auto-stage")
+		usage()
+	}
+	if *checkOutputFlag && (*checkFlag || *watchFlag || *ndjsonFlag || *renderOnStdinFlag || *goldenFlag != "" || *verifyFlag || *verifySumsFlag || *matrixFlag != "" || *recordFlag != "" || *writeSumsFlag || *autoStageFlag) {
+		fmt.Fprintln(os.Stderr, "-check-output can't be used with -check, -watch, -ndjson, -render-on-stdin, -golden, -verify-deterministic, -verify-sums, -matrix, -record, -write-sums, or -auto-stage")
+		usage()
+	}
+	if *checkOutputFlag && *formatFlag != "svg" {
+		fmt.Fprintln(os.Stderr, "-check-output only works with SVGs")
+		usage()
+	}
+	if *widthFlag < 0 || *heightFlag < 0 {
+		fmt.Fprintf(os.Stderr, "got -width=%d and -height=%d; expected 0 or more\n", *widthFlag, *heightFlag)
+		usage()
+	}
+	if *diffLinesFlag < 0 {
+		fmt.Fprintf(os.Stderr, "got -diff-lines=%d; expected 0 or more\n", *diffLinesFlag)
+		usage()
+	}
+	if *replayFlag != "" && (*ndjsonFlag || *renderOnStdinFlag || *stagedFlag) {
+		fmt.Fprintln(os.Stderr, "-replay can't be used with -ndjson, -render-on-stdin, or -staged")
+		usage()
+	}
+	if *serveFlag != "" && (*goldenFlag != "" || *verifyFlag || *verifySumsFlag) {
+		fmt.Fprintln(os.Stderr, "-serve can't be used with -golden, -verify-deterministic, or -verify-sums")
+		usage()
+	}
+	if *watchHashFlag && !*watchFlag {
+		fmt.Fprintln(os.Stderr, "-watch-hash needs -watch")
+		usage()
+	}
+	if *updateGoldenFlag && *goldenFlag == "" {
+		fmt.Fprintln(os.Stderr, "-update-golden needs -golden")
+		usage()
+	}
+	if *formatFlag != "svg" && *formatFlag != "png" && *formatFlag != "pdf" {
+		fmt.Fprintf(os.Stderr, "got -format=%s; expected svg, png, or pdf\n", *formatFlag)
+		usage()
+	}
+	if *scaleFlag <= 0 {
+		fmt.Fprintf(os.Stderr, "got -scale=%g; expected more than 0\n", *scaleFlag)
+		usage()
+	}
+	if *backgroundFlag != "" && *formatFlag == "svg" {
+		fmt.Fprintln(os.Stderr, "-background needs -format=png or pdf")
+		usage()
+	}
+	if *formatFlag != "svg" && (diffFlag != "" || *htmlFlag || *htmlTemplateFlag != "" || *placeholderFlag) {
+		fmt.Fprintln(os.Stderr, "-diff, -html, -html-template, and -error-placeholder only work with SVGs")
+		usage()
+	}
+	if *stagedFlag && (*watchFlag || *ndjsonFlag || *renderOnStdinFlag) {
+		fmt.Fprintln(os.Stderr, "-staged can't be used with -watch, -ndjson, or -render-on-stdin")
+		usage()
+	}
+	if *matrixFlag != "" && (*watchFlag || *ndjsonFlag || *renderOnStdinFlag || *goldenFlag != "" || *verifyFlag) {
+		fmt.Fprintln(os.Stderr, "-matrix can't be used with -watch, -ndjson, -render-on-stdin, -golden, or -verify-deterministic")
+		usage()
+	}
+	if *skipIfUnavailableFlag && (*watchFlag || *ndjsonFlag || *renderOnStdinFlag) {
+		fmt.Fprintln(os.Stderr, "-skip-if-unavailable can't be used with -watch, -ndjson, or -render-on-stdin")
+		usage()
+	}
+	if *autoStageFlag && !*stagedFlag {
+		fmt.Fprintln(os.Stderr, "-auto-stage needs -staged")
+		usage()
+	}
+	if *placeholderFlag && *removeOnFailFlag {
+		fmt.Fprintln(os.Stderr, "-error-placeholder and -remove-on-fail can't be used together")
 		usage()
 	}
 
-	switch {
-	default:
-		log.SetFlags(0)
-		log.SetOutput(io.Discard)
-	case *logFlag:
+	if *failOnDuplicatesFlag {
+		*dedupeReportFlag = true
+	}
+	if *logFormatFlag == "json" {
+		logger = new(jsonLogger)
+	}
+	if *logFlag || *logFormatFlag == "json" {
 		enableLogging()
 	}
 
-	pairs := make([]renderPair, 0)
-	for _, inputName := range flag.Args() {
-		if !strings.HasSuffix(inputName, mmd) {
-			fatalf("got input MermaidJS document %s; expected it to end with %s", inputName, mmd)
+	stopDeadline := startDeadline()
+	defer stopDeadline()
+
+	if *themeMapFlag != "" {
+		if err := loadThemeMap(); err != nil {
+			fatalf("couldn't load theme map: %v", err)
 		}
-		svgName := strings.TrimSuffix(inputName, mmd) + svg
-		if *dirFlag != "" {
-			svgName = path.Join(*dirFlag, path.Base(svgName))
+	}
+
+	if *nameTemplateFlag != "" {
+		t, err := plan.ParseNameTemplate(*nameTemplateFlag)
+		if err != nil {
+			fatalf("couldn't parse -name-template: %v", err)
 		}
-		pairs = append(pairs, renderPair{
-			mmdName: inputName,
-			svgName: svgName,
-		})
+		nameTemplate = t
+	}
+
+	if *htmlFlag || *htmlTemplateFlag != "" {
+		*htmlFlag = true
+		t, err := loadHTMLTemplate()
+		if err != nil {
+			fatalf("couldn't load HTML template: %v", err)
+		}
+		htmlTemplate = t
 	}
 
-	renderer = NewRenderer()
+	if *replayFlag != "" {
+		ok := replaySession(*replayFlag)
+		stopRenderer(mainRenderer)
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *ndjsonFlag {
+		mainRenderer = newRenderer(rendererOptionsFromFlags()...)
+		if err := renderNDJSON(os.Stdin, os.Stdout); err != nil {
+			fatalf("%v", err)
+		}
+		stopRenderer(mainRenderer)
+		return
+	}
+
+	if *showConfigFlag {
+		mainRenderer = newRenderer(rendererOptionsFromFlags()...)
+		showEffectiveConfig(flag.Arg(0))
+		stopRenderer(mainRenderer)
+		return
+	}
+
+	if *renderOnStdinFlag {
+		mainRenderer = newRenderer(rendererOptionsFromFlags()...)
+		if err := renderOnStdin(os.Stdin, os.Stdout); err != nil {
+			fatalf("%v", err)
+		}
+		stopRenderer(mainRenderer)
+		return
+	}
+
+	var (
+		inputs []inputArg
+		pairs  []renderPair
+		err    error
+	)
 	switch {
-	case *watchFlag:
-		watchAndRender(pairs)
+	case *manifestFlag != "":
+		// The manifest's outputs are its own; it checks that no
+		// two entries share one.
+		if pairs, err = loadManifest(); err != nil {
+			fatalf("couldn't load manifest: %v", err)
+		}
 	default:
+		if *stagedFlag {
+			// Nothing staged is fine: most commits have no diagrams.
+			inputs, err = stagedInputs()
+		} else {
+			inputs, err = expandInputs(flag.Args())
+			if err == nil {
+				checkInputs(inputs)
+			}
+		}
+		if err != nil {
+			fatalf("%v", err)
+		}
+		var names []string
+		for _, in := range inputs {
+			for _, name := range in.names {
+				if isMarkdown(name) {
+					noteMarkdown(name)
+				}
+				names = append(names, name)
+			}
+		}
+		if *matrixFlag != "" {
+			if err := loadMatrix(); err != nil {
+				fatalf("couldn't load matrix: %v", err)
+			}
+		}
+		// The plan checks that no two documents share an output.
+		if pairs, err = planPairs(names, matrixVariants()); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	if *dryRunFlag {
 		for _, pair := range pairs {
-			render(pair)
+			fmt.Printf("%s -> %s\n", pair.docName(), pair.svgName)
+		}
+		return
+	}
+	runPairs = pairs
+	if len(pairs) == 0 {
+		// -allow-empty: nothing to render, but still report so.
+		writeReports()
+		return
+	}
+
+	if *verifySumsFlag {
+		if !verifySums(pairs) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if !*verifyFlag && *goldenFlag == "" && !*checkFlag && !*checkOutputFlag && pairs[0].svgName != stdioName {
+		lockOutputs(pairs, *lockTimeoutFlag)
+	}
+
+	opts := rendererOptionsFromFlags()
+	mainRenderer = newRenderer(opts...)
+	if *recordFlag != "" {
+		startRecording(mainRenderer)
+	}
+	if *checkUpdateFlag {
+		checkMermaidUpdate(mainRenderer.Version())
+	}
+	failed, parseFailures := false, false
+	switch {
+	case *verifyFlag:
+		failed = !verifyDeterministic(pairs, *verifyFreshFlag, opts)
+	case *goldenFlag != "":
+		failed = !checkGolden(pairs, *goldenFlag, *updateGoldenFlag)
+	case *checkFlag:
+		if checkAll(pairs) > 0 {
+			failed, parseFailures = true, onlyParseErrors()
+		}
+	case *checkOutputFlag:
+		if checkOutputs(pairs) > 0 {
+			failed, parseFailures = true, onlyParseErrors()
+		}
+	case *watchFlag:
+		watchAndRender(pairs, inputs)
+	default:
+		stale := pairs
+		if !*forceFlag {
+			stale = skipUpToDate(pairs)
+		}
+		render := renderAll
+		if len(matrix) > 0 {
+			render = renderMatrix
+		}
+		if n := render(stale); n > 0 {
+			failed, parseFailures = true, onlyParseErrors()
+			errorf("%d of %d documents failed", n, len(stale))
+		}
+		if *dedupeReportFlag {
+			if n := reportDuplicates(); n > 0 && *failOnDuplicatesFlag {
+				failed, parseFailures = true, false
+				errorf("%d groups of documents render the same diagram", n)
+			}
 		}
 	}
-	renderer.Stop()
+	if deadlineExceeded() {
+		abortRun()
+	}
+	writeReports()
+	stopRenderer(mainRenderer)
+	if !failed && *writeSumsFlag {
+		updateSums(pairs)
+	}
+	if !failed && *autoStageFlag {
+		if err := autoStage(pairs); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	unlockOutputs()
+	if failed && parseFailures {
+		os.Exit(parseErrorExitStatus)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// inputPairs returns the pairs for the input inputName: one for a
+// MermaidJS document, or one for each mermaid block of a Markdown
+// file, which is noted for the watcher.
+func inputPairs(inputName string) ([]renderPair, error) {
+	if isMarkdown(inputName) {
+		noteMarkdown(inputName)
+	}
+	return planPairs([]string{inputName}, nil)
+}
+
+// newRenderPair returns the pair for the document inputName, with
+// the SVG name that -outdir and -name-from-title call for.
+func newRenderPair(inputName string) (renderPair, error) {
+	pairs, err := planPairs([]string{inputName}, nil)
+	if err != nil {
+		return renderPair{}, err
+	}
+	return pairs[0], nil
+}
+
+// nameTemplate is the -name-template, parsed once at startup, or
+// nil.
+var nameTemplate *texttemplate.Template
+
+// planPairs returns the pairs for inputs, rendered once per
+// variant if there are any, as plan.Outputs plans them with the
+// flags: -format, -outdir, -name-template, -name-from-title,
+// -split-threshold, and -split.
+func planPairs(inputs []string, variants []plan.Variant) ([]renderPair, error) {
+	opts := plan.Options{
+		Format:   *formatFlag,
+		OutDir:   *dirFlag,
+		Blocks:   countBlocks,
+		Name:     nameTemplate,
+		Variants: variants,
+	}
+	if *nameFromTitleFlag {
+		opts.Title = docTitle
+	}
+	if *splitThresholdFlag > 0 {
+		opts.Parts = countParts
+	}
+	if *splitFlag {
+		opts.Parts = countDiagrams
+	}
+	planned, err := plan.Outputs(inputs, opts)
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([]renderPair, len(planned))
+	for i, p := range planned {
+		pairs[i] = renderPair{mmdName: p.Input, svgName: p.Output, block: p.Block, variant: p.Variant}
+	}
+	return pairs, nil
+}
+
+// docTitle returns the title of the document name, or of its
+// block'th mermaid block if it's Markdown, for -name-from-title.
+func docTitle(name string, block int) (string, error) {
+	b, err := readInput(name)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read %s: %w", name, err)
+	}
+	src := string(b)
+	if block > 0 {
+		blocks := markdownBlocks(src)
+		if block > len(blocks) {
+			return "", fmt.Errorf("%s has no mermaid block %d", name, block)
+		}
+		src = blocks[block-1].src
+	}
+	return sourceTitle(src), nil
+}
+
+// rendererOptionsFromFlags turns the flags that configure the
+// renderer into renderer.Options.
+//
+// It prints and exits for any error.
+func rendererOptionsFromFlags() []renderer.Option {
+	bundle, err := readMermaidJS()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	opts := []renderer.Option{renderer.WithMermaidJS(bundle), renderer.WithBundleName(mermaidJSOrigin())}
+	if *emojiFontFlag != "" {
+		b, err := os.ReadFile(*emojiFontFlag)
+		if err != nil {
+			fatalf("couldn't read emoji font: %v", err)
+		}
+		opts = append(opts, renderer.WithEmojiFont(b))
+	}
+	opts = append(opts, extraJSOptions()...)
+	if *jobsFlag > 0 {
+		opts = append(opts, renderer.WithConcurrency(*jobsFlag))
+	}
+	if *cjkFontFlag != "" {
+		b, err := os.ReadFile(*cjkFontFlag)
+		if err != nil {
+			fatalf("couldn't read CJK font: %v", err)
+		}
+		opts = append(opts, renderer.WithCJKFont(b))
+	}
+	config := make(map[string]any)
+	if *configFlag != "" {
+		var err error
+		if config, err = loadMermaidConfig(*configFlag); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	if len(gitGraphFlag) > 0 {
+		renderer.MergeConfig(config, map[string]any{"gitGraph": map[string]any(gitGraphFlag)})
+	}
+	if *cssFlag != "" {
+		css, err := os.ReadFile(*cssFlag)
+		if err != nil {
+			fatalf("couldn't read CSS: %v", err)
+		}
+		if _, ok := config["themeCSS"]; ok {
+			warnf("-css %s overrides the themeCSS in %s", *cssFlag, *configFlag)
+		}
+		opts = append(opts, renderer.WithCSS(string(css)))
+	}
+	if *fontFlag != "" {
+		opts = append(opts, renderer.WithFontFamily(*fontFlag))
+	}
+	if len(config) > 0 {
+		opts = append(opts, renderer.WithConfig(config))
+	}
+	cliConfig = config
+	opts = append(opts, renderer.WithRenderTimeout(*timeoutFlag), renderer.WithStartupTimeout(*startupTimeoutFlag))
+	if url := remoteChromeURL(); url != "" {
+		opts = append(opts, renderer.WithRemoteChrome(url))
+	}
+	if *chromePathFlag != "" {
+		opts = append(opts, renderer.WithChromePath(*chromePathFlag))
+	}
+	if len(chromeFlagFlag) > 0 {
+		opts = append(opts, renderer.WithChromeFlags(chromeFlagFlag...))
+	}
+	if *themeFlag != "" {
+		opts = append(opts, renderer.WithTheme(*themeFlag))
+	}
+	if *deterministicFlag {
+		opts = append(opts, renderer.WithDeterministic(artifactTime()))
+	}
+	return opts
 }
 
 // watchAndRender immediately renders the MermaidJS documents in
 // inputNames and sets up a watcher to rerender the documents if
 // they change.
 //
-// The watcher polls all files every 250ms.  It prints and exits
-// for any error.
-func watchAndRender(pairs []renderPair) {
-	modTime := func(name string) time.Time {
-		info, err := os.Stat(name)
+// The watcher watches the files' directories with fsnotify, and
+// checks a file once it's gone 100ms without another event, for a
+// newer modification time, or with -watch-hash for changed contents
+// (see statFile).  If fsnotify can't be set up it polls all files
+// every 250ms instead.  It compares contents on its own if the
+// files' times are only to the second.  A file that's deleted is
+// reported and stays watched, to be rendered again when it comes
+// back, as does a document that fails to render.  It prints and
+// exits for any other error.
+//
+// A document that appears in a directory named by inputs, or that
+// matches a pattern the cli expanded, is rendered and watched too.
+//
+// Changed documents are rendered from a queue: one that changed on
+// its own, as when it's being edited, goes before ones that changed
+// together, as in a branch switch, and the most recently modified
+// goes first.  A document modified again while queued moves up.
+// They're rendered one at a time by a renderWorker, so changes are
+// taken in while a document renders, and a document modified while
+// it renders is queued to render again, from what's on disk then.
+// A reload, or a change to the -theme-map or -css file, waits for
+// the render in flight.
+//
+// On SIGHUP (or "r" and Enter on Windows) it restarts the
+// renderer, which re-reads the font files and re-initializes
+// MermaidJS, and rerenders every document whether it changed or
+// not.
+//
+// On SIGUSR1 it prints its status to Stderr, between renders, and
+// with -status-file it writes the same status to a file every 5s.
+//
+// With -serve it serves the outputs too, with an index page that
+// reloads after each render (see previewServer), until it stops.
+func watchAndRender(pairs []renderPair, inputs []inputArg) {
+	hash := *watchHashFlag
+	if !hash && coarseModTimes(pairs) {
+		log.Println("modification times are only to the second; comparing contents instead, as with -watch-hash")
+		hash = true
+	}
+
+	status := newWatchStatus(pairs)
+	if *serveFlag != "" {
+		srv, err := startPreviewServer(*serveFlag, pairs)
 		if err != nil {
-			fatalf("couldn't get info: %v", err)
+			fatalf("couldn't serve previews: %v", err)
 		}
-		return info.ModTime()
+		defer srv.Close()
+		status.preview = srv
+		fmt.Fprintf(os.Stderr, "serving previews at %s\n", srv.URL())
 	}
-
-	modTimes := make(map[string]time.Time)
 	for _, pair := range pairs {
-		render(pair)
-		modTimes[pair.mmdName] = modTime(pair.mmdName)
+		status.render(pair)
+	}
+	names := append(watchedNames(pairs), dirDefaultsNames(pairs)...)
+	for _, name := range []string{*themeMapFlag, *cssFlag} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	states := make(map[string]fileState)
+	for _, name := range names {
+		states[name] = statFile(name, hash)
+	}
+	status.writeStatusFile()
+
+	// check looks at the watched file name, which may have changed,
+	// and returns the jobs to render any documents it changed.
+	check := func(name string) []watchJob {
+		old, st := states[name], statFile(name, hash)
+		states[name] = st
+		if filepath.Base(name) == dirDefaultsName {
+			// Adding or removing one changes settings too.
+			if !old.changed(st) && old.missing == st.missing {
+				return nil
+			}
+			var jobs []watchJob
+			for _, pair := range reloadDirDefaults(pairs, name) {
+				jobs = append(jobs, watchJob{pair: pair, modTime: st.modTime})
+			}
+			return jobs
+		}
+		if st.missing && !old.missing {
+			warnf("%s is gone; watching for it to come back", name)
+		}
+		if !old.changed(st) {
+			return nil
+		}
+		var jobs []watchJob
+		if name == *themeMapFlag {
+			for _, pair := range reloadThemeMap(pairs) {
+				jobs = append(jobs, watchJob{pair: pair, modTime: st.modTime})
+			}
+			return jobs
+		}
+		if name == *cssFlag {
+			for _, pair := range reloadCSS(pairs) {
+				jobs = append(jobs, watchJob{pair: pair, modTime: st.modTime})
+			}
+			return jobs
+		}
+		if replans(name) {
+			pairs = replanInput(pairs, name)
+		}
+		for _, pair := range pairs {
+			if pair.mmdName == name {
+				jobs = append(jobs, watchJob{pair: pair, modTime: st.modTime})
+			}
+		}
+		return jobs
+	}
+
+	// Changed documents are queued, and rendered one at a time by
+	// a worker, so the watcher keeps taking in changes (and can
+	// reorder the queue) while a document renders.
+	var queue renderQueue
+	push := func(jobs []watchJob) {
+		for _, j := range jobs {
+			j.bulk = len(jobs) > 1
+			queue.push(j)
+		}
+	}
+	ready := make(chan struct{})
+	close(ready)
+	worker := startRenderWorker(render)
+	defer worker.stop()
+
+	// The theme map and CSS files change what the renderer renders
+	// with, so changes to them wait for the render in flight, as a
+	// reload does.
+	var (
+		deferred      []string
+		reloadPending bool
+	)
+	checkNames := func(names []string) []watchJob {
+		var jobs []watchJob
+		for _, name := range names {
+			if worker.busy && (name == *themeMapFlag || name == *cssFlag) {
+				if !slices.Contains(deferred, name) {
+					deferred = append(deferred, name)
+				}
+				continue
+			}
+			jobs = append(jobs, check(name)...)
+		}
+		return jobs
 	}
 
-	stop := make(chan os.Signal)
+	// Files are watched with fsnotify, or polled four times a
+	// second if that can't be set up.
+	var (
+		events <-chan string
+		found  <-chan struct{}
+		poll   <-chan time.Time
+	)
+	fw, err := newFileWatcher(names)
+	if err != nil {
+		warnf("couldn't watch for file events, so polling instead: %v", err)
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		poll = ticker.C
+	} else {
+		defer fw.Close()
+		events = fw.changed
+		found = fw.found
+		for _, in := range inputs {
+			fw.watchDirs(in.dirs)
+		}
+	}
+
+	// find looks for new documents in the directories and patterns
+	// of inputs, starts watching them, and returns the jobs to
+	// render them.
+	find := func() []watchJob {
+		var jobs []watchJob
+		for _, in := range inputs {
+			if in.dirs == nil {
+				continue // not a directory or pattern
+			}
+			now, err := expandInput(in.arg)
+			if err != nil {
+				errorf("%v", err)
+				continue
+			}
+			if fw != nil {
+				fw.watchDirs(now.dirs)
+			}
+			for _, name := range now.names {
+				if _, ok := states[name]; ok {
+					continue
+				}
+				newPairs, err := inputPairs(name)
+				if err != nil {
+					errorf("%v", err)
+					continue
+				}
+				log.Println("found", name)
+				st := statFile(name, hash)
+				states[name] = st
+				names = append(names, name)
+				if fw != nil {
+					fw.add(name)
+				}
+				pairs = append(pairs, newPairs...)
+				for _, pair := range newPairs {
+					jobs = append(jobs, watchJob{pair: pair, modTime: st.modTime})
+				}
+				for _, name := range dirDefaultsNames(newPairs) {
+					if _, ok := states[name]; ok {
+						continue
+					}
+					states[name] = statFile(name, hash)
+					names = append(names, name)
+					if fw != nil {
+						fw.add(name)
+					}
+				}
+			}
+		}
+		return jobs
+	}
+
+	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
-	ticker := time.NewTicker(250 * time.Millisecond)
+	reload := make(chan struct{}, 1)
+	notifyReload(reload)
+
+	dump := make(chan struct{}, 1)
+	notifyStatus(dump)
+
+	statusTicker := time.NewTicker(5 * time.Second)
+
+	restart := func() {
+		log.Println("reload triggered; restarting renderer and rerendering everything")
+		stopRenderer(mainRenderer)
+		mainRenderer = newRenderer(rendererOptionsFromFlags()...)
+		status.restarts++
+		queue.clear()
+		find()
+		for _, name := range names {
+			states[name] = statFile(name, hash)
+			if replans(name) {
+				pairs = replanInput(pairs, name)
+			}
+		}
+		for _, pair := range pairs {
+			status.render(pair)
+		}
+	}
 
 	log.Println("watching...")
 
 Loop:
 	for {
+		var work <-chan struct{}
+		if queue.len() > 0 && !worker.busy {
+			work = ready
+		}
 		select {
 		case <-stop:
 			fmt.Fprintln(os.Stdout)
+			if o, ok := worker.wait(); ok {
+				status.record(o)
+			}
 			break Loop
-		case <-ticker.C:
-			for _, pair := range pairs {
-				t := modTime(pair.mmdName)
-				if t.After(modTimes[pair.mmdName]) {
-					modTimes[pair.mmdName] = t
-					render(pair)
-				}
+		case <-runCtx.Done():
+			abortRun()
+		case <-reload:
+			if worker.busy {
+				reloadPending = true
+				continue
+			}
+			restart()
+		case <-dump:
+			status.writeTo(os.Stderr)
+		case <-statusTicker.C:
+			status.writeStatusFile()
+		case name := <-events:
+			push(checkNames(append([]string{name}, fw.settled()...)))
+		case <-found:
+			push(find())
+		case <-poll:
+			push(append(find(), checkNames(names)...))
+		case <-work:
+			worker.start(queue.pop().pair)
+		case o := <-worker.done:
+			worker.finished()
+			status.record(o)
+			jobs := checkNames(deferred)
+			deferred = nil
+			if reloadPending {
+				reloadPending = false
+				restart() // which renders everything
+				continue
 			}
+			push(jobs)
 		}
 	}
 
@@ -147,167 +1087,576 @@ Loop:
 	return
 }
 
+// watchedNames returns the files the watcher watches for pairs:
+// their documents, and the Markdown files named on the command
+// line, once each.
+func watchedNames(pairs []renderPair) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range markdownInputs() {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, pair := range pairs {
+		if !seen[pair.mmdName] {
+			seen[pair.mmdName] = true
+			names = append(names, pair.mmdName)
+		}
+	}
+	return names
+}
+
 // render renders the MermaidJS document at pair.mmdName to
 // SVG at pair.svgName.
 //
-// It prints and exits for any error.
-func render(pair renderPair) {
-	b, err := os.ReadFile(pair.mmdName)
-	if err != nil {
-		fatalf("couldn't read MMD: %v", err)
-	}
+// An SVG over its -max-output-size budget fails the document like
+// a render error, unless -write-oversized, which writes it before
+// failing.
+//
+// With -format=png it writes a PNG, at -scale, instead, and with
+// -format=pdf a PDF.
+//
+// Local images of image shapes are inlined; see inlineImages.
+// With -embed-source the SVG carries the document's source.  With
+// -metadata it also writes the SVG's metadata sidecar, with -html
+// a page showing it, and with -diff it prints how the SVG changed
+// once it's written.
+//
+// With -err-sidecars, a document that fails also gets a file
+// next to it, file.mmd.err.txt, with the failure in full (see
+// writeErrSidecar), which is removed once it renders again.
+//
+// If the document can't be read, rendered, or written, render
+// prints the error, naming the document, and returns it, for the
+// caller to carry on with the next document.  The existing SVG
+// (and sidecar) is left as is, or removed with -remove-on-fail, or
+// with -error-placeholder replaced with a placeholder SVG showing
+// the error.  If -max-total-time runs out during the render, it
+// ends the run with abortRun instead.
+//
+// Batches of documents go through render's stages as a pipeline;
+// see renderAll.
+func render(pair renderPair) error {
+	d := readDoc(pair)
+	d.render(mainRenderer)
+	return finishRender(d)
+}
 
-	svgResult, err := renderer.Render(string(b))
-	if err != nil {
-		fatalf("couldn't render %s: %v", pair.mmdName, err)
+// renderDoc is a document on its way through render's stages:
+// readDoc, renderDoc.render, and finishRender.
+type renderDoc struct {
+	pair    renderPair
+	start   time.Time
+	src     []byte
+	readErr error
+
+	// lineOffset is how many lines of the input file come before
+	// src, for a Markdown block.
+	lineOffset int
+
+	result     renderer.RenderResult
+	image      []byte // with -format=png or pdf
+	sizeErr    error  // the SVG is over budget
+	err        error  // the document failed
+	errDetails *renderer.RenderErrorDetails
+
+	// unknownConfig are the settings the document sets that
+	// MermaidJS doesn't know (see checkDocConfig).
+	unknownConfig []string
+
+	// overriddenConfig are the settings the document sets that
+	// -force-config removed (see forceDocConfig).
+	overriddenConfig []string
+}
+
+// readDoc reads the document of pair.
+func readDoc(pair renderPair) *renderDoc {
+	d := &renderDoc{pair: pair, start: time.Now()}
+	if pair.mmdName == stdioName {
+		d.src, d.readErr = io.ReadAll(os.Stdin)
+		return d
+	}
+	if pair.block > 0 && isMarkdown(pair.mmdName) {
+		block, err := readMarkdownBlock(pair)
+		d.src, d.readErr, d.lineOffset = []byte(block.src), err, block.line-1
+		return d
+	}
+	if pair.block > 0 && *splitFlag {
+		chunk, err := readDiagram(pair)
+		d.src, d.readErr, d.lineOffset = []byte(chunk.src), err, chunk.line-1
+		return d
+	}
+	if pair.block > 0 {
+		d.src, d.readErr = readSplitPart(pair)
+		return d
 	}
+	d.src, d.readErr = readInput(pair.mmdName)
+	return d
+}
 
-	if err := os.WriteFile(pair.svgName, []byte(svgResult), 0644); err != nil {
-		fatalf("couldn't write SVG: %v", err)
+// readInput reads the input file name: from the git index if
+// -staged found it there, or else from disk.
+func readInput(name string) ([]byte, error) {
+	if path, ok := stagedPaths[name]; ok {
+		return stagedBlob(path)
 	}
-	log.Println("rendered", pair.svgName)
+	return os.ReadFile(name)
 }
 
-// svgRenderer manages the setup and teardown of the headeless
-// Chrome browser, and the rendering of a MermaidJS document.
-type svgRenderer struct {
-	ctx    context.Context
-	cancel context.CancelFunc
+// readSource reads the source of pair's document: its input file,
+// its block of a Markdown file, its diagram of a document -split
+// splits, or its part of a split flowchart.
+func readSource(pair renderPair) ([]byte, error) {
+	if pair.block == 0 {
+		return readInput(pair.mmdName)
+	}
+	if !isMarkdown(pair.mmdName) && *splitFlag {
+		chunk, err := readDiagram(pair)
+		return []byte(chunk.src), err
+	}
+	if !isMarkdown(pair.mmdName) {
+		return readSplitPart(pair)
+	}
+	block, err := readMarkdownBlock(pair)
+	return []byte(block.src), err
 }
 
-// mermaidInitializeConfig fulfills some basic requirements for
-// using MermaidJS.
-type mermaidInitializeConfig struct {
-	Theme       string `json:"theme,omitempty"`
-	StartOnLoad bool   `json:"startOnLoad"`
+// render renders d's SVG with r, and validates, scopes, and
+// checks its size as the flags call for, without printing or
+// writing anything.
+func (d *renderDoc) render(r *renderer.Renderer) {
+	if d.readErr != nil {
+		return
+	}
+	src, err := inlineImages(d.pair.mmdName, string(d.src))
+	if err != nil {
+		d.err = err
+		return
+	}
+	if known, err := loadKnownConfig(r); err == nil {
+		d.unknownConfig, src = checkDocConfig(src, known, *stripUnknownFlag && !*strictFlag)
+		if len(d.unknownConfig) > 0 && *strictFlag {
+			d.err = fmt.Errorf("sets config MermaidJS %s doesn't know: %s", r.Version(), strings.Join(d.unknownConfig, ", "))
+			return
+		}
+	}
+	if *forceConfigFlag {
+		d.overriddenConfig, src = forceDocConfig(src, forcedConfig())
+	}
+	var (
+		result     renderer.RenderResult
+		browserErr *renderer.BrowserError
+		timeoutErr *renderer.RenderTimeoutError
+	)
+	// A browser that's died shows up first here, and is restarted
+	// below, like one that dies during the render.
+	err = applyDocConfig(r, d.pair, string(d.src))
+	if err != nil && !errors.As(err, &browserErr) {
+		d.err = err
+		return
+	}
+	if err == nil {
+		result, err = r.RenderDiagram(runCtx, src)
+		if err != nil && *errSidecarsFlag {
+			d.errDetails, _ = r.RenderError(runCtx)
+		}
+	}
+	switch {
+	case errors.As(err, &timeoutErr):
+		// Whatever MermaidJS was in the middle of, it's in no
+		// state to go on from.
+		if err := r.Reload(runCtx); err != nil {
+			errorf("couldn't reload the page after %s timed out: %v", d.pair.docName(), err)
+		}
+	case errors.As(err, &browserErr):
+		// The browser itself is gone.  Unless the run is out of
+		// time, start another and try once more.
+		if deadlineExceeded() {
+			break
+		}
+		next, restartErr := replaceRenderer(r, err)
+		if restartErr != nil {
+			d.err = restartErr
+			return
+		}
+		if next == nil {
+			break
+		}
+		r = next
+		if err = applyDocConfig(r, d.pair, string(d.src)); err == nil {
+			result, err = r.RenderDiagram(runCtx, src)
+		}
+	case err != nil:
+		result, err = recoverPage(r, d.pair.docName(), err, func() (renderer.RenderResult, error) {
+			return d.renderInNewTab(r, src)
+		})
+	}
+	recording.record(r, d.pair.docName(), src, result.SVG, err)
+	var parseErr *renderer.ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.File = d.pair.mmdName
+		if parseErr.Line > 0 {
+			parseErr.Line += d.lineOffset
+		}
+	}
+	if err == nil && !*noValidateFlag {
+		err = validateSVG(result.SVG)
+	}
+	if err == nil {
+		var sized string
+		if sized, err = sizeSVG(result.SVG, *widthFlag, *heightFlag, *noMaxWidthFlag); err == nil {
+			result.SVG = sized
+		}
+	}
+	if err == nil && *scopePrefixFlag != "" {
+		result.SVG = scopeSVG(result.SVG, *scopePrefixFlag)
+	}
+	if err == nil && *embedSourceFlag {
+		result.SVG = embedSource(result.SVG, string(d.src))
+	}
+	var sizeErr error
+	if err == nil {
+		var budget byteSize
+		budget, err = maxOutputSize(string(d.src))
+		if err == nil {
+			sizeErr = checkOutputSize(result.SVG, budget)
+		}
+		if sizeErr != nil && !*writeOversizedFlag {
+			err = sizeErr
+		}
+	}
+	switch {
+	case err != nil:
+	case *formatFlag == "png":
+		d.image, err = r.RenderPNG(runCtx, result.SVG, *scaleFlag, *backgroundFlag)
+	case *formatFlag == "pdf":
+		d.image, err = r.RenderPDF(runCtx, result.SVG, *backgroundFlag)
+	}
+	d.result, d.sizeErr, d.err = result, sizeErr, err
 }
 
-// mermaidJSSource is the source for MermaidJS that will be
-// registered with the headles Chrome browser.
-//
-// Use the minified version (see download.sh) for a smaller
-// binary.
-//
-//go:embed mermaid.min.js
-var mermaidJSSource string
+// finishRender prints what there is to print about d, and writes
+// its SVG and the other outputs, or handles its failure; see
+// render.
+func finishRender(d *renderDoc) error {
+	pair, start, b := d.pair, d.start, d.src
+	fail := func(err error, format string, args ...any) error {
+		recordRender(pair, start, renderer.RenderResult{}, err)
+		fileErrorf(pair.mmdName, err, format, args...)
+		return err
+	}
+	if d.readErr != nil {
+		return fail(d.readErr, "couldn't read MMD: %v", d.readErr)
+	}
 
-// extrasJSSource has helper code that will be registered with
-// the browser, in addition to mermaidJSSource.
-//
-//   - renderSVG calls MermaidJS's render func, and will be called
-//     by the Render method.
-const extrasJSSource = `
-async function renderSVG(src) {
-		const { svg } = await mermaid.render('mermaid', src);
-		return svg;
-}
-`
+	if !mainRenderer.HasColorEmoji() && containsEmoji(string(b)) {
+		fileWarnf(pair.mmdName, "%s has emoji but the browser has no color emoji font, so they may draw as empty boxes; use -emoji-font to supply one", pair.docName())
+	}
+	if !mainRenderer.HasCJKGlyphs() && containsCJK(string(b)) {
+		fileWarnf(pair.mmdName, "%s has Chinese, Japanese, or Korean text but the browser has no font for it, so it may draw as empty boxes in mis-sized shapes; use -cjk-font to supply one", pair.docName())
+	}
 
-// NewRenderer starts a headless Chrome browser and sets up
-// MermaidJS with that browser.
-//
-// Prints and exits for any error.
-func NewRenderer() svgRenderer {
-	log.Println("starting headless browser")
+	if len(d.unknownConfig) > 0 && !*strictFlag {
+		what := "which it ignores"
+		if *stripUnknownFlag {
+			what = "so they were removed before rendering"
+		}
+		fileWarnf(pair.mmdName, "%s sets config MermaidJS %s doesn't know, %s: %s", pair.docName(), mainRenderer.Version(), what, strings.Join(d.unknownConfig, ", "))
+	}
+	if len(d.overriddenConfig) > 0 {
+		log.Printf("-force-config overrides %s's %s", pair.docName(), strings.Join(d.overriddenConfig, ", "))
+	}
+
+	result, sizeErr, err := d.result, d.sizeErr, d.err
+	if err != nil {
+		var parseErr *renderer.ParseError
+		switch hint := separatorHint(pair, b); {
+		case hint != "":
+			fail(err, "%s", hint)
+		case errors.As(err, &parseErr):
+			fail(err, "%s", parseErrorReport(parseErr, string(b), d.lineOffset))
+		default:
+			fail(err, "couldn't render %s: %v", pair.docName(), err)
+		}
+		if deadlineExceeded() {
+			abortRun()
+		}
+		if *errSidecarsFlag {
+			if err := writeErrSidecar(d); err != nil {
+				errorf("couldn't write error sidecar: %v", err)
+			} else {
+				log.Println("wrote", errSidecarName(pair))
+			}
+		}
+		state := outputKeptOld
+		switch {
+		case *placeholderFlag:
+			if err := writeSVG(pair.svgName, []byte(placeholderSVG(pair.docName(), err))); err != nil {
+				errorf("couldn't write SVG: %v", err)
+			} else {
+				state = outputPlaceholder
+				log.Println("wrote error placeholder", pair.svgName)
+			}
+		case *removeOnFailFlag:
+			for _, name := range []string{pair.svgName, inputsName(pair.svgName), metadataName(pair.svgName), htmlName(pair.svgName)} {
+				switch err := os.Remove(name); {
+				case err == nil:
+					log.Println("removed", name)
+				case !errors.Is(err, fs.ErrNotExist):
+					errorf("couldn't remove %s: %v", name, err)
+					continue
+				}
+				if name == pair.svgName {
+					state = outputRemoved
+				}
+			}
+		}
+		if pair.svgName != stdioName {
+			recordFailedOutput(pair, state)
+		}
+		return err
+	}
+
+	var oldSVG []byte
+	if diffFlag != "" {
+		oldSVG, err = os.ReadFile(pair.svgName)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errorf("couldn't read the previous SVG: %v", err)
+		}
+	}
+
+	// The SVG as written is stamped with the versions that
+	// rendered it, and its inputs, for the next run's upToDate;
+	// the result as rendered is what's recorded.
+	svgOut := stampVersion(result.SVG, mainRenderer.Version())
+	if pair.svgName != stdioName {
+		svgOut = stampInputs(svgOut, inputsHash(pair, b))
+	}
+	if d.image != nil {
+		err = writeOutput(pair.svgName, d.image)
+		if err == nil && pair.svgName != stdioName {
+			err = writeInputs(pair.svgName, inputsHash(pair, b))
+		}
+	} else {
+		err = writeSVG(pair.svgName, []byte(svgOut))
+	}
+	if err != nil {
+		return fail(err, "couldn't write SVG: %v", err)
+	}
+	removeErrSidecar(pair)
 
-	ctx, cancel := chromedp.NewContext(context.Background())
+	// Compare the bytes as written, so -output-bom and
+	// -output-newline don't show up as changes.
+	newSVG := string(encodeOutput([]byte(svgOut)))
+	if d.image != nil {
+		logRendered(pair, start, len(d.image))
+	} else {
+		logRendered(pair, start, len(newSVG))
+	}
+	switch {
+	case diffFlag == "":
+	case oldSVG == nil:
+		fmt.Fprintf(os.Stderr, "%s: new\n", pair.svgName)
+	case diffFlag == "full":
+		fmt.Print(limitLines(mermaidtest.Diff(pair.svgName+" (old)", mermaidtest.NormalizeSVG(string(oldSVG)),
+			pair.svgName, mermaidtest.NormalizeSVG(newSVG)), *diffLinesFlag))
+		fallthrough
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %s\n", pair.svgName, summarizeSVGChange(string(oldSVG), newSVG))
+	}
 
-	// Start Chrome and load MermaidJS in browser
-	var ready *cdruntime.RemoteObject
-	if err := chromedp.Run(ctx, chromedp.Evaluate(mermaidJSSource, &ready)); err != nil {
-		fatalf("set up headless browser: %w", err)
+	if *metadataFlag {
+		md := newDiagramMetadata(pair.mmdName, string(b), mainRenderer.Version(), result)
+		if err := writeFileAtomic(metadataName(pair.svgName), md.marshal(), 0644); err != nil {
+			return fail(err, "couldn't write metadata: %v", err)
+		}
+		log.Println("wrote", metadataName(pair.svgName))
 	}
 
-	// Initialize MermaidJS
-	initConfig := mermaidInitializeConfig{
-		Theme:       "default",
-		StartOnLoad: false,
+	if *htmlFlag {
+		if err := writeHTML(pair.mmdName, pair.svgName, result.SVG, result.Title); err != nil {
+			return fail(err, "couldn't write HTML page: %v", err)
+		}
+		log.Println("wrote", htmlName(pair.svgName))
 	}
 
-	jsSource := jsonEncodeJS("mermaid.initialize(", initConfig, ")")
-	ready = nil
-	if err := chromedp.Run(ctx, chromedp.Evaluate(jsSource, &ready)); err != nil {
-		fatalf("initialize mermaid: %w", err)
+	// A split flowchart's parts share an index page, written with
+	// the first.
+	if pair.block == 1 && !isMarkdown(pair.mmdName) && *splitThresholdFlag > 0 {
+		if err := writeSplitIndex(pair); err != nil {
+			return fail(err, "couldn't write index page: %v", err)
+		}
+		log.Println("wrote", splitIndexName(pair))
 	}
 
-	// Load helpers in browser
-	ready = nil
-	if err := chromedp.Run(ctx, chromedp.Evaluate(extrasJSSource, &ready)); err != nil {
-		fatalf("inject additional JavaScript: %w", err)
+	recordRender(pair, start, result, sizeErr)
+	if pair.variant != "" {
+		keepVariantOutput(d)
 	}
+	if sizeErr != nil {
+		fileErrorf(pair.mmdName, sizeErr, "%s: %v", pair.svgName, sizeErr)
+		return sizeErr
+	}
+	return nil
+}
 
-	return svgRenderer{ctx, cancel}
+// showEffectiveConfig prints the MermaidJS config that the
+// document at name renders with to Stdout, as JSON.
+func showEffectiveConfig(name string) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		fileFatalf(name, err, "couldn't read MMD: %v", err)
+	}
+	if err := applyDocConfig(mainRenderer, renderPair{mmdName: name}, string(b)); err != nil {
+		fatalf("%v", err)
+	}
+	if *forceConfigFlag {
+		_, src := forceDocConfig(string(b), forcedConfig())
+		b = []byte(src)
+	}
+	config, err := mainRenderer.EffectiveConfig(runCtx, string(b))
+	if err != nil {
+		fileFatalf(name, err, "couldn't get the config of %s: %v", name, err)
+	}
+	out, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		fatalf("encode config: %v", err)
+	}
+	fmt.Println(string(out))
+	printConfigSources(name)
 }
 
-// Render calls the extras renderSVG func to render mmdSource to
-// SVG.
-func (r svgRenderer) Render(mmdSource string) (svgResult string, err error) {
-	jsSource := jsonEncodeJS("renderSVG(", mmdSource, ")")
-
-	render := chromedp.Evaluate(
-		jsSource,
-		&svgResult,
-		func(p *cdruntime.EvaluateParams) *cdruntime.EvaluateParams {
-			return p.WithAwaitPromise(true)
-		},
+// printConfigSources prints, to Stderr, each file that gives the
+// document name settings, lowest precedence first, with the
+// settings it gives that another file doesn't override.  The
+// document's own front matter and directives override them all.
+func printConfigSources(name string) {
+	var (
+		sources []string
+		from    = make(map[string]string) // setting name to its source
 	)
-
-	if err = chromedp.Run(r.ctx, render); err != nil {
-		return "", unescapeErr(err)
+	add := func(source string, config map[string]any) {
+		sources = append(sources, source)
+		for _, setting := range settingNames(config) {
+			from[setting] = source
+		}
+	}
+	if *configFlag != "" {
+		if config, err := loadMermaidConfig(*configFlag); err == nil {
+			add(*configFlag, config)
+		}
+	}
+	_, files, _ := dirDefaults(name)
+	for _, f := range files {
+		add(f.name, f.config)
+	}
+	if e := matchThemeMap(themeMap, name); e != nil {
+		add(fmt.Sprintf("%s (%s)", *themeMapFlag, e.pattern), e.config)
 	}
 
-	return svgResult, nil
+	for _, source := range sources {
+		var settings []string
+		for setting, s := range from {
+			if s == source {
+				settings = append(settings, setting)
+			}
+		}
+		if len(settings) == 0 {
+			continue
+		}
+		sort.Strings(settings)
+		fmt.Fprintf(os.Stderr, "%s: %s\n", source, strings.Join(settings, ", "))
+	}
 }
 
-// Stop stops the headless Chrome browser.
-func (r svgRenderer) Stop() {
-	r.cancel()
-	log.Println("stopped headless browser")
+// writeSVG writes data to the SVG file name atomically, encoded
+// per -output-bom and -output-newline, first rotating the old SVG
+// into its -keep-old backups.
+func writeSVG(name string, data []byte) error {
+	return writeOutput(name, encodeOutput(data))
 }
 
-// jsonEncodeJS JSON-encodes encodable, and wraps it in pre and
-// post... presumably to make it ready for from chromedp to send
-// in a JSON body... maybe jsonEscapeJS would be more apt.
-func jsonEncodeJS(pre string, encodable any, post string) string {
-	var jsSource strings.Builder
+// writeOutput writes data to the output file name atomically, as
+// is, first rotating the old file into its -keep-old backups.  The
+// name - is stdout.
+func writeOutput(name string, data []byte) error {
+	if name == stdioName {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	// -outdir, the name template, or the manifest can name
+	// directories that aren't there yet.  They're made only now,
+	// so -dry-run, or a run that fails before it renders, leaves
+	// none behind.
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if *keepOldFlag > 0 {
+		if err := rotateBackups(name, data, *keepOldFlag); err != nil {
+			return fmt.Errorf("keep old SVG: %w", err)
+		}
+	}
+	return writeFileAtomic(name, data, 0644)
+}
 
-	jsSource.WriteString(pre)
-	if err := json.NewEncoder(&jsSource).Encode(encodable); err != nil {
-		fatalf("encode source: %w", err)
+// newRenderer starts the renderer with opts, under runCtx, so the
+// browser stops with the run.
+//
+// Prints and exits for any error.
+func newRenderer(opts ...renderer.Option) *renderer.Renderer {
+	log.Println("starting headless browser")
+	r, err := renderer.NewRenderer(runCtx, opts...)
+	if err != nil {
+		if deadlineExceeded() {
+			errorf("%v", err)
+			abortRun()
+		}
+		if *skipIfUnavailableFlag {
+			skipRun(err)
+		}
+		fatalf("%v", err)
 	}
-	jsSource.WriteString(post)
+	return r
+}
 
-	return jsSource.String()
+// stopRenderer stops r's browser, if it started.
+func stopRenderer(r *renderer.Renderer) {
+	if r == nil {
+		return
+	}
+	r.Close()
+	log.Println("stopped headless browser")
 }
 
-var unescaper = strings.NewReplacer(
-	"Error: ", "Error:\n",
-	`\n`, "\n",
-)
+// enableLogging turns on info events, as -log does, unless -q
+// turns them off.
+func enableLogging() {
+	logging = !*quietFlag
+}
 
-func unescapeErr(err error) error {
-	return errors.New(unescaper.Replace(err.Error()))
+// errorf prints the format string and its arguments to Stderr as
+// an error, like fatalf, but doesn't exit.
+func errorf(format string, args ...any) {
+	logEventf("error", "", format, args...)
 }
 
-func enableLogging() {
-	log.SetFlags(3)
-	log.SetOutput(os.Stderr)
+// warnf prints the format string and its arguments to Stderr as a
+// warning, whether or not logging is turned on, unless -q.
+func warnf(format string, args ...any) {
+	logEventf("warning", "", format, args...)
 }
 
-// fatalf logs the format string and its arguments to Stderr and
-// exits with return code 1.  It also stops the renderer.
+// fatalf prints the format string and its arguments to Stderr as
+// an error and exits with return code 1.  It also stops the
+// renderer, and removes the output locks.
 //
-// It also adds some extra formatting so the caller doesn't have
-// to.
+// As with errorf and warnf, the caller needn't add the "error: "
+// prefix or a trailing newline.
 func fatalf(format string, args ...any) {
-	renderer.Stop()
-
-	if !strings.HasPrefix(format, "error: ") {
-		format = "error: " + format
-	}
-	if !strings.HasSuffix(format, "\n") {
-		format += "\n"
-	}
-	enableLogging()
-	log.Fatalf(format, args...)
+	stopRenderer(mainRenderer)
+	unlockOutputs()
+	logEventf("error", "", format, args...)
+	os.Exit(1)
 }
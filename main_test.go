@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// runMainEnv is set in the environment of a test binary that
+// runMain starts, to the arguments for main, as a JSON array.
+const runMainEnv = "MERMAID_CLI_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if env, ok := os.LookupEnv(runMainEnv); ok {
+		var args []string
+		if err := json.Unmarshal([]byte(env), &args); err != nil {
+			panic(err)
+		}
+		os.Args = append([]string{"mermaid-cli"}, args...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the cli, as the test binary, with args, in the
+// current directory, and returns what it printed to Stdout and
+// Stderr, and its exit status.  env is added to its environment.
+func runMain(t *testing.T, env []string, args ...string) (stdout, stderr string, status int) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(exe)
+	cmd.Env = append(append(os.Environ(), runMainEnv+"="+string(b)), env...)
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		status = exitErr.ExitCode()
+	case err != nil:
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), status
+}
+
+// startTestRenderer starts mainRenderer, with the bundle the flags
+// load and opts, for a test that renders as the cli does, and
+// stops it when t is done.  Rendering needs Chrome and a real
+// bundle (see download.sh), so it skips t with -short, or if
+// either is missing.
+func startTestRenderer(t testing.TB, opts ...renderer.Option) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping Chrome test in short mode")
+	}
+	bundle, err := readMermaidJS()
+	if err != nil {
+		t.Skipf("no MermaidJS bundle: %v", err)
+	}
+	// The checked-in stub only stands in for the bundle to build
+	// with; it can't render.
+	if len(bundle) < 1024 {
+		t.Skip("the embedded MermaidJS is a stub; run download.sh")
+	}
+	opts = append([]renderer.Option{renderer.WithMermaidJS(bundle)}, opts...)
+	r, err := renderer.NewRenderer(runCtx, opts...)
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skipf("no Chrome: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainRenderer = r
+	t.Cleanup(func() {
+		r.Close()
+		mainRenderer.Close() // if it was restarted
+		mainRenderer = nil
+		failures, reportEntries = nil, nil
+	})
+}
+
+// chdirTemp changes to a new temporary directory until t is done,
+// with the files in files, by their slash-separated names.
+func chdirTemp(t testing.TB, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		writeTestFile(t, filepath.Join(dir, filepath.FromSlash(name)), data)
+	}
+	old, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(old) })
+	return dir
+}
+
+// writeTestFile writes data to the file name, and the directories
+// it's in, failing t for any error.
+func writeTestFile(t testing.TB, name, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setFlag sets the command-line flag name to value until t is
+// done.
+func setFlag(t testing.TB, name, value string) {
+	t.Helper()
+	f := flag.Lookup(name)
+	if f == nil {
+		t.Fatalf("no flag -%s", name)
+	}
+	old := f.Value.String()
+	if err := flag.Set(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { flag.Set(name, old) })
+}
+
+// TestDryRunMakesNoDirs checks neither -dry-run nor a plan that
+// fails makes the -outdir.
+func TestDryRunMakesNoDirs(t *testing.T) {
+	const flow = "flowchart LR\n    A --> B\n"
+	chdirTemp(t, map[string]string{"x/flow.mmd": flow, "y/flow.mmd": flow})
+	out := filepath.Join("a", "b", "c")
+
+	stdout, stderr, status := runMain(t, nil, "-dry-run", "-o", out, filepath.Join("x", "flow.mmd"))
+	if status != 0 {
+		t.Fatalf("-dry-run exited %d: %s", status, stderr)
+	}
+	if want := filepath.Join("x", "flow.mmd") + " -> " + filepath.Join(out, "flow.svg") + "\n"; stdout != want {
+		t.Errorf("-dry-run printed %q, want %q", stdout, want)
+	}
+	if _, err := os.Stat("a"); err == nil {
+		t.Error("-dry-run made the -outdir")
+	}
+
+	_, stderr, status = runMain(t, nil, "-o", out, filepath.Join("x", "flow.mmd"), filepath.Join("y", "flow.mmd"))
+	if status == 0 {
+		t.Fatal("two documents with one output didn't fail")
+	}
+	if _, err := os.Stat("a"); err == nil {
+		t.Errorf("a run that failed to plan made the -outdir: %s", stderr)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/plan"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// manifestEntry is a -manifest entry: a document, its output, and
+// settings for it over the flags'.
+type manifestEntry struct {
+	input, output string
+
+	// theme and config are MermaidJS settings the document renders
+	// with over -theme and -c; a document's own front matter and
+	// directives still override them.
+	theme  string
+	config map[string]any
+}
+
+// manifest is the -manifest file's entries, in order.
+var manifest []manifestEntry
+
+// loadManifest reads and checks the -manifest file into manifest,
+// and returns a pair for each entry.  Every entry is checked,
+// and all the problems returned together, before anything is
+// rendered.
+func loadManifest() ([]renderPair, error) {
+	name := *manifestFlag
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var raw []map[string]any
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %v; expected a JSON array of entries", name, err)
+		}
+	case ".yaml", ".yml":
+		if raw, err = parseManifestYAML(name, string(b)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s: expected a .json, .yaml, or .yml file", name)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("%s: no entries", name)
+	}
+
+	var (
+		entries []manifestEntry
+		pairs   []renderPair
+		errs    []error
+		outputs = make(map[string]int) // output to its entry
+	)
+	for i, m := range raw {
+		e, err := manifestEntryFrom(filepath.Dir(name), m)
+		if err == nil {
+			if prev, ok := outputs[e.output]; ok {
+				err = fmt.Errorf("output %s is entry %d's too", e.output, prev)
+			} else {
+				outputs[e.output] = i + 1
+			}
+		}
+		if err != nil {
+			input, _ := m["input"].(string)
+			errs = append(errs, fmt.Errorf("%s: entry %d (%s): %w", name, i+1, input, err))
+			continue
+		}
+		entries = append(entries, e)
+		pairs = append(pairs, renderPair{mmdName: e.input, svgName: e.output, entry: i + 1})
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	manifest = entries
+	return pairs, nil
+}
+
+// manifestEntryFrom checks the entry m, as decoded from the
+// manifest in dir, and returns it, with its paths relative to dir.
+func manifestEntryFrom(dir string, m map[string]any) (manifestEntry, error) {
+	var e manifestEntry
+	for _, k := range sortedKeys(m) {
+		switch k {
+		case "input", "output", "theme", "config":
+		default:
+			return e, fmt.Errorf("got key %s; expected input, output, theme, or config", k)
+		}
+	}
+	path := func(key string) (string, error) {
+		s, ok := m[key].(string)
+		if !ok || s == "" {
+			return "", fmt.Errorf("needs an %s path", key)
+		}
+		if filepath.IsAbs(s) {
+			return s, nil
+		}
+		return filepath.Join(dir, s), nil
+	}
+
+	var err error
+	if e.input, err = path("input"); err != nil {
+		return e, err
+	}
+	if !strings.HasSuffix(e.input, plan.MermaidExt) {
+		return e, fmt.Errorf("input %s isn't a MermaidJS document (%s)", e.input, plan.MermaidExt)
+	}
+	info, err := os.Stat(e.input)
+	if err != nil {
+		return e, err
+	}
+	if info.IsDir() {
+		return e, fmt.Errorf("input %s is a directory", e.input)
+	}
+	if e.output, err = path("output"); err != nil {
+		return e, err
+	}
+	if ext := filepath.Ext(e.output); ext != "."+*formatFlag {
+		return e, fmt.Errorf("got output %s; expected a .%s file, for -format=%s", e.output, *formatFlag, *formatFlag)
+	}
+	if info, err := os.Stat(e.output); err == nil && info.IsDir() {
+		return e, fmt.Errorf("output %s is a directory", e.output)
+	}
+
+	if v, ok := m["theme"]; ok {
+		if !isMermaidTheme(v) {
+			return e, fmt.Errorf("got theme %v; expected one of %s", v, strings.Join(mermaidThemes, ", "))
+		}
+		e.theme = v.(string)
+	}
+	if v, ok := m["config"]; ok {
+		config, ok := v.(map[string]any)
+		if !ok {
+			return e, errors.New("config has to be a mapping of MermaidJS settings")
+		}
+		e.config = config
+	}
+	return e, nil
+}
+
+// parseManifestYAML parses the manifest in the file name, with
+// contents src, into its entries.  Like a theme map, it's only as
+// much YAML as it needs: a list of mappings, whose values are
+// scalars, or for config, mappings nested as deep as MermaidJS's
+// settings go.
+//
+//	# Two outputs of one document.
+//	- input: docs/flow.mmd
+//	  output: build/flow-dark.svg
+//	  theme: dark
+//	  config:
+//	    flowchart:
+//	      curve: basis
+//	- input: docs/flow.mmd
+//	  output: build/flow.svg
+func parseManifestYAML(name, src string) ([]map[string]any, error) {
+	var (
+		entries [][]string // each entry's lines, dedented
+		first   []int      // the line each entry starts on
+	)
+	for i, line := range strings.Split(src, "\n") {
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", name, i+1, fmt.Sprintf(format, args...))
+		}
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			if len(entries) > 0 {
+				entries[len(entries)-1] = append(entries[len(entries)-1], "")
+			}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "- "); ok {
+			entries = append(entries, nil)
+			first = append(first, i)
+			line, trimmed = "  "+rest, strings.TrimLeft(rest, " \t")
+		} else if len(entries) == 0 {
+			return nil, errorf("expected a list of entries, each starting with -")
+		}
+		if _, _, ok := cutYAMLKey(trimmed); !ok {
+			return nil, errorf("expected key: value")
+		}
+		entries[len(entries)-1] = append(entries[len(entries)-1], line)
+	}
+
+	raw := make([]map[string]any, len(entries))
+	for i, lines := range entries {
+		nodes := parseYAMLTree(lines)
+		for _, n := range nodes {
+			if n.indent != 2 {
+				return nil, fmt.Errorf("%s:%d: key %s is indented differently from its entry's first", name, first[i]+n.first+1, n.key)
+			}
+		}
+		raw[i] = yamlNodesMap(nodes)
+	}
+	return raw, nil
+}
+
+// yamlNodesMap returns the mapping nodes, read by parseYAMLTree,
+// stand for, with scalars read by yamlScalar.
+func yamlNodesMap(nodes []*yamlNode) map[string]any {
+	m := make(map[string]any, len(nodes))
+	for _, n := range nodes {
+		if len(n.children) > 0 {
+			m[n.key] = yamlNodesMap(n.children)
+			continue
+		}
+		m[n.key] = yamlScalar(n.value)
+	}
+	return m
+}
+
+// manifestEntryOf returns pair's -manifest entry, or nil if it
+// isn't for one.
+func manifestEntryOf(pair renderPair) *manifestEntry {
+	if pair.entry < 1 || pair.entry > len(manifest) {
+		return nil
+	}
+	return &manifest[pair.entry-1]
+}
+
+// manifestConfig returns the MermaidJS settings pair's -manifest
+// entry gives it, or nil for none.
+func manifestConfig(pair renderPair) map[string]any {
+	e := manifestEntryOf(pair)
+	if e == nil || (e.theme == "" && len(e.config) == 0) {
+		return nil
+	}
+	config := make(map[string]any)
+	renderer.MergeConfig(config, e.config)
+	if e.theme != "" {
+		config["theme"] = e.theme
+	}
+	return config
+}
+
+// manifestKey returns the settings pair's -manifest entry gives it,
+// as JSON, for inputsHash, or "" for none.
+func manifestKey(pair renderPair) string {
+	config := manifestConfig(pair)
+	if config == nil {
+		return ""
+	}
+	b, _ := json.Marshal(config)
+	return string(b)
+}
+
+// manifestConflict returns the first flag set that -manifest can't
+// be used with, since it plans outputs, or finds inputs, of its
+// own, or "" for none.
+func manifestConflict() string {
+	switch {
+	case *watchFlag:
+		return "-watch"
+	case *matrixFlag != "":
+		return "-matrix"
+	case *stagedFlag:
+		return "-staged"
+	case *dirFlag != "":
+		return "-outdir"
+	case *nameTemplateFlag != "":
+		return "-name-template"
+	case *nameFromTitleFlag:
+		return "-name-from-title"
+	case *splitThresholdFlag > 0:
+		return "-split-threshold"
+	case *splitFlag:
+		return "-split"
+	case *showConfigFlag:
+		return "-show-effective-config"
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// loadTestManifest loads the manifest name, as -manifest, until t
+// is done.
+func loadTestManifest(t *testing.T, name string) ([]renderPair, error) {
+	t.Helper()
+	old := manifest
+	t.Cleanup(func() { manifest = old })
+	setFlag(t, "manifest", name)
+	return loadManifest()
+}
+
+// TestLoadManifest loads the same batch from testdata/manifest's
+// JSON and YAML manifests.
+func TestLoadManifest(t *testing.T) {
+	dir := filepath.Join("testdata", "manifest")
+	wantPairs := []renderPair{
+		{mmdName: filepath.Join("testdata", "flow.mmd"), svgName: filepath.Join(dir, "out", "flow.svg"), entry: 1},
+		{mmdName: filepath.Join("testdata", "flow.mmd"), svgName: filepath.Join(dir, "out", "flow-dark.svg"), entry: 2},
+		{mmdName: filepath.Join("testdata", "sequence.mmd"), svgName: filepath.Join(dir, "out", "sequence.svg"), entry: 3},
+	}
+	wantConfigs := []string{
+		"null",
+		`{"theme":"dark"}`,
+		`{"sequence":{"mirrorActors":false},"theme":"forest"}`,
+	}
+	var entries [][]manifestEntry
+	for _, name := range []string{"build.json", "build.yaml"} {
+		pairs, err := loadTestManifest(t, filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !slices.Equal(pairs, wantPairs) {
+			t.Errorf("%s: pairs\n%+v\nwant\n%+v", name, pairs, wantPairs)
+		}
+		for i, pair := range pairs {
+			b, err := json.Marshal(manifestConfig(pair))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != wantConfigs[i] {
+				t.Errorf("%s: entry %d's config = %s, want %s", name, i+1, b, wantConfigs[i])
+			}
+		}
+		entries = append(entries, manifest)
+	}
+	if !reflect.DeepEqual(entries[0], entries[1]) {
+		t.Errorf("build.json's entries\n%+v\ndiffer from build.yaml's\n%+v", entries[0], entries[1])
+	}
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	chdirTemp(t, map[string]string{
+		"a.mmd": "flowchart LR\n    A --> B\n",
+		"b.txt": "not a document",
+	})
+	for _, tc := range []struct {
+		name, data string
+		want       []string
+	}{
+		{"empty.json", `[]`, []string{"empty.json: no entries"}},
+		{"bad.json", `{}`, []string{"expected a JSON array of entries"}},
+		{"build.toml", ``, []string{"expected a .json, .yaml, or .yml file"}},
+		{"keys.json", `[{"input": "a.mmd", "output": "a.svg", "colour": "red"}]`, []string{"entry 1 (a.mmd): got key colour"}},
+		{"outputs.json", `[{"input": "a.mmd", "output": "a.svg"}, {"input": "a.mmd", "output": "a.svg"}]`, []string{"entry 2 (a.mmd): output a.svg is entry 1's too"}},
+		{"inputs.json", `[{"input": "b.txt", "output": "b.svg"}, {"input": "missing.mmd", "output": "c.svg"}, {"output": "d.svg"}]`, []string{
+			"entry 1 (b.txt): input b.txt isn't a MermaidJS document",
+			"entry 2 (missing.mmd): ",
+			"entry 3 (): needs an input path",
+		}},
+		{"format.json", `[{"input": "a.mmd", "output": "a.png"}]`, []string{"got output a.png; expected a .svg file"}},
+		{"theme.json", `[{"input": "a.mmd", "output": "a.svg", "theme": "sparkly"}]`, []string{"got theme sparkly"}},
+		{"config.yaml", "- input: a.mmd\n  output: a.svg\n  config: curvy\n", []string{"config has to be a mapping"}},
+		{"list.yaml", "input: a.mmd\n", []string{"list.yaml:1: expected a list of entries"}},
+		{"indent.yaml", "- input: a.mmd\n output: a.svg\n", []string{"indent.yaml:2: key output is indented differently"}},
+	} {
+		writeTestFile(t, tc.name, tc.data)
+		_, err := loadTestManifest(t, tc.name)
+		if err == nil {
+			t.Errorf("%s loaded", tc.name)
+			continue
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got %v, want an error with %q", tc.name, err, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const md = ".md"
+
+// markdownNames are the Markdown files named on the command line,
+// which the watcher watches even if they have no mermaid blocks
+// yet.  It's locked, since the watcher notes new ones while its
+// worker renders.
+var markdownNames struct {
+	sync.Mutex
+	names []string
+}
+
+// noteMarkdown adds the Markdown file name to markdownNames.
+func noteMarkdown(name string) {
+	markdownNames.Lock()
+	defer markdownNames.Unlock()
+	markdownNames.names = append(markdownNames.names, name)
+}
+
+// markdownInputs returns a copy of markdownNames's files.
+func markdownInputs() []string {
+	markdownNames.Lock()
+	defer markdownNames.Unlock()
+	return slices.Clone(markdownNames.names)
+}
+
+// isMarkdown reports whether the input name is a Markdown file,
+// whose mermaid blocks are rendered rather than the file itself.
+func isMarkdown(name string) bool {
+	return strings.HasSuffix(name, md)
+}
+
+// mermaidBlock is a mermaid fenced code block in a Markdown file.
+type mermaidBlock struct {
+	src  string
+	line int // the line of the file src starts on, counting from 1
+}
+
+// markdownBlocks returns the mermaid fenced code blocks in the
+// Markdown src, in order.
+//
+// A fence is three or more backticks or tildes, indented or not,
+// so blocks in list items count; the block's lines lose as much
+// indentation as its fence has.  A block is mermaid if the first
+// word of its info string is.  The rest of the info string, if
+// it's an init object, e.g., ```mermaid {init: {"theme": "dark"}},
+// is added to the block as a directive.  A block that isn't closed
+// runs to the end of the file, as in CommonMark.
+func markdownBlocks(src string) []mermaidBlock {
+	lines := strings.Split(src, "\n")
+	var blocks []mermaidBlock
+	for i := 0; i < len(lines); i++ {
+		indent, fence, info, ok := openingFence(lines[i])
+		if !ok {
+			continue
+		}
+		var body []string
+		j := i + 1
+		for ; j < len(lines) && !closesFence(lines[j], fence); j++ {
+			body = append(body, dedent(strings.TrimSuffix(lines[j], "\r"), indent))
+		}
+		if lang, rest := cutInfo(info); strings.EqualFold(lang, "mermaid") {
+			blockSrc := strings.Join(body, "\n")
+			if strings.HasPrefix(rest, "{") {
+				// Directives can go anywhere, and at the end they
+				// don't throw off the lines of errors.
+				blockSrc += "\n%%" + rest + "%%"
+			}
+			blocks = append(blocks, mermaidBlock{src: blockSrc, line: i + 2})
+		}
+		i = j
+	}
+	return blocks
+}
+
+// openingFence reports whether line opens a fenced code block,
+// returning the fence's indentation, the fence itself, and the
+// info string after it.
+func openingFence(line string) (indent, fence, info string, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+	rest := strings.TrimLeft(line, " \t")
+	indent = line[:len(line)-len(rest)]
+	if rest == "" || (rest[0] != '`' && rest[0] != '~') {
+		return "", "", "", false
+	}
+	n := len(rest) - len(strings.TrimLeft(rest, rest[:1]))
+	if n < 3 {
+		return "", "", "", false
+	}
+	fence, info = rest[:n], strings.TrimSpace(rest[n:])
+	if fence[0] == '`' && strings.Contains(info, "`") {
+		return "", "", "", false // inline code, not a fence
+	}
+	return indent, fence, info, true
+}
+
+// closesFence reports whether line closes the block opened by
+// fence: it's only the fence's character, at least as many.
+func closesFence(line, fence string) bool {
+	t := strings.TrimSpace(line)
+	return len(t) >= len(fence) && strings.Trim(t, fence[:1]) == ""
+}
+
+// dedent removes up to len(indent) spaces and tabs from the start
+// of line.
+func dedent(line, indent string) string {
+	for i := 0; i < len(indent) && line != "" && (line[0] == ' ' || line[0] == '\t'); i++ {
+		line = line[1:]
+	}
+	return line
+}
+
+// cutInfo splits a fence's info string into its language and the
+// rest, e.g., "mermaid" and "{init: ...}".
+func cutInfo(info string) (lang, rest string) {
+	i := strings.IndexAny(info, " \t{")
+	if i < 0 {
+		return info, ""
+	}
+	return info[:i], strings.TrimSpace(info[i:])
+}
+
+// countBlocks returns how many mermaid blocks the Markdown file
+// name has, for planning its outputs.
+func countBlocks(name string) (int, error) {
+	b, err := readInput(name)
+	if err != nil {
+		return 0, err
+	}
+	n := len(markdownBlocks(string(b)))
+	if n == 0 {
+		log.Printf("%s has no mermaid blocks", name)
+	}
+	return n, nil
+}
+
+// readMarkdownBlock returns the block of the Markdown file that
+// pair is for.
+func readMarkdownBlock(pair renderPair) (mermaidBlock, error) {
+	b, err := readInput(pair.mmdName)
+	if err != nil {
+		return mermaidBlock{}, err
+	}
+	blocks := markdownBlocks(string(b))
+	if pair.block > len(blocks) {
+		return mermaidBlock{}, fmt.Errorf("%s has no mermaid block %d", pair.mmdName, pair.block)
+	}
+	return blocks[pair.block-1], nil
+}
+
+// replanInput returns pairs with the pairs of the input name
+// replaced by the ones planned for it now, for the watcher, after
+// it changes: a Markdown file's blocks may have come, gone, or
+// moved, and a flowchart that -split-threshold splits may have
+// gained or lost parts (see replans).  If it can't be read, pairs
+// are returned as they are.
+func replanInput(pairs []renderPair, name string) []renderPair {
+	fresh, err := planPairs([]string{name}, nil)
+	if err != nil {
+		errorf("%v", err)
+		return pairs
+	}
+	var out []renderPair
+	for _, pair := range pairs {
+		if pair.mmdName != name {
+			out = append(out, pair)
+			continue
+		}
+		out = append(out, fresh...) // in place of the first old one
+		fresh = nil
+	}
+	return append(out, fresh...)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestMarkdownBlocksGuide reads testdata/markdown/guide.md's two
+// mermaid blocks: a plain one, and one in a list item with an init
+// object in its info string.  Its sh block isn't one.
+func TestMarkdownBlocksGuide(t *testing.T) {
+	b, err := readInput(filepath.Join("testdata", "markdown", "guide.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mermaidBlock{
+		{src: "flowchart LR\n    A[Login] --> B{Valid?}\n    B -- yes --> C[Home]\n    B -- no --> A", line: 6},
+		{src: "pie title Pets\n    \"Dogs\" : 3\n    \"Cats\" : 2\n%%{init: {\"theme\": \"forest\"}}%%", line: 17},
+	}
+	if got := markdownBlocks(string(b)); !slices.Equal(got, want) {
+		t.Errorf("guide.md's blocks are\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestMarkdownBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		name, src string
+		want      []mermaidBlock
+	}{
+		{"none", "# Title\n\nText with `inline` code.\n", nil},
+		{"unclosed", "```mermaid\npie\n    \"A\" : 1\n", []mermaidBlock{{src: "pie\n    \"A\" : 1\n", line: 2}}},
+		{"longer fence", "````mermaid\n```\npie\n````\n", []mermaidBlock{{src: "```\npie", line: 2}}},
+		{"case", "```Mermaid\npie\n```\n", []mermaidBlock{{src: "pie", line: 2}}},
+		{"crlf", "```mermaid\r\npie\r\n```\r\n", []mermaidBlock{{src: "pie", line: 2}}},
+		{"inline", "```mermaid `x` ```\npie\n", nil},
+		{"other", "```mermaidjs\npie\n```\n", nil},
+	} {
+		if got := markdownBlocks(tc.src); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: blocks %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestPlanMarkdown plans an output for each of guide.md's blocks,
+// and none for none.md, which has none.
+func TestPlanMarkdown(t *testing.T) {
+	dir := filepath.Join("testdata", "markdown")
+	guide, none := filepath.Join(dir, "guide.md"), filepath.Join(dir, "none.md")
+	for _, tc := range []struct {
+		name string
+		want int
+	}{{guide, 2}, {none, 0}} {
+		if n, err := countBlocks(tc.name); err != nil || n != tc.want {
+			t.Errorf("countBlocks(%s) = %d, %v; want %d", tc.name, n, err, tc.want)
+		}
+	}
+
+	pairs, err := planPairs([]string{guide, none}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []renderPair{
+		{mmdName: guide, svgName: filepath.Join(dir, "guide-1.svg"), block: 1},
+		{mmdName: guide, svgName: filepath.Join(dir, "guide-2.svg"), block: 2},
+	}
+	if !slices.Equal(pairs, want) {
+		t.Errorf("planned\n%+v\nwant\n%+v", pairs, want)
+	}
+	for _, pair := range pairs {
+		block, err := readMarkdownBlock(pair)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.line != []int{6, 17}[pair.block-1] {
+			t.Errorf("%s is block %d, starting on line %d", pair.svgName, pair.block, block.line)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/plan"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// matrixVariant is one -matrix variant: settings every document
+// is rendered with, once more, to outputs of its own.
+type matrixVariant struct {
+	name string
+
+	// theme, background, and scale stand in for -theme,
+	// -background, and -scale, which they default to.
+	theme, background string
+	scale             float64
+
+	// suffix goes on the end of the output's name, before its
+	// extension, and dir is a directory, in the output's own
+	// directory, that it goes in instead.
+	suffix, dir string
+}
+
+// matrix is the -matrix file's variants, in order.
+var matrix []matrixVariant
+
+// loadMatrix reads and checks the -matrix file into matrix.
+func loadMatrix() error {
+	b, err := os.ReadFile(*matrixFlag)
+	if err != nil {
+		return err
+	}
+	variants, err := parseMatrix(*matrixFlag, string(b))
+	if err != nil {
+		return err
+	}
+	matrix = variants
+	return nil
+}
+
+// parseMatrix parses the matrix in the file name, with contents
+// src.  Like a theme map, it's only as much YAML as it needs: a
+// mapping from variant names to their settings.
+//
+//	light:
+//	  suffix: -light
+//	dark:
+//	  theme: dark
+//	  background: "#1e1e1e"
+//	  dir: dark
+//	print:
+//	  theme: neutral
+//	  scale: 2
+//	  suffix: -print
+//
+// Every variant needs a suffix or a dir, so its outputs don't
+// overwrite another's.
+func parseMatrix(name, src string) ([]matrixVariant, error) {
+	var (
+		variants []matrixVariant
+		seen     = make(map[string]int)
+	)
+	for i, line := range strings.Split(src, "\n") {
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", name, i+1, fmt.Sprintf(format, args...))
+		}
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key, value, ok := cutYAMLKey(trimmed)
+		if !ok {
+			return nil, errorf("expected key: value")
+		}
+
+		if trimmed == line { // a variant
+			if value != "" {
+				return nil, errorf("variant %s takes settings on the lines under it", key)
+			}
+			if prev, ok := seen[key]; ok {
+				return nil, errorf("variant %s is already on line %d", key, prev)
+			}
+			seen[key] = i + 1
+			variants = append(variants, matrixVariant{name: key})
+			continue
+		}
+
+		if len(variants) == 0 {
+			return nil, errorf("setting %s isn't under a variant", key)
+		}
+		if value == "" {
+			return nil, errorf("setting %s has no value", key)
+		}
+		v := &variants[len(variants)-1]
+		s, ok := yamlScalar(value).(string)
+		if !ok {
+			s = value
+		}
+		switch key {
+		case "theme":
+			if !isMermaidTheme(s) {
+				return nil, errorf("got theme %s; expected one of %s", s, strings.Join(mermaidThemes, ", "))
+			}
+			v.theme = s
+		case "background":
+			v.background = s
+		case "scale":
+			f, ok := yamlScalar(value).(float64)
+			if !ok || f <= 0 {
+				return nil, errorf("got scale %s; expected a number more than 0", value)
+			}
+			v.scale = f
+		case "suffix":
+			v.suffix = s
+		case "dir":
+			v.dir = s
+		default:
+			return nil, errorf("got setting %s; expected theme, background, scale, suffix, or dir", key)
+		}
+	}
+
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("%s: no variants", name)
+	}
+	for _, v := range variants {
+		if v.suffix == "" && v.dir == "" {
+			return nil, fmt.Errorf("%s: variant %s needs a suffix or a dir", name, v.name)
+		}
+	}
+	return variants, nil
+}
+
+// matrixVariants returns matrix's variants for planning their
+// outputs.
+func matrixVariants() []plan.Variant {
+	variants := make([]plan.Variant, len(matrix))
+	for i, v := range matrix {
+		variants[i] = plan.Variant{Name: v.name, Suffix: v.suffix, Dir: v.dir}
+	}
+	return variants
+}
+
+// renderMatrix renders pairs, planned with matrixVariants, a variant at a
+// time, setting the renderer up for each variant before its
+// documents, rather than before every document.  It returns how
+// many failed.
+func renderMatrix(pairs []renderPair) int {
+	theme, background, scale := *themeFlag, *backgroundFlag, *scaleFlag
+	defer func() {
+		*themeFlag, *backgroundFlag, *scaleFlag = theme, background, scale
+	}()
+	runFingerprint() // of the flags as given; inputsHash adds the variant's
+
+	failed, reused := 0, 0
+	for _, v := range matrix {
+		var group []renderPair
+		for _, pair := range pairs {
+			if pair.variant == v.name {
+				group = append(group, pair)
+			}
+		}
+		if len(group) == 0 {
+			continue // all up to date
+		}
+
+		*themeFlag, *backgroundFlag, *scaleFlag = theme, background, scale
+		if v.theme != "" {
+			*themeFlag = v.theme
+		}
+		if v.background != "" {
+			*backgroundFlag = v.background
+		}
+		if v.scale > 0 {
+			*scaleFlag = v.scale
+		}
+		log.Printf("rendering variant %s", v.name)
+		if err := useTheme(*themeFlag); err != nil {
+			errorf("couldn't set up variant %s: %v", v.name, err)
+			failed += len(group)
+			continue
+		}
+		var render []renderPair
+		for _, pair := range group {
+			if err := os.MkdirAll(filepath.Dir(pair.svgName), 0755); err != nil {
+				fatalf("%v", err)
+			}
+			d, ok := reuseVariantOutput(pair)
+			if !ok {
+				render = append(render, pair)
+				continue
+			}
+			reused++
+			if err := finishRender(d); err != nil {
+				failed++
+			}
+		}
+		failed += renderAll(render)
+	}
+	if *statsFlag {
+		fmt.Fprintf(os.Stderr, "%d outputs across %d variants: %d rendered, %d reused\n", len(pairs), len(matrix), len(pairs)-reused, reused)
+	}
+	return failed
+}
+
+// variantOutput is an output rendered for a -matrix variant, kept
+// for a later variant that would render it the same.
+type variantOutput struct {
+	result  renderer.RenderResult
+	image   []byte
+	sizeErr error
+}
+
+// variantOutputs are the outputs of the run's variants so far, by
+// variantReuseKey.
+var variantOutputs = make(map[string]variantOutput)
+
+// variantReuseKey returns the key, for variantOutputs, of d's
+// output under the variant being rendered: its document, and the
+// settings of the variant that reach it.  Variants differ only in
+// -theme, -background, and -scale, so two variants render a
+// document the same if it pins its own theme (see pinnedTheme), or
+// they have the same one, and they share what of the rest its
+// -format uses.
+func variantReuseKey(d *renderDoc) string {
+	theme := pinnedTheme(d.pair.mmdName, string(d.src))
+	if theme == "" {
+		theme = *themeFlag
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s#%d\n%s\n", d.pair.mmdName, d.pair.block, theme)
+	switch *formatFlag {
+	case "png":
+		fmt.Fprintf(h, "%s %g\n", *backgroundFlag, *scaleFlag)
+	case "pdf":
+		fmt.Fprintf(h, "%s\n", *backgroundFlag)
+	}
+	h.Write(d.src)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// keepVariantOutput keeps d's output, once it's written, for
+// reuseVariantOutput.
+func keepVariantOutput(d *renderDoc) {
+	variantOutputs[variantReuseKey(d)] = variantOutput{d.result, d.image, d.sizeErr}
+}
+
+// reuseVariantOutput returns pair's document, ready for
+// finishRender, with the output of an earlier variant that rendered
+// it the same as pair's variant would, if there is one.
+func reuseVariantOutput(pair renderPair) (*renderDoc, bool) {
+	d := readDoc(pair)
+	if d.readErr != nil {
+		return nil, false
+	}
+	out, ok := variantOutputs[variantReuseKey(d)]
+	if !ok {
+		return nil, false
+	}
+	d.result, d.image, d.sizeErr = out.result, out.image, out.sizeErr
+	log.Printf("reusing the %s output of an earlier variant", pair.docName())
+	return d, true
+}
+
+// variantSettings returns the settings of the variant called name,
+// as text, for inputsHash, or "" if there's none.
+func variantSettings(name string) string {
+	for _, v := range matrix {
+		if v.name == name {
+			return fmt.Sprintf("%+v", v)
+		}
+	}
+	return ""
+}
+
+// useTheme re-initializes MermaidJS in the renderer with theme, as
+// if it had started with -theme=theme, so the documents after it
+// render with it.
+func useTheme(theme string) error {
+	return mainRenderer.SetTheme(runCtx, theme)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestMatrixGallery loads testdata/matrix/gallery.yaml, and plans
+// a document's outputs in each of its variants.
+func TestMatrixGallery(t *testing.T) {
+	old := matrix
+	t.Cleanup(func() { matrix = old })
+	setFlag(t, "matrix", filepath.Join("testdata", "matrix", "gallery.yaml"))
+	if err := loadMatrix(); err != nil {
+		t.Fatal(err)
+	}
+	want := []matrixVariant{
+		{name: "light", suffix: "-light"},
+		{name: "dark", theme: "dark", background: "#1e1e1e", dir: "dark"},
+		{name: "print", theme: "neutral", scale: 2, suffix: "-print"},
+	}
+	if !slices.Equal(matrix, want) {
+		t.Errorf("variants\n%+v\nwant\n%+v", matrix, want)
+	}
+
+	name := filepath.Join("testdata", "flow.mmd")
+	pairs, err := planPairs([]string{name}, matrixVariants())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPairs := []renderPair{
+		{mmdName: name, svgName: filepath.Join("testdata", "flow-light.svg"), variant: "light"},
+		{mmdName: name, svgName: filepath.Join("testdata", "dark", "flow.svg"), variant: "dark"},
+		{mmdName: name, svgName: filepath.Join("testdata", "flow-print.svg"), variant: "print"},
+	}
+	if !slices.Equal(pairs, wantPairs) {
+		t.Errorf("planned\n%+v\nwant\n%+v", pairs, wantPairs)
+	}
+}
+
+func TestParseMatrixErrors(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{"", "m.yaml: no variants"},
+		{"  theme: dark\n", "m.yaml:1: setting theme isn't under a variant"},
+		{"dark: yes\n", "m.yaml:1: variant dark takes settings on the lines under it"},
+		{"dark:\n  dir: dark\ndark:\n  dir: d\n", "m.yaml:3: variant dark is already on line 1"},
+		{"dark:\n  theme:\n", "m.yaml:2: setting theme has no value"},
+		{"dark:\n  theme: sparkly\n", "m.yaml:2: got theme sparkly"},
+		{"big:\n  scale: 0\n", "m.yaml:2: got scale 0"},
+		{"dark:\n  colour: red\n", "m.yaml:2: got setting colour"},
+		{"dark:\n  theme: dark\n", "m.yaml: variant dark needs a suffix or a dir"},
+		{"dark\n", "m.yaml:1: expected key: value"},
+	} {
+		_, err := parseMatrix("m.yaml", tc.src)
+		if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("parseMatrix(%q) = %v, want an error starting %q", tc.src, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package mermaidtest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each
+// change.
+const diffContext = 3
+
+// Diff returns a unified diff of the lines of want and got, with
+// their names in the header, or "" if they're equal.
+//
+// It's meant for the modest number of lines in a normalized SVG;
+// it takes time and memory proportional to the product of the
+// two line counts.
+func Diff(wantName, want, gotName, got string) string {
+	return diff(wantName, want, gotName, got, -1)
+}
+
+// FirstDiff is like Diff, but only shows the first change (with
+// any changes close enough to share its context).
+func FirstDiff(wantName, want, gotName, got string) string {
+	return diff(wantName, want, gotName, got, 1)
+}
+
+// DiffSVG returns Diff of want and got once they're normalized with
+// NormalizeSVG, or "" if they're the same SVG.
+func DiffSVG(wantName, want, gotName, got string) string {
+	return Diff(wantName, NormalizeSVG(want), gotName, NormalizeSVG(got))
+}
+
+// diff returns the unified diff with at most maxHunks hunks, or
+// all of them if maxHunks < 0.
+func diff(wantName, want, gotName, got string, maxHunks int) string {
+	if want == got {
+		return ""
+	}
+	a, b := strings.Split(want, "\n"), strings.Split(got, "\n")
+	ops := editScript(a, b)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", wantName, gotName)
+	hs := hunks(ops)
+	if maxHunks >= 0 && len(hs) > maxHunks {
+		hs = hs[:maxHunks]
+	}
+	for _, h := range hs {
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", h.aStart+1, h.aLen, h.bStart+1, h.bLen)
+		for _, op := range ops[h.first:h.last] {
+			switch op.kind {
+			case ' ':
+				sb.WriteString(" " + a[op.a] + "\n")
+			case '-':
+				sb.WriteString("-" + a[op.a] + "\n")
+			case '+':
+				sb.WriteString("+" + b[op.b] + "\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// An editOp keeps (' '), deletes ('-'), or inserts ('+') a line.
+// a and b are the line's indexes in the old and new lines; for a
+// deletion b is where the new lines are at, and vice versa.
+type editOp struct {
+	kind byte
+	a, b int
+}
+
+// editScript returns the shortest list of editOps that turns a
+// into b, from their longest common subsequence.
+func editScript(a, b []string) []editOp {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:].
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []editOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, editOp{' ', i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, editOp{'-', i, j})
+			i++
+		default:
+			ops = append(ops, editOp{'+', i, j})
+			j++
+		}
+	}
+	return ops
+}
+
+// A hunk is the ops[first:last] shown under one @@ header.
+type hunk struct {
+	first, last  int
+	aStart, aLen int
+	bStart, bLen int
+}
+
+// hunks groups the changes in ops, with diffContext lines of
+// context, merging groups whose context would overlap.
+func hunks(ops []editOp) []hunk {
+	var hs []hunk
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == ' ' {
+			continue
+		}
+		first := max(0, i-diffContext)
+		last := i
+		// Extend past every change that's within 2*diffContext
+		// unchanged lines of the previous one.
+		for k := i; k < len(ops) && k-last <= 2*diffContext; k++ {
+			if ops[k].kind != ' ' {
+				last = k
+			}
+		}
+		last = min(len(ops), last+diffContext+1)
+
+		h := hunk{first: first, last: last, aStart: ops[first].a, bStart: ops[first].b}
+		for _, op := range ops[first:last] {
+			if op.kind != '+' {
+				h.aLen++
+			}
+			if op.kind != '-' {
+				h.bLen++
+			}
+		}
+		hs = append(hs, h)
+		i = last - 1
+	}
+	return hs
+}
@@ -0,0 +1,194 @@
+package mermaidtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numbered returns the lines "1" to "n", with line i replaced by
+// edits[i], or dropped if it's "".
+func numbered(n int, edits map[int]string) string {
+	var lines []string
+	for i := 1; i <= n; i++ {
+		line, ok := edits[i]
+		if !ok {
+			line = fmt.Sprint(i)
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestDiff(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		want, got string
+		diff      string
+	}{
+		{"equal", "a\nb", "a\nb", ""},
+		{
+			"changed line",
+			numbered(5, nil), numbered(5, map[int]string{3: "three"}),
+			`--- want
++++ got
+@@ -1,5 +1,5 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+`,
+		},
+		{
+			"inserted line",
+			"a\nb", "a\nx\nb",
+			`--- want
++++ got
+@@ -1,2 +1,3 @@
+ a
++x
+ b
+`,
+		},
+		{
+			"deleted line",
+			"a\nx\nb", "a\nb",
+			`--- want
++++ got
+@@ -1,3 +1,2 @@
+ a
+-x
+ b
+`,
+		},
+		{
+			"far apart changes",
+			numbered(20, nil), numbered(20, map[int]string{2: "two", 18: "eighteen"}),
+			`--- want
++++ got
+@@ -1,5 +1,5 @@
+ 1
+-2
++two
+ 3
+ 4
+ 5
+@@ -15,6 +15,6 @@
+ 15
+ 16
+ 17
+-18
++eighteen
+ 19
+ 20
+`,
+		},
+		{
+			// Changes whose context would overlap share a hunk.
+			"close changes",
+			numbered(12, nil), numbered(12, map[int]string{3: "three", 8: ""}),
+			`--- want
++++ got
+@@ -1,11 +1,10 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+ 7
+-8
+ 9
+ 10
+ 11
+`,
+		},
+	} {
+		if got := Diff("want", tc.want, "got", tc.got); got != tc.diff {
+			t.Errorf("%s: Diff =\n%s\nwant\n%s", tc.name, got, tc.diff)
+		}
+	}
+}
+
+func TestFirstDiff(t *testing.T) {
+	got := FirstDiff("want", numbered(20, nil), "got", numbered(20, map[int]string{2: "two", 18: "eighteen"}))
+	want := `--- want
++++ got
+@@ -1,5 +1,5 @@
+ 1
+-2
++two
+ 3
+ 4
+ 5
+`
+	if got != want {
+		t.Errorf("FirstDiff =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDiffSVG(t *testing.T) {
+	a := `<svg id="mermaid-1"><g class="node a" id="n-3"/></svg>`
+	b := `<svg id="mermaid-2"><g class="a node" id="n-9"/></svg>`
+	if diff := DiffSVG("a", a, "b", b); diff != "" {
+		t.Errorf("DiffSVG of two renders of the same diagram =\n%s", diff)
+	}
+
+	c := `<svg id="mermaid-2"><g class="a node" id="n-9"/><g id="extra"/></svg>`
+	want := `--- a
++++ c
+@@ -1,3 +1,4 @@
+ <svg id="id-0">
+ <g class="a node" id="id-1"/>
++<g id="id-2"/>
+ </svg>
+`
+	if diff := DiffSVG("a", a, "c", c); diff != want {
+		t.Errorf("DiffSVG =\n%s\nwant\n%s", diff, want)
+	}
+}
+
+// recordingTB is a testing.TB that records its errors instead of
+// failing the test.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Errorf(format string, args ...any) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func TestEqualSVG(t *testing.T) {
+	a := `<svg id="mermaid-1"><rect width="10.00001"/></svg>`
+	b := `<svg id="mermaid-2"><rect width="10"/></svg>`
+	tb := &recordingTB{TB: t}
+	if !EqualSVG(tb, a, b) || len(tb.errors) > 0 {
+		t.Errorf("EqualSVG of equivalent SVGs failed: %q", tb.errors)
+	}
+
+	c := `<svg id="mermaid-2"><rect width="20"/></svg>`
+	tb = &recordingTB{TB: t}
+	if EqualSVG(tb, a, c) {
+		t.Error("EqualSVG of different SVGs = true")
+	}
+	want := `SVGs differ (-want +got):
+--- want
++++ got
+@@ -1,3 +1,3 @@
+ <svg id="id-0">
+-<rect width="10"/>
++<rect width="20"/>
+ </svg>
+`
+	if len(tb.errors) != 1 || tb.errors[0] != want {
+		t.Errorf("EqualSVG reported %q, want %q", tb.errors, want)
+	}
+}
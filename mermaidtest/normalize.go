@@ -0,0 +1,125 @@
+/*
+Package mermaidtest has helpers for testing the SVGs that
+MermaidJS renders, like comparing them against golden files.
+
+MermaidJS's output isn't stable enough to compare byte for byte:
+element ids carry counters and random suffixes, class lists come
+in no particular order, and coordinates carry more precision than
+anything can draw.  NormalizeSVG scrubs those so two renders of
+the same diagram compare equal, and Diff shows how two normalized
+SVGs differ.  EqualSVG does both for a test:
+
+	func TestFlow(t *testing.T) {
+		got := render(t, mermaidtest.LoadFixture(t, "flow.mmd"))
+		mermaidtest.EqualSVG(t, mermaidtest.LoadFixture(t, "flow.svg"), got)
+	}
+
+It doesn't depend on chromedp or a browser, so it's cheap to
+import in tests.
+*/
+package mermaidtest
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Precision is the number of decimal places NormalizeSVG rounds
+// numbers to.
+const Precision = 3
+
+// idAttrRE and classRE match only the attributes themselves, not
+// ones like data-id that end the same way.
+var (
+	idAttrRE  = regexp.MustCompile(`(\s)id="([^"]+)"`)
+	idRefRE   = regexp.MustCompile(`#([A-Za-z_][-\w]*)`)
+	ariaRefRE = regexp.MustCompile(`\b(aria-labelledby|aria-describedby)="([^"]*)"`)
+	classRE   = regexp.MustCompile(`(\s)class="([^"]*)"`)
+	numberRE  = regexp.MustCompile(`-?\d*\.\d+`)
+)
+
+// NormalizeSVG returns svg with:
+//
+//   - every element id renamed, in order of appearance, to id-0,
+//     id-1, ..., along with the references to them in url(#...),
+//     href="#...", aria attributes, and style selectors
+//   - every class list sorted
+//   - every decimal number rounded to Precision places
+//   - every element's start tag on its own line, so line-based
+//     diffs of two SVGs are readable
+func NormalizeSVG(svg string) string {
+	svg = normalizeIDs(svg)
+	svg = normalizeClasses(svg)
+	svg = normalizeNumbers(svg)
+	return Lines(svg)
+}
+
+// Lines returns svg with every element's start tag on its own
+// line, and nothing else changed.  It's for diffing SVGs that
+// shouldn't be normalized.
+func Lines(svg string) string {
+	return strings.ReplaceAll(svg, "><", ">\n<")
+}
+
+func normalizeIDs(svg string) string {
+	ids := make(map[string]string)
+	for _, m := range idAttrRE.FindAllStringSubmatch(svg, -1) {
+		if _, ok := ids[m[2]]; !ok {
+			ids[m[2]] = "id-" + strconv.Itoa(len(ids))
+		}
+	}
+	if len(ids) == 0 {
+		return svg
+	}
+
+	svg = idAttrRE.ReplaceAllStringFunc(svg, func(s string) string {
+		m := idAttrRE.FindStringSubmatch(s)
+		return m[1] + `id="` + ids[m[2]] + `"`
+	})
+	svg = ariaRefRE.ReplaceAllStringFunc(svg, func(s string) string {
+		m := ariaRefRE.FindStringSubmatch(s)
+		refs := strings.Fields(m[2])
+		for i, ref := range refs {
+			if id, ok := ids[ref]; ok {
+				refs[i] = id
+			}
+		}
+		return m[1] + `="` + strings.Join(refs, " ") + `"`
+	})
+	svg = idRefRE.ReplaceAllStringFunc(svg, func(s string) string {
+		// Only rename what's actually an id, so colors like #fff
+		// are left alone.
+		if id, ok := ids[s[1:]]; ok {
+			return "#" + id
+		}
+		return s
+	})
+	return svg
+}
+
+func normalizeClasses(svg string) string {
+	return classRE.ReplaceAllStringFunc(svg, func(s string) string {
+		m := classRE.FindStringSubmatch(s)
+		classes := strings.Fields(m[2])
+		sort.Strings(classes)
+		return m[1] + `class="` + strings.Join(classes, " ") + `"`
+	})
+}
+
+func normalizeNumbers(svg string) string {
+	scale := math.Pow10(Precision)
+	return numberRE.ReplaceAllStringFunc(svg, func(s string) string {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return s
+		}
+		f = math.Round(f*scale) / scale
+		if f == 0 {
+			f = 0 // no -0
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	})
+}
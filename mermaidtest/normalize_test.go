@@ -0,0 +1,126 @@
+package mermaidtest
+
+import "testing"
+
+func TestNormalizeIDs(t *testing.T) {
+	for _, tc := range []struct {
+		name, svg, want string
+	}{
+		{
+			"renamed in order",
+			`<svg id="mermaid-1719"><g id="flowchart-A-12"/><g id="flowchart-B-13"/></svg>`,
+			`<svg id="id-0"><g id="id-1"/><g id="id-2"/></svg>`,
+		},
+		{
+			"repeated id",
+			`<g id="a"/><g id="b"/><g id="a"/>`,
+			`<g id="id-0"/><g id="id-1"/><g id="id-0"/>`,
+		},
+		{
+			"url and href references",
+			`<marker id="arrow-7"/><path marker-end="url(#arrow-7)"/><use href="#arrow-7"/>`,
+			`<marker id="id-0"/><path marker-end="url(#id-0)"/><use href="#id-0"/>`,
+		},
+		{
+			"aria references",
+			`<svg aria-labelledby="t-3 d-4"><title id="t-3"/><desc id="d-4"/></svg>`,
+			`<svg aria-labelledby="id-0 id-1"><title id="id-0"/><desc id="id-1"/></svg>`,
+		},
+		{
+			"aria reference to no id",
+			`<svg aria-describedby="gone"><title id="t-3"/></svg>`,
+			`<svg aria-describedby="gone"><title id="id-0"/></svg>`,
+		},
+		{
+			"style selectors",
+			`<svg id="my-svg"><style>#my-svg .node{fill:#fff}</style></svg>`,
+			`<svg id="id-0"><style>#id-0 .node{fill:#fff}</style></svg>`,
+		},
+		{
+			// Colors aren't ids, so they're left alone.
+			"colors",
+			`<g id="node-1"/><rect fill="#fab" stroke="#abc"/>`,
+			`<g id="id-0"/><rect fill="#fab" stroke="#abc"/>`,
+		},
+		{
+			"data-id",
+			`<g id="flowchart-A-0" data-id="A"/><a href="#A"/>`,
+			`<g id="id-0" data-id="A"/><a href="#A"/>`,
+		},
+		{
+			"no ids",
+			`<rect fill="#fff"/>`,
+			`<rect fill="#fff"/>`,
+		},
+	} {
+		if got := normalizeIDs(tc.svg); got != tc.want {
+			t.Errorf("%s: normalizeIDs(%s)\n got %s\nwant %s", tc.name, tc.svg, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeClasses(t *testing.T) {
+	for _, tc := range []struct {
+		svg, want string
+	}{
+		{`<g class="node default flowchart-label"/>`, `<g class="default flowchart-label node"/>`},
+		{`<g class="  b   a "/>`, `<g class="a b"/>`},
+		{`<g class="a"/>`, `<g class="a"/>`},
+		{`<g class=""/>`, `<g class=""/>`},
+		{`<g class="z y"/><g class="b a"/>`, `<g class="y z"/><g class="a b"/>`},
+		// Only class attributes are sorted.
+		{`<g data-class="b a"/>`, `<g data-class="b a"/>`},
+	} {
+		if got := normalizeClasses(tc.svg); got != tc.want {
+			t.Errorf("normalizeClasses(%s) = %s, want %s", tc.svg, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeNumbers(t *testing.T) {
+	for _, tc := range []struct {
+		svg, want string
+	}{
+		{`x="1.23456"`, `x="1.235"`},
+		{`x="1.2"`, `x="1.2"`},
+		{`x="1.2000001"`, `x="1.2"`},
+		{`x="12"`, `x="12"`},
+		{`x=".5"`, `x="0.5"`},
+		{`x="-3.14159"`, `x="-3.142"`},
+		{`x="-0.0001"`, `x="0"`},
+		{`x="0.0004"`, `x="0"`},
+		{`x="0.0005"`, `x="0.001"`},
+		{`d="M10.12345,20.98765L30,40.00001"`, `d="M10.123,20.988L30,40"`},
+		{`transform="translate(100.55555, -7.77777)"`, `transform="translate(100.556, -7.778)"`},
+	} {
+		if got := normalizeNumbers(tc.svg); got != tc.want {
+			t.Errorf("normalizeNumbers(%s) = %s, want %s", tc.svg, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeSVG(t *testing.T) {
+	a := `<svg id="mermaid-1"><g class="node a" id="n-3" transform="translate(1.23456,2)"/><path marker-end="url(#n-3)"/></svg>`
+	b := `<svg id="mermaid-2"><g class="a node" id="n-9" transform="translate(1.2346,2)"/><path marker-end="url(#n-9)"/></svg>`
+	want := `<svg id="id-0">
+<g class="a node" id="id-1" transform="translate(1.235,2)"/>
+<path marker-end="url(#id-1)"/>
+</svg>`
+	if got := NormalizeSVG(a); got != want {
+		t.Errorf("NormalizeSVG(a)\n got %s\nwant %s", got, want)
+	}
+	if NormalizeSVG(a) != NormalizeSVG(b) {
+		t.Error("two renders of the same diagram normalize differently")
+	}
+	if got := NormalizeSVG(want); got != want {
+		t.Errorf("NormalizeSVG isn't idempotent:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestLines(t *testing.T) {
+	got := Lines(`<svg id="x"><g><rect x="1.23456"/></g></svg>`)
+	want := "<svg id=\"x\">\n<g>\n<rect x=\"1.23456\"/>\n</g>\n</svg>"
+	if got != want {
+		t.Errorf("Lines = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,30 @@
+package mermaidtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// EqualSVG reports whether want and got are the same SVG once
+// normalized with NormalizeSVG, and if they aren't, fails t with a
+// diff of the two.
+func EqualSVG(t testing.TB, want, got string) bool {
+	t.Helper()
+	if diff := DiffSVG("want", want, "got", got); diff != "" {
+		t.Errorf("SVGs differ (-want +got):\n%s", diff)
+		return false
+	}
+	return true
+}
+
+// LoadFixture returns the contents of the file name in the
+// testdata directory, failing t if it can't be read.
+func LoadFixture(t testing.TB, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("load fixture: %v", err)
+	}
+	return string(b)
+}
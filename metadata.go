@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// diagramMetadata is the schema of the -metadata sidecar written
+// next to each SVG, with the SVG's name plus .json, e.g.,
+// arch.svg.json:
+//
+//	{
+//	  "type": "flowchart-v2",
+//	  "width": 412.5,
+//	  "height": 174,
+//	  "title": "Login flow",
+//	  "accTitle": "Login flow for screen readers",
+//	  "source": "docs/arch.mmd",
+//	  "sourceSHA256": "9f86d08...",
+//	  "toolVersion": "v1.2.0",
+//	  "mermaidVersion": "11.4.1"
+//	}
+//
+// Width and height come from the SVG's viewBox.  Title is from the
+// document's front matter or title statement, and accTitle from
+// its accTitle statement; each is left out if the document has
+// none.  testdata/metadata/arch.svg.json is the golden copy of this
+// example that the tests check the schema against.
+type diagramMetadata struct {
+	Type           string  `json:"type"`
+	Width          float64 `json:"width"`
+	Height         float64 `json:"height"`
+	Title          string  `json:"title,omitempty"`
+	AccTitle       string  `json:"accTitle,omitempty"`
+	Source         string  `json:"source"`
+	SourceSHA256   string  `json:"sourceSHA256"`
+	ToolVersion    string  `json:"toolVersion"`
+	MermaidVersion string  `json:"mermaidVersion"`
+}
+
+// metadataName is the name of the metadata sidecar for the SVG
+// svgName.
+func metadataName(svgName string) string {
+	return svgName + ".json"
+}
+
+// newDiagramMetadata gathers the metadata for the document at
+// mmdName, with source mmdSource, rendered to result by MermaidJS
+// mermaidVersion.
+func newDiagramMetadata(mmdName, mmdSource, mermaidVersion string, result renderer.RenderResult) diagramMetadata {
+	sum := sha256.Sum256([]byte(mmdSource))
+	return diagramMetadata{
+		Type:           result.DiagramType,
+		Width:          result.Width,
+		Height:         result.Height,
+		Title:          result.Title,
+		AccTitle:       statementValue(mmdSource, "accTitle"),
+		Source:         mmdName,
+		SourceSHA256:   hex.EncodeToString(sum[:]),
+		ToolVersion:    version,
+		MermaidVersion: mermaidVersion,
+	}
+}
+
+// marshal returns md as indented JSON.
+func (md diagramMetadata) marshal() []byte {
+	b, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		fatalf("encode metadata: %v", err)
+	}
+	return append(b, '\n')
+}
+
+// statementValue returns the value of the first "key: value" or
+// "key value" line in text, unquoted, or "" if there isn't one.
+func statementValue(text, key string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		rest, ok := strings.CutPrefix(line, key)
+		if !ok || rest == "" || (rest[0] != ':' && rest[0] != ' ') {
+			continue
+		}
+		v := strings.TrimSpace(strings.TrimPrefix(rest, ":"))
+		if uq, err := strconv.Unquote(v); err == nil {
+			v = uq
+		} else if len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'' {
+			v = v[1 : len(v)-1]
+		}
+		return v
+	}
+	return ""
+}
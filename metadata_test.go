@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// metadataTestSource is a document with a title in its front
+// matter and an accTitle statement.
+const metadataTestSource = `---
+title: Login flow
+---
+flowchart LR
+    accTitle: "Login flow for screen readers"
+    A[Sign in] --> B{Valid?}
+    B -->|yes| C[Home]
+`
+
+// TestDiagramMetadataGolden checks the -metadata sidecar's schema,
+// in testdata/metadata/arch.svg.json, which the doc comment on
+// diagramMetadata shows.
+func TestDiagramMetadataGolden(t *testing.T) {
+	old := version
+	t.Cleanup(func() { version = old })
+	version = "v1.2.0"
+	result := renderer.RenderResult{
+		DiagramType: "flowchart-v2",
+		Width:       412.5,
+		Height:      174,
+		Title:       "Login flow",
+	}
+	got := newDiagramMetadata("docs/arch.mmd", metadataTestSource, "11.4.1", result).marshal()
+
+	goldenName := filepath.Join("testdata", "metadata", "arch.svg.json")
+	want, err := os.ReadFile(goldenName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := mermaidtest.Diff(goldenName, string(want), "-metadata", string(got)); diff != "" {
+		t.Errorf("-metadata sidecar differs:\n%s", diff)
+	}
+}
+
+func TestDiagramMetadataUntitled(t *testing.T) {
+	result := renderer.RenderResult{DiagramType: "pie", Width: 10, Height: 10}
+	got := string(newDiagramMetadata("pie.mmd", "pie\n    \"A\" : 1\n", "11.4.1", result).marshal())
+	for _, key := range []string{`"title"`, `"accTitle"`} {
+		if strings.Contains(got, key) {
+			t.Errorf("metadata of an untitled document has %s:\n%s", key, got)
+		}
+	}
+}
+
+func TestStatementValue(t *testing.T) {
+	for _, tc := range []struct {
+		text, key, want string
+	}{
+		{"flowchart LR\n    accTitle: Plain\n", "accTitle", "Plain"},
+		{"flowchart LR\n    accTitle: \"Double\"\n", "accTitle", "Double"},
+		{"flowchart LR\n    accTitle: 'Single'\n", "accTitle", "Single"},
+		{"pie\n    title Pets\n", "title", "Pets"},
+		{"flowchart LR\n    accTitleX: no\n", "accTitle", ""},
+		{"flowchart LR\n", "accTitle", ""},
+	} {
+		if got := statementValue(tc.text, tc.key); got != tc.want {
+			t.Errorf("statementValue(%q, %q) = %q, want %q", tc.text, tc.key, got, tc.want)
+		}
+	}
+}
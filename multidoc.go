@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// diagramSeparator is the line that, with -split, separates the
+// diagrams of a MermaidJS document that has more than one, as
+// some other tools have it.
+const diagramSeparator = "---"
+
+// yamlKeyLineRE matches a line that starts a YAML mapping, as the
+// first line of front matter does, e.g., "config:" or "title: x".
+var yamlKeyLineRE = regexp.MustCompile(`^\s*[A-Za-z_][\w-]*\s*:`)
+
+// diagramChunk is one of the diagrams of a MermaidJS document.
+type diagramChunk struct {
+	src  string
+	line int // the line of the file src starts on, counting from 1
+}
+
+// splitDiagrams returns the diagrams of the MermaidJS document
+// mmdSource, which are separated by lines of only
+// diagramSeparator, in order, and whether it has any separators.
+// Chunks with nothing but blank lines in them, as before a leading
+// separator or after a trailing one, are skipped, so they don't
+// count toward the diagrams' numbers.
+//
+// A diagram can start with front matter, whose first and last
+// lines are diagramSeparator lines too: one at the start of a
+// diagram opens front matter if the line after it starts a YAML
+// mapping, and the next one closes it.
+func splitDiagrams(mmdSource string) (chunks []diagramChunk, separated bool) {
+	lines := strings.SplitAfter(mmdSource, "\n")
+	var (
+		cur       []string
+		start     = 1
+		content   bool // cur has more than blank lines
+		inFront   bool // in cur's front matter
+		frontDone bool // cur's front matter is closed, or it has none
+	)
+	flush := func(next int) {
+		if content {
+			chunks = append(chunks, diagramChunk{src: strings.Join(cur, ""), line: start})
+		}
+		cur, start, content, inFront, frontDone = nil, next, false, false, false
+	}
+	for i, line := range lines {
+		isSep := strings.TrimSpace(line) == diagramSeparator
+		switch {
+		case inFront:
+			if isSep {
+				inFront, frontDone = false, true
+			}
+		case isSep && !content && !frontDone && i+1 < len(lines) && yamlKeyLineRE.MatchString(lines[i+1]):
+			inFront = true
+		case isSep:
+			separated = true
+			flush(i + 2)
+			continue
+		}
+		if len(cur) == 0 && strings.TrimSpace(line) == "" {
+			start = i + 2 // leading blank lines aren't the diagram's
+			continue
+		}
+		cur = append(cur, line)
+		content = content || strings.TrimSpace(line) != ""
+	}
+	flush(len(lines) + 1)
+	return chunks, separated
+}
+
+// countDiagrams returns how many diagrams -split renders the
+// MermaidJS document name as, for planning its outputs, or 0 to
+// render it whole, if it has no separators.
+func countDiagrams(name string) (int, error) {
+	b, err := readInput(name)
+	if err != nil {
+		return 0, nil // reading it to render it says what's wrong
+	}
+	chunks, separated := splitDiagrams(string(b))
+	if !separated {
+		return 0, nil
+	}
+	return len(chunks), nil
+}
+
+// readDiagram returns the diagram of its document that pair, of a
+// document -split splits, is for.
+func readDiagram(pair renderPair) (diagramChunk, error) {
+	b, err := readInput(pair.mmdName)
+	if err != nil {
+		return diagramChunk{}, err
+	}
+	chunks, _ := splitDiagrams(string(b))
+	if pair.block > len(chunks) {
+		return diagramChunk{}, fmt.Errorf("%s has no diagram %d", pair.mmdName, pair.block)
+	}
+	return chunks[pair.block-1], nil
+}
+
+// separatorHint returns, for a document that failed to render
+// whole, a hint to use -split if it has more than one diagram, or
+// "" if it doesn't: MermaidJS's own error, about the separator,
+// doesn't say what's wrong.
+func separatorHint(pair renderPair, mmdSource []byte) string {
+	if *splitFlag || pair.block > 0 || isMarkdown(pair.mmdName) {
+		return ""
+	}
+	chunks, separated := splitDiagrams(string(mmdSource))
+	if !separated || len(chunks) < 2 {
+		return ""
+	}
+	return fmt.Sprintf("%s has %d diagrams separated by %q lines, which MermaidJS can't render as one; use -split to render each to an output of its own", pair.docName(), len(chunks), diagramSeparator)
+}
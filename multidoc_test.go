@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestSplitDiagramsSteps splits testdata/multi/steps.mmd, which has
+// leading and trailing separators, and front matter on its second
+// diagram, into its three diagrams.
+func TestSplitDiagramsSteps(t *testing.T) {
+	name := filepath.Join("testdata", "multi", "steps.mmd")
+	b, err := readInput(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, separated := splitDiagrams(string(b))
+	want := []diagramChunk{
+		{src: "flowchart LR\n    A[Build] --> B[Test]\n\n", line: 3},
+		{src: "---\nconfig:\n  theme: forest\n---\nsequenceDiagram\n    CI->>Registry: push image\n    Registry-->>CI: digest\n", line: 7},
+		{src: "pie title Time spent\n    \"Build\" : 40\n    \"Test\" : 60\n\n", line: 16},
+	}
+	if !separated || !slices.Equal(chunks, want) {
+		t.Errorf("steps.mmd splits into (%t)\n%q\nwant\n%q", separated, chunks, want)
+	}
+
+	hint := separatorHint(renderPair{mmdName: name}, b)
+	if !strings.Contains(hint, "has 3 diagrams") || !strings.Contains(hint, "use -split") {
+		t.Errorf("separatorHint = %q, want one saying to use -split for 3 diagrams", hint)
+	}
+
+	setFlag(t, "split", "true")
+	if hint := separatorHint(renderPair{mmdName: name}, b); hint != "" {
+		t.Errorf("with -split, separatorHint = %q", hint)
+	}
+	pairs, err := planPairs([]string{name}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pair := range pairs {
+		chunk, err := readDiagram(pair)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk != want[i] {
+			t.Errorf("%s is diagram %q, want %q", pair.svgName, chunk.src, want[i].src)
+		}
+	}
+	var names []string
+	for _, pair := range pairs {
+		names = append(names, filepath.Base(pair.svgName))
+	}
+	if wantNames := []string{"steps-1.svg", "steps-2.svg", "steps-3.svg"}; !slices.Equal(names, wantNames) {
+		t.Errorf("planned %q, want %q", names, wantNames)
+	}
+}
+
+func TestSplitDiagrams(t *testing.T) {
+	for _, tc := range []struct {
+		name, src string
+		want      []diagramChunk
+		separated bool
+	}{
+		{"one", "pie\n", []diagramChunk{{src: "pie\n", line: 1}}, false},
+		{"front matter only", "---\ntitle: T\n---\npie\n", []diagramChunk{{src: "---\ntitle: T\n---\npie\n", line: 1}}, false},
+		{"two", "pie\n---\nflowchart LR\n", []diagramChunk{{src: "pie\n", line: 1}, {src: "flowchart LR\n", line: 3}}, true},
+		{"blank", "pie\n---\n\n---\nflowchart LR\n", []diagramChunk{{src: "pie\n", line: 1}, {src: "flowchart LR\n", line: 5}}, true},
+		{"indented", "pie\n  ---  \nflowchart LR\n", []diagramChunk{{src: "pie\n", line: 1}, {src: "flowchart LR\n", line: 3}}, true},
+	} {
+		chunks, separated := splitDiagrams(tc.src)
+		if separated != tc.separated || !slices.Equal(chunks, tc.want) {
+			t.Errorf("%s: got (%t) %q, want (%t) %q", tc.name, separated, chunks, tc.separated, tc.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// ndjsonRequest is one line of input in -ndjson mode.
+type ndjsonRequest struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Theme  string `json:"theme,omitempty"`
+}
+
+// ndjsonResponse is one line of output in -ndjson mode.  Exactly
+// one of SVG and Error is set.
+type ndjsonResponse struct {
+	ID    string       `json:"id"`
+	SVG   string       `json:"svg,omitempty"`
+	Error *ndjsonError `json:"error,omitempty"`
+}
+
+type ndjsonError struct {
+	Message string `json:"message"`
+}
+
+// renderNDJSON reads render requests, one JSON object per line,
+// from in and writes a response line to out for each of them.
+//
+// A line that isn't a valid request gets an error response with
+// a synthetic id, "line-N", instead of stopping the stream.  It
+// returns at EOF, or for any error reading in or writing out.
+func renderNDJSON(in io.Reader, out io.Writer) error {
+	var (
+		br           = bufio.NewReader(in)
+		enc          = json.NewEncoder(out)
+		defaultTheme = mainRenderer.Theme()
+		lineN        = 0
+	)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			lineN++
+			resp := handleNDJSONLine(line, lineN, defaultTheme)
+			if resp != nil {
+				if err := enc.Encode(resp); err != nil {
+					return fmt.Errorf("write response: %w", err)
+				}
+			}
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return fmt.Errorf("read request: %w", err)
+		}
+	}
+}
+
+// handleNDJSONLine renders the request in line, re-initializing
+// MermaidJS first if the request asks for a different theme than
+// the last one, or defaultTheme if it doesn't ask for one.  It
+// returns nil for blank lines.
+func handleNDJSONLine(line []byte, lineN int, defaultTheme string) *ndjsonResponse {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+
+	var req ndjsonRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return ndjsonFailure(fmt.Sprintf("line-%d", lineN), fmt.Errorf("malformed request: %w", err))
+	}
+	if req.ID == "" {
+		req.ID = fmt.Sprintf("line-%d", lineN)
+	}
+
+	if req.Theme == "" {
+		req.Theme = defaultTheme
+	}
+	if req.Theme != mainRenderer.Theme() {
+		if err := mainRenderer.SetTheme(runCtx, req.Theme); err != nil {
+			return ndjsonFailure(req.ID, err)
+		}
+	}
+
+	svgResult, err := mainRenderer.Render(runCtx, req.Source)
+	if err != nil {
+		return ndjsonFailure(req.ID, err)
+	}
+	log.Println("rendered", req.ID)
+	return &ndjsonResponse{ID: req.ID, SVG: svgResult}
+}
+
+func ndjsonFailure(id string, err error) *ndjsonResponse {
+	log.Printf("couldn't render %s: %v", id, err)
+	return &ndjsonResponse{ID: id, Error: &ndjsonError{Message: err.Error()}}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeFileAtomic writes data to name like os.WriteFile, but
+// through a temporary file in the same directory that's renamed
+// over name, so name is never left half-written: it either has
+// its old content or all of data.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // after a successful rename this is a no-op
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// utf8BOM is the UTF-8 byte order mark that -output-bom adds.
+var utf8BOM = []byte("\uFEFF")
+
+// encodeOutput returns the SVG or HTML data with the line endings
+// of -output-newline, and starting with a UTF-8 BOM for
+// -output-bom.  Everything that compares or checksums outputs
+// sees these final bytes, since they're what's on disk.
+func encodeOutput(data []byte) []byte {
+	if *outputNewlineFlag == "crlf" {
+		data = bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	}
+	if *outputBOMFlag && !bytes.HasPrefix(data, utf8BOM) {
+		data = append(utf8BOM[:len(utf8BOM):len(utf8BOM)], data...)
+	}
+	return data
+}
+
+// rotateBackups keeps up to n backups of name, as name.1 (the
+// newest) through name.n, before name is overwritten with data.
+// It does nothing if name doesn't exist or already has data as
+// its content, and removes any backups past name.n.
+//
+// The backups are copies, so name itself is never missing.
+func rotateBackups(name string, data []byte, n int) error {
+	old, err := os.ReadFile(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case bytes.Equal(old, data):
+		return nil
+	}
+
+	backup := func(i int) string { return fmt.Sprintf("%s.%d", name, i) }
+	for i := n + 1; ; i++ {
+		err := os.Remove(backup(i))
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for i := n - 1; i >= 1; i-- {
+		err := os.Rename(backup(i), backup(i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return writeFileAtomic(backup(1), old, 0644)
+}
+
+// validateSVG checks that svgResult is well-formed XML with an
+// svg root element, so a mangled result fails here rather than
+// somewhere confusing downstream.
+//
+// The decoder never fetches external entities or DTDs.
+func validateSVG(svgResult string) error {
+	d := xml.NewDecoder(strings.NewReader(svgResult))
+	root := ""
+	for {
+		tok, err := d.Token()
+		switch {
+		case errors.Is(err, io.EOF) && root == "":
+			return errors.New("invalid SVG: no root element")
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return fmt.Errorf("invalid SVG at byte %d: %w", d.InputOffset(), err)
+		}
+		if se, ok := tok.(xml.StartElement); ok && root == "" {
+			root = se.Name.Local
+			if root != "svg" {
+				return fmt.Errorf("invalid SVG at byte %d: got root element <%s>; expected <svg>", d.InputOffset(), root)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// pipelineDepth is how many documents each stage of renderAll can
+// get ahead of the next.
+const pipelineDepth = 4
+
+// renderAll renders pairs as render does, but pipelined: a reader
+// goroutine reads documents ahead, render goroutines keep the
+// browser busy with them, and the calling goroutine finishes each
+// one (writes its SVG, and prints and records its outcome) while
+// the browser renders the next, so disk I/O overlaps the round
+// trips to the browser.
+//
+// With WithConcurrency (-j) over 1, there's a render goroutine for
+// each tab of a renderer.Pool.  Otherwise the one render goroutine
+// uses renderer.  Either way, documents are finished in the order
+// of pairs, holding back any rendered ahead of those before them,
+// so the log and the reports are the same as if they were rendered
+// one by one.
+//
+// A document that fails doesn't stop the others.  It returns how
+// many documents failed.
+func renderAll(pairs []renderPair) int {
+	return renderAllWith(pairs, (*renderDoc).render, finishRender)
+}
+
+// renderAllWith is renderAll, handing each document to work, with
+// the renderer (or Pool tab) it's to use, instead of rendering it,
+// and finishing it with finish instead of finishRender.
+func renderAllWith(pairs []renderPair, work func(*renderDoc, *renderer.Renderer), finish func(*renderDoc) error) int {
+	// seqDoc is a document and its index in pairs.
+	type seqDoc struct {
+		i int
+		d *renderDoc
+	}
+	read := make(chan seqDoc, pipelineDepth)
+	go func() {
+		defer close(read)
+		for i, pair := range pairs {
+			read <- seqDoc{i, readDoc(pair)}
+		}
+	}()
+
+	var pool *renderer.Pool
+	workers := min(mainRenderer.Concurrency(), len(pairs))
+	if workers > 1 {
+		var err error
+		if pool, err = mainRenderer.NewPool(runCtx, workers); err != nil {
+			if deadlineExceeded() {
+				errorf("%v", err)
+				abortRun()
+			}
+			fatalf("%v", err)
+		}
+		defer pool.Close()
+		browser.Lock()
+		browser.pool = pool
+		browser.Unlock()
+		defer func() {
+			browser.Lock()
+			browser.pool = nil
+			browser.Unlock()
+		}()
+	}
+
+	rendered := make(chan seqDoc, pipelineDepth)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sd := range read {
+				if pool == nil {
+					work(sd.d, mainRenderer)
+					rendered <- sd
+					continue
+				}
+				r, err := pool.Acquire(runCtx)
+				if err != nil {
+					sd.d.err = err
+				} else {
+					work(sd.d, r)
+					pool.Release(r)
+				}
+				rendered <- sd
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(rendered)
+	}()
+
+	failed := 0
+	ahead := make(map[int]*renderDoc)
+	next := 0
+	for sd := range rendered {
+		ahead[sd.i] = sd.d
+		for d, ok := ahead[next]; ok; d, ok = ahead[next] {
+			delete(ahead, next)
+			next++
+			if finish(d) != nil {
+				failed++
+			}
+		}
+	}
+	return failed
+}
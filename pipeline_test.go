@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+func TestRenderAllOrder(t *testing.T) {
+	startTestRenderer(t, renderer.WithConcurrency(4))
+	var pairs []renderPair
+	for i := range 12 {
+		name := fmt.Sprintf("%02d.mmd", i)
+		pairs = append(pairs, renderPair{mmdName: name, svgName: name + ".svg"})
+	}
+
+	// The later documents take the least time, so they come back
+	// from the tabs first.
+	work := func(d *renderDoc, r *renderer.Renderer) {
+		i := slices.IndexFunc(pairs, func(p renderPair) bool { return p == d.pair })
+		time.Sleep(time.Duration(len(pairs)-i) * 5 * time.Millisecond)
+	}
+	var finished []string
+	finish := func(d *renderDoc) error {
+		finished = append(finished, d.pair.mmdName)
+		return nil
+	}
+	if failed := renderAllWith(pairs, work, finish); failed != 0 {
+		t.Errorf("%d documents failed", failed)
+	}
+
+	var want []string
+	for _, pair := range pairs {
+		want = append(want, pair.mmdName)
+	}
+	if !slices.Equal(finished, want) {
+		t.Errorf("documents finished in the order\n%s\nwant\n%s", strings.Join(finished, " "), strings.Join(want, " "))
+	}
+}
+
+// BenchmarkRenderAll renders a synthetic corpus of 200 flowcharts
+// one by one, with render, and pipelined, with renderAll.
+func BenchmarkRenderAll(b *testing.B) {
+	files := make(map[string]string)
+	var pairs []renderPair
+	for i := range 200 {
+		name := fmt.Sprintf("doc%03d.mmd", i)
+		files[name] = fmt.Sprintf("flowchart TD\n    A%d[Start] --> B{Choice %d}\n    B --> C[One]\n    B --> D[Two]\n", i, i)
+		pairs = append(pairs, renderPair{mmdName: name, svgName: filepath.Join("out", name+".svg")})
+	}
+	chdirTemp(b, files)
+	setFlag(b, "q", "true")
+
+	b.Run("sequential", func(b *testing.B) {
+		startTestRenderer(b)
+		for range b.N {
+			for _, pair := range pairs {
+				if err := render(pair); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("pipelined", func(b *testing.B) {
+		startTestRenderer(b)
+		for range b.N {
+			if failed := renderAll(pairs); failed != 0 {
+				b.Fatalf("%d documents failed", failed)
+			}
+		}
+	})
+}
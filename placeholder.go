@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Layout for the placeholder SVG, in pixels.  The text is 12px
+// monospace, which is about 7.2px per character.
+const (
+	placeholderCols       = 80
+	placeholderCharWidth  = 7.2
+	placeholderLineHeight = 16
+	placeholderPad        = 16
+)
+
+// placeholderSVG returns an SVG that shows name and err in place
+// of the diagram in name that failed to render.
+//
+// It's drawn with a red, dashed border over red stripes so it
+// can't be mistaken for a real diagram.
+func placeholderSVG(name string, err error) string {
+	lines := []string{"mermaid-cli: couldn't render " + name, ""}
+	for _, line := range strings.Split(err.Error(), "\n") {
+		lines = append(lines, wrapLine(line, placeholderCols)...)
+	}
+
+	cols := 0
+	for _, line := range lines {
+		cols = max(cols, len([]rune(line)))
+	}
+	width := math.Ceil(float64(cols)*placeholderCharWidth) + 2*placeholderPad
+	height := float64(len(lines)*placeholderLineHeight + 2*placeholderPad)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]g" height="%[2]g" viewBox="0 0 %[1]g %[2]g">`+"\n", width, height)
+	b.WriteString(`<defs><pattern id="mermaid-cli-error-stripes" width="16" height="16" patternUnits="userSpaceOnUse" patternTransform="rotate(45)">` +
+		`<rect width="16" height="16" fill="#fff0f0"/><rect width="8" height="16" fill="#ffe0e0"/></pattern></defs>` + "\n")
+	fmt.Fprintf(&b, `<rect x="1" y="1" width="%g" height="%g" fill="url(#mermaid-cli-error-stripes)" stroke="#d00" stroke-width="2" stroke-dasharray="8 4"/>`+"\n", width-2, height-2)
+	fmt.Fprintf(&b, `<text font-family="monospace" font-size="12" fill="#900" xml:space="preserve">`+"\n")
+	for i, line := range lines {
+		y := placeholderPad + (i+1)*placeholderLineHeight - 4
+		fmt.Fprintf(&b, `<tspan x="%d" y="%d"`, placeholderPad, y)
+		if i == 0 {
+			b.WriteString(` font-weight="bold"`)
+		}
+		b.WriteString(">")
+		xml.EscapeText(&b, []byte(line))
+		b.WriteString("</tspan>\n")
+	}
+	b.WriteString("</text>\n</svg>\n")
+
+	return b.String()
+}
+
+// wrapLine breaks line into lines of at most n runes, at spaces
+// where it can.
+func wrapLine(line string, n int) []string {
+	var lines []string
+	r := []rune(line)
+	for len(r) > n {
+		i := n
+		for i > 0 && r[i] != ' ' {
+			i--
+		}
+		if i == 0 {
+			i = n
+		}
+		lines = append(lines, string(r[:i]))
+		r = []rune(strings.TrimLeft(string(r[i:]), " "))
+	}
+	return append(lines, string(r))
+}
@@ -0,0 +1,387 @@
+/*
+Package plan works out where mermaid-cli writes each document's
+output, without rendering, or writing, anything: for a build tool
+that wants to know a run's outputs ahead of time.
+
+	pairs, err := plan.Outputs([]string{"docs/flow.mmd", "README.md"}, plan.Options{
+		Format: "png",
+		OutDir: "build",
+		Blocks: countBlocks,
+	})
+
+The cli plans its own outputs with it, and -dry-run prints the
+plan.  Match and SkipDir are its rules for which documents a
+pattern, or a directory, names.
+*/
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Stdio is the input that means standard input, whose output goes
+// to standard output.
+const Stdio = "-"
+
+// The extensions of the inputs Outputs takes: MermaidJS documents,
+// and Markdown files, whose mermaid blocks are rendered instead.
+const (
+	MermaidExt  = ".mmd"
+	MarkdownExt = ".md"
+)
+
+// A Pair is an input, and the output it's rendered to.
+type Pair struct {
+	Input string
+
+	// Block is which mermaid block of the Markdown file Input the
+	// pair is for, counting from 1, or which part of the MermaidJS
+	// document Input that Options.Parts splits it into, or 0 for a
+	// whole MermaidJS document.
+	Block int
+
+	// Variant is the name of the Variant the pair renders with, or
+	// "".
+	Variant string
+
+	Output string
+}
+
+// A Variant is a set of settings every input is rendered with once
+// more, as for -matrix, to outputs of its own.
+type Variant struct {
+	Name string
+
+	// Suffix goes on the end of the output's name, before its
+	// extension, and Dir is a directory, in the output's own
+	// directory, that it goes in instead.  A Variant needs at
+	// least one.
+	Suffix, Dir string
+}
+
+// Options are the settings that decide outputs' names.
+type Options struct {
+	// Format is the output's format, and extension: svg, png, or
+	// pdf.  "" means svg.
+	Format string
+
+	// OutDir, if set, is the directory every output goes in, as for
+	// -outdir, rather than beside its input.
+	OutDir string
+
+	// Blocks returns how many mermaid blocks the Markdown file name
+	// has.  It's required for Markdown inputs.
+	Blocks func(name string) (int, error)
+
+	// Name, if set, names each output instead, as -name-template
+	// does: it's executed with the output's NameData, and names a
+	// file relative to OutDir, if it's set, or else to the input's
+	// directory.  ParseNameTemplate parses one.
+	Name *template.Template
+
+	// Title, if set, names each output after its document's title,
+	// as -name-from-title does: it returns the title of the
+	// document name, or of its block'th mermaid block if it's
+	// Markdown, or "" to keep the output's usual name.
+	Title func(name string, block int) (string, error)
+
+	// Parts, if set, splits MermaidJS documents, as
+	// -split-threshold and -split do: it returns how many parts the document
+	// name is rendered in, each to an output of its own, numbered
+	// like a Markdown file's, or 0 to render it whole.
+	Parts func(name string) (int, error)
+
+	// Variants, if any, render every input once per variant; the
+	// pairs are grouped by variant, in order.  Stdio isn't varied.
+	Variants []Variant
+}
+
+// NameData is what an Options.Name template is executed with, for
+// one output.
+type NameData struct {
+	// Dir is the input's directory, with slashes, e.g., docs/guide,
+	// or "." for the current directory.
+	Dir string
+
+	// Base is the input's name without its directory or extension,
+	// e.g., flow for docs/flow.mmd.
+	Base string
+
+	// Ext is the output's extension, with its dot, e.g., .svg.
+	Ext string
+
+	// Index is the number of the Markdown block, or the part, the
+	// output is for, counting from 1, or 0 for a whole MermaidJS
+	// document.
+	Index int
+}
+
+// DefaultNameTemplate is the Options.Name template that names
+// outputs as Outputs does without one.
+const DefaultNameTemplate = "{{.Base}}{{if .Index}}-{{.Index}}{{end}}{{.Ext}}"
+
+// ParseNameTemplate parses text as an Options.Name template, and
+// tries it on a sample output, so a template that refers to data
+// NameData doesn't have, or that names no file, fails now rather
+// than when it's used.
+func ParseNameTemplate(text string) (*template.Template, error) {
+	t, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := execName(t, NameData{Dir: "docs", Base: "flow", Ext: ".svg", Index: 1}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// execName returns the name t gives the output with data.
+func execName(t *template.Template, data NameData) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	name := b.String()
+	if name == "" || strings.HasSuffix(name, "/") || path.Base(name) == "." || path.Base(name) == ".." {
+		return "", fmt.Errorf("name template %q names no file for %s", t.Root.String(), data.Base+data.Ext)
+	}
+	return name, nil
+}
+
+// CollisionError is returned by Outputs for two pairs that would
+// be written to the same output.
+type CollisionError struct {
+	Output        string
+	First, Second Pair
+}
+
+func (e *CollisionError) Error() string {
+	return fmt.Sprintf("%s and %s would both be written to %s", e.First.Name(), e.Second.Name(), e.Output)
+}
+
+// Name returns the name of pair's document for messages: Input,
+// or for a Markdown block or a part, e.g., README.md#2, with its variant
+// after it, e.g., flow.mmd [dark].
+func (pair Pair) Name() string {
+	name := pair.Input
+	if pair.Block > 0 {
+		name = fmt.Sprintf("%s#%d", pair.Input, pair.Block)
+	}
+	if pair.Variant != "" {
+		name += " [" + pair.Variant + "]"
+	}
+	return name
+}
+
+// Outputs returns the pairs for inputs, in order: one for a
+// MermaidJS document (.mmd), named for it with opts.Format's
+// extension, or for each part opts.Parts splits it into, and one
+// for each mermaid block of a Markdown file (.md), numbered from
+// 1, e.g., README-1.svg.  Standard input (-) goes to standard
+// output.
+//
+// It reads nothing itself; opts.Blocks, opts.Parts, and
+// opts.Title do.  It
+// returns an error for an input with any other extension, or a
+// *CollisionError for two pairs with the same output.
+func Outputs(inputs []string, opts Options) ([]Pair, error) {
+	format := opts.Format
+	if format == "" {
+		format = "svg"
+	}
+	var pairs []Pair
+	for _, input := range inputs {
+		switch {
+		case input == Stdio:
+			pairs = append(pairs, Pair{Input: Stdio, Output: Stdio})
+		case strings.HasSuffix(input, MarkdownExt):
+			if opts.Blocks == nil {
+				return nil, errors.New("plan: no Blocks func for Markdown input " + input)
+			}
+			n, err := opts.Blocks(input)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't read Markdown: %w", err)
+			}
+			for block := 1; block <= n; block++ {
+				name := fmt.Sprintf("%s-%d.%s", strings.TrimSuffix(input, MarkdownExt), block, format)
+				pair, err := newPair(input, block, name, opts)
+				if err != nil {
+					return nil, err
+				}
+				pairs = append(pairs, pair)
+			}
+		case strings.HasSuffix(input, MermaidExt):
+			parts := 0
+			if opts.Parts != nil {
+				n, err := opts.Parts(input)
+				if err != nil {
+					return nil, fmt.Errorf("couldn't split %s: %w", input, err)
+				}
+				parts = n
+			}
+			if parts == 0 {
+				name := strings.TrimSuffix(input, MermaidExt) + "." + format
+				pair, err := newPair(input, 0, name, opts)
+				if err != nil {
+					return nil, err
+				}
+				pairs = append(pairs, pair)
+			}
+			for part := 1; part <= parts; part++ {
+				name := fmt.Sprintf("%s-%d.%s", strings.TrimSuffix(input, MermaidExt), part, format)
+				pair, err := newPair(input, part, name, opts)
+				if err != nil {
+					return nil, err
+				}
+				pairs = append(pairs, pair)
+			}
+		default:
+			return nil, fmt.Errorf("got input MermaidJS document %s; expected it to end with %s, or %s for Markdown", input, MermaidExt, MarkdownExt)
+		}
+	}
+
+	if len(opts.Variants) > 0 {
+		pairs = variantPairs(pairs, opts.Variants)
+	}
+	if err := CheckCollisions(pairs); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// newPair returns the pair for the block of input (0 for all of
+// it), whose output is otherwise name.
+func newPair(input string, block int, name string, opts Options) (Pair, error) {
+	switch {
+	case opts.Name != nil:
+		named, err := execName(opts.Name, NameData{
+			Dir:   filepath.ToSlash(filepath.Dir(input)),
+			Base:  strings.TrimSuffix(filepath.Base(input), filepath.Ext(input)),
+			Ext:   filepath.Ext(name),
+			Index: block,
+		})
+		if err != nil {
+			return Pair{}, err
+		}
+		named = filepath.FromSlash(named)
+		switch {
+		case filepath.IsAbs(named):
+			name = filepath.Clean(named)
+		case opts.OutDir != "":
+			name = filepath.Join(opts.OutDir, named)
+		default:
+			name = filepath.Join(filepath.Dir(input), named)
+		}
+	case opts.OutDir != "":
+		name = filepath.Join(opts.OutDir, filepath.Base(name))
+	}
+	if opts.Title != nil {
+		title, err := opts.Title(input, block)
+		if err != nil {
+			return Pair{}, err
+		}
+		if slug := Slug(title); slug != "" {
+			name = filepath.Join(filepath.Dir(name), slug+filepath.Ext(name))
+		}
+	}
+	return Pair{Input: input, Block: block, Output: name}, nil
+}
+
+// variantPairs returns pairs once per variant, grouped by variant.
+// A Stdio pair is left as is: stdout takes one output, so it
+// isn't varied.
+func variantPairs(pairs []Pair, variants []Variant) []Pair {
+	out := make([]Pair, 0, len(pairs)*len(variants))
+	for _, pair := range pairs {
+		if pair.Output == Stdio {
+			out = append(out, pair)
+		}
+	}
+	for _, v := range variants {
+		for _, pair := range pairs {
+			if pair.Output == Stdio {
+				continue
+			}
+			dir, base := filepath.Split(pair.Output)
+			ext := filepath.Ext(base)
+			pair.Output = filepath.Join(dir, v.Dir, strings.TrimSuffix(base, ext)+v.Suffix+ext)
+			pair.Variant = v.Name
+			out = append(out, pair)
+		}
+	}
+	return out
+}
+
+// CheckCollisions returns a *CollisionError for the first two of
+// pairs with the same output, or nil.
+func CheckCollisions(pairs []Pair) error {
+	seen := make(map[string]Pair)
+	for _, pair := range pairs {
+		if first, ok := seen[pair.Output]; ok {
+			return &CollisionError{Output: pair.Output, First: first, Second: pair}
+		}
+		seen[pair.Output] = pair
+	}
+	return nil
+}
+
+// Slug returns title lowercased, with each run of characters
+// other than letters and digits replaced by a hyphen, and no
+// leading or trailing hyphens.
+func Slug(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+			continue
+		}
+		hyphen = true
+	}
+	return b.String()
+}
+
+// SkipDir reports whether a search for documents skips the
+// directory named base: hidden ones, like .git, and node_modules.
+func SkipDir(base string) bool {
+	return strings.HasPrefix(base, ".") || base == "node_modules"
+}
+
+// Match reports whether the slash-separated name matches pattern,
+// where each element is matched as for path.Match, so * doesn't
+// cross directories, except that an element that's only **
+// matches any number of elements, none included.
+func Match(pattern, name string) bool {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,427 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// blocks is an Options.Blocks that gives every Markdown file two
+// blocks.
+func blocks(name string) (int, error) { return 2, nil }
+
+func TestOutputs(t *testing.T) {
+	j := filepath.Join
+	for _, tc := range []struct {
+		name   string
+		inputs []string
+		opts   Options
+		want   []Pair
+	}{
+		{
+			"mmd",
+			[]string{"flow.mmd", j("docs", "seq.mmd")},
+			Options{},
+			[]Pair{
+				{Input: "flow.mmd", Output: "flow.svg"},
+				{Input: j("docs", "seq.mmd"), Output: j("docs", "seq.svg")},
+			},
+		},
+		{
+			"format",
+			[]string{"flow.mmd"},
+			Options{Format: "pdf"},
+			[]Pair{{Input: "flow.mmd", Output: "flow.pdf"}},
+		},
+		{
+			"stdio",
+			[]string{Stdio},
+			Options{Format: "png", OutDir: "out", Variants: []Variant{{Name: "dark", Suffix: "-dark"}, {Name: "print", Dir: "print"}}},
+			[]Pair{{Input: Stdio, Output: Stdio}},
+		},
+		{
+			"markdown",
+			[]string{j("docs", "README.md")},
+			Options{Blocks: blocks},
+			[]Pair{
+				{Input: j("docs", "README.md"), Block: 1, Output: j("docs", "README-1.svg")},
+				{Input: j("docs", "README.md"), Block: 2, Output: j("docs", "README-2.svg")},
+			},
+		},
+		{
+			"markdown with no blocks",
+			[]string{"README.md"},
+			Options{Blocks: func(string) (int, error) { return 0, nil }},
+			nil,
+		},
+		{
+			"outdir",
+			[]string{j("docs", "flow.mmd"), "README.md"},
+			Options{OutDir: "out", Blocks: blocks},
+			[]Pair{
+				{Input: j("docs", "flow.mmd"), Output: j("out", "flow.svg")},
+				{Input: "README.md", Block: 1, Output: j("out", "README-1.svg")},
+				{Input: "README.md", Block: 2, Output: j("out", "README-2.svg")},
+			},
+		},
+		{
+			"name template",
+			[]string{j("docs", "flow.mmd")},
+			Options{Name: template.Must(ParseNameTemplate("{{.Dir}}/{{.Base}}.diagram{{.Ext}}"))},
+			[]Pair{{Input: j("docs", "flow.mmd"), Output: j("docs", "docs", "flow.diagram.svg")}},
+		},
+		{
+			"name template with outdir",
+			[]string{j("docs", "flow.mmd")},
+			Options{OutDir: "out", Name: template.Must(ParseNameTemplate("{{.Dir}}/{{.Base}}{{.Ext}}"))},
+			[]Pair{{Input: j("docs", "flow.mmd"), Output: j("out", "docs", "flow.svg")}},
+		},
+		{
+			"absolute name template",
+			[]string{j("docs", "flow.mmd")},
+			Options{OutDir: "out", Name: template.Must(ParseNameTemplate("/tmp/{{.Base}}{{.Ext}}"))},
+			[]Pair{{Input: j("docs", "flow.mmd"), Output: filepath.FromSlash("/tmp/flow.svg")}},
+		},
+		{
+			"default name template",
+			[]string{"flow.mmd", "README.md"},
+			Options{Blocks: blocks, Name: template.Must(ParseNameTemplate(DefaultNameTemplate))},
+			[]Pair{
+				{Input: "flow.mmd", Output: "flow.svg"},
+				{Input: "README.md", Block: 1, Output: "README-1.svg"},
+				{Input: "README.md", Block: 2, Output: "README-2.svg"},
+			},
+		},
+		{
+			"title",
+			[]string{j("docs", "flow.mmd"), "untitled.mmd"},
+			Options{Title: func(name string, block int) (string, error) {
+				if name == "untitled.mmd" {
+					return "", nil
+				}
+				return "Login: Happy Path!", nil
+			}},
+			[]Pair{
+				{Input: j("docs", "flow.mmd"), Output: j("docs", "login-happy-path.svg")},
+				{Input: "untitled.mmd", Output: "untitled.svg"},
+			},
+		},
+		{
+			"title of nothing but punctuation",
+			[]string{"flow.mmd"},
+			Options{Title: func(string, int) (string, error) { return "?!", nil }},
+			[]Pair{{Input: "flow.mmd", Output: "flow.svg"}},
+		},
+		{
+			"parts",
+			[]string{"flow.mmd", "whole.mmd"},
+			Options{Parts: func(name string) (int, error) {
+				if name == "whole.mmd" {
+					return 0, nil
+				}
+				return 2, nil
+			}},
+			[]Pair{
+				{Input: "flow.mmd", Block: 1, Output: "flow-1.svg"},
+				{Input: "flow.mmd", Block: 2, Output: "flow-2.svg"},
+				{Input: "whole.mmd", Output: "whole.svg"},
+			},
+		},
+		{
+			"variants",
+			[]string{"flow.mmd", "seq.mmd"},
+			Options{Variants: []Variant{{Name: "dark", Suffix: "-dark"}, {Name: "print", Dir: "print"}}},
+			[]Pair{
+				{Input: "flow.mmd", Variant: "dark", Output: "flow-dark.svg"},
+				{Input: "seq.mmd", Variant: "dark", Output: "seq-dark.svg"},
+				{Input: "flow.mmd", Variant: "print", Output: j("print", "flow.svg")},
+				{Input: "seq.mmd", Variant: "print", Output: j("print", "seq.svg")},
+			},
+		},
+		{
+			"variant with a suffix and a dir",
+			[]string{j("docs", "flow.mmd")},
+			Options{Format: "png", Variants: []Variant{{Name: "v", Suffix: ".v", Dir: "v"}}},
+			[]Pair{{Input: j("docs", "flow.mmd"), Variant: "v", Output: j("docs", "v", "flow.v.png")}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Outputs(tc.inputs, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Outputs(%q) =\n%v\nwant\n%v", tc.inputs, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestOutputsCombinations plans the same inputs with every
+// combination of options, checking each against the names its
+// options call for, composed by hand.
+func TestOutputsCombinations(t *testing.T) {
+	j := filepath.Join
+	inputs := []string{j("docs", "flow.mmd"), j("docs", "README.md")}
+	variants := []Variant{{Name: "dark", Suffix: "-dark"}, {Name: "print", Dir: "print"}}
+	name := template.Must(ParseNameTemplate("{{.Base}}.{{.Index}}{{.Ext}}"))
+	title := func(name string, block int) (string, error) {
+		return fmt.Sprintf("%s Part %d", filepath.Base(name), block), nil
+	}
+	parts := func(string) (int, error) { return 2, nil }
+
+	for _, format := range []string{"", "png"} {
+		for _, outDir := range []string{"", "out"} {
+			for mask := range 16 {
+				opts := Options{Format: format, OutDir: outDir, Blocks: blocks}
+				if mask&1 != 0 {
+					opts.Name = name
+				}
+				if mask&2 != 0 {
+					opts.Title = title
+				}
+				if mask&4 != 0 {
+					opts.Parts = parts
+				}
+				if mask&8 != 0 {
+					opts.Variants = variants
+				}
+
+				// The documents, and their names without
+				// directories or extensions, before the name
+				// template and title.
+				type doc struct {
+					input, stem string
+					block       int
+				}
+				docs := []doc{{inputs[0], "flow", 0}}
+				if opts.Parts != nil {
+					docs = []doc{{inputs[0], "flow-1", 1}, {inputs[0], "flow-2", 2}}
+				}
+				docs = append(docs, doc{inputs[1], "README-1", 1}, doc{inputs[1], "README-2", 2})
+
+				ext := ".svg"
+				if format != "" {
+					ext = "." + format
+				}
+				dir := "docs"
+				if outDir != "" {
+					dir = outDir
+				}
+				var want []Pair
+				for _, d := range docs {
+					stem := d.stem
+					if opts.Name != nil {
+						stem = fmt.Sprintf("%s.%d", strings.SplitN(d.stem, "-", 2)[0], d.block)
+					}
+					if opts.Title != nil {
+						stem = fmt.Sprintf("%s-part-%d", strings.ToLower(strings.ReplaceAll(filepath.Base(d.input), ".", "-")), d.block)
+					}
+					want = append(want, Pair{Input: d.input, Block: d.block, Output: j(dir, stem+ext)})
+				}
+				if opts.Variants != nil {
+					var all []Pair
+					for _, v := range variants {
+						for _, pair := range want {
+							stem := strings.TrimSuffix(filepath.Base(pair.Output), ext)
+							pair.Output = j(filepath.Dir(pair.Output), v.Dir, stem+v.Suffix+ext)
+							pair.Variant = v.Name
+							all = append(all, pair)
+						}
+					}
+					want = all
+				}
+
+				got, err := Outputs(inputs, opts)
+				if err != nil {
+					t.Errorf("Outputs with %+v: %v", opts, err)
+					continue
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Outputs with format %q, outdir %q, name %v, title %v, parts %v, variants %v =\n%v\nwant\n%v",
+						format, outDir, opts.Name != nil, opts.Title != nil, opts.Parts != nil, opts.Variants != nil, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestOutputsErrors(t *testing.T) {
+	errRead := errors.New("can't read")
+	for _, tc := range []struct {
+		name   string
+		inputs []string
+		opts   Options
+		want   string
+	}{
+		{"unknown extension", []string{"flow.txt"}, Options{}, "expected it to end with .mmd"},
+		{"no Blocks", []string{"README.md"}, Options{}, "no Blocks func"},
+		{
+			"Blocks error",
+			[]string{"README.md"},
+			Options{Blocks: func(string) (int, error) { return 0, errRead }},
+			"couldn't read Markdown: can't read",
+		},
+		{
+			"Parts error",
+			[]string{"flow.mmd"},
+			Options{Parts: func(string) (int, error) { return 0, errRead }},
+			"couldn't split flow.mmd: can't read",
+		},
+		{
+			"Title error",
+			[]string{"flow.mmd"},
+			Options{Title: func(string, int) (string, error) { return "", errRead }},
+			"can't read",
+		},
+	} {
+		_, err := Outputs(tc.inputs, tc.opts)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: Outputs = %v, want an error with %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestOutputsCollisions(t *testing.T) {
+	j := filepath.Join
+	for _, tc := range []struct {
+		name   string
+		inputs []string
+		opts   Options
+		output string
+	}{
+		{
+			"outdir",
+			[]string{j("a", "flow.mmd"), j("b", "flow.mmd")},
+			Options{OutDir: "out"},
+			j("out", "flow.svg"),
+		},
+		{
+			"same title",
+			[]string{"a.mmd", "b.mmd"},
+			Options{Title: func(string, int) (string, error) { return "Flow", nil }},
+			"flow.svg",
+		},
+		{
+			"name template",
+			[]string{"a.mmd", "b.mmd"},
+			Options{Name: template.Must(ParseNameTemplate("diagram{{.Ext}}"))},
+			"diagram.svg",
+		},
+		{
+			"part and Markdown block",
+			[]string{"flow.mmd", "flow.md"},
+			Options{Blocks: blocks, Parts: func(string) (int, error) { return 1, nil }},
+			"flow-1.svg",
+		},
+		{
+			"variant suffix",
+			[]string{"flow.mmd", "flow-dark.mmd"},
+			Options{Variants: []Variant{{Name: "plain", Dir: "."}, {Name: "dark", Suffix: "-dark"}}},
+			"flow-dark.svg",
+		},
+	} {
+		_, err := Outputs(tc.inputs, tc.opts)
+		var collision *CollisionError
+		if !errors.As(err, &collision) {
+			t.Errorf("%s: Outputs = %v, want a *CollisionError", tc.name, err)
+			continue
+		}
+		if collision.Output != tc.output {
+			t.Errorf("%s: collision at %s, want %s", tc.name, collision.Output, tc.output)
+		}
+	}
+}
+
+func TestParseNameTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		ok   bool
+	}{
+		{DefaultNameTemplate, true},
+		{"{{.Dir}}/{{.Base}}{{.Ext}}", true},
+		{"{{.Nope}}", false},
+		{"{{.Base", false},
+		{"", false},
+		{"{{.Dir}}/", false},
+		{"..", false},
+	} {
+		_, err := ParseNameTemplate(tc.text)
+		if (err == nil) != tc.ok {
+			t.Errorf("ParseNameTemplate(%q) = %v, want ok %v", tc.text, err, tc.ok)
+		}
+	}
+}
+
+func TestPairName(t *testing.T) {
+	for _, tc := range []struct {
+		pair Pair
+		want string
+	}{
+		{Pair{Input: "flow.mmd"}, "flow.mmd"},
+		{Pair{Input: "README.md", Block: 2}, "README.md#2"},
+		{Pair{Input: "flow.mmd", Variant: "dark"}, "flow.mmd [dark]"},
+		{Pair{Input: "README.md", Block: 2, Variant: "dark"}, "README.md#2 [dark]"},
+	} {
+		if got := tc.pair.Name(); got != tc.want {
+			t.Errorf("%+v.Name() = %q, want %q", tc.pair, got, tc.want)
+		}
+	}
+}
+
+func TestSlug(t *testing.T) {
+	for _, tc := range []struct {
+		title, want string
+	}{
+		{"Login Flow", "login-flow"},
+		{"  Login -- Flow!  ", "login-flow"},
+		{"Étape 2: Paiement", "étape-2-paiement"},
+		{"?!", ""},
+		{"", ""},
+	} {
+		if got := Slug(tc.title); got != tc.want {
+			t.Errorf("Slug(%q) = %q, want %q", tc.title, got, tc.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.mmd", "flow.mmd", true},
+		{"*.mmd", "docs/flow.mmd", false},
+		{"docs/*.mmd", "docs/flow.mmd", true},
+		{"**/*.mmd", "flow.mmd", true},
+		{"**/*.mmd", "a/b/c/flow.mmd", true},
+		{"docs/**", "docs", true},
+		{"docs/**", "docs/a/b", true},
+		{"docs/**/flow.mmd", "docs/flow.mmd", true},
+		{"docs/**/flow.mmd", "docs/a/b/flow.mmd", true},
+		{"docs/**/flow.mmd", "other/flow.mmd", false},
+		{"**/*.mmd", "flow.md", false},
+	} {
+		if got := Match(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSkipDir(t *testing.T) {
+	for base, want := range map[string]bool{
+		".git":         true,
+		".hidden":      true,
+		"node_modules": true,
+		"docs":         false,
+		"modules":      false,
+	} {
+		if got := SkipDir(base); got != want {
+			t.Errorf("SkipDir(%q) = %v, want %v", base, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// pageRenderer is the part of a renderer.Renderer that
+// recoverPage needs, so it can be tried without a browser.
+type pageRenderer interface {
+	RenderDiagram(ctx context.Context, src string) (renderer.RenderResult, error)
+	Healthy(ctx context.Context) bool
+	Reload(ctx context.Context) error
+}
+
+// recoverPage is for when the document name failed to render with
+// r, with err.  If r isn't Healthy either, its page is broken: it
+// reloads the page, for the documents after this one, and renders
+// the document once more with retry, in a tab of its own,
+// returning how that went.  The document only fails if it fails
+// there too.  Otherwise the document is what's broken, and it
+// returns err.
+//
+// Either way it says what happened, so the document that broke
+// MermaidJS can be reported upstream.
+func recoverPage(r pageRenderer, name string, err error, retry func() (renderer.RenderResult, error)) (renderer.RenderResult, error) {
+	if r.Healthy(runCtx) {
+		return renderer.RenderResult{}, err
+	}
+	if err := r.Reload(runCtx); err != nil {
+		errorf("MermaidJS stopped rendering at %s, and its page couldn't be reloaded: %v", name, err)
+	}
+	result, err := retry()
+	if err != nil {
+		warnf("MermaidJS stopped rendering at %s, which fails in a new tab too, so it's likely what broke MermaidJS; consider reporting it upstream.  The page was reloaded.", name)
+		return renderer.RenderResult{}, err
+	}
+	warnf("MermaidJS stopped rendering at %s, which renders in a new tab, so a document before it on the same page likely broke MermaidJS; consider reporting it upstream.  The page was reloaded.", name)
+	return result, nil
+}
+
+// renderInNewTab renders src, d's document, once more, in a new
+// tab of r, for recoverPage.
+func (d *renderDoc) renderInNewTab(r *renderer.Renderer, src string) (renderer.RenderResult, error) {
+	tab, err := r.NewTab(runCtx)
+	if err != nil {
+		return renderer.RenderResult{}, fmt.Errorf("retry in a new tab: %w", err)
+	}
+	defer tab.Close()
+
+	if err := applyDocConfig(tab, d.pair, string(d.src)); err != nil {
+		return renderer.RenderResult{}, err
+	}
+	result, err := tab.RenderDiagram(runCtx, src)
+	if err != nil && *errSidecarsFlag {
+		d.errDetails, _ = tab.RenderError(runCtx)
+	}
+	return result, err
+}
+
+// maxBrowserRestarts is how many times restartBrowser restarts the
+// browser in a minute, so one that dies as soon as it starts isn't
+// restarted forever.
+const maxBrowserRestarts = 3
+
+// browser is the state of the browser mainRenderer runs, for
+// restarting it when it dies.
+var browser struct {
+	sync.Mutex
+
+	// restarts are when restartBrowser restarted it.
+	restarts []time.Time
+
+	// pool is the pool of its tabs renderAll renders with, while
+	// it does, with -j over 1.
+	pool *renderer.Pool
+}
+
+// replaceRenderer returns a renderer to render with in place of r,
+// whose browser died with cause.  For mainRenderer, it's
+// mainRenderer restarted, with restartBrowser.  For a tab of
+// browser.pool, it's a new tab, in r's place in the pool, of
+// mainRenderer, restarted unless another tab has restarted it
+// already.  It returns nil, and no error, for any other renderer,
+// which has no browser to restart.
+func replaceRenderer(r *renderer.Renderer, cause error) (*renderer.Renderer, error) {
+	browser.Lock()
+	defer browser.Unlock()
+	if r == mainRenderer {
+		return restartBrowser(cause)
+	}
+	if browser.pool == nil {
+		return nil, nil
+	}
+	if r.Browser() == mainRenderer {
+		if _, err := restartBrowser(cause); err != nil {
+			return nil, err
+		}
+	}
+	tab, err := browser.pool.Replace(runCtx, r, mainRenderer)
+	if err != nil {
+		return nil, fmt.Errorf("restart browser: %w", err)
+	}
+	return tab, nil
+}
+
+// restartBrowser replaces mainRenderer, whose browser died with
+// cause, with a new browser set up the same way: the same
+// MermaidJS, config, fonts, and helpers.  It returns the new
+// renderer, or an error if the browser has been restarted too often
+// lately, or won't start.  browser must be locked.
+func restartBrowser(cause error) (*renderer.Renderer, error) {
+	now := time.Now()
+	recent := browser.restarts[:0]
+	for _, t := range browser.restarts {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	browser.restarts = recent
+	if len(recent) >= maxBrowserRestarts {
+		return nil, fmt.Errorf("the browser died %d times in the last minute, so it won't be restarted again yet: %v", len(recent)+1, cause)
+	}
+	browser.restarts = append(browser.restarts, now)
+
+	warnf("the browser died (%v); restarting it", cause)
+	log.Println("stopped headless browser")
+	r, err := mainRenderer.Restart(runCtx)
+	if err != nil {
+		return nil, fmt.Errorf("restart browser: %w", err)
+	}
+	mainRenderer = r
+	return r, nil
+}
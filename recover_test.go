@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// fakePage stands in for a renderer's page.  "poison" fails and
+// breaks it, and "poison-quietly" renders but breaks it; once it's
+// broken, everything fails until it's reloaded.  "bad" just fails.
+type fakePage struct {
+	broken  bool
+	reloads int
+}
+
+var errFakeInternal = errors.New("internal error")
+
+func (p *fakePage) RenderDiagram(ctx context.Context, src string) (renderer.RenderResult, error) {
+	switch {
+	case p.broken:
+		return renderer.RenderResult{}, errFakeInternal
+	case src == "poison":
+		p.broken = true
+		return renderer.RenderResult{}, errFakeInternal
+	case src == "poison-quietly":
+		p.broken = true
+	case src == "bad":
+		return renderer.RenderResult{}, errors.New("parse error")
+	}
+	return renderer.RenderResult{SVG: "<svg>" + src + "</svg>"}, nil
+}
+
+func (p *fakePage) Healthy(ctx context.Context) bool {
+	_, err := p.RenderDiagram(ctx, "flowchart LR\n    A --> B")
+	return err == nil
+}
+
+func (p *fakePage) Reload(ctx context.Context) error {
+	p.broken = false
+	p.reloads++
+	return nil
+}
+
+func TestRecoverPage(t *testing.T) {
+	for _, tc := range []struct {
+		docs    []string
+		failed  []string
+		reloads int
+	}{
+		{[]string{"a", "b"}, nil, 0},
+		{[]string{"a", "bad", "b"}, []string{"bad"}, 0},
+		// The document that breaks the page fails, even in a new
+		// tab, but the next one renders.
+		{[]string{"a", "poison", "b"}, []string{"poison"}, 1},
+		// The document after one that breaks the page without
+		// failing renders in a new tab, and so does the next on the
+		// reloaded page.
+		{[]string{"poison-quietly", "a", "b"}, nil, 1},
+	} {
+		page := new(fakePage)
+		var failed []string
+		for _, src := range tc.docs {
+			result, err := page.RenderDiagram(runCtx, src)
+			if err != nil {
+				result, err = recoverPage(page, src, err, func() (renderer.RenderResult, error) {
+					return new(fakePage).RenderDiagram(runCtx, src)
+				})
+			}
+			if err != nil {
+				failed = append(failed, src)
+			} else if want := "<svg>" + src + "</svg>"; result.SVG != want {
+				t.Errorf("%q: %s rendered %q, want %q", tc.docs, src, result.SVG, want)
+			}
+		}
+		if !slices.Equal(failed, tc.failed) {
+			t.Errorf("%q: %q failed, want %q", tc.docs, failed, tc.failed)
+		}
+		if page.reloads != tc.reloads {
+			t.Errorf("%q: the page was reloaded %d times, want %d", tc.docs, page.reloads, tc.reloads)
+		}
+	}
+}
+
+// TestRestartBrowserPool kills the browser under renderAll's pool
+// of tabs partway through, and checks it's restarted, once, and
+// every document still renders.
+func TestRestartBrowserPool(t *testing.T) {
+	startTestRenderer(t, renderer.WithConcurrency(2))
+	t.Cleanup(func() { browser.restarts = nil })
+	files := make(map[string]string)
+	var pairs []renderPair
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		files[name+".mmd"] = "flowchart LR\n    A --> " + name + "\n"
+		pairs = append(pairs, renderPair{mmdName: name + ".mmd", svgName: name + ".svg"})
+	}
+	chdirTemp(t, files)
+
+	first := mainRenderer
+	var crash sync.Once
+	work := func(d *renderDoc, r *renderer.Renderer) {
+		if d.pair.mmdName == "c.mmd" {
+			crash.Do(func() { first.Close() })
+		}
+		d.render(r)
+	}
+	finish := func(d *renderDoc) error {
+		if d.err != nil {
+			t.Errorf("%s: %v", d.pair.mmdName, d.err)
+		}
+		return d.err
+	}
+	if failed := renderAllWith(pairs, work, finish); failed != 0 {
+		t.Errorf("%d documents failed", failed)
+	}
+	if mainRenderer == first {
+		t.Error("the browser wasn't restarted")
+	}
+	if n := len(browser.restarts); n != 1 {
+		t.Errorf("the browser was restarted %d times, want 1", n)
+	}
+}
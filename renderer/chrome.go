@@ -0,0 +1,51 @@
+package renderer
+
+import (
+	"context"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+// newAllocator returns a chromedp allocator context under parent
+// for the browser o asks for: a connection to a remote Chrome, or
+// a local Chrome launched with o's executable and flags.  With
+// none of those it returns parent, which launches chromedp's
+// default browser.
+func newAllocator(parent context.Context, o options) (context.Context, context.CancelFunc) {
+	if o.remoteChrome != "" {
+		return chromedp.NewRemoteAllocator(parent, o.remoteChrome)
+	}
+	if o.chromePath == "" && len(o.chromeFlags) == 0 {
+		return parent, func() {}
+	}
+	opts := append([]chromedp.ExecAllocatorOption(nil), chromedp.DefaultExecAllocatorOptions[:]...)
+	if o.chromePath != "" {
+		opts = append(opts, chromedp.ExecPath(o.chromePath))
+	}
+	for _, f := range o.chromeFlags {
+		name, value, ok := strings.Cut(strings.TrimLeft(f, "-"), "=")
+		switch {
+		case !ok:
+			opts = append(opts, chromedp.Flag(name, true))
+		case value == "true" || value == "false":
+			opts = append(opts, chromedp.Flag(name, value == "true"))
+		default:
+			opts = append(opts, chromedp.Flag(name, value))
+		}
+	}
+	return chromedp.NewExecAllocator(parent, opts...)
+}
+
+// browserSource says where o's browser comes from, for errors
+// starting it: the remote Chrome's URL, or the local Chrome
+// launched.
+func browserSource(o options) string {
+	switch {
+	case o.remoteChrome != "":
+		return "connect to remote Chrome at " + o.remoteChrome
+	case o.chromePath != "":
+		return "launch local Chrome " + o.chromePath
+	}
+	return "launch local Chrome"
+}
@@ -0,0 +1,65 @@
+package renderer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// TestCJKLabels renders testdata/cjk/sequence.mmd, whose
+// participants and messages are Chinese, Japanese, and Korean, and
+// checks each of its text nodes has a width.  With a font file at
+// MERMAID_CJK_FONT, it's loaded with WithCJKFont, and the browser
+// has to be able to draw them.
+func TestCJKLabels(t *testing.T) {
+	var opts []renderer.Option
+	font := os.Getenv("MERMAID_CJK_FONT")
+	if font != "" {
+		b, err := os.ReadFile(font)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, renderer.WithCJKFont(b))
+	}
+	r := newTestRenderer(t, opts...)
+	if font != "" && !r.HasCJKGlyphs() {
+		t.Errorf("with WithCJKFont(%s), HasCJKGlyphs() = false", font)
+	}
+	src, err := os.ReadFile(filepath.Join("..", "testdata", "cjk", "sequence.mmd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg, err := r.Render(context.Background(), string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var texts []struct {
+		Text  string
+		Width float64
+	}
+	evalStandalone(t, svg, `Array.from(document.querySelectorAll('text'), (text) => ({
+		text: text.textContent,
+		width: text.getBBox().width,
+	}))`, &texts)
+	cjk := 0
+	for _, text := range texts {
+		if !strings.ContainsFunc(text.Text, func(c rune) bool {
+			return unicode.In(c, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+		}) {
+			continue
+		}
+		cjk++
+		if text.Width <= 0 {
+			t.Errorf("text %q has width %v", text.Text, text.Width)
+		}
+	}
+	if cjk == 0 {
+		t.Errorf("the SVG has no CJK text nodes in %+v", texts)
+	}
+}
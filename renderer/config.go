@@ -0,0 +1,21 @@
+package renderer
+
+// MergeConfig merges the MermaidJS config src into dst: a key in
+// both whose values are both objects is merged in turn, so, e.g.,
+// flowchart.curve from one doesn't drop flowchart.htmlLabels from
+// the other.  Otherwise src's value wins.
+func MergeConfig(dst, src map[string]any) {
+	for k, v := range src {
+		sub, ok := v.(map[string]any)
+		if dstSub, dstOK := dst[k].(map[string]any); ok && dstOK {
+			merged := make(map[string]any, len(dstSub))
+			for dk, dv := range dstSub {
+				merged[dk] = dv
+			}
+			MergeConfig(merged, sub)
+			dst[k] = merged
+			continue
+		}
+		dst[k] = v
+	}
+}
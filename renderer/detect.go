@@ -0,0 +1,40 @@
+package renderer
+
+import "context"
+
+// DetectType calls the extras detectType func to get the type of
+// diagram in mmdSource, e.g., "flowchart-v2", without rendering
+// it.
+//
+// It returns an *UnknownDiagramError if no diagram type, built-in
+// or externally registered, recognizes mmdSource.
+func (r *Renderer) DetectType(ctx context.Context, mmdSource string) (diagramType string, err error) {
+	var result struct {
+		Type    string `json:"type"`
+		Unknown string `json:"unknown"`
+	}
+	if err = r.eval(ctx, jsonEncodeJS("detectType(", mmdSource, ")"), &result); err != nil {
+		return "", err
+	}
+	if result.Type == "" {
+		return "", &UnknownDiagramError{Message: result.Unknown}
+	}
+	return result.Type, nil
+}
+
+// ParseCheck calls the extras parseCheck func to check the syntax
+// of mmdSource, without rendering it.  It restores r's config first,
+// as RenderDiagram does, so it can be called between renders
+// without changing them.
+//
+// It returns a *ParseError if the document doesn't parse.
+func (r *Renderer) ParseCheck(ctx context.Context, mmdSource string) error {
+	var parseErr *ParseError
+	if err := r.eval(ctx, jsonEncodeJS("parseCheck(", mmdSource, ")"), &parseErr); err != nil {
+		return err
+	}
+	if parseErr != nil {
+		return parseErr
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package renderer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+func TestDetectType(t *testing.T) {
+	r := newTestRenderer(t)
+
+	for _, tc := range []struct {
+		src, want string
+	}{
+		{"graph TD; A-->B", "flowchart-v2"},
+		{"flowchart LR\n    A --> B", "flowchart-v2"},
+		{"sequenceDiagram\n    Alice->>Bob: Hello", "sequence"},
+		{"pie\n    \"a\": 1", "pie"},
+		{"gantt\n    title Plan", "gantt"},
+		{"---\ntitle: Login\n---\nflowchart TD\n    A --> B", "flowchart-v2"},
+	} {
+		got, err := r.DetectType(context.Background(), tc.src)
+		if err != nil {
+			t.Errorf("DetectType(%q): %v", tc.src, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("DetectType(%q) = %q, want %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestDetectTypeUnknown(t *testing.T) {
+	r := newTestRenderer(t)
+
+	_, err := r.DetectType(context.Background(), "not a diagram")
+	var unknownErr *renderer.UnknownDiagramError
+	if !errors.As(err, &unknownErr) {
+		t.Fatalf("DetectType = %v, want an *UnknownDiagramError", err)
+	}
+	if unknownErr.Message == "" {
+		t.Error("UnknownDiagramError has no Message")
+	}
+}
@@ -0,0 +1,54 @@
+package renderer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// deterministicJSSource makes the page deterministic, for
+// WithDeterministic.  It's evaluated before MermaidJS, with the
+// clock time in milliseconds and a seed:
+//
+//   - new Date() and Date.now() return the fixed time, so, e.g.,
+//     a gantt chart's today marker doesn't move
+//   - Math.random is a seeded PRNG (mulberry32), for anything in
+//     MermaidJS or its dependencies that's random beyond the ids
+//     that its deterministicIds setting covers
+const deterministicJSSource = `
+(function (epochMillis, seed) {
+		const RealDate = Date;
+		function FixedDate(...args) {
+				if (!new.target) {
+						return new RealDate(epochMillis).toString();
+				}
+				return args.length ? new RealDate(...args) : new RealDate(epochMillis);
+		}
+		FixedDate.prototype = RealDate.prototype;
+		FixedDate.now = () => epochMillis;
+		FixedDate.parse = RealDate.parse;
+		FixedDate.UTC = RealDate.UTC;
+		window.Date = FixedDate;
+
+		let s = seed >>> 0;
+		Math.random = function () {
+				s = (s + 0x6D2B79F5) >>> 0;
+				let t = s;
+				t = Math.imul(t ^ (t >>> 15), t | 1);
+				t ^= t + Math.imul(t ^ (t >>> 7), t | 61);
+				return ((t ^ (t >>> 14)) >>> 0) / 4294967296;
+		};
+})`
+
+// svgID returns the id RenderDiagram renders mmdSource with, which
+// is the SVG's id, and the prefix of the ids in it: "mermaid", or
+// with WithDeterministic, "mermaid-" and a hash of mmdSource.  The
+// hash also seeds MermaidJS's deterministic ids, so they're the
+// same every time a document renders, but differ between
+// documents, and SVGs inlined on one page don't clash.
+func (r *Renderer) svgID(mmdSource string) string {
+	if !r.opts.deterministic {
+		return "mermaid"
+	}
+	sum := sha256.Sum256([]byte(mmdSource))
+	return "mermaid-" + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,49 @@
+package renderer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// TestDeterministic renders a flowchart, a sequence diagram, and a
+// gantt chart (whose today marker moves with the clock) in two
+// renderers, one after the other, and checks they come out byte for
+// byte the same, with ids that differ between the documents.
+func TestDeterministic(t *testing.T) {
+	epoch := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	var runs [2][]string
+	for i := range runs {
+		r := newTestRenderer(t, renderer.WithDeterministic(epoch))
+		for _, name := range []string{"flow.mmd", "sequence.mmd", "gantt.mmd"} {
+			src, err := os.ReadFile(filepath.Join("..", "testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			svg, err := r.Render(context.Background(), string(src))
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			runs[i] = append(runs[i], svg)
+		}
+		r.Close()
+	}
+
+	ids := make(map[string]bool)
+	for i, svg := range runs[0] {
+		if svg != runs[1][i] {
+			t.Errorf("document %d renders differently the second time", i)
+		}
+		_, rest, _ := strings.Cut(svg, ` id="`)
+		id, _, _ := strings.Cut(rest, `"`)
+		if !strings.HasPrefix(id, "mermaid-") || ids[id] {
+			t.Errorf("document %d has id %q, want mermaid- and a hash of its own", i, id)
+		}
+		ids[id] = true
+	}
+}
@@ -0,0 +1,47 @@
+package renderer
+
+import (
+	"context"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/chromedp"
+)
+
+// RenderErrorDetails are the details of a failed render, from the
+// page: what the JavaScript exception said, and the config
+// MermaidJS had at the time.
+type RenderErrorDetails struct {
+	Message string `json:"message"`
+	Stack   string `json:"stack"`
+
+	// Hash is the parser's description of a syntax error (its
+	// text, token, line, loc, and expected tokens), or nil.
+	Hash map[string]any `json:"hash"`
+
+	Config map[string]any `json:"config"`
+}
+
+// RenderError calls the extras renderError func to get the details
+// of the last render, if it failed, or nil.  Call it right after
+// the failed RenderDiagram: another render replaces them.
+func (r *Renderer) RenderError(ctx context.Context) (details *RenderErrorDetails, err error) {
+	err = r.eval(ctx, "renderError()", &details)
+	return details, err
+}
+
+// BrowserVersion returns the browser's product and version, e.g.,
+// HeadlessChrome/126.0.6478.126.
+func (r *Renderer) BrowserVersion(ctx context.Context) (product string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runCtx, cancel := r.runCtx(ctx)
+	defer cancel()
+	err = chromedp.Run(runCtx, chromedp.ActionFunc(func(ctx context.Context) error {
+		_, product, _, _, _, err = browser.GetVersion().Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return "", r.wrapErr(runCtx, err)
+	}
+	return product, nil
+}
@@ -0,0 +1,92 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// UnknownDiagramError is returned by DetectType for a document
+// that no registered diagram type recognizes.
+type UnknownDiagramError struct {
+	// Message is MermaidJS's explanation.
+	Message string
+}
+
+func (e *UnknownDiagramError) Error() string {
+	return "unknown diagram type: " + e.Message
+}
+
+// ParseError is a syntax error in a document, as reported by
+// MermaidJS's parser, from RenderDiagram or ParseCheck.
+type ParseError struct {
+	// File is the document's file, if the caller knows it.
+	File string
+
+	// Line and Column are where the error is, counting from 1, or
+	// 0 if the parser didn't say.
+	Line, Column int
+
+	// Message is the parser's message, which usually quotes the
+	// offending line.
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return e.Message
+}
+
+// Position returns where the error is as File:Line:Column, leaving
+// off what isn't known.
+func (e *ParseError) Position() string {
+	pos := e.File
+	if pos == "" {
+		pos = "<input>"
+	}
+	if e.Line > 0 {
+		pos += fmt.Sprintf(":%d", e.Line)
+		if e.Column > 0 {
+			pos += fmt.Sprintf(":%d", e.Column)
+		}
+	}
+	return pos
+}
+
+// RenderTimeoutError is returned for a render that took longer
+// than WithRenderTimeout allows.
+type RenderTimeoutError struct {
+	Elapsed time.Duration
+}
+
+func (e *RenderTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v", e.Elapsed.Round(time.Millisecond))
+}
+
+// BrowserError is returned for a render that failed because the
+// browser (or the renderer's tab in it) is gone, rather than
+// because of anything about the document.
+type BrowserError struct {
+	Err error
+}
+
+func (e *BrowserError) Error() string {
+	return "browser unavailable: " + e.Err.Error()
+}
+
+func (e *BrowserError) Unwrap() error {
+	return e.Err
+}
+
+// lostBrowser reports whether err, from running something in the
+// browser, says the browser, or its connection, is gone, e.g.,
+// because Chrome crashed or was killed for using too much memory.
+func lostBrowser(err error) bool {
+	if errors.Is(err, chromedp.ErrChannelClosed) || errors.Is(err, chromedp.ErrInvalidTarget) || errors.Is(err, chromedp.ErrInvalidContext) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "websocket") || strings.Contains(msg, "target closed")
+}
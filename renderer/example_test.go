@@ -0,0 +1,57 @@
+package renderer_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// RenderStream has backpressure: with two tabs, the goroutine
+// sending documents gets at most two ahead of the loop receiving
+// their results, however many documents there are to send, so
+// nothing piles up in memory while, say, a slow writer catches up.
+func ExampleRenderer_RenderStream() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bundle, err := os.ReadFile("mermaid.min.js")
+	if err != nil {
+		log.Fatal(err)
+	}
+	r, err := renderer.NewRenderer(ctx, renderer.WithMermaidJS(bundle), renderer.WithConcurrency(2))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer r.Close()
+
+	items, results, err := r.RenderStream(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		defer close(items)
+		for i := range 100 {
+			item := renderer.RenderItem{
+				ID:     fmt.Sprintf("doc-%d", i),
+				Source: fmt.Sprintf("graph TD; A%d-->B%d", i, i),
+			}
+			// This blocks while both tabs are busy, or are waiting
+			// for their last results to be received below.
+			select {
+			case items <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for result := range results {
+		if result.Err != nil {
+			log.Printf("%s: %v", result.ID, result.Err)
+			continue
+		}
+		fmt.Println(result.ID, len(result.SVG))
+	}
+}
@@ -0,0 +1,63 @@
+package renderer
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	cdruntime "github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// The family names the WithEmojiFont and WithCJKFont fonts are
+// loaded under.
+const (
+	emojiFontFamily = "mermaid-cli emoji"
+	cjkFontFamily   = "mermaid-cli cjk"
+)
+
+// mermaidFontFamily is MermaidJS's own default fontFamily.
+const mermaidFontFamily = `"trebuchet ms", verdana, arial, sans-serif`
+
+// fontFamily is the fontFamily MermaidJS is initialized with:
+// WithFontFamily's, or its default, followed by any fonts loaded
+// for glyphs the default fonts are likely to be missing.  The
+// browser falls back through the list one glyph at a time.
+//
+// It returns "" (leave MermaidJS's default alone) if there's
+// neither WithFontFamily's nor any fonts loaded.
+func (r *Renderer) fontFamily() string {
+	family := mermaidFontFamily
+	if r.opts.fontFamily != "" {
+		family = r.opts.fontFamily
+	}
+	if len(r.opts.cjkFont) > 0 {
+		family += fmt.Sprintf(", %q", cjkFontFamily)
+	}
+	if len(r.opts.emojiFont) > 0 {
+		family += fmt.Sprintf(", %q", emojiFontFamily)
+	}
+	if family == mermaidFontFamily {
+		return ""
+	}
+	return family
+}
+
+// loadFont loads the font file in b into the browser as family,
+// running under ctx, and waits for it to be ready to use.
+func (r *Renderer) loadFont(ctx context.Context, family string, b []byte) error {
+	url := "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(b)
+
+	var ok bool
+	load := chromedp.Evaluate(
+		jsonEncodeJS("loadFont(...", []string{family, url}, ")"),
+		&ok,
+		func(p *cdruntime.EvaluateParams) *cdruntime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		},
+	)
+	if err := chromedp.Run(ctx, load); err != nil {
+		return r.wrapErr(ctx, err)
+	}
+	return nil
+}
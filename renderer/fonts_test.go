@@ -0,0 +1,38 @@
+package renderer_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// fontFaceCSS declares a family, from whichever common font the
+// system has, that nothing on the page uses until a label does.
+const fontFaceCSS = `@font-face {
+  font-family: "mermaid-cli test";
+  src: local("DejaVu Sans"), local("Liberation Sans"), local("Arial"), local("Helvetica");
+}`
+
+// TestRenderFontsFirstRender renders a document twice with a family
+// -css declares and -font uses: the first render mustn't measure
+// its labels with a fallback font the second doesn't.
+func TestRenderFontsFirstRender(t *testing.T) {
+	r := newTestRenderer(t,
+		renderer.WithCSS(fontFaceCSS),
+		renderer.WithFontFamily(`"mermaid-cli test", monospace`),
+	)
+	ctx := context.Background()
+	const doc = "flowchart LR\n    A[A wide label, measured in the loaded font] --> B[Another]\n"
+
+	first, err := r.Render(ctx, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := r.Render(ctx, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mermaidtest.EqualSVG(t, first, second)
+}
@@ -0,0 +1,93 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/plan"
+)
+
+// RenderFS renders each diagram in fsys whose name matches pattern
+// (see Glob), in lexical order, and hands its SVG to sink, under
+// its name with its extension changed to .svg, e.g., flows/a.svg
+// for flows/a.mmd.  fsys can be any fs.FS: an embed.FS, an
+// fstest.MapFS, or os.DirFS, so a test harness can render without
+// touching the disk.
+//
+// A diagram that fails to read or render doesn't stop the others;
+// RenderFS returns their errors together, each naming its diagram.
+// An error from sink, or ctx being canceled, stops it right away.
+func (r *Renderer) RenderFS(ctx context.Context, fsys fs.FS, pattern string, sink func(name string, svg []byte) error) error {
+	names, err := Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		svg, err := r.Render(ctx, string(src))
+		if err != nil {
+			if ctx.Err() != nil {
+				return errors.Join(append(errs, err)...)
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		out := strings.TrimSuffix(name, path.Ext(name)) + ".svg"
+		if err := sink(out, []byte(svg)); err != nil {
+			return errors.Join(append(errs, fmt.Errorf("%s: %w", out, err))...)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Glob returns the names of the files in fsys that match pattern,
+// in lexical order.  It's fs.Glob, except that an element of the
+// pattern that's only ** matches any number of directories, none
+// included, as in docs/**/*.mmd; a pattern with ** skips hidden
+// directories, like .git, and node_modules.
+func Glob(fsys fs.FS, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("bad pattern %s: %w", pattern, err)
+	}
+	if !strings.Contains(pattern, "**") {
+		return fs.Glob(fsys, pattern)
+	}
+	// Only the directories under the part of the pattern before
+	// any wildcards can match.
+	root := "."
+	if i := strings.IndexAny(pattern, "*?["); strings.Contains(pattern[:i], "/") {
+		root = pattern[:strings.LastIndex(pattern[:i], "/")]
+	}
+	var names []string
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if name == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll // matches nothing
+			}
+			return err
+		}
+		if d.IsDir() {
+			if name != root && plan.SkipDir(d.Name()) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if plan.Match(pattern, name) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
@@ -0,0 +1,54 @@
+package renderer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// TestRestoreConfig renders testdata/isolation's document with an
+// init directive, then its plain one, and checks the plain one
+// comes out as it does in a renderer of its own, and its effective
+// config has none of the directive's settings.
+func TestRestoreConfig(t *testing.T) {
+	ctx := context.Background()
+	epoch := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join("..", "testdata", "isolation", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	directive, plain := read("1-directive.mmd"), read("2-plain.mmd")
+
+	r := newTestRenderer(t, renderer.WithDeterministic(epoch))
+	if _, err := r.Render(ctx, directive); err != nil {
+		t.Fatal(err)
+	}
+	after, err := r.Render(ctx, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := r.EffectiveConfig(ctx, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if theme := config["theme"]; theme != "default" {
+		t.Errorf("after the directive, theme = %v, want default", theme)
+	}
+
+	alone, err := newTestRenderer(t, renderer.WithDeterministic(epoch)).Render(ctx, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != alone {
+		t.Errorf("2-plain.mmd renders differently after 1-directive.mmd:\n%s",
+			mermaidtest.DiffSVG("alone", alone, "after", after))
+	}
+}
@@ -0,0 +1,339 @@
+package renderer
+
+// extrasJSSource has helper code that will be registered with
+// the browser, in addition to mermaidJSSource.
+//
+//   - restoreConfig re-initializes MermaidJS from the snapshot of
+//     its config that initializeConfig took, undoing anything the
+//     last document's directives left behind, with seed, if it's
+//     given, as its deterministicIDSeed.
+//   - renderSVG calls MermaidJS's render func, with id as the
+//     SVG's id, and will be called by the RenderDiagram method.
+//     It restores the config first, seeding ids with id, and
+//     loads the config's fonts (see loadFonts), otherwise
+//     MermaidJS measures labels with the fallback font and the
+//     first render comes out different (often truncated) from the
+//     ones after it.  It leaves the SVG in window.mermaidCLIResult,
+//     and returns its length along with the diagram's type, its
+//     size from the viewBox, and its title (from front matter or a
+//     title statement) as drawn.  If the render throws, it leaves the
+//     exception's details, and the config MermaidJS had, in
+//     window.mermaidCLIError for renderError; a parse error (see
+//     parseErrorOf) is returned, as {parseError}, rather than
+//     thrown.  An SVG with HTML labels goes through
+//     inlineLabelStyles first, and then through postProcess, if
+//     a WithExtraJS script defined window.postProcessSVG.
+//   - loadFonts loads the families the config's fontFamily names,
+//     and the ones its themeCSS declares with @font-face, and
+//     waits for every font to finish loading.  The browser only
+//     loads a family once something on the page uses it, and
+//     MermaidJS measures labels before its SVG's styles apply, so
+//     document.fonts.ready alone doesn't cover them.  The
+//     themeCSS's @font-face rules are copied into the page's own
+//     style sheet, so document.fonts knows of their families.
+//   - parseErrorOf returns an exception from a parser as
+//     {message, line, column}, or null if it isn't one that says
+//     where: jison's parsers put the position in e.hash, and
+//     Langium's (for pie, gitGraph, and the newer diagrams) in
+//     their lexer and parser errors in e.result.
+//   - inlineLabelStyles puts an SVG in the page, and copies the
+//     styles the browser computed for the HTML in each
+//     foreignObject onto the elements as style attributes.  HTML
+//     labels are styled in part by the page's CSS, not the SVG's,
+//     so without them an SVG viewed on its own shows the labels
+//     unstyled, and wrapped differently than they were measured.
+//   - noteExtraJS records the name of the WithExtraJS script that
+//     just ran if it defined (or redefined) postProcessSVG, for
+//     postProcess's errors.
+//   - postProcess passes an SVG through postProcessSVG, and
+//     checks it got a string back, naming the script in any error.
+//   - resultChunk returns a slice of window.mermaidCLIResult, and
+//     where the slice ended, never splitting a surrogate pair.  It
+//     deletes the SVG once the last slice is taken.  A big SVG can
+//     be tens of MB, more than fits in one CDP message, so
+//     RenderDiagram fetches it in chunks.
+//   - loadFont adds a font to the page, under family, from a data
+//     URL.
+//   - hasColorEmoji draws an emoji to a canvas and reports whether
+//     any of its pixels came out in color, i.e., whether the
+//     browser has a color emoji font.
+//   - mermaidVersion returns MermaidJS's version, which depending
+//     on the release is a string or a func on the mermaid object.
+//   - detectType returns the type of diagram (e.g., flowchart-v2)
+//     in a document, without rendering it.  MermaidJS throws for
+//     a document no registered diagram type recognizes, and
+//     detectType returns that as {unknown: message}.
+//   - parseCheck runs MermaidJS's parser over a document, after
+//     restoring the config, without rendering it, and returns
+//     null, or the parser's error as {message, line, column}, with
+//     a line of 0 if it doesn't say.
+//   - hasGlyph draws a character and a private-use character (which
+//     no font has) to canvases and reports whether they differ,
+//     i.e., whether the character drew as something other than the
+//     missing-glyph box.
+//   - effectiveConfig restores the config, renders a document, and
+//     returns the config MermaidJS rendered it with: the initialize
+//     config, overridden by the document's front matter config,
+//     overridden by its init directives.
+//   - renderError returns the details renderSVG left of its last
+//     failure, as {message, stack, hash, config}, or null.
+//   - defaultConfig returns MermaidJS's default config, which has
+//     every setting it knows, or, if it doesn't say, the config
+//     it has now.
+const extrasJSSource = `
+function restoreConfig(seed) {
+		if (window.mermaidCLIConfig) {
+				const config = JSON.parse(window.mermaidCLIConfig);
+				if (seed) {
+						config.deterministicIDSeed = seed;
+				}
+				mermaid.initialize(config);
+		}
+}
+
+async function renderSVG(src, id) {
+		restoreConfig(id);
+		await loadFonts();
+		window.mermaidCLIError = null;
+		let svg, diagramType;
+		try {
+				({ svg, diagramType } = await mermaid.render(id, src));
+		} catch (e) {
+				window.mermaidCLIError = {
+						message: (e && e.message) || String(e),
+						stack: (e && e.stack) || '',
+						hash: (e && e.hash) || null,
+						config: mermaid.mermaidAPI.getConfig(),
+				};
+				const parseError = parseErrorOf(e);
+				if (parseError) {
+						return { parseError: parseError };
+				}
+				throw e;
+		}
+
+		if (svg.includes('<foreignObject')) {
+				svg = inlineLabelStyles(svg);
+		}
+		if (window.postProcessSVG) {
+				svg = await postProcess(svg);
+		}
+
+		const root = new DOMParser().parseFromString(svg, 'image/svg+xml').documentElement;
+		const viewBox = root.viewBox && root.viewBox.baseVal;
+		const title = root.querySelector('[class$="TitleText"], .titleText');
+		window.mermaidCLIResult = svg;
+		return {
+				length: svg.length,
+				width: viewBox ? viewBox.width : 0,
+				height: viewBox ? viewBox.height : 0,
+				diagramType: diagramType || '',
+				title: title ? title.textContent.trim() : '',
+		};
+}
+
+async function loadFonts() {
+		const config = mermaid.getConfig();
+		const faces = (config.themeCSS || '').match(/@font-face\s*{[^}]*}/gi) || [];
+		let style = document.getElementById('mermaid-cli-font-faces');
+		if (!style) {
+				style = document.createElement('style');
+				style.id = 'mermaid-cli-font-faces';
+				document.head.appendChild(style);
+		}
+		const css = faces.join('\n');
+		if (style.textContent !== css) {
+				style.textContent = css;
+		}
+
+		const families = new Set();
+		for (const face of faces) {
+				const m = face.match(/font-family\s*:\s*([^;}]+)/i);
+				if (m) {
+						families.add(m[1]);
+				}
+		}
+		for (const family of (config.fontFamily || '').split(',')) {
+				families.add(family);
+		}
+		await Promise.all([...families].map((family) => {
+				family = family.trim().replace(/^(['"])(.*)\1$/, '$2');
+				if (!family) {
+						return null;
+				}
+				// A family that fails to load falls back, as it would
+				// have anyway.
+				return document.fonts.load('16px ' + JSON.stringify(family)).catch(() => null);
+		}));
+		await document.fonts.ready;
+}
+
+const labelStyleProperties = [
+		'display', 'box-sizing', 'width', 'max-width', 'height',
+		'padding', 'margin', 'border', 'background-color',
+		'color', 'fill', 'font-family', 'font-size', 'font-style', 'font-weight',
+		'line-height', 'letter-spacing', 'text-align', 'text-decoration',
+		'white-space', 'word-break', 'overflow-wrap', 'vertical-align',
+];
+
+function inlineLabelStyles(svg) {
+		const box = document.createElement('div');
+		box.style.cssText = 'position: absolute; left: -100000px; top: 0;';
+		box.innerHTML = svg;
+		document.body.appendChild(box);
+		try {
+				const el = box.querySelector('svg');
+				for (const fo of el.querySelectorAll('foreignObject')) {
+						for (const node of fo.querySelectorAll('*')) {
+								const computed = getComputedStyle(node);
+								const decls = labelStyleProperties.map((prop) =>
+										prop + ': ' + computed.getPropertyValue(prop));
+								const own = node.getAttribute('style');
+								node.setAttribute('style', decls.join('; ') + (own ? '; ' + own : ''));
+						}
+				}
+				return new XMLSerializer().serializeToString(el);
+		} finally {
+				box.remove();
+		}
+}
+
+function noteExtraJS(name) {
+		if (window.postProcessSVG && window.postProcessSVG !== window.mermaidCLIPostProcess) {
+				window.mermaidCLIPostProcess = window.postProcessSVG;
+				window.mermaidCLIPostProcessOrigin = name;
+		}
+		return true;
+}
+
+async function postProcess(svg) {
+		const where = (window.mermaidCLIPostProcessOrigin || 'extra JavaScript') + ': postProcessSVG';
+		let out;
+		try {
+				out = await window.postProcessSVG(svg);
+		} catch (e) {
+				throw new Error(where + ': ' + ((e && e.message) || String(e)));
+		}
+		if (typeof out !== 'string') {
+				throw new Error(where + ': returned ' + typeof out + ', not a string');
+		}
+		return out;
+}
+
+function resultChunk(start, size) {
+		const svg = window.mermaidCLIResult;
+		let end = Math.min(start + size, svg.length);
+		const code = svg.charCodeAt(end - 1);
+		if (end < svg.length && code >= 0xD800 && code <= 0xDBFF) {
+				end--; // don't split a surrogate pair
+		}
+		if (end >= svg.length) {
+				delete window.mermaidCLIResult;
+		}
+		return { text: svg.slice(start, end), end: end };
+}
+
+async function loadFont(family, url) {
+		const font = new FontFace(family, 'url(' + url + ')');
+		document.fonts.add(await font.load());
+		return true;
+}
+
+function hasColorEmoji() {
+		const canvas = document.createElement('canvas');
+		canvas.width = canvas.height = 32;
+		const ctx = canvas.getContext('2d');
+		ctx.font = '24px sans-serif';
+		ctx.textBaseline = 'top';
+		ctx.fillText('\u{1F600}', 0, 0);
+		const data = ctx.getImageData(0, 0, 32, 32).data;
+		for (let i = 0; i < data.length; i += 4) {
+				if (data[i] !== data[i+1] || data[i+1] !== data[i+2]) {
+						return true;
+				}
+		}
+		return false;
+}
+
+function mermaidVersion() {
+		const v = mermaid.version;
+		return (typeof v === 'function' ? v() : v) || 'unknown';
+}
+
+function detectType(src) {
+		try {
+				return { type: mermaid.detectType(src) };
+		} catch (e) {
+				if (e.name === 'UnknownDiagramError') {
+						return { unknown: e.message };
+				}
+				throw e;
+		}
+}
+
+function parseErrorOf(e) {
+		if (!e) {
+				return null;
+		}
+		const message = e.message || String(e);
+		if (e.hash) {
+				const loc = e.hash.loc;
+				if (loc) {
+						return { message: message, line: loc.first_line, column: loc.first_column + 1 };
+				}
+				// A lexical error has only the 0-based line.
+				const line = typeof e.hash.line === 'number' ? e.hash.line + 1 : 0;
+				return { message: message, line: line, column: 0 };
+		}
+		const result = e.result;
+		if (result && (result.lexerErrors || result.parserErrors)) {
+				const lexed = (result.lexerErrors || [])[0];
+				const parsed = (result.parserErrors || [])[0];
+				if (lexed) {
+						return { message: message, line: lexed.line || 0, column: lexed.column || 0 };
+				}
+				const token = parsed && parsed.token;
+				if (token && token.startLine) {
+						return { message: message, line: token.startLine, column: token.startColumn || 0 };
+				}
+				return { message: message, line: 0, column: 0 };
+		}
+		return null;
+}
+
+async function parseCheck(src) {
+		restoreConfig();
+		try {
+				await mermaid.parse(src);
+				return null;
+		} catch (e) {
+				return parseErrorOf(e) || { message: e.message || String(e), line: 0, column: 0 };
+		}
+}
+
+function hasGlyph(ch) {
+		const pixels = (s) => {
+				const canvas = document.createElement('canvas');
+				canvas.width = canvas.height = 32;
+				const ctx = canvas.getContext('2d');
+				ctx.font = '24px ' + (mermaid.getConfig().fontFamily || 'sans-serif');
+				ctx.textBaseline = 'top';
+				ctx.fillText(s, 0, 0);
+				return ctx.getImageData(0, 0, 32, 32).data.join();
+		};
+		return pixels(ch) !== pixels('\u{E000}');
+}
+
+async function effectiveConfig(src) {
+		restoreConfig();
+		await mermaid.render('mermaid-effective-config', src);
+		return mermaid.mermaidAPI.getConfig();
+}
+function renderError() {
+		return window.mermaidCLIError || null;
+}
+
+function defaultConfig() {
+		return mermaid.mermaidAPI.defaultConfig || mermaid.mermaidAPI.getConfig();
+}
+`
@@ -0,0 +1,104 @@
+package renderer_test
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// renderWrapped renders testdata/labels/wrapped.mmd, whose HTML
+// labels wrap, are formatted with Markdown, and break lines.
+func renderWrapped(t *testing.T) string {
+	t.Helper()
+	r := newTestRenderer(t)
+	src, err := os.ReadFile(filepath.Join("..", "testdata", "labels", "wrapped.mmd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg, err := r.Render(context.Background(), string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svg
+}
+
+// TestInlineLabelStyles checks every element in the labels'
+// foreignObjects has the computed styles it was measured with.
+func TestInlineLabelStyles(t *testing.T) {
+	svg := renderWrapped(t)
+	d := xml.NewDecoder(strings.NewReader(svg))
+	depth, styled := 0, 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("SVG doesn't parse: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if depth > 0 {
+				depth++
+				var style string
+				for _, attr := range tok.Attr {
+					if attr.Name.Local == "style" {
+						style = attr.Value
+					}
+				}
+				for _, want := range []string{"font-family: ", "font-size: ", "white-space: ", "line-height: "} {
+					if !strings.Contains(style, want) {
+						t.Errorf("%s in a foreignObject has style %q, without %q", tok.Name.Local, style, want)
+					}
+				}
+				styled++
+			} else if tok.Name.Local == "foreignObject" {
+				depth = 1
+			}
+		case xml.EndElement:
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+	if styled == 0 {
+		t.Error("the SVG has no HTML labels")
+	}
+}
+
+// TestInlineLabelStylesStandalone opens the SVG on its own, in a
+// page without MermaidJS's CSS, and checks each label still fits
+// the foreignObject it was measured for, rather than wrapping onto
+// more lines.
+func TestInlineLabelStylesStandalone(t *testing.T) {
+	svg := renderWrapped(t)
+	var labels []struct {
+		Text                      string
+		Width, Height, BoxW, BoxH float64
+	}
+	evalStandalone(t, svg, `Array.from(document.querySelectorAll('foreignObject'), (fo) => {
+		const el = fo.firstElementChild;
+		const rect = el ? el.getBoundingClientRect() : {width: 0, height: 0};
+		return {
+			text: fo.textContent,
+			width: rect.width, height: rect.height,
+			boxW: fo.width.baseVal.value, boxH: fo.height.baseVal.value,
+		};
+	})`, &labels)
+
+	if len(labels) == 0 {
+		t.Fatal("the SVG has no HTML labels")
+	}
+	for _, l := range labels {
+		if l.Text == "" {
+			continue // an edge without a label
+		}
+		if l.Width > l.BoxW+1 || l.Height > l.BoxH+1 {
+			t.Errorf("label %q is %.1fx%.1f on its own, but was measured at %.1fx%.1f", l.Text, l.Width, l.Height, l.BoxW, l.BoxH)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package renderer
+
+import (
+	"context"
+	"time"
+)
+
+// options are set by the Option funcs passed to NewRenderer.
+type options struct {
+	browserCtx         context.Context
+	mermaidJS          []byte
+	emojiFont, cjkFont []byte
+
+	// bundleName is the file or URL mermaidJS came from, for
+	// messages, or "" if it isn't known.
+	bundleName string
+
+	// extraJS are the scripts WithExtraJS adds, in order.
+	extraJS     []extraJS
+	concurrency int
+
+	// theme is the MermaidJS theme documents render with unless
+	// they say otherwise; "" means config's, or else DefaultTheme.
+	theme string
+
+	// config is more MermaidJS config for mermaid.initialize.
+	config map[string]any
+
+	// css is the CSS for MermaidJS's themeCSS, and fontFamily the
+	// font-family list for its fontFamily, over config's; "" for
+	// either means config's, or MermaidJS's own.
+	css, fontFamily string
+
+	// deterministic is whether to fix the page's clock at epoch
+	// and seed its randomness; see WithDeterministic.
+	deterministic bool
+	epoch         time.Time
+
+	// renderTimeout limits each RenderDiagram, and startupTimeout
+	// starting the browser and setting up its page; 0 is no limit.
+	renderTimeout, startupTimeout time.Duration
+
+	// remoteChrome is the DevTools websocket URL of a running
+	// Chrome to use instead of launching one, and chromePath and
+	// chromeFlags are for the one launched otherwise; see
+	// newAllocator.
+	remoteChrome string
+	chromePath   string
+	chromeFlags  []string
+}
+
+// An Option configures the Renderer made by NewRenderer.
+type Option func(*options)
+
+// WithBrowserContext has the renderer open its own tab in the
+// browser of ctx, a chromedp context whose browser is already
+// running, instead of starting a browser of its own.
+//
+// Close closes only the renderer's tab.  If ctx is canceled, the
+// renderer's methods return a *BrowserError.
+func WithBrowserContext(ctx context.Context) Option {
+	return func(o *options) { o.browserCtx = ctx }
+}
+
+// WithMermaidJS has the renderer load the MermaidJS bundle in src,
+// e.g., the contents of mermaid.min.js (see download.sh).  It's
+// required: the package doesn't embed a bundle of its own.
+func WithMermaidJS(src []byte) Option {
+	return func(o *options) { o.mermaidJS = src }
+}
+
+// WithBundleName names the file or URL that WithMermaidJS's bundle
+// came from, for errors loading it.
+func WithBundleName(name string) Option {
+	return func(o *options) { o.bundleName = name }
+}
+
+// extraJS is a script of the caller's to load into the page.
+type extraJS struct {
+	name string
+	src  []byte
+}
+
+// WithExtraJS has the renderer evaluate src, a script named name
+// (e.g., its file's name), in the page after its own helpers, and
+// again whenever the page is set up anew.  Use it more than once
+// for more scripts; they're evaluated in order.
+//
+// If a script defines window.postProcessSVG(svg), a func from a
+// string to a string (or a promise of one), every render's SVG
+// goes through it before it's returned.  Errors from a script, and
+// from its postProcessSVG, are reported under name.
+func WithExtraJS(name string, src []byte) Option {
+	return func(o *options) { o.extraJS = append(o.extraJS, extraJS{name: name, src: src}) }
+}
+
+// WithConcurrency sets how many tabs RenderStream renders in at
+// once, and Concurrency reports for sizing a Pool.  The default is
+// the number of CPUs, up to 4.
+func WithConcurrency(n int) Option {
+	return func(o *options) { o.concurrency = n }
+}
+
+// WithEmojiFont loads font (the bytes of a TTF, OTF, or WOFF
+// file) into the browser and has MermaidJS fall back to it for
+// emoji.
+func WithEmojiFont(font []byte) Option {
+	return func(o *options) { o.emojiFont = font }
+}
+
+// WithCJKFont loads font (the bytes of a TTF, OTF, or WOFF file)
+// into the browser and has MermaidJS fall back to it for Chinese,
+// Japanese, and Korean characters.
+func WithCJKFont(font []byte) Option {
+	return func(o *options) { o.cjkFont = font }
+}
+
+// WithTheme has MermaidJS render documents with theme, e.g., dark,
+// forest, or neutral, unless they set their own.  The theme isn't
+// checked, so a theme MermaidJS adds later works; MermaidJS says
+// if it doesn't know it.
+func WithTheme(theme string) Option {
+	return func(o *options) { o.theme = theme }
+}
+
+// WithConfig passes config, any MermaidJS config (e.g.,
+// themeVariables or flowchart.curve), to mermaid.initialize, on
+// top of the renderer's own.  Keys the renderer doesn't know are
+// passed through as they are.  WithTheme's theme, if set, wins
+// over config's.
+func WithConfig(config map[string]any) Option {
+	return func(o *options) { o.config = config }
+}
+
+// WithCSS has MermaidJS add css to every SVG's style sheet, as
+// its themeCSS setting, which it wins over in WithConfig's config.
+func WithCSS(css string) Option {
+	return func(o *options) { o.css = css }
+}
+
+// WithFontFamily has MermaidJS draw labels in family, a CSS
+// font-family list, e.g., "Inter, sans-serif", instead of its own
+// default.  WithEmojiFont's and WithCJKFont's fonts still come
+// after it.
+func WithFontFamily(family string) Option {
+	return func(o *options) { o.fontFamily = family }
+}
+
+// WithDeterministic makes rendering reproducible: the same
+// document renders to the same bytes, run after run.  MermaidJS
+// gets its deterministicIds setting, the page's clock is fixed at
+// epoch (e.g., from SOURCE_DATE_EPOCH), and Math.random is seeded.
+func WithDeterministic(epoch time.Time) Option {
+	return func(o *options) { o.deterministic, o.epoch = true, epoch }
+}
+
+// WithRenderTimeout has RenderDiagram give up on a document after
+// d, with a *RenderTimeoutError, stopping whatever MermaidJS was
+// doing, so the renderer can carry on with the next one.
+func WithRenderTimeout(d time.Duration) Option {
+	return func(o *options) { o.renderTimeout = d }
+}
+
+// WithStartupTimeout has NewRenderer give up after d if the
+// browser hasn't started and set up MermaidJS, e.g., because
+// Chrome is broken and hangs.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(o *options) { o.startupTimeout = d }
+}
+
+// WithRemoteChrome has the renderer open its tab in the running
+// Chrome at the DevTools websocket URL url, e.g.,
+// ws://localhost:9222, rather than launch a browser.  A URL
+// without a path is looked up at its /json/version.
+func WithRemoteChrome(url string) Option {
+	return func(o *options) { o.remoteChrome = url }
+}
+
+// WithChromePath has the renderer launch the Chrome executable at
+// path, rather than the one found on the PATH.
+func WithChromePath(path string) Option {
+	return func(o *options) { o.chromePath = path }
+}
+
+// WithChromeFlags has the renderer launch Chrome with flags, each
+// like --name or --name=value, on top of chromedp's defaults.
+// --name=false drops a default.
+func WithChromeFlags(flags ...string) Option {
+	return func(o *options) { o.chromeFlags = append(o.chromeFlags, flags...) }
+}
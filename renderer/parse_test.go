@@ -0,0 +1,81 @@
+package renderer_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+func TestParseCheck(t *testing.T) {
+	r := newTestRenderer(t)
+
+	if err := r.ParseCheck(context.Background(), "graph TD; A-->B"); err != nil {
+		t.Errorf("ParseCheck of a good diagram: %v", err)
+	}
+}
+
+// TestParseCheckLine checks where ParseCheck says the error in
+// testdata/bad-signal.mmd is: its third line has a signal with no
+// actor to send it to.
+func TestParseCheckLine(t *testing.T) {
+	r := newTestRenderer(t)
+	src, err := os.ReadFile("testdata/bad-signal.mmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.ParseCheck(context.Background(), string(src))
+	var parseErr *renderer.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("ParseCheck = %v, want a *ParseError", err)
+	}
+	if parseErr.Line != 3 {
+		t.Errorf("ParseError.Line = %d, want 3 (%v)", parseErr.Line, parseErr)
+	}
+}
+
+// TestParseCheckBetweenRenders checks that a failed ParseCheck
+// doesn't change how the renders after it come out.
+func TestParseCheckBetweenRenders(t *testing.T) {
+	r := newTestRenderer(t, renderer.WithDeterministic(time.Unix(0, 0)))
+	ctx := context.Background()
+	const src = "graph TD; A-->B"
+
+	before, err := r.Render(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ParseCheck(ctx, "%%{init: {\"theme\": \"dark\"}}%%\ngraph TD\nA-->"); err == nil {
+		t.Error("ParseCheck of a bad diagram = nil")
+	}
+	after, err := r.Render(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != after {
+		t.Error("Render after ParseCheck came out different")
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	for _, tc := range []struct {
+		err  renderer.ParseError
+		want string
+	}{
+		{renderer.ParseError{}, "<input>"},
+		{renderer.ParseError{File: "a.mmd"}, "a.mmd"},
+		{renderer.ParseError{File: "a.mmd", Line: 3}, "a.mmd:3"},
+		{renderer.ParseError{File: "a.mmd", Line: 3, Column: 7}, "a.mmd:3:7"},
+		{renderer.ParseError{Line: 3, Column: 7}, "<input>:3:7"},
+		// A column without a line isn't a position.
+		{renderer.ParseError{File: "a.mmd", Column: 7}, "a.mmd"},
+	} {
+		if got := tc.err.Position(); got != tc.want {
+			t.Errorf("%+v.Position() = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package renderer
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// cssPixelsPerInch is how many CSS pixels make an inch, the unit
+// PrintToPDF's paper sizes are in.
+const cssPixelsPerInch = 96
+
+// pdfJSSource has the helpers RenderPDF evaluates in the page, in
+// addition to pngJSSource: printOnlySVG hides everything but the
+// SVG showSVG shows, and takes off the page's margins, when
+// printing; printAll undoes it.
+const pdfJSSource = `
+function printOnlySVG() {
+		const style = document.createElement('style');
+		style.id = 'mermaid-cli-print';
+		style.textContent = '@page { margin: 0; } @media print { body { margin: 0; } body > :not(#mermaid-cli-png) { display: none !important; } }';
+		document.head.appendChild(style);
+		return true;
+}
+function printAll() {
+		const style = document.getElementById('mermaid-cli-print');
+		if (style) {
+				style.remove();
+		}
+		return true;
+}
+`
+
+// RenderPDF prints svgResult, from RenderDiagram, to a one-page PDF
+// by showing it in the page and printing it, on a page the size of
+// the diagram, with no margins.  It stays vector graphics, so
+// there's no scale to pick.  The diagram is on background, or
+// white if that's empty, so a dark theme's light text doesn't end
+// up on the paper's white.
+func (r *Renderer) RenderPDF(ctx context.Context, svgResult, background string) ([]byte, error) {
+	if background == "" {
+		background = "white"
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runCtx, cancel := r.runCtx(ctx)
+	defer cancel()
+	box, err := r.showSVG(runCtx, svgResult, background)
+	if err != nil {
+		return nil, err
+	}
+	defer r.hideSVG()
+
+	var ok bool
+	if err := chromedp.Run(runCtx, chromedp.Evaluate(pdfJSSource+"printOnlySVG()", &ok)); err != nil {
+		return nil, r.wrapErr(runCtx, err)
+	}
+	defer chromedp.Run(r.ctx, chromedp.Evaluate("printAll()", &ok))
+
+	var pdf []byte
+	err = chromedp.Run(runCtx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		pdf, _, err = page.PrintToPDF().
+			WithPrintBackground(true).
+			WithPaperWidth(box.Width / cssPixelsPerInch).
+			WithPaperHeight(box.Height / cssPixelsPerInch).
+			WithMarginTop(0).
+			WithMarginBottom(0).
+			WithMarginLeft(0).
+			WithMarginRight(0).
+			WithPageRanges("1"). // rounding can spill a sliver onto a second page
+			Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return nil, r.wrapErr(runCtx, err)
+	}
+	if r.opts.deterministic {
+		pdf = fixPDFDates(pdf, r.opts.epoch)
+	}
+	return pdf, nil
+}
+
+// pdfDateRE matches the dates Chrome stamps a PDF's /CreationDate
+// and /ModDate with, e.g., (D:20240102150405-07'00').
+var pdfDateRE = regexp.MustCompile(`/(CreationDate|ModDate) ?\(D:\d{14}[-+Z]\d{2}'\d{2}'\)`)
+
+// fixPDFDates sets the dates Chrome stamps pdf with, from the real
+// clock, to t, with WithDeterministic.  The dates keep their
+// length, so the offsets in the PDF's cross-reference table stay
+// right.
+func fixPDFDates(pdf []byte, t time.Time) []byte {
+	return pdfDateRE.ReplaceAllFunc(pdf, func(m []byte) []byte {
+		i := len(m) - len("(D:20060102150405+00'00')")
+		return append(m[:i:i], t.UTC().Format("(D:20060102150405+00'00')")...)
+	})
+}
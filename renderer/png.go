@@ -0,0 +1,114 @@
+package renderer
+
+import (
+	"context"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// pngJSSource has the helpers RenderPNG and RenderPDF evaluate in
+// the page, in addition to extrasJSSource.
+//
+//   - showSVG puts an SVG in the page, at its intrinsic size from
+//     its viewBox (MermaidJS makes it as wide as its container, up
+//     to that size), on background if it's set, and returns where
+//     it is.
+//   - hideSVG takes it out again, so its ids don't clash with the
+//     next render's.
+const pngJSSource = `
+function showSVG(svg, background) {
+		const box = document.createElement('div');
+		box.id = 'mermaid-cli-png';
+		box.style.cssText = 'position: absolute; left: 0; top: 0; display: inline-block;';
+		if (background) {
+				box.style.background = background;
+		}
+		box.innerHTML = svg;
+		document.body.appendChild(box);
+		const el = box.querySelector('svg');
+		const vb = el.viewBox && el.viewBox.baseVal;
+		if (vb && vb.width && vb.height) {
+				el.setAttribute('width', vb.width);
+				el.setAttribute('height', vb.height);
+		}
+		el.style.maxWidth = 'none';
+		const r = el.getBoundingClientRect();
+		return { x: r.x, y: r.y, width: r.width, height: r.height };
+}
+function hideSVG() {
+		const box = document.getElementById('mermaid-cli-png');
+		if (box) {
+				box.remove();
+		}
+		return true;
+}
+`
+
+// svgBox is where showSVG put an SVG in the page, in CSS pixels.
+type svgBox struct {
+	X, Y, Width, Height float64
+}
+
+// showSVG shows svgResult in the page, on background if it isn't
+// empty, running under ctx, for RenderPNG and RenderPDF.  The
+// caller hides it again with hideSVG.
+func (r *Renderer) showSVG(ctx context.Context, svgResult, background string) (svgBox, error) {
+	var defined bool
+	if err := chromedp.Run(ctx, chromedp.Evaluate("typeof showSVG === 'function'", &defined)); err != nil {
+		return svgBox{}, r.wrapErr(ctx, err)
+	}
+	if !defined {
+		var ready bool
+		if err := chromedp.Run(ctx, chromedp.Evaluate(pngJSSource+"true", &ready)); err != nil {
+			return svgBox{}, r.wrapErr(ctx, err)
+		}
+	}
+
+	var box svgBox
+	if err := chromedp.Run(ctx, chromedp.Evaluate(jsonEncodeJS("showSVG(...", []string{svgResult, background}, ")"), &box)); err != nil {
+		return svgBox{}, r.wrapErr(ctx, err)
+	}
+	return box, nil
+}
+
+// hideSVG takes out the SVG showSVG showed.  It does so even if
+// the caller has given up, so the SVG's ids don't clash with the
+// next render's.
+func (r *Renderer) hideSVG() {
+	var done bool
+	chromedp.Run(r.ctx, chromedp.Evaluate("hideSVG()", &done))
+}
+
+// RenderPNG rasterizes svgResult, from RenderDiagram, to a PNG by
+// showing it in the page and taking a screenshot of it, at scale
+// device pixels per CSS pixel (e.g., 2 for a high-density
+// screen), on background if it isn't empty.  A screenshot draws
+// everything the browser does, including the HTML labels in
+// foreignObjects that a canvas won't.
+func (r *Renderer) RenderPNG(ctx context.Context, svgResult string, scale float64, background string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runCtx, cancel := r.runCtx(ctx)
+	defer cancel()
+	box, err := r.showSVG(runCtx, svgResult, background)
+	if err != nil {
+		return nil, err
+	}
+	defer r.hideSVG()
+
+	var png []byte
+	err = chromedp.Run(runCtx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		png, err = page.CaptureScreenshot().
+			WithFormat(page.CaptureScreenshotFormatPng).
+			WithCaptureBeyondViewport(true).
+			WithClip(&page.Viewport{X: box.X, Y: box.Y, Width: box.Width, Height: box.Height, Scale: scale}).
+			Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return nil, r.wrapErr(runCtx, err)
+	}
+	return png, nil
+}
@@ -0,0 +1,97 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// Pool is a fixed set of renderers, each a tab in one browser, for
+// rendering documents concurrently.  Each goroutine Acquires a
+// renderer, has it to itself, and Releases it when it's done with
+// it.
+type Pool struct {
+	free chan *Renderer
+
+	mu   sync.Mutex
+	tabs []*Renderer
+
+	// replaced are the tabs Replace closed, each to the tab it
+	// opened in its place, until they're released.
+	replaced map[*Renderer]*Renderer
+}
+
+// NewPool opens n tabs in r's browser, each set up as r is (see
+// NewTab), and returns them as a pool.  ctx bounds opening them.
+//
+// For any error it closes the tabs it opened.
+func (r *Renderer) NewPool(ctx context.Context, n int) (*Pool, error) {
+	p := &Pool{free: make(chan *Renderer, n), replaced: make(map[*Renderer]*Renderer)}
+	for range n {
+		tab, err := r.NewTab(ctx)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.tabs = append(p.tabs, tab)
+		p.free <- tab
+	}
+	return p, nil
+}
+
+// Acquire waits for a free renderer and returns it, or returns
+// ctx's error if ctx is done first.
+func (p *Pool) Acquire(ctx context.Context) (*Renderer, error) {
+	select {
+	case tab := <-p.free:
+		return tab, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Release returns tab, from Acquire, to the pool, or the tab
+// Replace put in its place.
+func (p *Pool) Release(tab *Renderer) {
+	p.mu.Lock()
+	if next, ok := p.replaced[tab]; ok {
+		delete(p.replaced, tab)
+		tab = next
+	}
+	p.mu.Unlock()
+	p.free <- tab
+}
+
+// Replace closes tab, acquired from the pool, e.g., once its
+// browser has died, and opens a tab in browser in its place, set
+// up as browser is (see NewTab).  browser is usually the pool's
+// browser restarted, with Restart.  It returns the new tab, for the
+// caller to use instead of tab; releasing either returns the new
+// one to the pool.  ctx bounds opening the tab.
+func (p *Pool) Replace(ctx context.Context, tab, browser *Renderer) (*Renderer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := slices.Index(p.tabs, tab)
+	if i < 0 {
+		return nil, errors.New("replace tab: not a tab of the pool")
+	}
+	next, err := browser.NewTab(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tab.Close()
+	p.tabs[i] = next
+	p.replaced[tab] = next
+	return next, nil
+}
+
+// Close closes the pool's tabs.  Renderers acquired from it can't
+// be used after.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, tab := range p.tabs {
+		tab.Close()
+	}
+}
@@ -0,0 +1,39 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chromedp/chromedp"
+)
+
+// warmupDiagram is a diagram any working MermaidJS renders, to
+// tell a document that's broken from a page that is.
+const warmupDiagram = "flowchart LR\n    A --> B"
+
+// Healthy reports whether r can still render a simple diagram.
+//
+// Now and then a malformed document leaves MermaidJS's state
+// broken, so that every render after it fails, valid or not, until
+// the page is set up again with Reload.
+func (r *Renderer) Healthy(ctx context.Context) bool {
+	_, err := r.RenderDiagram(ctx, warmupDiagram)
+	return err == nil
+}
+
+// Reload clears r's page and sets it up again, as it was when r
+// started, with its theme and CSS but not its Configure config,
+// throwing away MermaidJS's broken state.
+func (r *Renderer) Reload(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runCtx, cancel := r.runCtx(ctx)
+	defer cancel()
+	if err := chromedp.Run(runCtx, chromedp.Navigate("about:blank")); err != nil {
+		return fmt.Errorf("reload page: %w", r.wrapErr(runCtx, err))
+	}
+	if err := r.setupPage(runCtx); err != nil {
+		return fmt.Errorf("reload page: %w", err)
+	}
+	return nil
+}
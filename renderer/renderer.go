@@ -0,0 +1,680 @@
+/*
+Package renderer renders MermaidJS diagrams to SVG, PNG, and PDF in
+a headless Chrome browser.  It's what mermaid-cli renders with, for
+programs, like static site generators, that would rather call it
+than run the binary:
+
+	r, err := renderer.NewRenderer(ctx, renderer.WithMermaidJS(bundle))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	svg, err := r.Render(ctx, "graph TD; A-->B")
+
+It returns errors rather than exiting.  The browser runs until
+NewRenderer's ctx is done, or Close; every other call takes a
+context of its own, so a caller can give up on a render without
+stopping the browser.
+
+A Renderer is one tab in the browser, and renders one diagram at a
+time; calls from more than one goroutine take turns.  To render
+several at once, a Pool has more tabs, and RenderStream renders
+from a channel with them.
+*/
+package renderer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cdruntime "github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// DefaultTheme is the MermaidJS theme documents render with unless
+// WithTheme or WithConfig sets another, or they set their own.
+const DefaultTheme = "default"
+
+// ErrNoMermaidJS is returned by NewRenderer without a bundle from
+// WithMermaidJS.
+var ErrNoMermaidJS = errors.New("no MermaidJS bundle; give one with WithMermaidJS")
+
+// mermaidInitializeConfig fulfills some basic requirements for
+// using MermaidJS.
+type mermaidInitializeConfig struct {
+	Theme            string `json:"theme,omitempty"`
+	FontFamily       string `json:"fontFamily,omitempty"`
+	ThemeCSS         string `json:"themeCSS,omitempty"`
+	StartOnLoad      bool   `json:"startOnLoad"`
+	DeterministicIDs bool   `json:"deterministicIds,omitempty"`
+}
+
+// Renderer is a tab of a headless Chrome browser with MermaidJS set
+// up in it, from NewRenderer.
+type Renderer struct {
+	// mu makes calls from more than one goroutine take turns.
+	mu     sync.Mutex
+	ctx    context.Context // the tab's
+	cancel context.CancelFunc
+	opts   options
+
+	// mermaidVersion is the version of the loaded MermaidJS, or
+	// "unknown".
+	mermaidVersion string
+
+	// colorEmoji is whether the browser has a font that can draw
+	// emoji in color, and cjkGlyphs whether it has one that can
+	// draw Chinese, Japanese, and Korean characters.
+	colorEmoji, cjkGlyphs bool
+
+	// configured is the config Configure last initialized MermaidJS
+	// with, as JSON, or "" for none beyond r's own.
+	configured string
+
+	// browser is the renderer whose browser r is a tab of, from
+	// NewTab, or nil if r started its own.
+	browser *Renderer
+}
+
+// NewRenderer starts a headless Chrome browser, or with
+// WithBrowserContext opens a tab in a running one, and sets up
+// MermaidJS in it.  The browser (or the tab) runs until ctx is done,
+// or until Close.
+//
+// For any error it stops the browser (or closes the tab) again.
+func NewRenderer(ctx context.Context, opts ...Option) (*Renderer, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.concurrency < 1 {
+		o.concurrency = min(runtime.NumCPU(), 4)
+	}
+	return start(ctx, ctx, o)
+}
+
+// start starts the renderer o asks for, whose browser, or tab, runs
+// until life is done, giving up on setting it up if setup is done
+// first.
+func start(life, setup context.Context, o options) (*Renderer, error) {
+	if len(o.mermaidJS) == 0 {
+		return nil, ErrNoMermaidJS
+	}
+	parent, cancelAlloc := life, context.CancelFunc(func() {})
+	if o.browserCtx != nil {
+		parent = o.browserCtx
+	} else {
+		parent, cancelAlloc = newAllocator(life, o)
+	}
+	ctx, cancelTab := chromedp.NewContext(parent)
+	stopLife := context.AfterFunc(life, cancelTab)
+	cancel := func() {
+		stopLife()
+		cancelTab()
+		cancelAlloc()
+	}
+	r := &Renderer{ctx: ctx, cancel: cancel, opts: o}
+
+	var timedOut atomic.Bool
+	if o.startupTimeout > 0 {
+		t := time.AfterFunc(o.startupTimeout, func() {
+			timedOut.Store(true)
+			cancel()
+		})
+		defer t.Stop()
+	}
+	stopSetup := context.AfterFunc(setup, cancel)
+	defer stopSetup()
+	if err := r.setupPage(ctx); err != nil {
+		cancel()
+		switch {
+		case timedOut.Load():
+			return nil, fmt.Errorf("set up headless browser: %s: gave up after %v", browserSource(o), o.startupTimeout)
+		case setup.Err() != nil:
+			return nil, fmt.Errorf("set up headless browser: %w", context.Cause(setup))
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewTab opens a tab in r's browser, set up as r is, with r's
+// options, theme, and CSS, but not its Configure config.  Closing
+// the tab leaves r's browser running.  ctx bounds opening the tab;
+// the tab then runs until Close, or until r's browser stops.
+func (r *Renderer) NewTab(ctx context.Context) (*Renderer, error) {
+	r.mu.Lock()
+	o := r.opts
+	r.mu.Unlock()
+	o.browserCtx = r.ctx
+	tab, err := start(r.ctx, ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	tab.browser = r.Browser()
+	return tab, nil
+}
+
+// Browser returns the renderer whose browser r is a tab of, from
+// NewTab (or a tab of a tab of), or r itself.
+func (r *Renderer) Browser() *Renderer {
+	if r.browser != nil {
+		return r.browser
+	}
+	return r
+}
+
+// Restart stops r's browser, if it's still running, and starts a
+// new one set up as r was, with the same MermaidJS, options, theme,
+// and CSS, e.g., once r's browser has died.  The new browser runs
+// until ctx is done, or until Close.  r can't be used after.
+func (r *Renderer) Restart(ctx context.Context) (*Renderer, error) {
+	r.mu.Lock()
+	o := r.opts
+	r.mu.Unlock()
+	r.Close()
+	return start(ctx, ctx, o)
+}
+
+// setupPage loads MermaidJS and the helpers into r's page, and
+// initializes MermaidJS, running under ctx, for start, or to set a
+// page up again once Reload has cleared it.
+func (r *Renderer) setupPage(ctx context.Context) error {
+	o := r.opts
+	// Start Chrome, if it isn't running, and load MermaidJS in
+	// browser
+	if err := chromedp.Run(ctx); err != nil {
+		if o.browserCtx != nil {
+			return fmt.Errorf("set up headless browser: %w", err)
+		}
+		return fmt.Errorf("set up headless browser: %s: %w", browserSource(o), err)
+	}
+	var ready *cdruntime.RemoteObject
+	if o.deterministic {
+		js := fmt.Sprintf("%s(%d, %d)", deterministicJSSource, o.epoch.UnixMilli(), 1)
+		if err := chromedp.Run(ctx, chromedp.Evaluate(js, &ready)); err != nil {
+			return fmt.Errorf("set up headless browser: make page deterministic: %w", err)
+		}
+	}
+	bundle := "MermaidJS bundle"
+	if o.bundleName != "" {
+		bundle += " " + o.bundleName
+	}
+	if err := chromedp.Run(ctx, chromedp.Evaluate(string(o.mermaidJS), &ready)); err != nil {
+		if lostBrowser(err) {
+			return fmt.Errorf("set up headless browser: %w", err)
+		}
+		return fmt.Errorf("set up headless browser: load %s: %w", bundle, unescapeErr(err))
+	}
+	var loaded bool
+	if err := chromedp.Run(ctx, chromedp.Evaluate("typeof window.mermaid === 'object' && typeof window.mermaid.render === 'function'", &loaded)); err != nil {
+		return fmt.Errorf("check for mermaid: %w", err)
+	}
+	if !loaded {
+		return fmt.Errorf("loaded %s, but it didn't define window.mermaid; is it MermaidJS's mermaid.min.js, and not the ESM build or a web page?", bundle)
+	}
+
+	// Initialize MermaidJS
+	if err := r.initialize(ctx, r.theme()); err != nil {
+		return err
+	}
+
+	// Load helpers in browser
+	ready = nil
+	if err := chromedp.Run(ctx, chromedp.Evaluate(extrasJSSource, &ready)); err != nil {
+		return fmt.Errorf("inject additional JavaScript: %w", err)
+	}
+	for _, js := range o.extraJS {
+		// The sourceURL names the script in its stack traces.
+		src := string(js.src) + "\n//# sourceURL=" + js.name
+		ready = nil
+		if err := chromedp.Run(ctx, chromedp.Evaluate(src, &ready)); err != nil {
+			if lostBrowser(err) {
+				return fmt.Errorf("load %s: %w", js.name, err)
+			}
+			return fmt.Errorf("load %s: %w", js.name, unescapeErr(err))
+		}
+		if err := chromedp.Run(ctx, chromedp.Evaluate(jsonEncodeJS("noteExtraJS(", js.name, ")"), &ready)); err != nil {
+			return fmt.Errorf("load %s: %w", js.name, err)
+		}
+	}
+
+	// Load fonts, and check what the browser can draw
+	if len(o.emojiFont) > 0 {
+		if err := r.loadFont(ctx, emojiFontFamily, o.emojiFont); err != nil {
+			return fmt.Errorf("load emoji font: %w", err)
+		}
+		r.colorEmoji = true
+	} else if err := chromedp.Run(ctx, chromedp.Evaluate("hasColorEmoji()", &r.colorEmoji)); err != nil {
+		return fmt.Errorf("check for emoji font: %w", err)
+	}
+	if len(o.cjkFont) > 0 {
+		if err := r.loadFont(ctx, cjkFontFamily, o.cjkFont); err != nil {
+			return fmt.Errorf("load CJK font: %w", err)
+		}
+		r.cjkGlyphs = true
+	} else if err := chromedp.Run(ctx, chromedp.Evaluate(`hasGlyph("\u4E2D")`, &r.cjkGlyphs)); err != nil {
+		return fmt.Errorf("check for CJK font: %w", err)
+	}
+
+	if err := chromedp.Run(ctx, chromedp.Evaluate("mermaidVersion()", &r.mermaidVersion)); err != nil {
+		return fmt.Errorf("get mermaid version: %w", err)
+	}
+
+	r.configured = ""
+	return nil
+}
+
+// initialize (re)initializes MermaidJS with theme, running under
+// ctx.  Documents rendered after it returns use the new
+// configuration.
+func (r *Renderer) initialize(ctx context.Context, theme string) error {
+	return r.initializeConfig(ctx, theme, nil)
+}
+
+// initializeConfig is initialize, with the MermaidJS settings in
+// config on top of r's own and WithConfig's.
+func (r *Renderer) initializeConfig(ctx context.Context, theme string, config map[string]any) error {
+	initConfig := mermaidInitializeConfig{
+		Theme:            theme,
+		FontFamily:       r.fontFamily(),
+		ThemeCSS:         r.opts.css,
+		StartOnLoad:      false,
+		DeterministicIDs: r.opts.deterministic,
+	}
+	var encodable any = initConfig
+	if len(r.opts.config) > 0 || len(config) > 0 {
+		b, err := json.Marshal(initConfig)
+		if err != nil {
+			return fmt.Errorf("initialize mermaid: %w", err)
+		}
+		merged := make(map[string]any)
+		if err := json.Unmarshal(b, &merged); err != nil {
+			return fmt.Errorf("initialize mermaid: %w", err)
+		}
+		MergeConfig(merged, r.opts.config)
+		merged["theme"] = theme
+		if r.opts.css != "" {
+			merged["themeCSS"] = r.opts.css
+		}
+		if r.opts.fontFamily != "" {
+			merged["fontFamily"] = initConfig.FontFamily
+		}
+		MergeConfig(merged, config)
+		encodable = merged
+	}
+	b, err := json.Marshal(encodable)
+	if err != nil {
+		return fmt.Errorf("initialize mermaid: %w", err)
+	}
+
+	// Snapshot the config MermaidJS ends up with, for restoreConfig
+	// to go back to before each document: directives can change
+	// MermaidJS's global config, and a document's shouldn't change
+	// how the next one renders.
+	jsSource := "mermaid.initialize(" + string(b) + ");" +
+		"window.mermaidCLIConfig = JSON.stringify(mermaid.mermaidAPI.getConfig());"
+	var ready *cdruntime.RemoteObject
+	if err := chromedp.Run(ctx, chromedp.Evaluate(jsSource, &ready)); err != nil {
+		return fmt.Errorf("initialize mermaid: %w", r.wrapErr(ctx, err))
+	}
+	return nil
+}
+
+// Configure re-initializes MermaidJS with config, any MermaidJS
+// settings, on top of r's own, for the documents rendered after it,
+// as if r had started with them in WithConfig.  It does nothing if
+// r already has config; an empty config goes back to r's own.  A
+// document's front matter and directives still override it.
+func (r *Renderer) Configure(ctx context.Context, config map[string]any) error {
+	key := ""
+	if len(config) > 0 {
+		b, err := json.Marshal(config)
+		if err != nil {
+			return fmt.Errorf("initialize mermaid: %w", err)
+		}
+		key = string(b)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key == r.configured {
+		return nil
+	}
+	runCtx, cancel := r.runCtx(ctx)
+	defer cancel()
+	if err := r.initializeConfig(runCtx, r.theme(), config); err != nil {
+		return err
+	}
+	r.configured = key
+	return nil
+}
+
+// SetTheme has MermaidJS render the documents after it with theme,
+// as if r had started with it in WithTheme.  It drops Configure's
+// config.  For an error, r keeps its old theme.
+func (r *Renderer) SetTheme(ctx context.Context, theme string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.opts.theme
+	r.opts.theme = theme
+	if err := r.reinitialize(ctx); err != nil {
+		r.opts.theme = old
+		return err
+	}
+	return nil
+}
+
+// SetCSS has MermaidJS add css to the SVGs of the documents after
+// it, as if r had started with it in WithCSS.  It drops Configure's
+// config.  For an error, r keeps its old CSS.
+func (r *Renderer) SetCSS(ctx context.Context, css string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.opts.css
+	r.opts.css = css
+	if err := r.reinitialize(ctx); err != nil {
+		r.opts.css = old
+		return err
+	}
+	return nil
+}
+
+// reinitialize initializes MermaidJS with r's own config again,
+// for SetTheme and SetCSS.
+func (r *Renderer) reinitialize(ctx context.Context) error {
+	runCtx, cancel := r.runCtx(ctx)
+	defer cancel()
+	if err := r.initialize(runCtx, r.theme()); err != nil {
+		return err
+	}
+	r.configured = ""
+	return nil
+}
+
+// RenderResult is a rendered diagram, and what the browser
+// measured of it.
+type RenderResult struct {
+	SVG string
+
+	// Width and Height are the SVG's intrinsic size, from its
+	// viewBox.
+	Width, Height float64
+
+	// DiagramType is the type of the diagram, e.g., flowchart-v2.
+	DiagramType string
+
+	// Title is the diagram's title, from its front matter or title
+	// statement, or "" if it has none.
+	Title string
+
+	// ID and Err are only set by RenderStream: the ID of the
+	// RenderItem, and the error rendering it, if any.
+	ID  string `json:"-"`
+	Err error  `json:"-"`
+}
+
+// RenderDiagram calls the extras renderSVG func to render
+// mmdSource to SVG.  If the diagram has a title, the SVG gets a
+// <title> element with it, if MermaidJS didn't add one.
+//
+// A document that doesn't parse fails with a *ParseError.  With
+// WithRenderTimeout, a render that takes too long fails with a
+// *RenderTimeoutError.  If ctx is done first, it stops the render
+// and returns ctx's error.
+func (r *Renderer) RenderDiagram(ctx context.Context, mmdSource string) (RenderResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runCtx, cancel := r.runCtx(ctx)
+	defer cancel()
+	return r.evalRender(runCtx, r.renderJS(mmdSource))
+}
+
+// renderJS returns the JavaScript RenderDiagram evaluates to render
+// mmdSource.
+func (r *Renderer) renderJS(mmdSource string) string {
+	return jsonEncodeJS("renderSVG(", mmdSource, ", "+strconv.Quote(r.svgID(mmdSource))+")")
+}
+
+// evalRender is RenderDiagram, for the JavaScript jsSource, a call
+// of renderSVG, as renderJS has it or as RenderScript recorded it,
+// running under ctx, from runCtx.
+func (r *Renderer) evalRender(ctx context.Context, jsSource string) (result RenderResult, err error) {
+	evalCtx, began := ctx, time.Now()
+	if r.opts.renderTimeout > 0 {
+		var cancel context.CancelFunc
+		evalCtx, cancel = context.WithTimeout(ctx, r.opts.renderTimeout)
+		defer cancel()
+	}
+
+	var rendered struct {
+		RenderResult
+		Length     int         `json:"length"`
+		ParseError *ParseError `json:"parseError"`
+	}
+	render := chromedp.Evaluate(
+		jsSource,
+		&rendered,
+		func(p *cdruntime.EvaluateParams) *cdruntime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		},
+	)
+	if err = chromedp.Run(evalCtx, render); err != nil {
+		return RenderResult{}, r.renderErr(ctx, evalCtx, began, err)
+	}
+	if rendered.ParseError != nil {
+		return RenderResult{}, rendered.ParseError
+	}
+	result = rendered.RenderResult
+
+	// Fetch the SVG in chunks, since a big one doesn't fit in one
+	// CDP message.  Length and the offsets count UTF-16 code
+	// units, as JS strings do.
+	var svgResult strings.Builder
+	for start := 0; start < rendered.Length; {
+		var chunk struct {
+			Text string `json:"text"`
+			End  int    `json:"end"`
+		}
+		jsSource := fmt.Sprintf("resultChunk(%d, %d)", start, resultChunkSize)
+		if err = chromedp.Run(evalCtx, chromedp.Evaluate(jsSource, &chunk)); err != nil {
+			return RenderResult{}, r.renderErr(ctx, evalCtx, began, err)
+		}
+		if chunk.End <= start {
+			return RenderResult{}, fmt.Errorf("fetch SVG: got no progress at offset %d of %d", start, rendered.Length)
+		}
+		svgResult.WriteString(chunk.Text)
+		start = chunk.End
+	}
+	result.SVG = addSVGTitle(svgResult.String(), result.Title)
+	return result, nil
+}
+
+// resultChunkSize is how many UTF-16 code units of an SVG
+// RenderDiagram fetches at a time, well under the size of a CDP
+// message even if every one takes 3 bytes of UTF-8, or 6 of JSON
+// escapes.
+const resultChunkSize = 1 << 20
+
+// renderErr is the error for a render, begun at began, that failed
+// with err, running under evalCtx, which is ctx with any
+// WithRenderTimeout limit.  If the render ran out of time, or the
+// caller gave up on it, renderErr stops the page's JavaScript,
+// which may be stuck in a loop, so the tab can be used again, and
+// returns a *RenderTimeoutError, or ctx's error.
+func (r *Renderer) renderErr(ctx, evalCtx context.Context, began time.Time, err error) error {
+	if r.ctx.Err() != nil || evalCtx.Err() == nil {
+		return r.wrapErr(ctx, err)
+	}
+	stopCtx, cancel := context.WithTimeout(r.ctx, 5*time.Second)
+	defer cancel()
+	chromedp.Run(stopCtx, cdruntime.TerminateExecution())
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return &RenderTimeoutError{Elapsed: time.Since(began)}
+}
+
+// Render is like RenderDiagram, but only returns the SVG.
+func (r *Renderer) Render(ctx context.Context, mmdSource string) (string, error) {
+	result, err := r.RenderDiagram(ctx, mmdSource)
+	return result.SVG, err
+}
+
+// EffectiveConfig calls the extras effectiveConfig func to get the
+// MermaidJS config that mmdSource renders with.
+//
+// The settings layer, from highest to lowest precedence:
+//
+//  1. the document's init directives (%%{init: {...}}%%)
+//  2. the document's front matter config
+//  3. the config r initialized MermaidJS with, from its options
+//     and Configure, or MermaidJS's defaults
+//
+// MermaidJS is re-initialized with r's config before each render,
+// so one document's settings never leak into the next.
+func (r *Renderer) EffectiveConfig(ctx context.Context, mmdSource string) (config map[string]any, err error) {
+	err = r.eval(ctx, jsonEncodeJS("effectiveConfig(", mmdSource, ")"), &config)
+	return config, err
+}
+
+// DefaultConfig returns the default config of the loaded
+// MermaidJS, which has every setting it knows.
+func (r *Renderer) DefaultConfig(ctx context.Context) (config map[string]any, err error) {
+	err = r.eval(ctx, "defaultConfig()", &config)
+	return config, err
+}
+
+// eval evaluates jsSource in r's page, awaiting it if it's a
+// promise, and decodes its value into v.
+func (r *Renderer) eval(ctx context.Context, jsSource string, v any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runCtx, cancel := r.runCtx(ctx)
+	defer cancel()
+	eval := chromedp.Evaluate(jsSource, v, func(p *cdruntime.EvaluateParams) *cdruntime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	})
+	if err := chromedp.Run(runCtx, eval); err != nil {
+		return r.wrapErr(runCtx, err)
+	}
+	return nil
+}
+
+// Version returns the version of the loaded MermaidJS, or
+// "unknown" if it doesn't say.
+func (r *Renderer) Version() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mermaidVersion
+}
+
+// Theme returns the theme documents render with unless they set
+// their own.
+func (r *Renderer) Theme() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.theme()
+}
+
+func (r *Renderer) theme() string {
+	if r.opts.theme != "" {
+		return r.opts.theme
+	}
+	if theme, ok := r.opts.config["theme"].(string); ok && theme != "" {
+		return theme
+	}
+	return DefaultTheme
+}
+
+// Concurrency returns how many tabs to render in at once, from
+// WithConcurrency.
+func (r *Renderer) Concurrency() int {
+	return r.opts.concurrency
+}
+
+// HasColorEmoji reports whether the browser can draw emoji in
+// color, with a font of its own or WithEmojiFont's.  Without one,
+// they come out in black and white, or as boxes.
+func (r *Renderer) HasColorEmoji() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.colorEmoji
+}
+
+// HasCJKGlyphs reports whether the browser can draw Chinese,
+// Japanese, and Korean characters, with a font of its own or
+// WithCJKFont's.  Without one, they come out as boxes.
+func (r *Renderer) HasCJKGlyphs() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cjkGlyphs
+}
+
+// runCtx returns a context for running actions in r's tab that's
+// done when ctx is, with ctx's error as its cause, and the func to
+// release it.
+func (r *Renderer) runCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	runCtx, cancel := context.WithCancelCause(r.ctx)
+	stop := context.AfterFunc(ctx, func() { cancel(context.Cause(ctx)) })
+	return runCtx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// wrapErr returns err, from running something in r's tab under
+// ctx, a context from runCtx: as a *BrowserError if the browser (or
+// the tab) is gone, as the caller's error if it gave up, or else as
+// the JavaScript error it is.
+func (r *Renderer) wrapErr(ctx context.Context, err error) error {
+	switch {
+	case r.ctx.Err() != nil || lostBrowser(err):
+		return &BrowserError{Err: err}
+	case ctx.Err() != nil:
+		return context.Cause(ctx)
+	}
+	return unescapeErr(err)
+}
+
+// Close stops the browser, or with WithBrowserContext, closes r's
+// tab.  r can't be used after.  It always returns nil; the error is
+// for io.Closer.
+func (r *Renderer) Close() error {
+	if r == nil || r.cancel == nil {
+		return nil // never started
+	}
+	r.cancel()
+	return nil
+}
+
+// jsonEncodeJS JSON-encodes encodable, a string or a []string, and
+// wraps it in pre and post, as a call's arguments, say.  Strings
+// always encode.
+func jsonEncodeJS(pre string, encodable any, post string) string {
+	var jsSource strings.Builder
+
+	jsSource.WriteString(pre)
+	if err := json.NewEncoder(&jsSource).Encode(encodable); err != nil {
+		panic(fmt.Sprintf("renderer: encode %T: %v", encodable, err))
+	}
+	jsSource.WriteString(post)
+
+	return jsSource.String()
+}
+
+var unescaper = strings.NewReplacer(
+	"Error: ", "Error:\n",
+	`\n`, "\n",
+)
+
+func unescapeErr(err error) error {
+	return errors.New(unescaper.Replace(err.Error()))
+}
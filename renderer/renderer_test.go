@@ -0,0 +1,339 @@
+package renderer_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// newTestRenderer starts a renderer with the MermaidJS bundle at
+// MERMAID_JS_PATH, or else the repo's mermaid.min.js, and opts,
+// stopping it when t is done.  These tests need Chrome and a real
+// bundle (see download.sh), so it skips t with -short, or if
+// either is missing.
+func newTestRenderer(t testing.TB, opts ...renderer.Option) *renderer.Renderer {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping Chrome test in short mode")
+	}
+	name := os.Getenv("MERMAID_JS_PATH")
+	if name == "" {
+		name = "../mermaid.min.js"
+	}
+	bundle, err := os.ReadFile(name)
+	if err != nil {
+		t.Skipf("no MermaidJS bundle: %v", err)
+	}
+	// The checked-in stub only stands in for the bundle to build
+	// with; it can't render.
+	if len(bundle) < 1024 {
+		t.Skipf("%s isn't a MermaidJS bundle; run download.sh", name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	opts = append([]renderer.Option{
+		renderer.WithMermaidJS(bundle),
+		renderer.WithStartupTimeout(time.Minute),
+	}, opts...)
+	r, err := renderer.NewRenderer(ctx, opts...)
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skipf("no Chrome: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// evalStandalone opens svg on its own, as a file in a browser of
+// its own, without MermaidJS or its page's CSS, and evaluates the
+// JavaScript expression in it into res.
+func evalStandalone(t *testing.T, svg, expression string, res any) {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "standalone.svg")
+	if err := os.WriteFile(name, []byte(svg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := chromedp.NewExecAllocator(context.Background(), chromedp.DefaultExecAllocatorOptions[:]...)
+	defer cancel()
+	ctx, cancel = chromedp.NewContext(ctx)
+	defer cancel()
+	err := chromedp.Run(ctx,
+		chromedp.Navigate("file://"+filepath.ToSlash(name)),
+		chromedp.Evaluate(expression, res),
+	)
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skipf("no Chrome: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewRendererNoMermaidJS(t *testing.T) {
+	_, err := renderer.NewRenderer(context.Background())
+	if !errors.Is(err, renderer.ErrNoMermaidJS) {
+		t.Errorf("NewRenderer without WithMermaidJS = %v, want ErrNoMermaidJS", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	r := newTestRenderer(t)
+	ctx := context.Background()
+
+	if r.Version() == "" {
+		t.Error("Version() = \"\"")
+	}
+	svg, err := r.Render(ctx, "graph TD; A-->B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, "</svg>") {
+		t.Errorf("Render = %.80q..., want an SVG", svg)
+	}
+}
+
+func TestRenderDiagram(t *testing.T) {
+	r := newTestRenderer(t)
+
+	result, err := r.RenderDiagram(context.Background(), "---\ntitle: Login\n---\ngraph TD; A-->B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DiagramType != "flowchart-v2" {
+		t.Errorf("DiagramType = %q, want flowchart-v2", result.DiagramType)
+	}
+	if result.Title != "Login" {
+		t.Errorf("Title = %q, want Login", result.Title)
+	}
+	if result.Width <= 0 || result.Height <= 0 {
+		t.Errorf("size = %vx%v, want positive", result.Width, result.Height)
+	}
+	if !strings.Contains(result.SVG, "<title>Login</title>") {
+		t.Error("SVG has no <title>Login</title>")
+	}
+}
+
+// TestRenderLarge renders a flowchart of 5,000 nodes, whose SVG is
+// many times the size of a chunk RenderDiagram fetches at a time.
+func TestRenderLarge(t *testing.T) {
+	r := newTestRenderer(t,
+		renderer.WithConfig(map[string]any{"maxTextSize": 1 << 30, "maxEdges": 1 << 20}),
+		renderer.WithRenderTimeout(10*time.Minute),
+	)
+
+	var src strings.Builder
+	src.WriteString("flowchart TD\n")
+	for i := 1; i < 5000; i++ {
+		fmt.Fprintf(&src, "    N%d --> N%d\n", (i-1)/4, i)
+	}
+	svg, err := r.Render(context.Background(), src.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svg) < 2<<20 {
+		t.Errorf("SVG is %d bytes, want one that takes several chunks", len(svg))
+	}
+	if !strings.HasSuffix(svg, "</svg>") {
+		t.Errorf("SVG ends with %q, want </svg>", svg[max(len(svg)-80, 0):])
+	}
+	d := xml.NewDecoder(strings.NewReader(svg))
+	d.Entity = xml.HTMLEntity
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("SVG doesn't parse: %v", err)
+		}
+	}
+	if n := strings.Count(svg, `class="node `); n != 5000 {
+		t.Errorf("SVG has %d nodes, want 5000", n)
+	}
+}
+
+func TestRenderParseError(t *testing.T) {
+	r := newTestRenderer(t)
+
+	_, err := r.Render(context.Background(), "graph TD\nA-->\n")
+	var parseErr *renderer.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Render = %v, want a *ParseError", err)
+	}
+}
+
+func TestRenderCanceled(t *testing.T) {
+	r := newTestRenderer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Render(ctx, "graph TD; A-->B"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Render with a canceled ctx = %v, want context.Canceled", err)
+	}
+	// Giving up on a render leaves the browser running.
+	if _, err := r.Render(context.Background(), "graph TD; A-->B"); err != nil {
+		t.Errorf("Render after a canceled one: %v", err)
+	}
+}
+
+func TestRenderClosed(t *testing.T) {
+	r := newTestRenderer(t)
+
+	r.Close()
+	_, err := r.Render(context.Background(), "graph TD; A-->B")
+	var browserErr *renderer.BrowserError
+	if !errors.As(err, &browserErr) {
+		t.Errorf("Render after Close = %v, want a *BrowserError", err)
+	}
+}
+
+func TestSetTheme(t *testing.T) {
+	r := newTestRenderer(t)
+	ctx := context.Background()
+
+	if got := r.Theme(); got != renderer.DefaultTheme {
+		t.Errorf("Theme() = %q, want %q", got, renderer.DefaultTheme)
+	}
+	before, err := r.Render(ctx, "graph TD; A-->B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetTheme(ctx, "dark"); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Theme(); got != "dark" {
+		t.Errorf("Theme() after SetTheme = %q, want dark", got)
+	}
+	after, err := r.Render(ctx, "graph TD; A-->B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Error("SetTheme(dark) didn't change the SVG")
+	}
+}
+
+func TestRenderPNG(t *testing.T) {
+	r := newTestRenderer(t)
+	ctx := context.Background()
+
+	svg, err := r.Render(ctx, "graph TD; A-->B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	png, err := r.RenderPNG(ctx, svg, 1, "white")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(png, []byte("\x89PNG\r\n\x1a\n")) {
+		t.Errorf("RenderPNG = %.8q..., want a PNG", png)
+	}
+}
+
+func TestRenderPDFDeterministic(t *testing.T) {
+	r := newTestRenderer(t, renderer.WithDeterministic(time.Unix(1700000000, 0)))
+	ctx := context.Background()
+
+	svg, err := r.Render(ctx, "graph TD; A-->B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf, err := r.RenderPDF(ctx, svg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatalf("RenderPDF = %.8q..., want a PDF", pdf)
+	}
+	if !bytes.Contains(pdf, []byte("/CreationDate (D:20231114221320+00'00')")) {
+		t.Error("the PDF isn't dated at the epoch")
+	}
+	again, err := r.RenderPDF(ctx, svg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pdf, again) {
+		t.Error("RenderPDF of the same SVG differs")
+	}
+}
+
+func TestPool(t *testing.T) {
+	r := newTestRenderer(t)
+	ctx := context.Background()
+
+	pool, err := r.NewPool(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	a, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("Acquire gave out the same tab twice")
+	}
+	for _, tab := range []*renderer.Renderer{a, b} {
+		if _, err := tab.Render(ctx, "graph TD; A-->B"); err != nil {
+			t.Error(err)
+		}
+		pool.Release(tab)
+	}
+}
+
+func TestPoolReplace(t *testing.T) {
+	r := newTestRenderer(t)
+	ctx := context.Background()
+
+	pool, err := r.NewPool(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	old, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Browser() != r {
+		t.Error("the tab's Browser isn't the renderer it was opened in")
+	}
+	tab, err := pool.Replace(ctx, old, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var browserErr *renderer.BrowserError
+	if _, err := old.Render(ctx, "graph TD; A-->B"); !errors.As(err, &browserErr) {
+		t.Errorf("Render in the replaced tab = %v, want a *BrowserError", err)
+	}
+	if _, err := tab.Render(ctx, "graph TD; A-->B"); err != nil {
+		t.Error(err)
+	}
+
+	// Releasing the replaced tab gives the pool the new one.
+	pool.Release(old)
+	if got, err := pool.Acquire(ctx); err != nil || got != tab {
+		t.Errorf("Acquire = %p, %v; want the new tab, %p", got, err, tab)
+	}
+	if _, err := pool.Replace(ctx, r, r); err == nil {
+		t.Error("Replace of a renderer that isn't in the pool succeeded")
+	}
+}
@@ -0,0 +1,47 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+)
+
+// RenderScript returns the JavaScript RenderDiagram evaluates in
+// the page to render mmdSource, for a recording of a session to
+// replay with RunRenderScript, say with a different MermaidJS.
+func (r *Renderer) RenderScript(mmdSource string) string {
+	return r.renderJS(mmdSource)
+}
+
+// RunRenderScript renders with jsSource, from RenderScript, as
+// RenderDiagram does.
+func (r *Renderer) RunRenderScript(ctx context.Context, jsSource string) (RenderResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runCtx, cancel := r.runCtx(ctx)
+	defer cancel()
+	return r.evalRender(runCtx, jsSource)
+}
+
+// InitConfig returns the config MermaidJS is initialized with, as
+// JSON, which each render starts from, and a document's own
+// config goes over.
+func (r *Renderer) InitConfig(ctx context.Context) (config string, err error) {
+	err = r.eval(ctx, "window.mermaidCLIConfig || ''", &config)
+	return config, err
+}
+
+// SetInitConfig has the renders after it start from config, JSON
+// from InitConfig, say from a recording, until r is configured
+// again.
+func (r *Renderer) SetInitConfig(ctx context.Context, config string) error {
+	var ok bool
+	if err := r.eval(ctx, jsonEncodeJS("window.mermaidCLIConfig = ", config, "; true"), &ok); err != nil {
+		return fmt.Errorf("set config: %w", err)
+	}
+	// Not JSON, so the next Configure initializes MermaidJS again,
+	// whatever its config.
+	r.mu.Lock()
+	r.configured = "-"
+	r.mu.Unlock()
+	return nil
+}
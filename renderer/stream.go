@@ -0,0 +1,76 @@
+package renderer
+
+import (
+	"context"
+	"sync"
+)
+
+// RenderItem is a document to render with RenderStream.
+type RenderItem struct {
+	// ID identifies the item's RenderResult; it's up to the
+	// caller.
+	ID     string
+	Source string
+}
+
+// RenderStream renders the RenderItems sent on items, and sends a
+// RenderResult for each, with the item's ID and any error in Err,
+// on results.  Up to WithConcurrency items are rendered at once,
+// each in a tab of its own in r's browser, so results come in the
+// order they finish, not the order they were sent.
+//
+// Sending on items blocks until a tab is free to take the item,
+// and a tab can't take another item until its last result has
+// been received: a caller that stops receiving results stops the
+// stream.
+//
+// Close items when done; results is closed once the last result
+// has been sent.  If ctx is canceled, the tabs close and results
+// is closed without waiting for the rest of the items, so a caller
+// that might block sending on items should select on ctx.Done()
+// too.
+func (r *Renderer) RenderStream(ctx context.Context) (chan<- RenderItem, <-chan RenderResult, error) {
+	pool, err := r.NewPool(ctx, r.Concurrency())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items := make(chan RenderItem)
+	results := make(chan RenderResult)
+
+	var wg sync.WaitGroup
+	for _, tab := range pool.tabs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				var item RenderItem
+				select {
+				case <-ctx.Done():
+					return
+				case it, ok := <-items:
+					if !ok {
+						return
+					}
+					item = it
+				}
+
+				result, err := tab.RenderDiagram(ctx, item.Source)
+				result.ID, result.Err = item.ID, err
+
+				select {
+				case <-ctx.Done():
+					return
+				case results <- result:
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		pool.Close()
+		close(results)
+	}()
+
+	return items, results, nil
+}
@@ -0,0 +1,76 @@
+package renderer_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+func TestRenderStream(t *testing.T) {
+	r := newTestRenderer(t, renderer.WithConcurrency(2))
+	ctx := context.Background()
+
+	items, results, err := r.RenderStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 6
+	go func() {
+		defer close(items)
+		for i := range n {
+			src := fmt.Sprintf("graph TD; A%d-->B%d", i, i)
+			if i == 3 {
+				src = "graph TD\nA-->"
+			}
+			items <- renderer.RenderItem{ID: fmt.Sprint(i), Source: src}
+		}
+	}()
+
+	seen := make(map[string]bool)
+	for result := range results {
+		if seen[result.ID] {
+			t.Errorf("got result %s twice", result.ID)
+		}
+		seen[result.ID] = true
+		if (result.ID == "3") != (result.Err != nil) {
+			t.Errorf("result %s: Err = %v", result.ID, result.Err)
+		}
+	}
+	if len(seen) != n {
+		t.Errorf("got %d results, want %d", len(seen), n)
+	}
+}
+
+// TestRenderStreamBackpressure checks that with one tab, an item
+// isn't taken until the last one's result has been received.
+func TestRenderStreamBackpressure(t *testing.T) {
+	r := newTestRenderer(t, renderer.WithConcurrency(1))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	items, results, err := r.RenderStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items <- renderer.RenderItem{ID: "a", Source: "graph TD; A-->B"}
+	select {
+	case items <- renderer.RenderItem{ID: "b", Source: "graph TD; B-->C"}:
+		t.Fatal("RenderStream took b before a's result was received")
+	case <-time.After(500 * time.Millisecond):
+	}
+	if result := <-results; result.ID != "a" || result.Err != nil {
+		t.Fatalf("first result = %s, %v; want a", result.ID, result.Err)
+	}
+	items <- renderer.RenderItem{ID: "b", Source: "graph TD; B-->C"}
+	if result := <-results; result.ID != "b" || result.Err != nil {
+		t.Fatalf("second result = %s, %v; want b", result.ID, result.Err)
+	}
+
+	// Canceling ctx closes results without items being closed.
+	cancel()
+	for range results {
+	}
+}
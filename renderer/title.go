@@ -0,0 +1,30 @@
+package renderer
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// addSVGTitle returns svgResult with a <title> element of title
+// as the first child of its root, so viewers show it as a
+// tooltip, unless title is "" or the SVG already has a title.
+func addSVGTitle(svgResult, title string) string {
+	if title == "" || strings.Contains(svgResult, "<title") {
+		return svgResult
+	}
+	i := strings.Index(svgResult, "<svg")
+	if i < 0 {
+		return svgResult
+	}
+	j := strings.IndexByte(svgResult[i:], '>')
+	if j < 0 {
+		return svgResult
+	}
+	j += i + 1
+
+	var b strings.Builder
+	b.WriteString("<title>")
+	xml.EscapeText(&b, []byte(title))
+	b.WriteString("</title>")
+	return svgResult[:j] + b.String() + svgResult[j:]
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestRenderQueueOrder pushes jobs in the order a poll might find
+// them, and pops lone edits before bulk changes, newest first.
+func TestRenderQueueOrder(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	pair := func(name string) renderPair {
+		return renderPair{mmdName: name + ".mmd", svgName: name + ".svg"}
+	}
+	var q renderQueue
+	q.push(watchJob{pair: pair("old-bulk"), modTime: t0, bulk: true})
+	q.push(watchJob{pair: pair("new-bulk"), modTime: t0.Add(2 * time.Second), bulk: true})
+	q.push(watchJob{pair: pair("old-edit"), modTime: t0.Add(time.Second)})
+	q.push(watchJob{pair: pair("new-edit"), modTime: t0.Add(3 * time.Second)})
+
+	var got []string
+	for q.len() > 0 {
+		got = append(got, q.pop().pair.mmdName)
+	}
+	want := []string{"new-edit.mmd", "old-edit.mmd", "new-bulk.mmd", "old-bulk.mmd"}
+	if !slices.Equal(got, want) {
+		t.Errorf("popped %q, want %q", got, want)
+	}
+}
+
+func TestRenderQueueCoalesce(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	a := renderPair{mmdName: "a.mmd", svgName: "a.svg"}
+	b := renderPair{mmdName: "b.mmd", svgName: "b.svg"}
+	var q renderQueue
+	q.push(watchJob{pair: a, modTime: t0, bulk: true})
+	q.push(watchJob{pair: b, modTime: t0.Add(time.Second)})
+	// a is edited again: its stale job goes, and it moves up.
+	q.push(watchJob{pair: a, modTime: t0.Add(2 * time.Second)})
+
+	if q.len() != 2 {
+		t.Fatalf("len = %d after pushing a twice, want 2", q.len())
+	}
+	if j := q.pop(); j.pair != a || j.bulk || !j.modTime.Equal(t0.Add(2*time.Second)) {
+		t.Errorf("popped %+v, want a's newest job", j)
+	}
+	if j := q.pop(); j.pair != b {
+		t.Errorf("popped %+v, want b's job", j)
+	}
+
+	q.push(watchJob{pair: a})
+	q.clear()
+	if q.len() != 0 {
+		t.Errorf("len = %d after clear, want 0", q.len())
+	}
+}
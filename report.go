@@ -0,0 +1,308 @@
+package main
+
+import (
+	"html/template"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// reportEntry is the outcome of the last render of one document,
+// for the -report-html report.
+type reportEntry struct {
+	Name    string
+	SVGName string
+	OK      bool
+	Error   string
+
+	// Variant is the -matrix variant the document rendered with, or
+	// "".
+	Variant string
+
+	// NotAttempted is whether the document wasn't rendered at all,
+	// because -max-total-time ran out first.
+	NotAttempted bool
+
+	// UpToDate is whether the document wasn't rendered because its
+	// output was already up to date.
+	UpToDate bool
+
+	// Skipped is why the document wasn't rendered, if it was
+	// skipped, e.g., noRendererReason.
+	Skipped string
+
+	// Output is what became of the output of a document that failed
+	// to render: outputKeptOld, outputRemoved, or
+	// outputPlaceholder.  It's "" otherwise.
+	Output string
+
+	Duration time.Duration
+	Size     int
+	Type     string
+
+	// Hash is the document's outputHash, with -dedupe-report, and
+	// Duplicates the other documents with the same one.
+	Hash       string
+	Duplicates []string
+}
+
+// The states the output of a document that failed to render can
+// be left in, for reportEntry.Output.
+const (
+	outputKeptOld     = "kept-old"    // as it was, if there was one
+	outputRemoved     = "removed"     // by -remove-on-fail
+	outputPlaceholder = "placeholder" // written by -error-placeholder
+)
+
+// reportEntries are the documents rendered so far, in the order
+// they were first rendered.  A document rendered again (in watch
+// mode) replaces its entry.
+var reportEntries []*reportEntry
+
+// recordRender records the render of pair that began at start,
+// with result, or err if it failed.
+func recordRender(pair renderPair, start time.Time, result renderer.RenderResult, err error) {
+	e := &reportEntry{
+		Name:     pair.docName(),
+		SVGName:  pair.svgName,
+		Variant:  pair.variant,
+		OK:       err == nil,
+		Duration: time.Since(start),
+		Size:     len(result.SVG),
+		Type:     result.DiagramType,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	} else if *dedupeReportFlag && result.SVG != "" {
+		e.Hash = outputHash(result.SVG)
+	}
+	for i, old := range reportEntries {
+		if old.Name == e.Name {
+			reportEntries[i] = e
+			return
+		}
+	}
+	reportEntries = append(reportEntries, e)
+}
+
+// recordFailedOutput records state, what became of the output of
+// pair, which just failed to render, in its report entry and its
+// failure.
+func recordFailedOutput(pair renderPair, state string) {
+	if e := findReportEntry(pair.docName()); e != nil {
+		e.Output = state
+	}
+	for i := len(failures) - 1; i >= 0; i-- {
+		if failures[i].name == pair.mmdName {
+			failures[i].output = state
+			break
+		}
+	}
+}
+
+// recordNotAttempted records that pair wasn't rendered at all.
+func recordNotAttempted(pair renderPair) {
+	reportEntries = append(reportEntries, &reportEntry{
+		Name:         pair.docName(),
+		SVGName:      pair.svgName,
+		Variant:      pair.variant,
+		Error:        "not attempted",
+		NotAttempted: true,
+	})
+}
+
+// recordUpToDate records that pair wasn't rendered because its
+// output was up to date.
+func recordUpToDate(pair renderPair) {
+	reportEntries = append(reportEntries, &reportEntry{
+		Name:     pair.docName(),
+		SVGName:  pair.svgName,
+		Variant:  pair.variant,
+		OK:       true,
+		UpToDate: true,
+	})
+}
+
+// recordSkipped records that pair wasn't rendered, for reason.
+func recordSkipped(pair renderPair, reason string) {
+	reportEntries = append(reportEntries, &reportEntry{
+		Name:    pair.docName(),
+		SVGName: pair.svgName,
+		Variant: pair.variant,
+		OK:      true,
+		Skipped: reason,
+	})
+}
+
+// findReportEntry returns the entry for the document name, or nil
+// if it hasn't been rendered.
+func findReportEntry(name string) *reportEntry {
+	for _, e := range reportEntries {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// writeReports writes the -sarif log, the -report-html report, and
+// the -record session, for whichever are set.  It's called at the
+// end of a run, and before exiting on a fatal per-document error.
+func writeReports() {
+	writeSARIF()
+	writeHTMLReport()
+	writeRecording()
+}
+
+var reportTmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms":   func(d time.Duration) int64 { return d.Milliseconds() },
+	"join": strings.Join,
+	"output": func(state string) string {
+		return map[string]string{
+			outputKeptOld:     "old output kept",
+			outputRemoved:     "output removed",
+			outputPlaceholder: "placeholder written",
+		}[state]
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mermaid-cli report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { cursor: pointer; background: #eee; }
+td.num { text-align: right; }
+tr.failed { background: #fee; }
+tr.skipped { color: #888; }
+pre { margin: 0; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>mermaid-cli report</h1>
+<p>{{.Total}} documents, {{.Failed}} failed,{{if .NotAttempted}} {{.NotAttempted}} not attempted,{{end}}{{if .Skipped}} {{.Skipped}} skipped,{{end}} {{ms .Duration}}ms, {{.Size}} bytes of SVG.  Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}} by mermaid-cli {{.Version}} with MermaidJS {{.MermaidVersion}}.</p>
+{{range .Groups}}{{if .Variant}}<h2>{{.Variant}}</h2>
+{{end}}<table class="report">
+<thead>
+<tr><th>Document</th><th>Status</th><th>Type</th><th>Duration (ms)</th><th>Size (bytes)</th><th>Output</th></tr>
+</thead>
+<tbody>
+{{range .Entries}}<tr{{if or .NotAttempted .Skipped}} class="skipped"{{else if not .OK}} class="failed"{{end}}>
+<td>{{.Name}}</td>
+<td>{{if .UpToDate}}up to date{{else if .Skipped}}skipped: {{.Skipped}}{{else if .OK}}ok{{if .Duplicates}}, same as {{join .Duplicates ", "}}{{end}}{{else if .NotAttempted}}not attempted{{else}}failed{{with output .Output}} ({{.}}){{end}}<pre>{{.Error}}</pre>{{end}}</td>
+<td>{{.Type}}</td>
+<td class="num" data-sort="{{ms .Duration}}">{{ms .Duration}}</td>
+<td class="num" data-sort="{{.Size}}">{{.Size}}</td>
+<td>{{if or (and .OK (not .Skipped)) (eq .Output "placeholder")}}<a href="{{.Link}}">{{.SVGName}}</a>{{end}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+{{end}}<script>
+document.querySelectorAll('table.report th').forEach((th) => {
+	const col = th.cellIndex;
+	let asc = true;
+	th.addEventListener('click', () => {
+		const tbody = th.closest('table').tBodies[0];
+		const key = (tr) => {
+			const td = tr.children[col];
+			return td.dataset.sort !== undefined ? Number(td.dataset.sort) : td.textContent;
+		};
+		const rows = Array.from(tbody.rows).sort((a, b) => {
+			const ka = key(a), kb = key(b);
+			return (ka < kb ? -1 : ka > kb ? 1 : 0) * (asc ? 1 : -1);
+		});
+		asc = !asc;
+		rows.forEach((tr) => tbody.appendChild(tr));
+	});
+});
+</script>
+</body>
+</html>
+`))
+
+// writeHTMLReport writes the report of the documents rendered so
+// far to the -report-html file, if it's set: a single page with a
+// sortable table of the documents, one for each -matrix variant,
+// and the totals.
+func writeHTMLReport() {
+	if *reportHTMLFlag == "" {
+		return
+	}
+
+	type entry struct {
+		*reportEntry
+		Link string
+	}
+	// With -matrix, there's a table per variant, in the order they
+	// rendered.
+	type group struct {
+		Variant string
+		Entries []entry
+	}
+	data := struct {
+		Total, Failed, Size     int
+		NotAttempted, Skipped   int
+		Duration                time.Duration
+		Generated               time.Time
+		Version, MermaidVersion string
+		Groups                  []*group
+	}{
+		Generated: artifactTime(),
+		Version:   version,
+	}
+	if mainRenderer != nil {
+		data.MermaidVersion = mainRenderer.Version()
+	}
+	for _, e := range reportEntries {
+		data.Total++
+		switch {
+		case e.NotAttempted:
+			data.NotAttempted++
+		case e.Skipped != "":
+			data.Skipped++
+		case !e.OK:
+			data.Failed++
+		}
+		data.Size += e.Size
+		data.Duration += e.Duration
+
+		i := slices.IndexFunc(data.Groups, func(g *group) bool { return g.Variant == e.Variant })
+		if i < 0 {
+			i = len(data.Groups)
+			data.Groups = append(data.Groups, &group{Variant: e.Variant})
+		}
+		g := data.Groups[i]
+		g.Entries = append(g.Entries, entry{e, reportLink(e.SVGName)})
+	}
+
+	var b strings.Builder
+	if err := reportTmpl.Execute(&b, data); err != nil {
+		fatalf("couldn't write report: %v", err)
+	}
+	if err := writeFileAtomic(*reportHTMLFlag, encodeOutput([]byte(b.String())), 0644); err != nil {
+		fatalf("couldn't write report: %v", err)
+	}
+}
+
+// reportLink returns the link to the SVG name from the -report-html
+// file: a relative path if there is one, or else name as is.
+func reportLink(name string) string {
+	dir, err := filepath.Abs(filepath.Dir(*reportHTMLFlag))
+	if err != nil {
+		return filepath.ToSlash(name)
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return filepath.ToSlash(name)
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return filepath.ToSlash(name)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// resetReports clears the failures and report entries until t is
+// done.
+func resetReports(t *testing.T) {
+	failures, reportEntries = nil, nil
+	t.Cleanup(func() { failures, reportEntries = nil, nil })
+}
+
+// failRender records pair as failing to render with err, as
+// finishRender does, and that its output was left in state.
+func failRender(pair renderPair, err error, state string) {
+	recordRender(pair, time.Now(), renderer.RenderResult{}, err)
+	fileErrorf(pair.mmdName, err, "couldn't render %s: %v", pair.docName(), err)
+	recordFailedOutput(pair, state)
+}
+
+func TestRecordFailedOutput(t *testing.T) {
+	resetReports(t)
+	pairs := []renderPair{
+		{mmdName: "a.mmd", svgName: "a.svg"},
+		{mmdName: "b.mmd", svgName: "b.svg"},
+		{mmdName: "c.mmd", svgName: "c.svg"},
+	}
+	states := []string{outputKeptOld, outputRemoved, outputPlaceholder}
+	for i, pair := range pairs {
+		failRender(pair, errors.New("boom"), states[i])
+	}
+
+	for i, pair := range pairs {
+		if e := findReportEntry(pair.docName()); e == nil || e.Output != states[i] {
+			t.Errorf("report entry of %s = %+v, want output %s", pair.mmdName, e, states[i])
+		}
+	}
+	log := newSARIFLog(failures, "")
+	for i, res := range log.Runs[0].Results {
+		if got := res.Properties["output"]; got != states[i] {
+			t.Errorf("SARIF result %d has output %q, want %q", i, got, states[i])
+		}
+	}
+}
+
+func TestHTMLReportFailedOutput(t *testing.T) {
+	resetReports(t)
+	dir := chdirTemp(t, nil)
+	setFlag(t, "report-html", filepath.Join(dir, "report.html"))
+	failRender(renderPair{mmdName: "a.mmd", svgName: "a.svg"}, errors.New("boom"), outputRemoved)
+	failRender(renderPair{mmdName: "b.mmd", svgName: "b.svg"}, errors.New("bang"), outputPlaceholder)
+
+	writeHTMLReport()
+	b, err := os.ReadFile("report.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(b)
+	for _, want := range []string{"failed (output removed)", "failed (placeholder written)", `<a href="b.svg">b.svg</a>`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("report doesn't have %q", want)
+		}
+	}
+	if strings.Contains(page, `<a href="a.svg">`) {
+		t.Error("report links to a removed output")
+	}
+}
+
+func TestHTMLReportVariants(t *testing.T) {
+	resetReports(t)
+	dir := chdirTemp(t, nil)
+	setFlag(t, "report-html", filepath.Join(dir, "report.html"))
+	for _, pair := range []renderPair{
+		{mmdName: "a.mmd", svgName: "light/a.svg", variant: "light"},
+		{mmdName: "a.mmd", svgName: "dark/a.svg", variant: "dark"},
+		{mmdName: "b.mmd", svgName: "light/b.svg", variant: "light"},
+		{mmdName: "b.mmd", svgName: "dark/b.svg", variant: "dark"},
+	} {
+		recordRender(pair, time.Now(), renderer.RenderResult{SVG: "<svg></svg>"}, nil)
+	}
+	if e := findReportEntry("a.mmd [dark]"); e == nil || e.Variant != "dark" {
+		t.Errorf("report entry of a.mmd [dark] = %+v, want variant dark", e)
+	}
+
+	writeHTMLReport()
+	b, err := os.ReadFile("report.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(b)
+	if n := strings.Count(page, `<table class="report">`); n != 2 {
+		t.Errorf("report has %d tables, want 2", n)
+	}
+	// Each variant's heading is followed by its own documents, and
+	// only those.
+	light, dark := strings.Index(page, "<h2>light</h2>"), strings.Index(page, "<h2>dark</h2>")
+	if light < 0 || dark < light {
+		t.Fatalf("report doesn't have the light then dark headings:\n%s", page)
+	}
+	for _, name := range []string{"light/a.svg", "light/b.svg"} {
+		if i := strings.Index(page, name); i < light || i > dark {
+			t.Errorf("%s isn't under the light heading", name)
+		}
+	}
+	for _, name := range []string{"dark/a.svg", "dark/b.svg"} {
+		if i := strings.Index(page, name); i < dark {
+			t.Errorf("%s isn't under the dark heading", name)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+)
+
+// fileFailure is a document that failed, as recorded by
+// fileErrorf.
+type fileFailure struct {
+	name  string
+	cause error
+
+	// output is what became of the document's output, if it failed
+	// to render (see reportEntry.Output).
+	output string
+}
+
+// failures are all the failures reported with fileErrorf, in the
+// order they happened.
+var failures []fileFailure
+
+// The subset of SARIF 2.1.0 (https://docs.oasis-open.org/sarif/sarif/v2.1.0/)
+// that the -sarif log uses.
+type (
+	sarifLog struct {
+		Version string     `json:"version"`
+		Schema  string     `json:"$schema"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string            `json:"name"`
+		Version        string            `json:"version"`
+		InformationURI string            `json:"informationUri"`
+		Rules          []sarifRule       `json:"rules"`
+		Properties     map[string]string `json:"properties,omitempty"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifResult struct {
+		RuleID     string            `json:"ruleId"`
+		Level      string            `json:"level"`
+		Message    sarifMessage      `json:"message"`
+		Locations  []sarifLocation   `json:"locations"`
+		Properties map[string]string `json:"properties,omitempty"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           sarifRegion           `json:"region"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn"`
+	}
+)
+
+// sarifRuleID is the one rule every result is for: the document
+// failed.
+const sarifRuleID = "mermaid-document-failed"
+
+// newSARIFLog returns a SARIF log with a result for each of
+// failures, from a run with MermaidJS mermaidVersion ("" if it's
+// unknown).  Results with no position are at 1:1, since SARIF
+// requires lines and columns to be positive.  A result for a
+// document that failed to render says what became of its output
+// in its "output" property.
+func newSARIFLog(failures []fileFailure, mermaidVersion string) sarifLog {
+	driver := sarifDriver{
+		Name:           "mermaid-cli",
+		Version:        version,
+		InformationURI: "https://github.com/zacharysyoung/go-mermaid-cli",
+		Rules: []sarifRule{{
+			ID:               sarifRuleID,
+			ShortDescription: sarifMessage{"MermaidJS document failed to parse or render"},
+		}},
+	}
+	if mermaidVersion != "" {
+		driver.Properties = map[string]string{"mermaidVersion": mermaidVersion}
+	}
+
+	results := make([]sarifResult, 0, len(failures))
+	for _, f := range failures {
+		line, col := errorPosition(f.cause)
+		var props map[string]string
+		if f.output != "" {
+			props = map[string]string{"output": f.output}
+		}
+		results = append(results, sarifResult{
+			RuleID:  sarifRuleID,
+			Level:   "error",
+			Message: sarifMessage{oneLineMessage(f.cause)},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(f.name)},
+					Region:           sarifRegion{StartLine: max(line, 1), StartColumn: max(col, 1)},
+				},
+			}},
+			Properties: props,
+		})
+	}
+
+	return sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+}
+
+// writeSARIF writes the SARIF log of the failures so far to the
+// -sarif file, if it's set.
+func writeSARIF() {
+	if *sarifFlag == "" {
+		return
+	}
+	var mermaidVersion string
+	if mainRenderer != nil {
+		mermaidVersion = mainRenderer.Version()
+	}
+	b, err := json.MarshalIndent(newSARIFLog(failures, mermaidVersion), "", "  ")
+	if err != nil {
+		fatalf("encode SARIF: %v", err)
+	}
+	if err := writeFileAtomic(*sarifFlag, append(b, '\n'), 0644); err != nil {
+		fatalf("couldn't write SARIF: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// sarifFailures are three failures: a parse error with a position,
+// an error that names only a line, and one that says nowhere.
+var sarifFailures = []fileFailure{
+	{
+		name: filepath.Join("docs", "flow.mmd"),
+		cause: &renderer.ParseError{
+			Line: 3, Column: 7,
+			Message: "Parse error on line 3:\n...A --> \n------^\nExpecting 'NODE_STRING', got 'EOF'",
+		},
+	},
+	{name: "seq.mmd", cause: errors.New("lexical error on line 4")},
+	{name: "README.md", cause: errors.New("timed out")},
+}
+
+// writeTestSARIF writes the -sarif log of sarifFailures, as
+// version v1.2.3, and returns it.
+func writeTestSARIF(t *testing.T) []byte {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "out.sarif")
+	oldFlag, oldVersion, oldFailures := *sarifFlag, version, failures
+	t.Cleanup(func() { *sarifFlag, version, failures = oldFlag, oldVersion, oldFailures })
+	*sarifFlag, version, failures = name, "v1.2.3", sarifFailures
+
+	writeSARIF()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestWriteSARIFGolden(t *testing.T) {
+	got := writeTestSARIF(t)
+	goldenName := filepath.Join("testdata", "sarif", "failures.sarif")
+	want, err := os.ReadFile(goldenName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := mermaidtest.Diff(goldenName, string(want), "-sarif", string(got)); diff != "" {
+		t.Errorf("-sarif log differs:\n%s", diff)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var log struct {
+		Version string `json:"version"`
+		Schema  string `json:"$schema"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name    string `json:"name"`
+					Version string `json:"version"`
+					Rules   []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine   int `json:"startLine"`
+							StartColumn int `json:"startColumn"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(writeTestSARIF(t), &log); err != nil {
+		t.Fatal(err)
+	}
+
+	if log.Version != "2.1.0" {
+		t.Errorf("version = %q, want 2.1.0", log.Version)
+	}
+	if log.Schema != "https://json.schemastore.org/sarif-2.1.0.json" {
+		t.Errorf("$schema = %q, want SARIF 2.1.0's", log.Schema)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("%d runs, want 1", len(log.Runs))
+	}
+	run := log.Runs[0]
+	driver := run.Tool.Driver
+	if driver.Name != "mermaid-cli" || driver.Version != "v1.2.3" {
+		t.Errorf("driver = %s %s, want mermaid-cli v1.2.3", driver.Name, driver.Version)
+	}
+	if len(driver.Rules) != 1 || driver.Rules[0].ID != sarifRuleID {
+		t.Errorf("driver rules = %+v, want just %s", driver.Rules, sarifRuleID)
+	}
+
+	want := []struct {
+		uri       string
+		line, col int
+	}{
+		{"docs/flow.mmd", 3, 7},
+		{"seq.mmd", 4, 1},
+		{"README.md", 1, 1},
+	}
+	if len(run.Results) != len(want) {
+		t.Fatalf("%d results, want one per failed file, %d", len(run.Results), len(want))
+	}
+	for i, res := range run.Results {
+		if res.RuleID != sarifRuleID || res.Level != "error" {
+			t.Errorf("result %d is a %s %s, want an error for %s", i, res.RuleID, res.Level, sarifRuleID)
+		}
+		if len(res.Locations) != 1 {
+			t.Errorf("result %d has %d locations, want 1", i, len(res.Locations))
+			continue
+		}
+		loc := res.Locations[0].PhysicalLocation
+		if loc.ArtifactLocation.URI != want[i].uri || loc.Region.StartLine != want[i].line || loc.Region.StartColumn != want[i].col {
+			t.Errorf("result %d is at %s:%d:%d, want %s:%d:%d", i,
+				loc.ArtifactLocation.URI, loc.Region.StartLine, loc.Region.StartColumn,
+				want[i].uri, want[i].line, want[i].col)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	scopeStyleRE   = regexp.MustCompile(`(?s)(<style[^>]*>)(.*?)(</style>)`)
+	scopeIDRE      = regexp.MustCompile(`(\s)id="([^"]+)"`)
+	scopeClassRE   = regexp.MustCompile(`(\s)class="([^"]*)"`)
+	scopeAriaRE    = regexp.MustCompile(`(\s)(aria-labelledby|aria-describedby)="([^"]*)"`)
+	scopeRefRE     = regexp.MustCompile(`(url\(\s*['"]?#|href="#)([^)'"\s]+)`)
+	selectorNameRE = regexp.MustCompile(`([.#])(-?[_a-zA-Z\x{80}-\x{10FFFF}][-\w\x{80}-\x{10FFFF}]*)`)
+
+	// scopePrefixRE is what -scope-prefix accepts: the start of a
+	// CSS identifier.
+	scopePrefixRE = regexp.MustCompile(`^-?[_a-zA-Z][-\w]*$`)
+)
+
+// scopeSVG returns svgResult with prefix added to every class name
+// and id, and consistently to everything that refers to them: the
+// selectors in its style blocks, url(#...) and href="#..."
+// references, and aria id lists.  Two scoped SVGs inlined in one
+// page then can't style each other's nodes, or be styled by the
+// page's own .node or .cluster rules.
+func scopeSVG(svgResult, prefix string) string {
+	ids := make(map[string]bool)
+	for _, m := range scopeIDRE.FindAllStringSubmatch(svgResult, -1) {
+		ids[m[2]] = true
+	}
+
+	// Styles and markup are rewritten separately, since a class
+	// name in a style block is a selector, not an attribute.
+	var b strings.Builder
+	last := 0
+	for _, m := range scopeStyleRE.FindAllStringSubmatchIndex(svgResult, -1) {
+		b.WriteString(scopeMarkup(svgResult[last:m[0]], prefix, ids))
+		b.WriteString(svgResult[m[2]:m[3]])
+		b.WriteString(scopeCSS(svgResult[m[4]:m[5]], prefix, ids))
+		b.WriteString(svgResult[m[6]:m[7]])
+		last = m[1]
+	}
+	b.WriteString(scopeMarkup(svgResult[last:], prefix, ids))
+	return b.String()
+}
+
+// scopeMarkup prefixes the ids, classes, and id references in the
+// attributes of markup.  References are only rewritten for ids in
+// ids, i.e., ones the SVG itself defines.
+func scopeMarkup(markup, prefix string, ids map[string]bool) string {
+	markup = scopeIDRE.ReplaceAllString(markup, `${1}id="`+prefix+`${2}"`)
+	markup = scopeClassRE.ReplaceAllStringFunc(markup, func(s string) string {
+		m := scopeClassRE.FindStringSubmatch(s)
+		classes := strings.Fields(m[2])
+		for i, class := range classes {
+			classes[i] = prefix + class
+		}
+		return m[1] + `class="` + strings.Join(classes, " ") + `"`
+	})
+	markup = scopeAriaRE.ReplaceAllStringFunc(markup, func(s string) string {
+		m := scopeAriaRE.FindStringSubmatch(s)
+		refs := strings.Fields(m[3])
+		for i, ref := range refs {
+			if ids[ref] {
+				refs[i] = prefix + ref
+			}
+		}
+		return m[1] + m[2] + `="` + strings.Join(refs, " ") + `"`
+	})
+	return scopeRefs(markup, prefix, ids)
+}
+
+// scopeRefs prefixes the url(#...) and href="#..." references in
+// s to ids in ids.
+func scopeRefs(s, prefix string, ids map[string]bool) string {
+	return scopeRefRE.ReplaceAllStringFunc(s, func(ref string) string {
+		m := scopeRefRE.FindStringSubmatch(ref)
+		if !ids[m[2]] {
+			return ref
+		}
+		return m[1] + prefix + m[2]
+	})
+}
+
+// scopeCSS prefixes the class and id selectors in the style sheet
+// css, and the url(#...) references to ids in its declarations.
+//
+// It walks the rules, so only selectors are rewritten: a color
+// like #fff or a number like .5 in a declaration is left alone.
+// The rules inside @media and @supports are rewritten too; other
+// at-rules' blocks (@keyframes, @font-face) are copied as is,
+// except for their url(#...) references.
+func scopeCSS(css, prefix string, ids map[string]bool) string {
+	var (
+		b       strings.Builder
+		prelude strings.Builder
+	)
+	for i := 0; i < len(css); {
+		switch {
+		case strings.HasPrefix(css[i:], "/*"):
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				end = len(css)
+			} else {
+				end += i + 4
+			}
+			b.WriteString(css[i:end]) // not part of any selector
+			i = end
+		case css[i] == '{':
+			p := prelude.String()
+			prelude.Reset()
+			at := strings.TrimSpace(p)
+			end := matchingBrace(css, i)
+			body := css[i+1 : end]
+			switch {
+			case strings.HasPrefix(at, "@media"), strings.HasPrefix(at, "@supports"):
+				b.WriteString(p + "{" + scopeCSS(body, prefix, ids) + "}")
+			case strings.HasPrefix(at, "@"):
+				b.WriteString(p + "{" + scopeRefs(body, prefix, ids) + "}")
+			default:
+				b.WriteString(scopeSelectors(p, prefix) + "{" + scopeRefs(body, prefix, ids) + "}")
+			}
+			i = min(end+1, len(css))
+		case css[i] == ';' || css[i] == '}':
+			// The end of a statement at-rule like @import, or a
+			// stray brace: nothing to scope.
+			b.WriteString(prelude.String())
+			b.WriteByte(css[i])
+			prelude.Reset()
+			i++
+		default:
+			prelude.WriteByte(css[i])
+			i++
+		}
+	}
+	b.WriteString(prelude.String())
+	return b.String()
+}
+
+// matchingBrace returns the index of the } that closes the { at
+// css[open], or len(css) if it isn't closed.
+func matchingBrace(css string, open int) int {
+	depth := 0
+	for i := open; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(css)
+}
+
+// scopeSelectors prefixes the class and id selectors in the
+// selector list sel, leaving attribute selectors' values alone.
+func scopeSelectors(sel, prefix string) string {
+	var b strings.Builder
+	for len(sel) > 0 {
+		open := strings.IndexByte(sel, '[')
+		if open < 0 {
+			b.WriteString(selectorNameRE.ReplaceAllString(sel, "${1}"+prefix+"${2}"))
+			break
+		}
+		close := strings.IndexByte(sel[open:], ']')
+		if close < 0 {
+			close = len(sel) - 1 - open
+		}
+		b.WriteString(selectorNameRE.ReplaceAllString(sel[:open], "${1}"+prefix+"${2}"))
+		b.WriteString(sel[open : open+close+1])
+		sel = sel[open+close+1:]
+	}
+	return b.String()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// scopeTestSVG is a flowchart's SVG as MermaidJS draws it, trimmed:
+// two renders of it have the same ids and classes.
+const scopeTestSVG = `<svg id="mermaid-1" xmlns="http://www.w3.org/2000/svg" aria-labelledby="chart-title-mermaid-1">` +
+	`<title id="chart-title-mermaid-1">Flow</title>` +
+	`<style>#mermaid-1{font-family:sans-serif;fill:#333;}` +
+	`#mermaid-1 .node rect{fill:#fff;stroke-width:.5px;}` +
+	`#mermaid-1 .cluster > .label, #mermaid-1 .node:hover{color:#f00;}` +
+	`#mermaid-1 .marker{fill:url(#grad-1);}` +
+	`#mermaid-1 [data-look="neo"].node{stroke:url(#external);}` +
+	`@media (min-width: 10px){#mermaid-1 .edgePath .path{stroke:#000;}}` +
+	`@keyframes dash{to{stroke-dashoffset:0;}}</style>` +
+	`<defs><linearGradient id="grad-1"/><marker id="arrowhead" class="marker"/></defs>` +
+	`<g class="cluster"><g class="label">Group</g>` +
+	`<g class="nodes"><g class="node default" id="flowchart-A-0" data-look="neo"><rect/></g></g></g>` +
+	`<g class="edgePath"><path class="path" marker-end="url(#arrowhead)"/></g>` +
+	`<use href="#flowchart-A-0"/>` +
+	`</svg>`
+
+// svgNames returns the ids and classes of the elements in svg.
+func svgNames(t *testing.T, svg string) (ids, classes map[string]bool) {
+	t.Helper()
+	ids, classes = make(map[string]bool), make(map[string]bool)
+	d := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return ids, classes
+		}
+		if err != nil {
+			t.Fatalf("scoped SVG doesn't parse: %v", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range se.Attr {
+			switch attr.Name.Local {
+			case "id":
+				ids[attr.Value] = true
+			case "class":
+				for _, class := range strings.Fields(attr.Value) {
+					classes[class] = true
+				}
+			}
+		}
+	}
+}
+
+// cssSelectorRE matches a rule's selector list, up to its {.
+var cssSelectorRE = regexp.MustCompile(`([^{};]+)\{`)
+
+// svgSelectors returns the selector lists in svg's style blocks,
+// skipping at-rules' preludes.
+func svgSelectors(svg string) []string {
+	var sels []string
+	for _, style := range scopeStyleRE.FindAllStringSubmatch(svg, -1) {
+		for _, m := range cssSelectorRE.FindAllStringSubmatch(style[2], -1) {
+			if sel := strings.TrimSpace(m[1]); !strings.HasPrefix(sel, "@") {
+				sels = append(sels, sel)
+			}
+		}
+	}
+	return sels
+}
+
+// TestScopeSVGInlined inlines two scoped renders of the same
+// diagram, as in one HTML page, and checks each one's selectors
+// only name its own ids and classes.  A selector needs every class
+// and id it names to match an element, so none can match the other
+// diagram's nodes, or be matched by the page's own .node rules.
+func TestScopeSVGInlined(t *testing.T) {
+	svgs := map[string]string{
+		"a-": scopeSVG(scopeTestSVG, "a-"),
+		"b-": scopeSVG(scopeTestSVG, "b-"),
+	}
+	names := make(map[string][2]map[string]bool)
+	for prefix, svg := range svgs {
+		ids, classes := svgNames(t, svg)
+		names[prefix] = [2]map[string]bool{ids, classes}
+		for name := range ids {
+			if !strings.HasPrefix(name, prefix) {
+				t.Errorf("%s SVG has unscoped id %q", prefix, name)
+			}
+		}
+		for name := range classes {
+			if !strings.HasPrefix(name, prefix) {
+				t.Errorf("%s SVG has unscoped class %q", prefix, name)
+			}
+		}
+	}
+
+	for prefix, svg := range svgs {
+		sels := svgSelectors(svg)
+		if len(sels) == 0 {
+			t.Fatalf("%s SVG has no selectors", prefix)
+		}
+		for _, sel := range sels {
+			named := false
+			for _, m := range selectorNameRE.FindAllStringSubmatch(sel, -1) {
+				named = true
+				set := 1 // classes
+				if m[1] == "#" {
+					set = 0
+				}
+				for other, n := range names {
+					switch in := n[set][m[2]]; {
+					case other == prefix && !in:
+						t.Errorf("%s SVG's selector %q names %s%s, which isn't in it", prefix, sel, m[1], m[2])
+					case other != prefix && in:
+						t.Errorf("%s SVG's selector %q names %s%s, which is in the %s SVG", prefix, sel, m[1], m[2], other)
+					}
+				}
+			}
+			if !named && sel != "to" {
+				t.Errorf("%s SVG's selector %q names no id or class", prefix, sel)
+			}
+		}
+	}
+}
+
+func TestScopeSVG(t *testing.T) {
+	got := scopeSVG(scopeTestSVG, "a-")
+	for _, want := range []string{
+		// Descendant, child, and compound selectors.
+		`#a-mermaid-1 .a-node rect{fill:#fff;stroke-width:.5px;}`,
+		`#a-mermaid-1 .a-cluster > .a-label, #a-mermaid-1 .a-node:hover{color:#f00;}`,
+		`@media (min-width: 10px){#a-mermaid-1 .a-edgePath .a-path{stroke:#000;}}`,
+		// Attribute selectors' values are left alone.
+		`#a-mermaid-1 [data-look="neo"].a-node{`,
+		// References to the SVG's own ids, in CSS and markup.
+		`fill:url(#a-grad-1);`,
+		`marker-end="url(#a-arrowhead)"`,
+		`href="#a-flowchart-A-0"`,
+		`aria-labelledby="a-chart-title-mermaid-1"`,
+		// A reference to an id the SVG doesn't define is left
+		// alone, as are @keyframes.
+		`stroke:url(#external);`,
+		`@keyframes dash{to{stroke-dashoffset:0;}}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("scoped SVG doesn't have %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestScopeCSSComments(t *testing.T) {
+	const css = `/* .node { } */ .node{fill:#fff}`
+	want := `/* .node { } */ .p-node{fill:#fff}`
+	if got := scopeCSS(css, "p-", nil); got != want {
+		t.Errorf("scopeCSS(%q) = %q, want %q", css, got, want)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// previewServer serves watch mode's outputs over HTTP, for -serve:
+// an index page of the documents, each output at its own path,
+// e.g., /docs/flow.svg, and server-sent events at /events that
+// tell the index page to reload when an output is rendered again.
+type previewServer struct {
+	srv  *http.Server
+	addr string // as bound, e.g., 127.0.0.1:8080
+
+	mu      sync.Mutex
+	docs    []*previewDoc          // in the order they're watched
+	outputs map[string]*previewDoc // by URL path
+	clients map[chan string]bool   // the index pages listening for events
+	done    chan struct{}          // closed when the server shuts down
+}
+
+// previewDoc is a document as the index page lists it.
+type previewDoc struct {
+	Name, URL, Format string
+	Err               string // the last render's error, or ""
+	Rendered          time.Time
+	output            string // the output's file
+}
+
+// startPreviewServer starts serving the outputs of pairs at addr,
+// e.g., :8080 or localhost:8080.
+func startPreviewServer(addr string, pairs []renderPair) (*previewServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &previewServer{
+		addr:    ln.Addr().String(),
+		outputs: make(map[string]*previewDoc),
+		clients: make(map[chan string]bool),
+		done:    make(chan struct{}),
+	}
+	for _, pair := range pairs {
+		s.doc(pair)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", s.serveIndex)
+	mux.HandleFunc("/events", s.serveEvents)
+	mux.HandleFunc("/", s.serveOutput)
+	s.srv = &http.Server{Handler: mux}
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errorf("preview server: %v", err)
+		}
+	}()
+	return s, nil
+}
+
+// URL returns the index page's URL, with localhost for a server
+// listening on every address.
+func (s *previewServer) URL() string {
+	host, port, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return "http://" + s.addr + "/"
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/"
+}
+
+// outputURL returns the URL path pair's output is served at: its
+// path, with slashes, under /.
+func outputURL(svgName string) string {
+	return path.Clean("/" + filepath.ToSlash(svgName))
+}
+
+// doc returns the previewDoc of pair, adding it if it's new.  It
+// must be called with s.mu held, or before the server starts.
+func (s *previewServer) doc(pair renderPair) *previewDoc {
+	url := outputURL(pair.svgName)
+	if d, ok := s.outputs[url]; ok {
+		return d
+	}
+	d := &previewDoc{Name: pair.docName(), URL: url, Format: *formatFlag, output: pair.svgName}
+	s.docs = append(s.docs, d)
+	s.outputs[url] = d
+	return d
+}
+
+// rendered records that pair was rendered, with err if it failed,
+// and tells the index pages listening.
+func (s *previewServer) rendered(pair renderPair, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.doc(pair)
+	d.Rendered, d.Err = time.Now(), ""
+	if err != nil {
+		d.Err = oneLineMessage(err)
+	}
+	for c := range s.clients {
+		select {
+		case c <- d.URL:
+		default: // it has an event to read already
+		}
+	}
+}
+
+var previewIndexTmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mermaid-cli preview</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+section { margin-bottom: 2em; }
+h2 { font-size: 1em; }
+.error { color: #b00; white-space: pre-wrap; }
+img { max-width: 100%; border: 1px solid #ddd; }
+</style>
+</head>
+<body>
+<h1>mermaid-cli preview</h1>
+{{range .}}
+<section>
+<h2><a href="{{.URL}}">{{.Name}}</a></h2>
+{{if .Err}}<p class="error">{{.Err}}</p>{{end}}
+{{if eq .Format "pdf"}}<p><a href="{{.URL}}">PDF</a></p>{{else}}<img src="{{.URL}}?t={{.Rendered.UnixNano}}" alt="{{.Name}}">{{end}}
+</section>
+{{else}}
+<p>No documents.</p>
+{{end}}
+<script>
+new EventSource('/events').onmessage = () => location.reload();
+</script>
+</body>
+</html>
+`))
+
+func (s *previewServer) serveIndex(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	docs := make([]previewDoc, len(s.docs))
+	for i, d := range s.docs {
+		docs[i] = *d
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := previewIndexTmpl.Execute(w, docs); err != nil {
+		log.Printf("preview server: %v", err)
+	}
+}
+
+// serveEvents sends the client an event, whose data is the output's
+// URL, each time an output is rendered, until it goes away or the
+// server shuts down.
+func (s *previewServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	c := make(chan string, 1)
+	s.mu.Lock()
+	s.clients[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	flusher.Flush()
+	for {
+		select {
+		case url := <-c:
+			fmt.Fprintf(w, "data: %s\n\n", url)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// serveOutput serves the output at the request's path.  Only the
+// outputs of the documents being watched are served, not whatever
+// else is on disk.
+func (s *previewServer) serveOutput(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	d, ok := s.outputs[path.Clean(r.URL.Path)]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(d.output)
+	if err != nil {
+		http.Error(w, "not rendered yet", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, d.output, fi.ModTime(), f)
+}
+
+// Close ends the event streams and shuts the server down, giving
+// requests in flight a few seconds to finish.
+func (s *previewServer) Close() {
+	close(s.done)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		errorf("preview server: %v", err)
+	}
+	log.Println("stopped preview server")
+}
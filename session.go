@@ -0,0 +1,249 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// sessionManifestName is the name of a -record session's manifest
+// in its tar file.
+const sessionManifestName = "session.json"
+
+// sessionManifest describes a -record session: what recorded it,
+// and each render, whose JavaScript, source, and SVG are files of
+// their own in the tar file, e.g., renders/3.js.
+type sessionManifest struct {
+	Version        string          `json:"version"`
+	Args           []string        `json:"args"`
+	Recorded       time.Time       `json:"recorded"`
+	MermaidVersion string          `json:"mermaidVersion"`
+	BundleSHA256   string          `json:"bundleSHA256"`
+	Renders        []sessionRender `json:"renders"`
+}
+
+// sessionRender is one render of a -record session.
+type sessionRender struct {
+	Name string `json:"name"` // the document, e.g., README.md#2
+
+	// JS is the file of the JavaScript that rendered it, Source of
+	// the document as it went to MermaidJS, and SVG of the SVG, or
+	// "" if it failed with Error.
+	JS     string `json:"js"`
+	Source string `json:"source"`
+	SVG    string `json:"svg,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// Config is the config MermaidJS was initialized with, which
+	// the document's own config went over.
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// recording is the -record session so far, or nil if there's no
+// -record.  Renders in a pool's tabs record concurrently.
+var recording *sessionRecording
+
+type sessionRecording struct {
+	mu       sync.Mutex
+	manifest sessionManifest
+	files    map[string][]byte
+}
+
+// startRecording starts the -record session, for renders with r.
+func startRecording(r *renderer.Renderer) {
+	recording = &sessionRecording{
+		manifest: sessionManifest{
+			Version:        version,
+			Args:           os.Args[1:],
+			Recorded:       artifactTime().UTC(),
+			MermaidVersion: r.Version(),
+			BundleSHA256:   bundleSum(),
+		},
+		files: make(map[string][]byte),
+	}
+}
+
+// bundleSum returns the SHA-256 of the MermaidJS bundle the flags
+// load, in hex.
+func bundleSum() string {
+	bundle, err := readMermaidJS()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	sum := sha256.Sum256(bundle)
+	return hex.EncodeToString(sum[:])
+}
+
+// record adds the render of the document name, whose source went to
+// MermaidJS as src, with r, to the session, if there is one.
+func (s *sessionRecording) record(r *renderer.Renderer, name, src, svgResult string, err error) {
+	if s == nil {
+		return
+	}
+	config, configErr := r.InitConfig(runCtx)
+	if configErr != nil {
+		log.Printf("couldn't record the config %s rendered with: %v", name, configErr)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.manifest.Renders) + 1
+	rec := sessionRender{
+		Name:   name,
+		JS:     fmt.Sprintf("renders/%d.js", n),
+		Source: fmt.Sprintf("renders/%d.mmd", n),
+	}
+	if config != "" {
+		rec.Config = json.RawMessage(config)
+	}
+	s.files[rec.JS] = []byte(r.RenderScript(src))
+	s.files[rec.Source] = []byte(src)
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.SVG = fmt.Sprintf("renders/%d.svg", n)
+		s.files[rec.SVG] = []byte(svgResult)
+	}
+	s.manifest.Renders = append(s.manifest.Renders, rec)
+}
+
+// writeRecording writes the -record session to its tar file, if
+// there is one.
+func writeRecording() {
+	s := recording
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: s.manifest.Recorded}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	manifest, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err == nil {
+		err = add(sessionManifestName, append(manifest, '\n'))
+	}
+	for _, rec := range s.manifest.Renders {
+		for _, name := range []string{rec.JS, rec.Source, rec.SVG} {
+			if err == nil && name != "" {
+				err = add(name, s.files[name])
+			}
+		}
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = writeFileAtomic(*recordFlag, b.Bytes(), 0644)
+	}
+	if err != nil {
+		errorf("couldn't write session: %v", err)
+		return
+	}
+	log.Printf("recorded %d renders to %s", len(s.manifest.Renders), *recordFlag)
+}
+
+// readSession reads the -record session in the tar file name.
+func readSession(name string) (*sessionManifest, map[string][]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	files := make(map[string][]byte)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		files[hdr.Name] = b
+	}
+	b, ok := files[sessionManifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s has no %s; is it a -record session?", name, sessionManifestName)
+	}
+	var m sessionManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, nil, fmt.Errorf("%s: %s: %w", name, sessionManifestName, err)
+	}
+	return &m, files, nil
+}
+
+// replaySession evaluates each render recorded in the -record
+// session in the tar file name again, with a new renderer, after
+// initializing MermaidJS with the config it had, and compares the
+// result with the recorded one, printing the first difference to
+// Stdout for each render that diverged.  It reports whether every
+// render came out the same.
+func replaySession(name string) bool {
+	m, files, err := readSession(name)
+	if err != nil {
+		fatalf("couldn't read session: %v", err)
+	}
+	mainRenderer = newRenderer(rendererOptionsFromFlags()...)
+	fmt.Fprintf(os.Stderr, "replaying %d renders recorded %s by mermaid-cli %s %s\n",
+		len(m.Renders), m.Recorded.Format(time.RFC3339), m.Version, strings.Join(m.Args, " "))
+	if sum := bundleSum(); sum != m.BundleSHA256 {
+		warnf("recorded with MermaidJS %s (bundle %.12s), replaying with %s (bundle %.12s)",
+			m.MermaidVersion, m.BundleSHA256, mainRenderer.Version(), sum)
+	}
+
+	diverged := 0
+	for _, rec := range m.Renders {
+		if len(rec.Config) > 0 {
+			if err := mainRenderer.SetInitConfig(runCtx, string(rec.Config)); err != nil {
+				fatalf("couldn't restore the config %s rendered with: %v", rec.Name, err)
+			}
+		}
+		result, err := mainRenderer.RunRenderScript(runCtx, string(files[rec.JS]))
+		want, got := string(files[rec.SVG]), result.SVG
+		if rec.Error != "" {
+			want = "error: " + rec.Error
+		}
+		if err != nil {
+			got = "error: " + err.Error()
+		}
+		if got == want {
+			log.Println("same", rec.Name)
+			continue
+		}
+		diverged++
+		fmt.Print(mermaidtest.FirstDiff(
+			rec.Name+" (recorded)", mermaidtest.Lines(want),
+			rec.Name+" (replayed)", mermaidtest.Lines(got),
+		))
+		errorf("%s diverged from the recording", rec.Name)
+	}
+	if diverged > 0 {
+		errorf("%d of %d renders diverged", diverged, len(m.Renders))
+	}
+	return diverged == 0
+}
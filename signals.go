@@ -0,0 +1,34 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReload sends on c whenever the process gets SIGHUP.  A
+// send is dropped if c already has one pending.
+func notifyReload(c chan<- struct{}) {
+	notifySignal(c, syscall.SIGHUP)
+}
+
+// notifyStatus sends on c whenever the process gets SIGUSR1.  A
+// send is dropped if c already has one pending.
+func notifyStatus(c chan<- struct{}) {
+	notifySignal(c, syscall.SIGUSR1)
+}
+
+func notifySignal(c chan<- struct{}, sig os.Signal) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, sig)
+	go func() {
+		for range sigs {
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+	}()
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// notifyReload sends on c whenever a line of just "r" is read
+// from Stdin, since Windows has no SIGHUP.  A send is dropped if c
+// already has one pending.
+func notifyReload(c chan<- struct{}) {
+	go func() {
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			if strings.TrimSpace(sc.Text()) != "r" {
+				continue
+			}
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+	}()
+}
+
+// notifyStatus does nothing, since Windows has no SIGUSR1; use
+// -status-file instead.
+func notifyStatus(c chan<- struct{}) {}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// byteSize is a size in bytes that parses from a number with an
+// optional unit, e.g., 1MB, 512KiB, or 2000.
+type byteSize int64
+
+// byteUnits are the units byteSize accepts, longest first so
+// "KiB" isn't taken for "B".  The SI units are powers of 1000,
+// and the IEC units powers of 1024.
+var byteUnits = []struct {
+	suffix string
+	n      float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"K", 1e3}, {"M", 1e6}, {"G", 1e9},
+	{"B", 1},
+}
+
+func parseByteSize(s string) (byteSize, error) {
+	num, mult := strings.TrimSpace(s), 1.0
+	for _, u := range byteUnits {
+		if len(num) > len(u.suffix) && strings.EqualFold(num[len(num)-len(u.suffix):], u.suffix) {
+			num, mult = strings.TrimSpace(num[:len(num)-len(u.suffix)]), u.n
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("got size %q; expected a number of bytes, optionally with a unit like KB, MB, or MiB", s)
+	}
+	return byteSize(f * mult), nil
+}
+
+func (b *byteSize) String() string {
+	if b == nil || *b == 0 {
+		return ""
+	}
+	return formatByteSize(int64(*b))
+}
+
+func (b *byteSize) Set(s string) error {
+	n, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = n
+	return nil
+}
+
+// formatByteSize formats n bytes with an SI unit, to one decimal
+// place.
+func formatByteSize(n int64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fGB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fMB", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fKB", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// maxOutputSize returns the size budget for the SVG of the
+// document mmdSource: its front matter's maxOutputSize, if it
+// has one, or else -max-output-size.  Zero means no budget.
+func maxOutputSize(mmdSource string) (byteSize, error) {
+	if v := statementValue(frontMatter(mmdSource), "maxOutputSize"); v != "" {
+		return parseByteSize(v)
+	}
+	return maxOutputSizeFlag, nil
+}
+
+// frontMatter returns the text between the --- lines that start
+// mmdSource, or "" if it has no front matter.
+func frontMatter(mmdSource string) string {
+	rest, ok := strings.CutPrefix(strings.TrimLeft(mmdSource, " \t\r\n"), "---")
+	if !ok {
+		return ""
+	}
+	fm, _, ok := strings.Cut(rest, "\n---")
+	if !ok {
+		return ""
+	}
+	return fm
+}
+
+// checkOutputSize returns an error if svgResult is over budget.
+// With -stats the error lists the elements that contribute the
+// most to its size.
+func checkOutputSize(svgResult string, budget byteSize) error {
+	if budget <= 0 || len(svgResult) <= int(budget) {
+		return nil
+	}
+	msg := fmt.Sprintf("SVG is %s; the budget is %s", formatByteSize(int64(len(svgResult))), formatByteSize(int64(budget)))
+	if *statsFlag {
+		for _, e := range largestElements(svgResult, 5) {
+			msg += fmt.Sprintf("\n\t%s %s", formatByteSize(e.size), e.desc)
+		}
+	}
+	return errors.New(msg)
+}
+
+// svgElementSize is how many bytes of an SVG an element takes up
+// itself, not counting its child elements.
+type svgElementSize struct {
+	desc string // the element's name, and id if it has one
+	size int64
+}
+
+// largestElements returns the n elements of svgResult that take
+// up the most bytes themselves, largest first.  A huge embedded
+// image, say, shows up as its <image>, not its ancestors.
+func largestElements(svgResult string, n int) []svgElementSize {
+	type open struct {
+		desc            string
+		start, children int64
+	}
+	var (
+		d     = xml.NewDecoder(strings.NewReader(svgResult))
+		stack []open
+		sizes []svgElementSize
+	)
+	for {
+		start := d.InputOffset()
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) || err != nil {
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			desc := "<" + tok.Name.Local
+			for _, attr := range tok.Attr {
+				if attr.Name.Local == "id" {
+					desc += fmt.Sprintf(" id=%q", attr.Value)
+				}
+			}
+			stack = append(stack, open{desc: desc + ">", start: start})
+		case xml.EndElement:
+			if len(stack) == 0 {
+				break
+			}
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			total := d.InputOffset() - e.start
+			sizes = append(sizes, svgElementSize{e.desc, total - e.children})
+			if len(stack) > 0 {
+				stack[len(stack)-1].children += total
+			}
+		}
+	}
+
+	sort.SliceStable(sizes, func(i, j int) bool { return sizes[i].size > sizes[j].size })
+	return sizes[:min(n, len(sizes))]
+}
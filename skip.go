@@ -0,0 +1,23 @@
+package main
+
+import "os"
+
+// noRendererReason is why -skip-if-unavailable skipped the
+// documents, for the reports.
+const noRendererReason = "no renderer"
+
+// skipRun ends a run whose browser couldn't be started, err, with
+// -skip-if-unavailable: it warns, loudly, that nothing was
+// rendered, records every document as skipped, writes the reports,
+// and exits with status 0, leaving any existing outputs as they
+// are.
+func skipRun(err error) {
+	for _, pair := range runPairs {
+		recordSkipped(pair, noRendererReason)
+	}
+	writeReports()
+	warnf("couldn't start a browser: %v", err)
+	warnf("SKIPPED ALL %d DOCUMENTS because of -skip-if-unavailable; their outputs weren't updated", len(runPairs))
+	unlockOutputs()
+	os.Exit(0)
+}
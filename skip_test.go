@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSkipIfUnavailable starts the cli with a Chrome that isn't
+// there, so the browser can't be started, with and without
+// -skip-if-unavailable.
+func TestSkipIfUnavailable(t *testing.T) {
+	dir := chdirTemp(t, map[string]string{
+		"flow.mmd": "flowchart LR\n    A --> B\n",
+		"flow.svg": "old",
+	})
+	chrome := filepath.Join(dir, "no-such-chrome")
+
+	_, stderr, status := runMain(t, nil, "-chrome-path", chrome, "flow.mmd")
+	if status != 1 {
+		t.Errorf("without -skip-if-unavailable, exited %d, want 1: %s", status, stderr)
+	}
+	if !strings.Contains(stderr, "no-such-chrome") {
+		t.Errorf("without -skip-if-unavailable, the error doesn't name the Chrome: %s", stderr)
+	}
+
+	_, stderr, status = runMain(t, nil, "-chrome-path", chrome, "-skip-if-unavailable", "-report-html", "report.html", "flow.mmd")
+	if status != 0 {
+		t.Errorf("with -skip-if-unavailable, exited %d, want 0: %s", status, stderr)
+	}
+	if !strings.Contains(stderr, "SKIPPED ALL 1 DOCUMENTS") {
+		t.Errorf("with -skip-if-unavailable, there's no warning: %s", stderr)
+	}
+	if b, err := os.ReadFile("flow.svg"); err != nil || string(b) != "old" {
+		t.Errorf("flow.svg = %q, %v; want it left as it was", b, err)
+	}
+	if b, err := os.ReadFile("report.html"); err != nil || !strings.Contains(string(b), noRendererReason) {
+		t.Errorf("report.html doesn't mark flow.mmd %q: %v", noRendererReason, err)
+	}
+	if _, err := os.Stat(lockName); err == nil {
+		t.Errorf("%s was left behind", lockName)
+	}
+}
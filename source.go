@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// sourceNS is the XML namespace of the element -embed-source adds
+// to an SVG.
+const sourceNS = "https://github.com/zacharysyoung/go-mermaid-cli"
+
+// sourceEscaper escapes text for XML character data, leaving
+// newlines and quotes alone so the embedded source stays readable.
+// Carriage returns are escaped, since XML parsers turn a literal
+// CRLF into LF, which would break the hash.
+var sourceEscaper = strings.NewReplacer(`&`, `&amp;`, `<`, `&lt;`, `>`, `&gt;`, "\r", `&#xD;`)
+
+// errNoEmbeddedSource is returned by extractSource for an SVG
+// that wasn't rendered with -embed-source.
+var errNoEmbeddedSource = errors.New("no embedded source; was it rendered with -embed-source?")
+
+// embedSource returns svgResult with the document source mmdSource
+// and its SHA-256 embedded as the first child of its root:
+//
+//	<metadata><mermaid-cli:source xmlns:mermaid-cli="..." sha256="...">...</mermaid-cli:source></metadata>
+func embedSource(svgResult, mmdSource string) string {
+	i := strings.Index(svgResult, "<svg")
+	if i < 0 {
+		return svgResult
+	}
+	j := strings.IndexByte(svgResult[i:], '>')
+	if j < 0 {
+		return svgResult
+	}
+	j += i + 1
+
+	sum := sha256.Sum256([]byte(mmdSource))
+	md := fmt.Sprintf(`<metadata><mermaid-cli:source xmlns:mermaid-cli="%s" sha256="%s">%s</mermaid-cli:source></metadata>`,
+		sourceNS, hex.EncodeToString(sum[:]), sourceEscaper.Replace(mmdSource))
+	return svgResult[:j] + md + svgResult[j:]
+}
+
+// extractSource returns the document source embedded in svgData
+// by embedSource, after checking it against its SHA-256.
+func extractSource(svgData []byte) (string, error) {
+	d := xml.NewDecoder(strings.NewReader(string(svgData)))
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return "", errNoEmbeddedSource
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid SVG at byte %d: %w", d.InputOffset(), err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Space != sourceNS || se.Name.Local != "source" {
+			continue
+		}
+
+		var src struct {
+			SHA256 string `xml:"sha256,attr"`
+			Text   string `xml:",chardata"`
+		}
+		if err := d.DecodeElement(&src, &se); err != nil {
+			return "", fmt.Errorf("invalid embedded source: %w", err)
+		}
+		sum := sha256.Sum256([]byte(src.Text))
+		if got := hex.EncodeToString(sum[:]); got != src.SHA256 {
+			return "", fmt.Errorf("embedded source has SHA-256 %s; expected %s, so it's been changed or damaged", got, src.SHA256)
+		}
+		return src.Text, nil
+	}
+}
+
+// extractFlagSet returns the extract subcommand's flags, which set
+// out, for extractCmd and for the completion scripts.
+func extractFlagSet(out *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mermaid-cli extract [-o=file.mmd] file.svg")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	fs.StringVar(out, "o", "", "write the source to `file` instead of stdout")
+	return fs
+}
+
+// extractCmd prints the document source embedded in the SVG named
+// in args by -embed-source to Stdout, or with -o writes it to a
+// file.
+//
+// usage: mermaid-cli extract [-o=file.mmd] file.svg
+func extractCmd(args []string) {
+	var out string
+	fs := extractFlagSet(&out)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+
+	name := fs.Arg(0)
+	b, err := os.ReadFile(name)
+	if err != nil {
+		fatalf("couldn't read SVG: %v", err)
+	}
+	src, err := extractSource(b)
+	if err != nil {
+		fatalf("%s: %v", name, err)
+	}
+
+	if out == "" {
+		fmt.Print(src)
+		return
+	}
+	if err := writeFileAtomic(out, []byte(src), 0644); err != nil {
+		fatalf("couldn't write MMD: %v", err)
+	}
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/plan"
+)
+
+// flowchartHeaderRE matches the statement a flowchart starts with.
+var flowchartHeaderRE = regexp.MustCompile(`^(?:graph|flowchart|flowchart-elk)(?:\s|;|$)`)
+
+// flowLinkRE matches a link between nodes in a flowchart statement,
+// with its label, e.g., " -->|yes| " or " -- yes --> ".  It's
+// matched against the statement as maskFlowText masks it, so
+// arrows in labels don't count.
+var flowLinkRE = regexp.MustCompile(`\s*(?:<?(?:--|==|-\.)\s[^|]*?\s(?:-{2,}|={2,}|\.-+)[>ox]?|<?(?:-{2,}|={2,}|-\.+-|~{3,})[>ox]?)(?:\|[^|]*\|)?\s*`)
+
+// flowNodeIDRE matches the id a node reference starts with, before
+// its shape or class, e.g., A in A[Start]:::big.
+var flowNodeIDRE = regexp.MustCompile(`^[^\s\[\](){}<>&;:"|]+`)
+
+// splitRefPrefix starts the id of a stub node standing in for a
+// node in another part.
+const splitRefPrefix = "split_ref_"
+
+// maskFlowText returns s with the text inside brackets and quotes
+// replaced by underscores, byte for byte, so a search for links,
+// &s, and semicolons finds only the ones between nodes, at the
+// same offsets.
+func maskFlowText(s string) string {
+	b := []byte(s)
+	depth, quoted := 0, false
+	for i, c := range b {
+		switch {
+		case quoted:
+			if c == '"' {
+				quoted = false
+			} else {
+				b[i] = '_'
+			}
+		case c == '"':
+			quoted = true
+		case c == '[' || c == '(' || c == '{':
+			depth++
+		case (c == ']' || c == ')' || c == '}') && depth > 0:
+			depth--
+		case depth > 0:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// flowRef is a node reference in a flowchart statement.
+type flowRef struct {
+	id   string
+	text string // as written, e.g., A[Start]
+}
+
+// label returns the text ref's shape gives its node, or its id.
+func (ref flowRef) label() string {
+	label := strings.Trim(ref.text[len(ref.id):], `[](){}<>/\"`)
+	if i := strings.Index(label, ":::"); i >= 0 {
+		label = strings.Trim(label[:i], `[](){}<>/\"`)
+	}
+	if label == "" {
+		return ref.id
+	}
+	return label
+}
+
+// flowStmt is a statement of a flowchart, as splitFlowchart reads
+// it.
+type flowStmt struct {
+	text string
+
+	// part is the top-level subgraph the statement is in, counting
+	// from 0, or -1 for one at the top level, and depth how many
+	// subgraphs it's in.
+	part, depth int
+
+	// For a statement of nodes and links, refs are the nodes
+	// between the links, each a group joined by &s, and links the
+	// links as written.  A node statement has one group and no
+	// links.
+	refs  [][]flowRef
+	links []string
+
+	// keyword is the statement's first word if it's one that
+	// splitFlowchart handles itself, like subgraph or classDef.
+	keyword string
+}
+
+// indented returns st's text, indented for the subgraphs it's in.
+func (st flowStmt) indented() string {
+	return strings.Repeat("    ", st.depth) + st.text
+}
+
+// parseFlowStmt reads the statement text, in part.
+func parseFlowStmt(text string, part int) flowStmt {
+	st := flowStmt{text: text, part: part}
+	word, _, _ := strings.Cut(text, " ")
+	switch word {
+	case "subgraph", "end", "classDef", "class", "style", "click", "linkStyle", "direction",
+		"accTitle", "accTitle:", "accDescr", "accDescr:", "title":
+		st.keyword = word
+		return st
+	}
+	masked := maskFlowText(text)
+	start := 0
+	for _, loc := range flowLinkRE.FindAllStringIndex(masked, -1) {
+		st.refs = append(st.refs, refsBetween(text, masked, start, loc[0]))
+		st.links = append(st.links, strings.TrimSpace(text[loc[0]:loc[1]]))
+		start = loc[1]
+	}
+	st.refs = append(st.refs, refsBetween(text, masked, start, len(text)))
+	return st
+}
+
+// refsBetween returns the node references in text[start:end], a
+// group of them joined by &s, finding the &s in masked.
+func refsBetween(text, masked string, start, end int) []flowRef {
+	var refs []flowRef
+	for start <= end {
+		i := strings.IndexByte(masked[start:end], '&')
+		stop := end
+		if i >= 0 {
+			stop = start + i
+		}
+		orig := strings.TrimSpace(text[start:stop])
+		if id := flowNodeIDRE.FindString(orig); id != "" {
+			refs = append(refs, flowRef{id: id, text: orig})
+		}
+		if i < 0 {
+			break
+		}
+		start = stop + 1
+	}
+	return refs
+}
+
+// splitFlowchart splits the flowchart mmdSource into parts, for
+// -split-threshold: one for each top-level subgraph, and one more
+// for the nodes outside any subgraph, if there are any.  It only
+// goes by the statements as written, never regrouping nodes.  A
+// node is in the part of the subgraph it first appears in, or in
+// the last part if it's in none.
+//
+// Each part has the source's front matter, directives, header,
+// and classDefs.  A link between nodes in different parts is cut:
+// each side links to a stub node naming the other node and the
+// part it's in, partName(i) for the ith part, counting from 1,
+// with a click link to it.  linkStyle statements that number links
+// are dropped, since the numbers don't survive.
+//
+// It returns the parts, and how many nodes the flowchart has.  For
+// a source that isn't a flowchart it returns no parts and no
+// nodes, and for one with nothing to split on, no parts and an
+// error saying why.
+func splitFlowchart(mmdSource string, partName func(part int) string) (parts []string, nodes int, err error) {
+	lines := strings.Split(mmdSource, "\n")
+
+	// The front matter and directives before the header go in
+	// every part.
+	var prefix []string
+	i := 0
+	if frontMatter(mmdSource) != "" {
+		for i < len(lines) && strings.TrimSpace(lines[i]) != "---" {
+			i++
+		}
+		for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "---"; i++ {
+		}
+		prefix, i = lines[:i+1], i+1
+	}
+	for ; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		if t != "" && !strings.HasPrefix(t, "%%") {
+			break
+		}
+		prefix = append(prefix, lines[i])
+	}
+	if i == len(lines) {
+		return nil, 0, nil
+	}
+	header, rest, _ := strings.Cut(strings.TrimSpace(lines[i]), ";")
+	if !flowchartHeaderRE.MatchString(header + " ") {
+		return nil, 0, nil
+	}
+
+	// Read the statements, noting which top-level subgraph each is
+	// in, and which part each node is in.
+	var stmts []flowStmt
+	depth, subgraphs := 0, 0
+	nodePart := make(map[string]int)
+	isNode := make(map[string]bool)
+	var order []string // the nodes, in the order they appear
+	labels := make(map[string]string)
+	note := func(ref flowRef, part int) {
+		if !isNode[ref.id] {
+			isNode[ref.id] = true
+			order = append(order, ref.id)
+		}
+		if _, ok := nodePart[ref.id]; !ok && part >= 0 {
+			nodePart[ref.id] = part
+		}
+		if _, ok := labels[ref.id]; !ok && ref.text != ref.id {
+			labels[ref.id] = ref.label()
+		}
+	}
+	body := append([]string{rest}, lines[i+1:]...)
+	for _, line := range body {
+		if strings.HasPrefix(strings.TrimSpace(line), "%%") {
+			continue
+		}
+		masked := maskFlowText(line)
+		start := 0
+		for _, semi := range append(indexAll(masked, ';'), len(line)) {
+			text := strings.TrimSpace(line[start:semi])
+			start = semi + 1
+			if text == "" {
+				continue
+			}
+			part := -1
+			if depth > 0 {
+				part = subgraphs - 1
+			}
+			st := parseFlowStmt(text, part)
+			st.depth = depth
+			switch st.keyword {
+			case "subgraph":
+				if depth == 0 {
+					subgraphs++
+					st.part = subgraphs - 1
+				}
+				depth++
+				if id := flowNodeIDRE.FindString(strings.TrimSpace(strings.TrimPrefix(text, "subgraph"))); id != "" {
+					if _, ok := nodePart[id]; !ok {
+						nodePart[id] = st.part
+					}
+				}
+			case "end":
+				if depth > 0 {
+					depth--
+					st.depth = depth
+				}
+			}
+			stmts = append(stmts, st)
+		}
+	}
+	for _, st := range stmts {
+		if st.part >= 0 {
+			for _, group := range st.refs {
+				for _, ref := range group {
+					note(ref, st.part)
+				}
+			}
+		}
+	}
+	restPart := -1
+	for _, st := range stmts {
+		if st.part < 0 {
+			for _, group := range st.refs {
+				for _, ref := range group {
+					note(ref, -1)
+					if _, ok := nodePart[ref.id]; !ok {
+						if restPart < 0 {
+							restPart = subgraphs
+						}
+						nodePart[ref.id] = restPart
+					}
+				}
+			}
+		}
+	}
+	nodes = len(order)
+	switch {
+	case subgraphs == 0:
+		return nil, nodes, errors.New("it has no subgraphs to split on")
+	case subgraphs == 1 && restPart < 0:
+		return nil, nodes, errors.New("it's all one subgraph")
+	}
+	n := subgraphs
+	if restPart >= 0 {
+		n++
+	}
+
+	// Write the parts.
+	common := append(append([]string{}, prefix...), header)
+	var globals []string
+	out := make([][]string, n)    // each part's statements
+	after := make([][]string, n)  // and the ones after its subgraph
+	stubs := make([][]string, n)  // the stubs' declarations
+	clicks := make([][]string, n) // and their links
+	stubbed := make([]map[string]bool, n)
+	for p := range stubbed {
+		stubbed[p] = make(map[string]bool)
+	}
+	stub := func(p int, id string) string {
+		other := nodePart[id]
+		sid := splitRefPrefix + id
+		if !stubbed[p][sid] {
+			stubbed[p][sid] = true
+			label := labels[id]
+			if label == "" {
+				label = id
+			}
+			label = strings.ReplaceAll(label, `"`, "#quot;")
+			name := partName(other + 1)
+			stubs[p] = append(stubs[p], fmt.Sprintf(`%s["%s (%s)"]`, sid, label, name))
+			if name != "" {
+				clicks[p] = append(clicks[p], fmt.Sprintf(`click %s %q`, sid, name))
+			}
+		}
+		return sid
+	}
+	for _, st := range stmts {
+		switch st.keyword {
+		case "classDef":
+			globals = append(globals, st.text)
+			continue
+		case "linkStyle":
+			if strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(st.text, "linkStyle")), "default") {
+				globals = append(globals, st.text)
+			}
+			continue
+		case "class", "style", "click":
+			if st.part >= 0 {
+				out[st.part] = append(out[st.part], st.indented())
+				continue
+			}
+			fields := strings.Fields(st.text)
+			if len(fields) < 2 {
+				continue
+			}
+			if st.keyword != "class" {
+				if p, ok := nodePart[fields[1]]; ok {
+					after[p] = append(after[p], st.text)
+				}
+				continue
+			}
+			byPart := make(map[int][]string)
+			for _, id := range strings.Split(fields[1], ",") {
+				if p, ok := nodePart[id]; ok {
+					byPart[p] = append(byPart[p], id)
+				}
+			}
+			for p, ids := range byPart {
+				after[p] = append(after[p], "class "+strings.Join(ids, ",")+" "+strings.Join(fields[2:], " "))
+			}
+			continue
+		case "":
+		default:
+			if st.part >= 0 {
+				out[st.part] = append(out[st.part], st.indented())
+			} else {
+				globals = append(globals, st.text)
+			}
+			continue
+		}
+
+		// Nodes and links.
+		partsOf := make(map[int]bool)
+		for _, group := range st.refs {
+			for _, ref := range group {
+				partsOf[nodePart[ref.id]] = true
+			}
+		}
+		if len(partsOf) == 1 {
+			for p := range partsOf {
+				if st.part == p {
+					out[p] = append(out[p], st.indented())
+				} else {
+					after[p] = append(after[p], st.text)
+				}
+			}
+			continue
+		}
+		// Cut it up: declare each node where it is, as written,
+		// and link them by id.
+		for _, group := range st.refs {
+			for _, ref := range group {
+				p := nodePart[ref.id]
+				switch {
+				case st.part == p:
+					out[p] = append(out[p], strings.Repeat("    ", st.depth)+ref.text)
+				case ref.text != ref.id:
+					after[p] = append(after[p], ref.text)
+				}
+			}
+		}
+		for k, link := range st.links {
+			for _, a := range st.refs[k] {
+				for _, b := range st.refs[k+1] {
+					pa, pb := nodePart[a.id], nodePart[b.id]
+					if pa == pb {
+						after[pa] = append(after[pa], a.id+" "+link+" "+b.id)
+						continue
+					}
+					after[pa] = append(after[pa], a.id+" "+link+" "+stub(pa, b.id))
+					after[pb] = append(after[pb], stub(pb, a.id)+" "+link+" "+b.id)
+				}
+			}
+		}
+	}
+
+	for p := range n {
+		part := append([]string{}, common...)
+		indent := func(lines []string) {
+			for _, l := range lines {
+				part = append(part, "    "+l)
+			}
+		}
+		indent(globals)
+		indent(out[p])
+		indent(stubs[p])
+		indent(after[p])
+		if len(stubs[p]) > 0 {
+			indent(clicks[p])
+			ids := make([]string, len(stubs[p]))
+			for i, s := range stubs[p] {
+				ids[i], _, _ = strings.Cut(s, "[")
+			}
+			indent([]string{
+				"classDef splitRef stroke-dasharray: 4 4",
+				"class " + strings.Join(ids, ",") + " splitRef",
+			})
+		}
+		parts = append(parts, strings.Join(part, "\n")+"\n")
+	}
+	return parts, nodes, nil
+}
+
+// indexAll returns the offsets of c in s.
+func indexAll(s string, c byte) []int {
+	var offs []int
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			offs = append(offs, i)
+		}
+	}
+	return offs
+}
+
+// countParts returns how many parts -split-threshold splits the
+// MermaidJS document name into, for planning its outputs, or 0 to
+// render it whole: if it isn't a flowchart, or has no more nodes
+// than the threshold.  It warns about one that's over the
+// threshold but has nothing to split on.
+func countParts(name string) (int, error) {
+	b, err := readInput(name)
+	if err != nil {
+		return 0, nil // reading it to render it says what's wrong
+	}
+	parts, nodes, err := splitFlowchart(string(b), func(int) string { return "" })
+	if nodes <= *splitThresholdFlag {
+		return 0, nil
+	}
+	if err != nil {
+		warnf("%s has %d nodes, over -split-threshold=%d, but %v; rendering it whole", name, nodes, *splitThresholdFlag, err)
+		return 0, nil
+	}
+	return len(parts), nil
+}
+
+// replans reports whether the watcher plans the outputs of the
+// input name again when it changes, since how many there are can
+// change: for a Markdown file, or a MermaidJS document with
+// -split-threshold or -split.
+func replans(name string) bool {
+	return isMarkdown(name) || (*splitThresholdFlag > 0 || *splitFlag) && strings.HasSuffix(name, plan.MermaidExt)
+}
+
+// splitStem returns the name of pair's output, of a part of a
+// document -split-threshold splits, on either side of the part's
+// number: e.g., "flow" and ".svg" for flow-2.svg.
+func splitStem(pair renderPair) (before, after string) {
+	base := filepath.Base(pair.svgName)
+	num := "-" + strconv.Itoa(pair.block)
+	i := strings.LastIndex(base, num)
+	if i < 0 {
+		return strings.TrimSuffix(base, filepath.Ext(base)), filepath.Ext(base)
+	}
+	return base[:i], base[i+len(num):]
+}
+
+// splitPartName returns the name of the output of the partth part
+// of the document that pair is a part of, relative to pair's own
+// output, for links between them.
+func splitPartName(pair renderPair, part int) string {
+	before, after := splitStem(pair)
+	return before + "-" + strconv.Itoa(part) + after
+}
+
+// splitIndexName returns the name of the index page of the parts
+// of the document that pair is a part of: e.g., flow.html beside
+// flow-2.svg.
+func splitIndexName(pair renderPair) string {
+	before, after := splitStem(pair)
+	return filepath.Join(filepath.Dir(pair.svgName), before+strings.TrimSuffix(after, filepath.Ext(after))+".html")
+}
+
+// readSplitPart returns the part of its document that pair, of a
+// document -split-threshold splits, is for.
+func readSplitPart(pair renderPair) ([]byte, error) {
+	b, err := readInput(pair.mmdName)
+	if err != nil {
+		return nil, err
+	}
+	parts, _, err := splitFlowchart(string(b), func(part int) string { return splitPartName(pair, part) })
+	if err != nil {
+		return nil, err
+	}
+	if pair.block > len(parts) {
+		return nil, fmt.Errorf("%s has no part %d", pair.mmdName, pair.block)
+	}
+	return []byte(parts[pair.block-1]), nil
+}
+
+var splitIndexTmpl = template.Must(template.New("index").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+img { max-width: 100%; border: 1px solid #ddd; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>{{.Nodes}} nodes, split into {{len .Parts}} parts on its top-level subgraphs.
+Dashed nodes stand for nodes in another part, and link to it.</p>
+{{range $i, $part := .Parts}}
+<section id="part-{{inc $i}}">
+<h2><a href="{{$part}}">Part {{inc $i}}</a></h2>
+{{if $.Images}}<img src="{{$part}}" alt="{{$.Name}}, part {{inc $i}}">{{end}}
+</section>
+{{end}}
+</body>
+</html>
+`))
+
+// writeSplitIndex writes the index page of the parts of the
+// document that pair is a part of, which links to each part's
+// output, and shows it unless it's a PDF.
+func writeSplitIndex(pair renderPair) error {
+	b, err := readInput(pair.mmdName)
+	if err != nil {
+		return err
+	}
+	parts, nodes, err := splitFlowchart(string(b), func(int) string { return "" })
+	if err != nil {
+		return err
+	}
+	data := struct {
+		Name   string
+		Nodes  int
+		Parts  []string
+		Images bool
+	}{pair.mmdName, nodes, make([]string, len(parts)), *formatFlag != "pdf"}
+	for i := range parts {
+		data.Parts[i] = splitPartName(pair, i+1)
+	}
+	var page bytes.Buffer
+	if err := splitIndexTmpl.Execute(&page, data); err != nil {
+		return err
+	}
+	return writeFileAtomic(splitIndexName(pair), encodeOutput(page.Bytes()), 0644)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chdirSplit changes to a temporary directory with the -split
+// fixtures until t is done.
+func chdirSplit(t *testing.T) {
+	t.Helper()
+	files := make(map[string]string)
+	for _, name := range []string{"services.mmd", "flat.mmd"} {
+		b, err := os.ReadFile(filepath.Join("testdata", "split", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = string(b)
+	}
+	chdirTemp(t, files)
+}
+
+func TestCountParts(t *testing.T) {
+	chdirSplit(t)
+	setFlag(t, "split-threshold", "10")
+
+	// One part for each top-level subgraph, and one for the nodes
+	// outside them.
+	if n, err := countParts("services.mmd"); err != nil || n != 4 {
+		t.Errorf("countParts(services.mmd) = %d, %v; want 4", n, err)
+	}
+	// No subgraphs to split on, so it renders whole.
+	if n, err := countParts("flat.mmd"); err != nil || n != 0 {
+		t.Errorf("countParts(flat.mmd) = %d, %v; want 0", n, err)
+	}
+}
+
+func TestSplitIndexEncoding(t *testing.T) {
+	chdirSplit(t)
+	setFlag(t, "split-threshold", "10")
+	setFlag(t, "output-newline", "crlf")
+	setFlag(t, "output-bom", "true")
+
+	if err := writeSplitIndex(renderPair{mmdName: "services.mmd", svgName: "services-2.svg", block: 2}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile("services.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, utf8BOM) {
+		t.Error("the index page doesn't start with a BOM")
+	}
+	if n, crlf := bytes.Count(b, []byte("\n")), bytes.Count(b, []byte("\r\n")); n == 0 || n != crlf {
+		t.Errorf("the index page has %d line endings, %d of them CRLF", n, crlf)
+	}
+	for i := 1; i <= 4; i++ {
+		if link := fmt.Sprintf(`href="services-%d.svg"`, i); !strings.Contains(string(b), link) {
+			t.Errorf("the index page doesn't have %s", link)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// stagedPaths maps the documents -staged found to their paths in
+// the git index, which readDoc reads them from instead of the
+// working tree.
+var stagedPaths map[string]string
+
+// git runs git with args, returning its stdout.  An error includes
+// what git said on stderr.
+func git(args ...string) ([]byte, error) {
+	return gitIn("", args...)
+}
+
+// gitIn is git run in the directory dir.
+func gitIn(dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// stagedInputs returns the documents and Markdown files that are
+// added, copied, modified, or renamed in the git index, named relative to the
+// current directory, and records where each is in the index.
+func stagedInputs() ([]inputArg, error) {
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("-staged needs a git repository: %w", err)
+	}
+	root := strings.TrimSpace(string(top))
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	out, err := git("diff", "--cached", "--name-only", "--diff-filter=ACMR", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	in := inputArg{arg: "-staged"}
+	stagedPaths = make(map[string]string)
+	for _, p := range strings.Split(string(out), "\x00") {
+		if !strings.HasSuffix(p, mmd) && !isMarkdown(p) {
+			continue
+		}
+		name, err := filepath.Rel(wd, filepath.Join(root, filepath.FromSlash(p)))
+		if err != nil {
+			return nil, err
+		}
+		in.names = append(in.names, name)
+		stagedPaths[name] = p
+	}
+	return []inputArg{in}, nil
+}
+
+// stagedBlob returns the staged content of the document at path in
+// the git index, which is what will be committed, partially staged
+// edits and all.
+func stagedBlob(path string) ([]byte, error) {
+	// git show's :path is relative to the top of the repository.
+	return git("show", ":"+path)
+}
+
+// autoStage stages the outputs of pairs with git add, for
+// -auto-stage.
+func autoStage(pairs []renderPair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	args := []string{"add", "--"}
+	for _, pair := range pairs {
+		args = append(args, pair.svgName)
+	}
+	if _, err := git(args...); err != nil {
+		return fmt.Errorf("couldn't stage outputs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// watchStatus is what the watcher has done so far, for the status
+// dump on SIGUSR1 and -status-file.
+type watchStatus struct {
+	started  time.Time
+	restarts int
+	names    []string // in the order they're watched
+	files    map[string]*fileStatus
+
+	// preview, with -serve, is told about each render.
+	preview *previewServer
+}
+
+// fileStatus is the outcome of the last render of one document.
+type fileStatus struct {
+	rendered time.Time // zero if it hasn't been rendered yet
+	took     time.Duration
+	err      error
+}
+
+func newWatchStatus(pairs []renderPair) *watchStatus {
+	s := &watchStatus{started: time.Now(), files: make(map[string]*fileStatus)}
+	for _, pair := range pairs {
+		s.names = append(s.names, pair.docName())
+		s.files[pair.docName()] = &fileStatus{}
+	}
+	return s
+}
+
+// render renders pair and records how it went.
+func (s *watchStatus) render(pair renderPair) {
+	start := time.Now()
+	err := render(pair)
+	s.record(renderOutcome{pair: pair, start: start, took: time.Since(start), err: err})
+}
+
+// record records how a render went, as a renderWorker tells it.
+func (s *watchStatus) record(o renderOutcome) {
+	if _, ok := s.files[o.pair.docName()]; !ok {
+		s.names = append(s.names, o.pair.docName()) // a new Markdown block
+	}
+	s.files[o.pair.docName()] = &fileStatus{rendered: o.start, took: o.took, err: o.err}
+	if s.preview != nil {
+		s.preview.rendered(o.pair, o.err)
+	}
+}
+
+// writeTo writes the status block to w.
+func (s *watchStatus) writeTo(w io.Writer) error {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "mermaid-cli status at %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "uptime: %s\n", time.Since(s.started).Round(time.Second))
+	fmt.Fprintf(&b, "watched files: %d\n", len(s.names))
+	fmt.Fprintf(&b, "renderer restarts: %d\n", s.restarts)
+	fmt.Fprintf(&b, "memory: %.1f MiB heap in use, %.1f MiB from the OS, %d GCs\n",
+		float64(ms.HeapInuse)/(1<<20), float64(ms.Sys)/(1<<20), ms.NumGC)
+	for _, name := range s.names {
+		f := s.files[name]
+		switch {
+		case f.rendered.IsZero():
+			fmt.Fprintf(&b, "  %s: not rendered yet\n", name)
+		case f.err != nil:
+			fmt.Fprintf(&b, "  %s: failed at %s in %s: %s\n", name, f.rendered.Format(time.TimeOnly), f.took.Round(time.Millisecond), oneLineMessage(f.err))
+		default:
+			fmt.Fprintf(&b, "  %s: ok at %s in %s\n", name, f.rendered.Format(time.TimeOnly), f.took.Round(time.Millisecond))
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeStatusFile writes the status block to the -status-file
+// file, if it's set.
+func (s *watchStatus) writeStatusFile() {
+	if *statusFileFlag == "" {
+		return
+	}
+	var b bytes.Buffer
+	s.writeTo(&b)
+	if err := writeFileAtomic(*statusFileFlag, b.Bytes(), 0644); err != nil {
+		errorf("couldn't write status file: %v", err)
+	}
+}
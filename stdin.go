@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// renderOnStdin reads the names of documents from in, one per
+// line, rendering each as it's read, and writes a result line to
+// out for each of them: "ok NAME", or "err NAME: MESSAGE" with the
+// message on one line.
+//
+// It returns at EOF, once the last document is rendered, or for
+// any error reading in or writing out.
+func renderOnStdin(in io.Reader, out io.Writer) error {
+	sc := bufio.NewScanner(in)
+	for sc.Scan() {
+		name := strings.TrimSpace(sc.Text())
+		if name == "" {
+			continue
+		}
+		result := "ok " + name
+		if err := renderOnStdinName(name); err != nil {
+			result = fmt.Sprintf("err %s: %s", name, oneLineMessage(err))
+		}
+		if _, err := fmt.Fprintln(out, result); err != nil {
+			return fmt.Errorf("write result: %w", err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read names: %w", err)
+	}
+	return nil
+}
+
+// renderOnStdinName renders the document name, returning any
+// error rather than exiting.
+func renderOnStdinName(name string) error {
+	if _, err := os.Stat(name); err != nil {
+		return err
+	}
+	if replans(name) {
+		pairs, err := planPairs([]string{name}, nil)
+		if err != nil {
+			return err
+		}
+		var errs []error
+		for _, pair := range pairs {
+			errs = append(errs, render(pair))
+		}
+		return errors.Join(errs...)
+	}
+	pair, err := newRenderPair(name)
+	if err != nil {
+		return err
+	}
+	return render(pair)
+}
+
+// stdioName is the document argument that means read the document
+// from stdin, and write its SVG (or PNG or PDF) to stdout.
+const stdioName = "-"
+
+// checkStdio prints usage and exits if the document arguments in
+// args read from stdin but can't, because there are others, or
+// the flags would watch it or write files beside its output.
+func checkStdio(args []string) {
+	found := false
+	for _, arg := range args {
+		found = found || arg == stdioName
+	}
+	if !found {
+		return
+	}
+	var conflict string
+	switch {
+	case len(args) > 1:
+		fmt.Fprintln(os.Stderr, "- (stdin) has to be the only document")
+		usage()
+	case *watchFlag:
+		conflict = "-watch"
+	case *goldenFlag != "":
+		conflict = "-golden"
+	case *verifyFlag:
+		conflict = "-verify-deterministic"
+	case *checkOutputFlag:
+		conflict = "-check-output"
+	case *writeSumsFlag || *verifySumsFlag:
+		conflict = "-write-sums and -verify-sums"
+	case *metadataFlag:
+		conflict = "-metadata"
+	case *htmlFlag || *htmlTemplateFlag != "":
+		conflict = "-html"
+	case *keepOldFlag > 0:
+		conflict = "-keep-old"
+	case diffFlag != "":
+		conflict = "-diff"
+	case *removeOnFailFlag:
+		conflict = "-remove-on-fail"
+	case *errSidecarsFlag:
+		conflict = "-err-sidecars"
+	case *nameFromTitleFlag:
+		conflict = "-name-from-title"
+	case *splitFlag:
+		conflict = "-split"
+	case *matrixFlag != "":
+		conflict = "-matrix"
+	}
+	if conflict != "" {
+		fmt.Fprintf(os.Stderr, "%s can't be used with - (stdin)\n", conflict)
+		usage()
+	}
+}
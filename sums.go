@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sumsName is the checksum manifest -write-sums writes and
+// -verify-sums checks, in the current directory.
+const sumsName = ".mermaid.sum"
+
+// A sumsEntry is one line of the manifest:
+//
+//	path/to/out.svg output:HEX inputs:HEX
+//
+// where output is the SHA-256 of the SVG, and inputs the SHA-256
+// of the document's source together with everything else that
+// decides the SVG (see inputsFingerprint).  Lines are sorted by
+// path, so merges only conflict over the same output.
+type sumsEntry struct {
+	output, inputs string
+}
+
+// readSums reads the manifest name.  A missing manifest is empty.
+func readSums(name string) (map[string]sumsEntry, error) {
+	sums := make(map[string]sumsEntry)
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// The path comes first and may have spaces, so the hashes
+		// are split off the end.
+		i := strings.LastIndex(line, " inputs:")
+		j := strings.LastIndex(line[:max(i, 0)], " output:")
+		if i < 0 || j < 0 {
+			return nil, fmt.Errorf("%s:%d: malformed line", name, n)
+		}
+		sums[line[:j]] = sumsEntry{
+			output: line[j+len(" output:") : i],
+			inputs: line[i+len(" inputs:"):],
+		}
+	}
+	return sums, sc.Err()
+}
+
+// writeSums writes sums to the manifest name, one line per output,
+// sorted.
+func writeSums(name string, sums map[string]sumsEntry) error {
+	paths := make([]string, 0, len(sums))
+	for path := range sums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b bytes.Buffer
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s output:%s inputs:%s\n", path, sums[path].output, sums[path].inputs)
+	}
+	return writeFileAtomic(name, b.Bytes(), 0644)
+}
+
+// inputsFingerprint hashes everything other than a document's
+// source that decides its output's bytes: the MermaidJS bundle,
+// the fonts, the theme map, the -html template, and the flags
+// that change the output, down to its encoding.
+func inputsFingerprint() []byte {
+	h := sha256.New()
+	bundle, err := readMermaidJS()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Fprintf(h, "mermaid.min.js %x\n", sha256.Sum256(bundle))
+	for _, name := range []string{*emojiFontFlag, *cjkFontFlag} {
+		if name == "" {
+			fmt.Fprintln(h, "font none")
+			continue
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			fatalf("couldn't read font: %v", err)
+		}
+		fmt.Fprintf(h, "font %x\n", sha256.Sum256(b))
+	}
+	if *themeMapFlag != "" {
+		b, err := os.ReadFile(*themeMapFlag)
+		if err != nil {
+			fatalf("couldn't read theme map: %v", err)
+		}
+		fmt.Fprintf(h, "theme-map %x\n", sha256.Sum256(b))
+	}
+	if *configFlag != "" {
+		b, err := os.ReadFile(*configFlag)
+		if err != nil {
+			fatalf("couldn't read config: %v", err)
+		}
+		fmt.Fprintf(h, "config %x\n", sha256.Sum256(b))
+	}
+	if *cssFlag != "" {
+		b, err := os.ReadFile(*cssFlag)
+		if err != nil {
+			fatalf("couldn't read CSS: %v", err)
+		}
+		fmt.Fprintf(h, "css %x\n", sha256.Sum256(b))
+	}
+	if *fontFlag != "" {
+		fmt.Fprintf(h, "font-family %s\n", *fontFlag)
+	}
+	for _, name := range extraJSFlag {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			fatalf("couldn't read extra JavaScript: %v", err)
+		}
+		fmt.Fprintf(h, "extra-js %x\n", sha256.Sum256(b))
+	}
+	if *htmlTemplateFlag != "" {
+		b, err := os.ReadFile(*htmlTemplateFlag)
+		if err != nil {
+			fatalf("couldn't read HTML template: %v", err)
+		}
+		fmt.Fprintf(h, "html-template %x\n", sha256.Sum256(b))
+	}
+	fmt.Fprintf(h, "format %s scale %g\n", *formatFlag, *scaleFlag)
+	fmt.Fprintf(h, "output-bom %t output-newline %s\n", *outputBOMFlag, *outputNewlineFlag)
+	fmt.Fprintf(h, "embed-source %t\n", *embedSourceFlag)
+	fmt.Fprintf(h, "gitgraph %s\n", gitGraphFlag.String())
+	fmt.Fprintf(h, "theme %s\n", *themeFlag)
+	fmt.Fprintf(h, "force-config %t\n", *forceConfigFlag)
+	fmt.Fprintf(h, "chart-size %dx%d\n", *chartWidthFlag, *chartHeightFlag)
+	fmt.Fprintf(h, "size %dx%d max-width %t\n", *widthFlag, *heightFlag, !*noMaxWidthFlag)
+	fmt.Fprintf(h, "scope-prefix %s\n", *scopePrefixFlag)
+	fmt.Fprintf(h, "deterministic %t\n", *deterministicFlag)
+	if *backgroundFlag != "" {
+		fmt.Fprintf(h, "background %s\n", *backgroundFlag)
+	}
+	return h.Sum(nil)
+}
+
+// pairSums returns the manifest entry for pair as it is on disk,
+// with fingerprint from inputsFingerprint.
+func pairSums(pair renderPair, fingerprint []byte) (sumsEntry, error) {
+	src, err := readSource(pair)
+	if err != nil {
+		return sumsEntry{}, err
+	}
+	out, err := os.ReadFile(pair.svgName)
+	if err != nil {
+		return sumsEntry{}, err
+	}
+	outSum := sha256.Sum256(out)
+	return sumsEntry{
+		output: hex.EncodeToString(outSum[:]),
+		inputs: inputsHashWith(fingerprint, pair, src),
+	}, nil
+}
+
+// sumsPath is the path of an output in the manifest.
+func sumsPath(svgName string) string {
+	return filepath.ToSlash(filepath.Clean(svgName))
+}
+
+// updateSums records the pairs' outputs in the manifest, keeping
+// the entries of any other outputs.
+func updateSums(pairs []renderPair) {
+	sums, err := readSums(sumsName)
+	if err != nil {
+		fatalf("couldn't read checksums: %v", err)
+	}
+	fingerprint := inputsFingerprint()
+	for _, pair := range pairs {
+		e, err := pairSums(pair, fingerprint)
+		if err != nil {
+			fatalf("couldn't checksum %s: %v", pair.svgName, err)
+		}
+		sums[sumsPath(pair.svgName)] = e
+	}
+	if err := writeSums(sumsName, sums); err != nil {
+		fatalf("couldn't write checksums: %v", err)
+	}
+	log.Println("wrote", sumsName)
+}
+
+// verifySums checks the pairs' sources and outputs on disk against
+// the manifest, without rendering, and prints each mismatch to
+// Stdout.  It reports whether everything matched.
+func verifySums(pairs []renderPair) (ok bool) {
+	sums, err := readSums(sumsName)
+	if err != nil {
+		fatalf("couldn't read checksums: %v", err)
+	}
+	fingerprint := inputsFingerprint()
+
+	ok = true
+	for _, pair := range pairs {
+		want, found := sums[sumsPath(pair.svgName)]
+		got, err := pairSums(pair, fingerprint)
+		switch {
+		case !found:
+			fmt.Printf("%s: not in %s\n", pair.svgName, sumsName)
+		case err != nil:
+			fmt.Printf("%s: %v\n", pair.svgName, err)
+		case got.inputs != want.inputs:
+			fmt.Printf("%s: source or configuration changed since the checksum was recorded\n", pair.svgName)
+		case got.output != want.output:
+			fmt.Printf("%s: output doesn't match its checksum\n", pair.svgName)
+		default:
+			log.Println("verified", pair.svgName)
+			continue
+		}
+		ok = false
+	}
+	return ok
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/mermaidtest"
+)
+
+// diffMode is the value of -diff: "" (off), "summary", or "full".
+// It's a boolean flag, so plain -diff means summary.
+type diffMode string
+
+func (m *diffMode) String() string { return string(*m) }
+
+func (m *diffMode) IsBoolFlag() bool { return true }
+
+func (m *diffMode) Set(s string) error {
+	switch s {
+	case "true", "summary":
+		*m = "summary"
+	case "false":
+		*m = ""
+	case "full":
+		*m = "full"
+	default:
+		return fmt.Errorf("got %q; expected summary or full", s)
+	}
+	return nil
+}
+
+// svgShape is what an SVG's change summary compares: its size
+// and how many of each element it has.
+type svgShape struct {
+	viewBox  string
+	elements map[string]int
+}
+
+func parseSVGShape(svgResult string) (svgShape, error) {
+	shape := svgShape{elements: make(map[string]int)}
+	d := xml.NewDecoder(strings.NewReader(svgResult))
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return shape, nil
+		}
+		if err != nil {
+			return shape, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if len(shape.elements) == 0 && se.Name.Local == "svg" {
+			for _, attr := range se.Attr {
+				if attr.Name.Local == "viewBox" {
+					shape.viewBox = attr.Value
+				}
+			}
+		}
+		shape.elements[se.Name.Local]++
+	}
+}
+
+// summarizeSVGChange describes how newSVG differs from oldSVG,
+// after normalizing both with mermaidtest.NormalizeSVG: identical,
+// attribute or text changes only, or the elements added and
+// removed, along with any change of size.
+func summarizeSVGChange(oldSVG, newSVG string) string {
+	oldSVG, newSVG = mermaidtest.NormalizeSVG(oldSVG), mermaidtest.NormalizeSVG(newSVG)
+	if oldSVG == newSVG {
+		return "identical"
+	}
+
+	oldShape, err := parseSVGShape(oldSVG)
+	if err != nil {
+		return fmt.Sprintf("changed; couldn't parse the old SVG: %v", err)
+	}
+	newShape, err := parseSVGShape(newSVG)
+	if err != nil {
+		return fmt.Sprintf("changed; couldn't parse the new SVG: %v", err)
+	}
+
+	var names []string
+	for name := range oldShape.elements {
+		names = append(names, name)
+	}
+	for name := range newShape.elements {
+		if _, ok := oldShape.elements[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var added, removed []string
+	for _, name := range names {
+		switch n := newShape.elements[name] - oldShape.elements[name]; {
+		case n > 0:
+			added = append(added, fmt.Sprintf("%d %s", n, name))
+		case n < 0:
+			removed = append(removed, fmt.Sprintf("%d %s", -n, name))
+		}
+	}
+
+	var parts []string
+	if len(added) > 0 {
+		parts = append(parts, "added "+strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		parts = append(parts, "removed "+strings.Join(removed, ", "))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "attribute or text changes only")
+	}
+	if oldShape.viewBox != newShape.viewBox {
+		parts = append(parts, fmt.Sprintf("viewBox %q -> %q", oldShape.viewBox, newShape.viewBox))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// limitLines returns the first n lines of diff, for -diff-lines,
+// with a note of how many more there are, or all of it if n is 0.
+func limitLines(diff string, n int) string {
+	lines := strings.SplitAfter(diff, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if n <= 0 || len(lines) <= n {
+		return diff
+	}
+	return strings.Join(lines[:n], "") + fmt.Sprintf("... %d more lines\n", len(lines)-n)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	viewBoxAttrRE = regexp.MustCompile(`\sviewBox="([^"]*)"`)
+	widthAttrRE   = regexp.MustCompile(`\swidth="[^"]*"`)
+	heightAttrRE  = regexp.MustCompile(`\sheight="[^"]*"`)
+	styleAttrRE   = regexp.MustCompile(`\sstyle="([^"]*)"`)
+	maxWidthRE    = regexp.MustCompile(`(?:^|;)\s*max-width\s*:[^;]*;?`)
+)
+
+// sizeSVG returns svgResult with explicit width and height
+// attributes on its root element, from its viewBox, in place of
+// MermaidJS's width="100%", which sizes an SVG to nothing in an
+// <img> in most email clients, or in LaTeX's \includegraphics.
+//
+// With width or height over 0 (-width and -height), the diagram
+// is scaled to that size, keeping its aspect ratio, or to fit
+// within both if both are set.  The max-width in the root's style
+// is then set to the new width, or with noMaxWidth
+// (-no-max-width) removed, so the SVG sizes itself by its
+// attributes alone.
+func sizeSVG(svgResult string, width, height int, noMaxWidth bool) (string, error) {
+	i := strings.Index(svgResult, "<svg")
+	if i < 0 {
+		return "", errors.New("no root svg element")
+	}
+	j := strings.IndexByte(svgResult[i:], '>')
+	if j < 0 {
+		return "", errors.New("no root svg element")
+	}
+	j += i
+	tag := svgResult[i:j]
+
+	m := viewBoxAttrRE.FindStringSubmatch(tag)
+	if m == nil {
+		if width > 0 || height > 0 {
+			return "", errors.New("can't size an SVG without a viewBox")
+		}
+		return svgResult, nil
+	}
+	var box [4]float64
+	fields := strings.Fields(strings.ReplaceAll(m[1], ",", " "))
+	if len(fields) != 4 {
+		return "", fmt.Errorf("got viewBox %q; expected 4 numbers", m[1])
+	}
+	for k, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return "", fmt.Errorf("got viewBox %q; expected 4 numbers", m[1])
+		}
+		box[k] = v
+	}
+	w, h := box[2], box[3]
+	if w <= 0 || h <= 0 {
+		return "", fmt.Errorf("got viewBox %q; expected a positive width and height", m[1])
+	}
+
+	scale := 1.0
+	switch {
+	case width > 0 && height > 0:
+		scale = math.Min(float64(width)/w, float64(height)/h)
+	case width > 0:
+		scale = float64(width) / w
+	case height > 0:
+		scale = float64(height) / h
+	}
+	w, h = w*scale, h*scale
+
+	tag = widthAttrRE.ReplaceAllString(tag, "")
+	tag = heightAttrRE.ReplaceAllString(tag, "")
+	if m := styleAttrRE.FindStringSubmatchIndex(tag); m != nil {
+		style := tag[m[2]:m[3]]
+		if noMaxWidth {
+			style = strings.TrimSpace(maxWidthRE.ReplaceAllString(style, ";"))
+			style = strings.TrimSpace(strings.TrimPrefix(style, ";"))
+		} else {
+			style = maxWidthRE.ReplaceAllStringFunc(style, func(decl string) string {
+				prefix := ""
+				if strings.HasPrefix(decl, ";") {
+					prefix = "; "
+				}
+				return prefix + "max-width: " + formatPixels(w) + "px;"
+			})
+		}
+		if style == "" {
+			tag = tag[:m[0]] + tag[m[1]:]
+		} else {
+			tag = tag[:m[2]] + style + tag[m[3]:]
+		}
+	}
+	closing := ""
+	if strings.HasSuffix(tag, "/") {
+		tag, closing = tag[:len(tag)-1], "/"
+	}
+	tag += fmt.Sprintf(` width="%s" height="%s"`, formatPixels(w), formatPixels(h)) + closing
+	return svgResult[:i] + tag + svgResult[j:], nil
+}
+
+// formatPixels returns v rounded to 3 decimal places, without
+// trailing zeros.
+func formatPixels(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
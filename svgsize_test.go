@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The root elements MermaidJS emits for a flowchart and a sequence
+// diagram, which put their attributes in different orders.
+const (
+	flowRoot = `<svg id="mermaid-0" width="100%" xmlns="http://www.w3.org/2000/svg" class="flowchart" style="max-width: 200px;" viewBox="-8 -8 200 100" role="graphics-document document" aria-roledescription="flowchart-v2">`
+	seqRoot  = `<svg aria-roledescription="sequence" role="graphics-document document" viewBox="-50 -10 450 300" style="max-width: 450px; background-color: white;" xmlns="http://www.w3.org/2000/svg" width="100%" id="mermaid-1">`
+)
+
+func TestSizeSVG(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		svg           string
+		width, height int
+		noMaxWidth    bool
+		want          string
+	}{
+		{
+			name: "flowchart",
+			svg:  flowRoot + "<g/></svg>",
+			want: `<svg id="mermaid-0" xmlns="http://www.w3.org/2000/svg" class="flowchart" style="max-width: 200px;" viewBox="-8 -8 200 100" role="graphics-document document" aria-roledescription="flowchart-v2" width="200" height="100"><g/></svg>`,
+		},
+		{
+			name: "sequence",
+			svg:  seqRoot + "<g/></svg>",
+			want: `<svg aria-roledescription="sequence" role="graphics-document document" viewBox="-50 -10 450 300" style="max-width: 450px; background-color: white;" xmlns="http://www.w3.org/2000/svg" id="mermaid-1" width="450" height="300"><g/></svg>`,
+		},
+		{
+			name:  "flowchart width",
+			svg:   flowRoot + "</svg>",
+			width: 400,
+			want:  `<svg id="mermaid-0" xmlns="http://www.w3.org/2000/svg" class="flowchart" style="max-width: 400px;" viewBox="-8 -8 200 100" role="graphics-document document" aria-roledescription="flowchart-v2" width="400" height="200"></svg>`,
+		},
+		{
+			name:   "sequence height",
+			svg:    seqRoot + "</svg>",
+			height: 100,
+			want:   `<svg aria-roledescription="sequence" role="graphics-document document" viewBox="-50 -10 450 300" style="max-width: 150px; background-color: white;" xmlns="http://www.w3.org/2000/svg" id="mermaid-1" width="150" height="100"></svg>`,
+		},
+		{
+			name:   "fit within both",
+			svg:    flowRoot + "</svg>",
+			width:  100,
+			height: 100,
+			want:   `<svg id="mermaid-0" xmlns="http://www.w3.org/2000/svg" class="flowchart" style="max-width: 100px;" viewBox="-8 -8 200 100" role="graphics-document document" aria-roledescription="flowchart-v2" width="100" height="50"></svg>`,
+		},
+		{
+			name:       "flowchart no max-width",
+			svg:        flowRoot + "</svg>",
+			noMaxWidth: true,
+			want:       `<svg id="mermaid-0" xmlns="http://www.w3.org/2000/svg" class="flowchart" viewBox="-8 -8 200 100" role="graphics-document document" aria-roledescription="flowchart-v2" width="200" height="100"></svg>`,
+		},
+		{
+			name:       "sequence no max-width",
+			svg:        seqRoot + "</svg>",
+			noMaxWidth: true,
+			want:       `<svg aria-roledescription="sequence" role="graphics-document document" viewBox="-50 -10 450 300" style="background-color: white;" xmlns="http://www.w3.org/2000/svg" id="mermaid-1" width="450" height="300"></svg>`,
+		},
+		{
+			name:  "self-closing",
+			svg:   `<?xml version="1.0"?><svg viewBox="0 0 3 7" width="100%"/>`,
+			width: 1,
+			want:  `<?xml version="1.0"?><svg viewBox="0 0 3 7" width="1" height="2.333"/>`,
+		},
+		{
+			name: "no viewBox",
+			svg:  `<svg width="100%"></svg>`,
+			want: `<svg width="100%"></svg>`,
+		},
+	} {
+		got, err := sizeSVG(tc.svg, tc.width, tc.height, tc.noMaxWidth)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSizeSVGErrors(t *testing.T) {
+	for _, tc := range []struct {
+		svg   string
+		width int
+		want  string
+	}{
+		{"<g/>", 0, "no root svg element"},
+		{`<svg width="100%"></svg>`, 10, "without a viewBox"},
+		{`<svg viewBox="0 0 10"></svg>`, 0, "expected 4 numbers"},
+		{`<svg viewBox="0 0 ten 10"></svg>`, 0, "expected 4 numbers"},
+		{`<svg viewBox="0 0 0 10"></svg>`, 0, "expected a positive width and height"},
+	} {
+		_, err := sizeSVG(tc.svg, tc.width, 0, false)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("sizeSVG(%q) = %v, want an error with %q", tc.svg, err, tc.want)
+		}
+	}
+}
+
+// TestSizeSVGRendered renders a flowchart and a sequence diagram
+// with -width and -no-max-width, and checks their root elements.
+func TestSizeSVGRendered(t *testing.T) {
+	startTestRenderer(t) // only to skip without Chrome
+	files := make(map[string]string)
+	for _, name := range []string{"flow.mmd", "sequence.mmd"} {
+		b, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = string(b)
+	}
+	chdirTemp(t, files)
+	if _, stderr, status := runMain(t, nil, "-width", "300", "-no-max-width", "flow.mmd", "sequence.mmd"); status != 0 {
+		t.Fatalf("exited %d: %s", status, stderr)
+	}
+
+	for _, name := range []string{"flow.svg", "sequence.svg"} {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, root, _ := strings.Cut(string(b), "<svg")
+		root, _, ok := strings.Cut(root, ">")
+		if !ok {
+			t.Fatalf("%s has no root svg element", name)
+		}
+		if !strings.Contains(root, ` width="300"`) {
+			t.Errorf("%s root %s isn't 300 wide", name, root)
+		}
+		if strings.Contains(root, "max-width") {
+			t.Errorf("%s root %s has a max-width", name, root)
+		}
+		m := viewBoxAttrRE.FindStringSubmatch(root)
+		if m == nil {
+			t.Fatalf("%s root %s has no viewBox", name, root)
+		}
+		box := strings.Fields(m[1])
+		w, _ := strconv.ParseFloat(box[2], 64)
+		h, _ := strconv.ParseFloat(box[3], 64)
+		if want := ` height="` + formatPixels(h*300/w) + `"`; !strings.Contains(root, want) {
+			t.Errorf("%s root %s doesn't have%s", name, root, want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// mermaidThemes are the themes MermaidJS has.
+var mermaidThemes = []string{"default", "base", "dark", "forest", "neutral", "null"}
+
+// themeMapEntry is a -theme-map pattern, and the MermaidJS config
+// for the documents it matches.
+type themeMapEntry struct {
+	pattern string
+	config  map[string]any
+}
+
+// themeMap is the -theme-map file's entries, in order.
+var themeMap []themeMapEntry
+
+// loadThemeMap reads and checks the -theme-map file into themeMap.
+// It leaves themeMap as is for any error.
+func loadThemeMap() error {
+	b, err := os.ReadFile(*themeMapFlag)
+	if err != nil {
+		return err
+	}
+	entries, err := parseThemeMap(*themeMapFlag, string(b))
+	if err != nil {
+		return err
+	}
+	themeMap = entries
+	return nil
+}
+
+// parseThemeMap parses the theme map in the file name, with
+// contents src.  It's YAML, but only as much as a theme map needs:
+// a mapping from patterns to themes, or to mappings of MermaidJS
+// settings to scalars.
+//
+//	# Print diagrams stay neutral.
+//	"docs/print/*.mmd": neutral
+//	docs/*.mmd:
+//	  theme: dark
+//	  fontFamily: Inter
+//
+// Patterns are matched against documents' paths with path.Match,
+// and a pattern can't be listed twice.  A theme must be one
+// MermaidJS has.
+func parseThemeMap(name, src string) ([]themeMapEntry, error) {
+	var (
+		entries []themeMapEntry
+		seen    = make(map[string]int)
+		open    = -1 // the index of the entry taking settings, if any
+	)
+	for i, line := range strings.Split(src, "\n") {
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", name, i+1, fmt.Sprintf(format, args...))
+		}
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key, value, ok := cutYAMLKey(trimmed)
+		if !ok {
+			return nil, errorf("expected key: value")
+		}
+
+		if trimmed != line { // indented: a setting of the open entry
+			if open < 0 {
+				return nil, errorf("setting %s isn't under a pattern", key)
+			}
+			if value == "" {
+				return nil, errorf("setting %s has no value", key)
+			}
+			entries[open].config[key] = yamlScalar(value)
+			continue
+		}
+
+		if _, err := path.Match(key, ""); err != nil {
+			return nil, errorf("bad pattern %s: %v", key, err)
+		}
+		if prev, ok := seen[key]; ok {
+			return nil, errorf("pattern %s is already on line %d", key, prev)
+		}
+		seen[key] = i + 1
+		e := themeMapEntry{pattern: key, config: make(map[string]any)}
+		open = -1
+		if value == "" {
+			open = len(entries)
+		} else {
+			e.config["theme"] = yamlScalar(value)
+		}
+		entries = append(entries, e)
+	}
+
+	for _, e := range entries {
+		if len(e.config) == 0 {
+			return nil, fmt.Errorf("%s: pattern %s has no theme or settings", name, e.pattern)
+		}
+		if theme, ok := e.config["theme"]; ok && !isMermaidTheme(theme) {
+			return nil, fmt.Errorf("%s: pattern %s: got theme %v; expected one of %s", name, e.pattern, theme, strings.Join(mermaidThemes, ", "))
+		}
+	}
+	return entries, nil
+}
+
+// cutYAMLKey splits "key: value", where key may be quoted, and
+// value may be empty.
+func cutYAMLKey(s string) (key, value string, ok bool) {
+	if q := s[0]; q == '"' || q == '\'' {
+		end := strings.IndexByte(s[1:], q)
+		if end < 0 {
+			return "", "", false
+		}
+		key, s = s[1:end+1], s[end+2:]
+		rest, ok := strings.CutPrefix(s, ":")
+		return key, strings.TrimSpace(rest), ok
+	}
+	if key, ok := strings.CutSuffix(s, ":"); ok {
+		return strings.TrimSpace(key), "", true
+	}
+	key, value, ok = strings.Cut(s, ": ")
+	return strings.TrimSpace(key), strings.TrimSpace(value), ok
+}
+
+// yamlScalar returns the YAML scalar s as a bool, number, or
+// string.
+func yamlScalar(s string) any {
+	if uq, err := strconv.Unquote(s); err == nil {
+		return uq
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1]
+	}
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+func isMermaidTheme(theme any) bool {
+	for _, t := range mermaidThemes {
+		if theme == t {
+			return true
+		}
+	}
+	return false
+}
+
+// matchThemeMap returns the first entry of entries whose pattern
+// matches the document mmdName, or nil.
+func matchThemeMap(entries []themeMapEntry, mmdName string) *themeMapEntry {
+	name := filepath.ToSlash(filepath.Clean(mmdName))
+	for i, e := range entries {
+		if ok, _ := path.Match(e.pattern, name); ok {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// reloadThemeMap rereads the -theme-map file in watch mode, and
+// returns the pairs whose documents now get different config and
+// need rerendering.  For an error, it prints it, keeps the old
+// theme map, and returns none.
+func reloadThemeMap(pairs []renderPair) []renderPair {
+	old := themeMap
+	if err := loadThemeMap(); err != nil {
+		errorf("couldn't reload theme map: %v", err)
+		return nil
+	}
+	var changed []renderPair
+	for _, pair := range pairs {
+		a, b := matchThemeMap(old, pair.mmdName), matchThemeMap(themeMap, pair.mmdName)
+		if (a == nil) != (b == nil) || (a != nil && fmt.Sprint(a.config) != fmt.Sprint(b.config)) {
+			changed = append(changed, pair)
+		}
+	}
+	return changed
+}
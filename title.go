@@ -0,0 +1,13 @@
+package main
+
+// sourceTitle returns the title declared in mmdSource, by its
+// front matter, a title statement (e.g., in a gantt chart), or a
+// pie chart's "pie title" line, or "" if it has none.
+//
+// It reads the source as text, so it works before rendering.
+func sourceTitle(mmdSource string) string {
+	if title := statementValue(mmdSource, "title"); title != "" {
+		return title
+	}
+	return statementValue(mmdSource, "pie title")
+}
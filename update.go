@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// latestMermaidURL is the npm registry's record of the latest
+	// MermaidJS release.
+	latestMermaidURL = "https://registry.npmjs.org/mermaid/latest"
+
+	// updateCheckTimeout bounds the request to latestMermaidURL.
+	updateCheckTimeout = 3 * time.Second
+
+	// updateCheckTTL is how long a check's result is cached.
+	updateCheckTTL = 24 * time.Hour
+)
+
+// updateCheck is the cached result of a check for the latest
+// MermaidJS release.
+type updateCheck struct {
+	Checked time.Time `json:"checked"`
+	Latest  string    `json:"latest"`
+}
+
+// checkMermaidUpdate prints a notice if there's a newer MermaidJS
+// release than current, the version of the loaded bundle.  The
+// latest release comes from the npm registry, at most once a day;
+// in between it's cached in the user's cache directory.
+//
+// It's only a notice: it never fails the run, and any error
+// getting the latest release is only logged.
+func checkMermaidUpdate(current string) {
+	latest, err := latestMermaidVersion()
+	if err != nil {
+		log.Printf("couldn't check for a newer MermaidJS: %v", err)
+		return
+	}
+	if compareVersions(latest, current) > 0 {
+		warnf("MermaidJS %s is out, and this is %s; run download.sh and rebuild, or load it with -mermaid-js", latest, current)
+	}
+}
+
+// latestMermaidVersion returns the version of the latest MermaidJS
+// release, from the cache if it's fresh, or else from the npm
+// registry.
+func latestMermaidVersion() (string, error) {
+	cacheName := ""
+	if dir, err := os.UserCacheDir(); err == nil {
+		cacheName = filepath.Join(dir, "mermaid-cli", "latest-mermaid.json")
+		var c updateCheck
+		if b, err := os.ReadFile(cacheName); err == nil && json.Unmarshal(b, &c) == nil &&
+			c.Latest != "" && time.Since(c.Checked) < updateCheckTTL {
+			return c.Latest, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), updateCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, latestMermaidURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", latestMermaidURL, resp.Status)
+	}
+	var release struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("%s: %w", latestMermaidURL, err)
+	}
+
+	if cacheName != "" {
+		b, _ := json.Marshal(updateCheck{Checked: time.Now(), Latest: release.Version})
+		if err := os.MkdirAll(filepath.Dir(cacheName), 0755); err == nil {
+			writeFileAtomic(cacheName, b, 0644)
+		}
+	}
+	return release.Version, nil
+}
+
+// compareVersions compares the dotted versions a and b, like
+// strings.Compare, by their numeric parts.  A pre-release suffix
+// (-rc.1) is ignored.
+func compareVersions(a, b string) int {
+	as, bs := versionParts(a), versionParts(b)
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "-")
+	var parts []int
+	for _, s := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(s)
+		parts = append(parts, n)
+	}
+	return parts
+}
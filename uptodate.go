@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// inputsStampRE matches the stamp stampInputs leaves in an SVG.
+var inputsStampRE = regexp.MustCompile(`<!-- mermaid-cli inputs:([0-9a-f]{64}) -->`)
+
+var (
+	runFingerprintOnce sync.Once
+	runFingerprintSum  []byte
+)
+
+// runFingerprint returns inputsFingerprint, worked out once per
+// run.
+func runFingerprint() []byte {
+	runFingerprintOnce.Do(func() { runFingerprintSum = inputsFingerprint() })
+	return runFingerprintSum
+}
+
+// inputsHash returns the hash of everything that decides the
+// output of pair's document with source src: src itself, the
+// runFingerprint, the settings of pair's -matrix variant, its
+// defaults files, and those of its -manifest entry.
+func inputsHash(pair renderPair, src []byte) string {
+	return inputsHashWith(runFingerprint(), pair, src)
+}
+
+// inputsHashWith is inputsHash with fingerprint in place of the
+// runFingerprint.
+func inputsHashWith(fingerprint []byte, pair renderPair, src []byte) string {
+	h := sha256.New()
+	h.Write(fingerprint)
+	if pair.variant != "" {
+		h.Write([]byte(variantSettings(pair.variant)))
+	}
+	h.Write([]byte(dirDefaultsKey(pair.mmdName)))
+	h.Write([]byte(manifestKey(pair)))
+	h.Write(src)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// stampInputs returns svgResult with a comment recording inputs,
+// its document's inputsHash, just inside its root element, for
+// upToDate to check on the next run.
+func stampInputs(svgResult, inputs string) string {
+	i := strings.Index(svgResult, "<svg")
+	if i < 0 {
+		return svgResult
+	}
+	j := strings.IndexByte(svgResult[i:], '>')
+	if j < 0 {
+		return svgResult
+	}
+	j += i + 1
+	return svgResult[:j] + fmt.Sprintf("<!-- mermaid-cli inputs:%s -->", inputs) + svgResult[j:]
+}
+
+// inputsName returns the name of the file beside a PNG or PDF
+// output that records its inputsHash, since only an SVG can carry
+// stampInputs's comment.
+func inputsName(outName string) string {
+	return outName + ".inputs"
+}
+
+// writeInputs records inputs, the inputsHash of the PNG or PDF
+// output outName, for upToDate.
+func writeInputs(outName, inputs string) error {
+	return writeFileAtomic(inputsName(outName), []byte(inputs+"\n"), 0644)
+}
+
+// upToDate reports whether pair's output, and the -metadata and
+// -html files beside it, are newer than its document, the
+// defaults files above it, and the files the flags name, as make
+// would have it.  The output also has to have the stamp of its
+// inputs as they are now (in the SVG, or a PNG's or PDF's
+// inputsName file), so changing, say, -theme makes it stale even
+// though no file changed.
+func upToDate(pair renderPair) bool {
+	if pair.svgName == stdioName {
+		return false
+	}
+	out, err := os.Stat(pair.svgName)
+	if err != nil {
+		return false
+	}
+	inputs := []string{pair.mmdName, *configFlag, *themeMapFlag, *cssFlag, *emojiFontFlag, *cjkFontFlag, mermaidJSPath()}
+	inputs = append(inputs, extraJSFlag...)
+	if _, files, err := dirDefaults(pair.mmdName); err == nil {
+		for _, f := range files {
+			inputs = append(inputs, f.name)
+		}
+	}
+	for _, name := range inputs {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil || !out.ModTime().After(info.ModTime()) {
+			return false
+		}
+	}
+	var sides []string
+	if *metadataFlag {
+		sides = append(sides, metadataName(pair.svgName))
+	}
+	if *htmlFlag {
+		sides = append(sides, htmlName(pair.svgName))
+	}
+	for _, name := range sides {
+		if _, err := os.Stat(name); err != nil {
+			return false
+		}
+	}
+
+	src, err := readSource(pair)
+	if err != nil {
+		return false
+	}
+	return outputInputs(pair.svgName) == inputsHash(pair, src)
+}
+
+// outputInputs returns the inputsHash the output outName was
+// stamped with, or "" if it has none.
+func outputInputs(outName string) string {
+	if *formatFlag != "svg" {
+		b, err := os.ReadFile(inputsName(outName))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(b))
+	}
+	b, err := os.ReadFile(outName)
+	if err != nil {
+		return ""
+	}
+	if m := inputsStampRE.FindSubmatch(b); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// skipUpToDate returns the pairs whose outputs aren't upToDate,
+// logging and recording the others as up to date.
+func skipUpToDate(pairs []renderPair) []renderPair {
+	var stale []renderPair
+	for _, pair := range pairs {
+		if !upToDate(pair) {
+			stale = append(stale, pair)
+			continue
+		}
+		log.Println("up to date", pair.svgName)
+		recordUpToDate(pair)
+	}
+	return stale
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetRunFingerprint makes runFingerprint work the fingerprint
+// out again, from the flags as they are now, and again after t.
+func resetRunFingerprint(t *testing.T) {
+	runFingerprintOnce = sync.Once{}
+	t.Cleanup(func() { runFingerprintOnce = sync.Once{} })
+}
+
+func TestInputsFingerprint(t *testing.T) {
+	chdirTemp(t, map[string]string{"page.tmpl": "<html>{{.SVG}}</html>"})
+	base := inputsFingerprint()
+	for _, tc := range []struct{ flag, value string }{
+		{"output-bom", "true"},
+		{"output-newline", "crlf"},
+		{"scale", "2"},
+		{"format", "png"},
+		{"theme", "dark"},
+		{"html-template", "page.tmpl"},
+	} {
+		t.Run(tc.flag, func(t *testing.T) {
+			setFlag(t, tc.flag, tc.value)
+			if bytes.Equal(inputsFingerprint(), base) {
+				t.Errorf("-%s=%s doesn't change the fingerprint", tc.flag, tc.value)
+			}
+		})
+	}
+
+	setFlag(t, "html-template", "page.tmpl")
+	withPage := inputsFingerprint()
+	writeTestFile(t, "page.tmpl", "<html><p>{{.SVG}}</p></html>")
+	if bytes.Equal(inputsFingerprint(), withPage) {
+		t.Error("changing the -html-template file doesn't change the fingerprint")
+	}
+}
+
+// TestPairSumsInputs checks -write-sums records the same inputs
+// hash as the stamps, -manifest settings and all.
+func TestPairSumsInputs(t *testing.T) {
+	chdirTemp(t, map[string]string{"flow.mmd": "flowchart LR\n    A --> B\n", "flow.svg": "<svg/>"})
+	resetRunFingerprint(t)
+	pair := renderPair{mmdName: "flow.mmd", svgName: "flow.svg"}
+	e, err := pairSums(pair, inputsFingerprint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := inputsHash(pair, []byte("flowchart LR\n    A --> B\n")); e.inputs != want {
+		t.Errorf("pairSums inputs = %s, want the stamp's %s", e.inputs, want)
+	}
+}
+
+// TestUpToDateImage checks a PNG's output is only up to date with
+// an inputs file that matches the flags as they are now.
+func TestUpToDateImage(t *testing.T) {
+	chdirTemp(t, map[string]string{"flow.mmd": "flowchart LR\n    A --> B\n", "flow.png": "PNG"})
+	setFlag(t, "format", "png")
+	resetRunFingerprint(t)
+	pair := renderPair{mmdName: "flow.mmd", svgName: "flow.png"}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes("flow.mmd", old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if upToDate(pair) {
+		t.Error("a PNG without an inputs file is up to date")
+	}
+	src, err := readSource(pair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeInputs(pair.svgName, inputsHash(pair, src)); err != nil {
+		t.Fatal(err)
+	}
+	if !upToDate(pair) {
+		t.Error("a PNG with its inputs file isn't up to date")
+	}
+
+	setFlag(t, "scale", "2")
+	resetRunFingerprint(t)
+	if upToDate(pair) {
+		t.Error("a PNG is up to date after -scale changed")
+	}
+}
+
+// TestUpToDateSVGEncoding checks -output-newline makes an SVG
+// stale, so it's written again in the new encoding.
+func TestUpToDateSVGEncoding(t *testing.T) {
+	const src = "flowchart LR\n    A --> B\n"
+	chdirTemp(t, map[string]string{"flow.mmd": src})
+	resetRunFingerprint(t)
+	pair := renderPair{mmdName: "flow.mmd", svgName: "flow.svg"}
+	writeTestFile(t, "flow.svg", stampInputs("<svg></svg>", inputsHash(pair, []byte(src))))
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes("flow.mmd", old, old); err != nil {
+		t.Fatal(err)
+	}
+	if !upToDate(pair) {
+		t.Fatal("a freshly stamped SVG isn't up to date")
+	}
+
+	setFlag(t, "output-newline", "crlf")
+	resetRunFingerprint(t)
+	if upToDate(pair) {
+		t.Error("an SVG is up to date after -output-newline changed")
+	}
+}
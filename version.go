@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/zacharysyoung/mermaid-cli/renderer"
+)
+
+// printVersion prints the version of mermaid-cli, of the Go it was
+// built with, and of the MermaidJS it loads, for -version.  That
+// last takes starting the browser, since the bundle may be the
+// -mermaid-js or -mermaid-cdn one rather than the embedded one;
+// if the browser can't start, it prints why in place of the
+// version and returns false.
+func printVersion() bool {
+	fmt.Printf("mermaid-cli %s\n", version)
+	fmt.Printf("built with %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	bundle, err := readMermaidJS()
+	if err != nil {
+		fmt.Printf("MermaidJS unknown: %v\n", err)
+		return false
+	}
+	r, err := renderer.NewRenderer(runCtx,
+		renderer.WithMermaidJS(bundle),
+		renderer.WithBundleName(mermaidJSOrigin()),
+		renderer.WithStartupTimeout(*startupTimeoutFlag),
+		renderer.WithConcurrency(1),
+	)
+	if err != nil {
+		fmt.Printf("MermaidJS unknown: %v\n", err)
+		return false
+	}
+	defer stopRenderer(r)
+	fmt.Printf("MermaidJS %s (%s)\n", r.Version(), bundleName())
+	return true
+}
+
+// stampVersion returns svgResult with a comment naming the
+// versions of mermaid-cli and of MermaidJS that rendered it just
+// inside its root element, as stampInputs does, so an SVG found
+// later can be traced back to them.
+func stampVersion(svgResult, mermaidVersion string) string {
+	i := strings.Index(svgResult, "<svg")
+	if i < 0 {
+		return svgResult
+	}
+	j := strings.IndexByte(svgResult[i:], '>')
+	if j < 0 {
+		return svgResult
+	}
+	j += i + 1
+	// "--" can't be in a comment.
+	comment := strings.ReplaceAll(fmt.Sprintf("mermaid-cli %s, MermaidJS %s", version, mermaidVersion), "--", "-")
+	return svgResult[:j] + "<!-- " + comment + " -->" + svgResult[j:]
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long a watched file has to go without
+// events before the watcher looks at it: editors often write a
+// file several times, or write a temporary file and rename it
+// over, for one save.
+const watchDebounce = 100 * time.Millisecond
+
+// fileWatcher tells the watcher when watched files may have
+// changed, from fsnotify events on their directories, rather than
+// polling.  Watching the directories, not the files, catches a
+// file being replaced by a rename, and a file coming back after
+// it was removed.
+type fileWatcher struct {
+	w *fsnotify.Watcher
+
+	// names maps the cleaned names of the watched files to the
+	// names they're watched by.
+	names map[string]string
+
+	// dirs are the directories being watched, and trees the ones
+	// where new files count, for found.
+	dirs, trees map[string]bool
+
+	mu         sync.Mutex
+	timers     map[string]*time.Timer
+	foundTimer *time.Timer
+
+	// changed gets the name of a watched file once its events have
+	// settled for watchDebounce.
+	changed chan string
+
+	// found gets a value once files or directories have been
+	// created in trees, and settled, for the watcher to look for
+	// new documents.
+	found chan struct{}
+}
+
+// newFileWatcher starts watching the directories of names.  It
+// returns an error if fsnotify can't, e.g., because the system is
+// out of inotify watches, for the caller to poll instead.
+func newFileWatcher(names []string) (*fileWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	fw := &fileWatcher{
+		w:       w,
+		names:   make(map[string]string),
+		dirs:    make(map[string]bool),
+		trees:   make(map[string]bool),
+		timers:  make(map[string]*time.Timer),
+		changed: make(chan string, len(names)),
+		found:   make(chan struct{}, 1),
+	}
+	for _, name := range names {
+		if err := fw.add(name); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	go fw.run()
+	return fw, nil
+}
+
+// add starts watching the file name.
+func (fw *fileWatcher) add(name string) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.names[filepath.Clean(name)] = name
+	return fw.watchDir(filepath.Dir(name))
+}
+
+// watchDirs starts watching dirs for new files.  A directory that
+// can't be watched is reported, and otherwise ignored.
+func (fw *fileWatcher) watchDirs(dirs []string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if err := fw.watchDir(dir); err != nil {
+			errorf("couldn't watch %s: %v", dir, err)
+			continue
+		}
+		fw.trees[dir] = true
+	}
+}
+
+// watchDir adds the directory dir to the fsnotify watcher, once.
+// fw.mu must be held.
+func (fw *fileWatcher) watchDir(dir string) error {
+	dir = filepath.Clean(dir)
+	if fw.dirs[dir] {
+		return nil
+	}
+	if err := fw.w.Add(dir); err != nil {
+		return err
+	}
+	fw.dirs[dir] = true
+	return nil
+}
+
+// run debounces the events for watched files, and for new files in
+// trees, and drops the rest.
+// Every kind of event counts (a create, write, rename, removal,
+// or a change of mode); the watcher then checks what the file is
+// like now.
+func (fw *fileWatcher) run() {
+	for {
+		select {
+		case ev, ok := <-fw.w.Events:
+			if !ok {
+				return
+			}
+			fw.mu.Lock()
+			name, ok := fw.names[filepath.Clean(ev.Name)]
+			if !ok {
+				if ev.Has(fsnotify.Create) && fw.trees[filepath.Dir(filepath.Clean(ev.Name))] {
+					fw.settleFound()
+				}
+				fw.mu.Unlock()
+				continue
+			}
+			if t, ok := fw.timers[name]; ok {
+				t.Reset(watchDebounce)
+			} else {
+				fw.timers[name] = time.AfterFunc(watchDebounce, func() {
+					fw.mu.Lock()
+					delete(fw.timers, name)
+					fw.mu.Unlock()
+					fw.changed <- name
+				})
+			}
+			fw.mu.Unlock()
+		case err, ok := <-fw.w.Errors:
+			if !ok {
+				return
+			}
+			errorf("watching files: %v", err)
+		}
+	}
+}
+
+// settleFound sends on found once creates in trees have settled.
+// fw.mu must be held.
+func (fw *fileWatcher) settleFound() {
+	if fw.foundTimer != nil {
+		fw.foundTimer.Reset(watchDebounce)
+		return
+	}
+	fw.foundTimer = time.AfterFunc(watchDebounce, func() {
+		fw.mu.Lock()
+		fw.foundTimer = nil
+		fw.mu.Unlock()
+		select {
+		case fw.found <- struct{}{}:
+		default: // one is already waiting
+		}
+	})
+}
+
+// settled returns the names of any other files that have settled
+// too, without waiting, so a batch of changes (say, a git
+// checkout) can be queued as one.
+func (fw *fileWatcher) settled() []string {
+	var names []string
+	for {
+		select {
+		case name := <-fw.changed:
+			names = append(names, name)
+		default:
+			return names
+		}
+	}
+}
+
+// Close stops watching.
+func (fw *fileWatcher) Close() error {
+	return fw.w.Close()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"time"
+)
+
+// watchHashMaxSize is the largest file -watch-hash reads and hashes
+// each time it changes.  A bigger one is watched by its
+// modification time and size, so as not to read it on every save.
+const watchHashMaxSize = 1 << 20
+
+// fileState is what the watcher knows of a watched file, to tell
+// when it changes.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	hashed  bool
+	sum     [sha256.Size]byte // of the normalized contents, if hashed
+
+	// missing is whether the file couldn't be found or read, e.g.,
+	// because it was removed, or is partway through being replaced.
+	missing bool
+}
+
+// statFile returns the state of the file name now.  With hash, a
+// file up to watchHashMaxSize is also read and hashed, after
+// normalizing its whitespace, so only a change to its contents
+// counts, and not a save that only touched the file or changed
+// line endings or trailing whitespace.
+//
+// A file that can't be found or read is missing.
+func statFile(name string, hash bool) fileState {
+	info, err := os.Stat(name)
+	if err != nil {
+		return fileState{missing: true}
+	}
+	st := fileState{modTime: info.ModTime(), size: info.Size()}
+	if !hash || st.size > watchHashMaxSize {
+		return st
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return fileState{missing: true}
+	}
+	st.hashed, st.sum = true, sha256.Sum256(normalizeSpace(b))
+	return st
+}
+
+// changed reports whether the file went from old to st: its
+// contents differ, if both were hashed, or else it has a newer
+// modification time or a different size.  A file that's gone
+// missing hasn't changed, since there's nothing to render, but one
+// that's come back has.
+func (old fileState) changed(st fileState) bool {
+	switch {
+	case st.missing:
+		return false
+	case old.missing:
+		return true
+	case old.hashed && st.hashed:
+		return old.sum != st.sum
+	}
+	return st.modTime.After(old.modTime) || st.size != old.size
+}
+
+// normalizeSpace returns src with CRLFs, the spaces and tabs that
+// end lines, and the blank lines that end it taken out: changes
+// to those don't change how a document renders.  Leading
+// whitespace, which can (e.g., in a mindmap), is left alone.
+func normalizeSpace(src []byte) []byte {
+	lines := bytes.Split(src, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimRight(line, " \t\r")
+	}
+	return bytes.TrimRight(bytes.Join(lines, []byte("\n")), "\n")
+}
+
+// coarseModTimes reports whether the documents of pairs all have
+// modification times in whole seconds, as on some network
+// filesystems and Docker bind mounts.  There, a save within the
+// same second as the last one doesn't change the time, and the
+// watcher has to compare contents instead.
+func coarseModTimes(pairs []renderPair) bool {
+	if len(pairs) == 0 {
+		return false
+	}
+	for _, pair := range pairs {
+		info, err := os.Stat(pair.mmdName)
+		if err != nil || info.ModTime().Nanosecond() != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package main
+
+import "time"
+
+// watchJob is a watched document waiting to be rendered again.
+type watchJob struct {
+	pair    renderPair
+	modTime time.Time
+
+	// bulk is whether the document changed along with others in
+	// one poll, as in a branch switch, rather than on its own, as
+	// when it's being edited.
+	bulk bool
+}
+
+// renderQueue is the watcher's queue of documents to render
+// again, so a document that's being edited doesn't wait behind a
+// backlog of others.
+type renderQueue struct {
+	jobs []watchJob
+}
+
+// push queues j, dropping any job already queued for the same
+// document: it's stale.
+func (q *renderQueue) push(j watchJob) {
+	for i, old := range q.jobs {
+		if old.pair == j.pair {
+			q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+			break
+		}
+	}
+	q.jobs = append(q.jobs, j)
+}
+
+// pop removes and returns the job to render next: documents that
+// changed on their own before ones that changed in bulk, and the
+// most recently modified first.
+func (q *renderQueue) pop() watchJob {
+	best := 0
+	for i, j := range q.jobs {
+		b := q.jobs[best]
+		if j.bulk != b.bulk {
+			if !j.bulk {
+				best = i
+			}
+			continue
+		}
+		if j.modTime.After(b.modTime) {
+			best = i
+		}
+	}
+	j := q.jobs[best]
+	q.jobs = append(q.jobs[:best], q.jobs[best+1:]...)
+	return j
+}
+
+func (q *renderQueue) len() int {
+	return len(q.jobs)
+}
+
+// clear drops every queued job.
+func (q *renderQueue) clear() {
+	q.jobs = nil
+}
+
+// renderWorker renders the watcher's documents one at a time, off
+// the watcher's loop, so the loop goes on taking in changes, and
+// queueing them, while a slow document renders.  There's one
+// render in flight at most, so two renders of a document never
+// overlap in the browser, and a document changed again while it
+// renders is queued, to be rendered once more after.
+//
+// The worker gets each pair by value, and the loop changes nothing
+// a render reads while one is in flight: the renderer restarts,
+// and the theme map and CSS reload, only between renders, and the
+// Markdown files it finds are noted under markdownNames's lock.
+type renderWorker struct {
+	jobs chan renderPair
+	done chan renderOutcome
+	busy bool // a render is in flight
+}
+
+// renderOutcome is how a renderWorker's render went.
+type renderOutcome struct {
+	pair  renderPair
+	start time.Time
+	took  time.Duration
+	err   error
+}
+
+// startRenderWorker starts a renderWorker that renders each pair
+// with render: render, or a fake of it.
+func startRenderWorker(render func(renderPair) error) *renderWorker {
+	w := &renderWorker{jobs: make(chan renderPair, 1), done: make(chan renderOutcome, 1)}
+	go func() {
+		for pair := range w.jobs {
+			start := time.Now()
+			err := render(pair)
+			w.done <- renderOutcome{pair: pair, start: start, took: time.Since(start), err: err}
+		}
+	}()
+	return w
+}
+
+// start hands pair to the worker to render.  The worker mustn't be
+// busy.
+func (w *renderWorker) start(pair renderPair) {
+	w.busy = true
+	w.jobs <- pair
+}
+
+// finished takes the outcome of the render in flight, once it's
+// received from w.done.
+func (w *renderWorker) finished() {
+	w.busy = false
+}
+
+// wait waits for the render in flight, if any, and returns its
+// outcome, and whether there was one.
+func (w *renderWorker) wait() (renderOutcome, bool) {
+	if !w.busy {
+		return renderOutcome{}, false
+	}
+	o := <-w.done
+	w.finished()
+	return o, true
+}
+
+// stop stops the worker, which mustn't be busy.
+func (w *renderWorker) stop() {
+	close(w.jobs)
+}
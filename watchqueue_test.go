@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRender is a render func for a renderWorker that records the
+// pairs it renders, in order, and blocks each render until it's
+// released.
+type fakeRender struct {
+	mu       sync.Mutex
+	rendered []renderPair
+	started  chan renderPair
+	release  chan error
+}
+
+func newFakeRender() *fakeRender {
+	return &fakeRender{started: make(chan renderPair), release: make(chan error)}
+}
+
+func (f *fakeRender) render(pair renderPair) error {
+	f.started <- pair
+	err := <-f.release
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rendered = append(f.rendered, pair)
+	return err
+}
+
+func (f *fakeRender) renders() []renderPair {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.rendered)
+}
+
+// TestRenderWorker drives a renderWorker as the watcher's loop
+// does: a document changed while it renders is queued, and
+// rendered once more after, and never twice at once.
+func TestRenderWorker(t *testing.T) {
+	a := renderPair{mmdName: "a.mmd", svgName: "a.svg"}
+	b := renderPair{mmdName: "b.mmd", svgName: "b.svg"}
+	f := newFakeRender()
+	w := startRenderWorker(f.render)
+	defer w.stop()
+
+	if _, ok := w.wait(); ok {
+		t.Fatal("wait on an idle worker returned an outcome")
+	}
+
+	var q renderQueue
+	w.start(a)
+	if got := <-f.started; got != a {
+		t.Fatalf("worker started %v, want a", got)
+	}
+	if !w.busy {
+		t.Error("worker isn't busy during a render")
+	}
+	// a and b change, and a again, while a renders.
+	q.push(watchJob{pair: a, modTime: time.Unix(1, 0), bulk: true})
+	q.push(watchJob{pair: b, modTime: time.Unix(2, 0), bulk: true})
+	q.push(watchJob{pair: a, modTime: time.Unix(3, 0)})
+
+	f.release <- nil
+	o := <-w.done
+	w.finished()
+	if o.pair != a || o.err != nil {
+		t.Errorf("outcome %+v, want a's, without error", o)
+	}
+
+	errFake := fmt.Errorf("fake failure")
+	for q.len() > 0 {
+		j := q.pop()
+		w.start(j.pair)
+		<-f.started
+		f.release <- errFake
+		o, ok := w.wait()
+		if !ok || o.pair != j.pair || o.err != errFake {
+			t.Errorf("wait = %+v, %v, want %v's outcome with its error", o, ok, j.pair)
+		}
+	}
+	if w.busy {
+		t.Error("worker is busy after its last render")
+	}
+
+	want := []renderPair{a, a, b}
+	if got := f.renders(); !slices.Equal(got, want) {
+		t.Errorf("rendered %v, want %v", got, want)
+	}
+}
+
+// TestMarkdownInputs notes Markdown files while another goroutine
+// reads them, as the watcher's loop and worker do, for -race.
+func TestMarkdownInputs(t *testing.T) {
+	defer func(names []string) { markdownNames.names = names }(markdownNames.names)
+	markdownNames.names = nil
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			markdownInputs()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		noteMarkdown(fmt.Sprintf("doc%d.md", i))
+	}
+	wg.Wait()
+
+	got := markdownInputs()
+	if len(got) != 100 || got[99] != "doc99.md" {
+		t.Fatalf("markdownInputs = %d names, want doc0.md to doc99.md", len(got))
+	}
+	got[0] = "changed.md"
+	if markdownInputs()[0] != "doc0.md" {
+		t.Error("changing markdownInputs's slice changed markdownNames")
+	}
+}